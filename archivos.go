@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"ubl-go-conversor/repository"
+	"ubl-go-conversor/storage"
+)
+
+// almacen es el almacenamiento de los archivos generados (STORAGE_TYPE)
+var almacen storage.Storage
+
+// inicializarAlmacenamiento crea el almacenamiento configurado. El directorio out/ se
+// sigue usando como área de trabajo para firmar y enviar; el almacenamiento guarda la
+// copia definitiva de cada archivo y es de donde se sirven.
+func inicializarAlmacenamiento() {
+	cfg := appConfig.Storage
+	switch cfg.Tipo {
+	case "s3":
+		if cfg.S3Bucket == "" || cfg.S3AccessKey == "" || cfg.S3SecretKey == "" {
+			log.Fatal("STORAGE_TYPE=s3 requiere S3_BUCKET, S3_ACCESS_KEY y S3_SECRET_KEY")
+		}
+		almacen = storage.NewS3(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3Prefix)
+		log.Printf("Almacenamiento de archivos: S3 %s/%s", cfg.S3Endpoint, cfg.S3Bucket)
+	case "local", "":
+		almacen = storage.NewLocal(cfg.LocalDir)
+	default:
+		log.Fatalf("STORAGE_TYPE=%s no soportado (use local o s3)", cfg.Tipo)
+	}
+}
+
+// persistirArchivos guarda en el almacenamiento los archivos ya generados en el área de
+// trabajo (rutas vacías se ignoran). Un error no interrumpe la emisión: el archivo
+// sigue disponible localmente y se registra en auditoría.
+func persistirArchivos(documentID, userIP string, rutas ...string) {
+	if local, ok := almacen.(*storage.Local); ok && local.EnDirectorioTrabajo() {
+		return
+	}
+	for _, ruta := range rutas {
+		if ruta == "" {
+			continue
+		}
+		data, err := os.ReadFile(ruta)
+		if err == nil {
+			err = almacen.Save(ruta, data)
+		}
+		if err != nil {
+			log.Printf("Error guardando %s en el almacenamiento: %v", ruta, err)
+			auditRepo.CreateLog(documentID, repository.ActionError, "Error guardando "+ruta+" en el almacenamiento: "+err.Error(), userIP)
+		}
+	}
+}
+
+// leerArchivo lee un archivo del almacenamiento. Si no está (ej: generado antes de
+// configurar S3) se intenta con la copia del área de trabajo local.
+func leerArchivo(ruta string) ([]byte, error) {
+	data, err := almacen.Read(ruta)
+	if errors.Is(err, storage.ErrNoEncontrado) {
+		if local, errLocal := os.ReadFile(ruta); errLocal == nil {
+			return local, nil
+		}
+	}
+	return data, err
+}
+
+// Archivos del documento que también se guardan en BD
+const (
+	contenidoXML = "xml"
+	contenidoCDR = "cdr"
+	contenidoZIP = "zip"
+)
+
+// guardarContenidosBD copia en BD el XML, CDR y ZIP ya generados (rutas vacías se
+// ignoran), para poder servirlos desde cualquier instancia. Como persistirArchivos,
+// un error no interrumpe la emisión y se registra en auditoría.
+func guardarContenidosBD(documentID, userIP, xmlPath, cdrPath, zipPath string) {
+	var contenidos [3][]byte
+	for i, ruta := range []string{xmlPath, cdrPath, zipPath} {
+		if ruta == "" {
+			continue
+		}
+		data, err := os.ReadFile(ruta)
+		if err != nil {
+			log.Printf("Error leyendo %s para guardarlo en BD: %v", ruta, err)
+			continue
+		}
+		contenidos[i] = data
+	}
+	if err := docRepo.UpdateContents(documentID, contenidos[0], contenidos[1], contenidos[2]); err != nil {
+		log.Printf("Error guardando los archivos del documento %s en BD: %v", documentID, err)
+		auditRepo.CreateLog(documentID, repository.ActionError, "Error guardando los archivos en BD: "+err.Error(), userIP)
+	}
+}
+
+// leerContenidoDocumento lee el XML, CDR o ZIP del documento desde el almacenamiento y,
+// si el archivo no existe (generado en otra instancia o en un contenedor ya eliminado),
+// desde la copia guardada en BD
+func leerContenidoDocumento(documentID, ruta, tipo string) ([]byte, error) {
+	errArchivo := fmt.Errorf("el documento %s no tiene %s", documentID, tipo)
+	if ruta != "" {
+		data, err := leerArchivo(ruta)
+		if err == nil {
+			return data, nil
+		}
+		errArchivo = err
+	}
+
+	doc, err := docRepo.GetContents(documentID)
+	if err != nil {
+		return nil, errArchivo
+	}
+	var contenido []byte
+	switch tipo {
+	case contenidoXML:
+		contenido = doc.XMLContent
+	case contenidoCDR:
+		contenido = doc.CDRContent
+	case contenidoZIP:
+		contenido = doc.ZIPContent
+	}
+	if len(contenido) == 0 {
+		return nil, errArchivo
+	}
+	return contenido, nil
+}
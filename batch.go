@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"ubl-go-conversor/models"
+)
+
+/*
+manejarBatch procesa múltiples comprobantes recibidos como array JSON.
+
+Cada documento pasa por el mismo flujo que el endpoint individual, usando un
+pool de workers limitado (BATCH_WORKERS). La concurrencia y el ritmo hacia
+SUNAT se controlan globalmente en utils, por lo que el batch no puede
+exceder los límites configurados. Un fallo en un documento no aborta los demás.
+
+Soporta ?contingencia=true para firmar todos los documentos sin enviarlos,
+?enviarEn= para programar el envío de todos (ej: al cierre del día)
+y ?autoTipo=true para determinar factura o boleta según el cliente.
+*/
+func manejarBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var documentos []models.ComprobanteBase
+	if err := json.NewDecoder(r.Body).Decode(&documentos); err != nil {
+		responderErrorJSON(w, err, "Error al leer JSON (se espera un array de comprobantes): ")
+		return
+	}
+	if len(documentos) == 0 {
+		http.Error(w, "El batch debe contener al menos un comprobante", http.StatusBadRequest)
+		return
+	}
+	if len(documentos) > appConfig.Batch.MaxDocuments {
+		http.Error(w, fmt.Sprintf("El batch excede el máximo de %d comprobantes", appConfig.Batch.MaxDocuments), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	opciones := opcionesProceso{
+		Contingencia: r.URL.Query().Get("contingencia") == "true",
+		AutoTipo:     r.URL.Query().Get("autoTipo") == "true",
+		Destino:      r.URL.Query().Get("destino"),
+		APIKey:       clienteAutenticado(r),
+		IncluirPDF:   r.URL.Query().Get("incluirPDF") == "base64",
+	}
+	enviarEn, ok := enviarEnDesdeRequest(w, r)
+	if !ok {
+		return
+	}
+	opciones.EnviarEn = enviarEn
+
+	resultados := make([]models.BatchResultado, len(documentos))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+
+	workers := appConfig.Batch.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for indice := range indices {
+				resultados[indice] = procesarItemBatch(indice, documentos[indice], opciones, r.RemoteAddr)
+			}
+		}()
+	}
+
+	for i := range documentos {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	response := models.BatchResponse{
+		Resumen:    models.BatchResumen{Total: len(resultados)},
+		Resultados: resultados,
+	}
+	for _, resultado := range resultados {
+		if resultado.Exitoso {
+			response.Resumen.Exitosos++
+		} else {
+			response.Resumen.Fallidos++
+		}
+	}
+
+	escribirRespuesta(w, r, http.StatusOK, response)
+}
+
+// procesarItemBatch procesa un documento del batch aislando errores y panics
+// para que no afecten al resto de documentos
+func procesarItemBatch(indice int, documento models.ComprobanteBase, opciones opcionesProceso, userIP string) (resultado models.BatchResultado) {
+	resultado = models.BatchResultado{
+		Indice:    indice,
+		Documento: documento.Serie + "-" + documento.Numero,
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			resultado.Status = http.StatusInternalServerError
+			resultado.Exitoso = false
+			resultado.Respuesta = nil
+			resultado.Error = &models.ErrorResponse{
+				Estado:      "error",
+				Code:        "500",
+				Description: "Error interno procesando el comprobante",
+				Details:     fmt.Sprintf("%v", rec),
+			}
+		}
+	}()
+
+	status, response, errProc := procesarComprobante(documento, opciones, userIP)
+	if errProc != nil {
+		resultado.Status = errProc.Status
+		resultado.Error = errProc.Detalle
+		if resultado.Error == nil {
+			resultado.Error = &models.ErrorResponse{
+				Estado:      "error",
+				Code:        strconv.Itoa(errProc.Status),
+				Description: errProc.Mensaje,
+			}
+		}
+		return resultado
+	}
+
+	resultado.Status = status
+	resultado.Respuesta = &response
+	switch response.Estado {
+	case "aprobada", "pendiente_envio", models.StatusTicketPending:
+		resultado.Exitoso = true
+	case "observada":
+		resultado.Exitoso = !appConfig.ObservadosRequierenAccion()
+	}
+	return resultado
+}
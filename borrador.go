@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"ubl-go-conversor/models"
+	"ubl-go-conversor/repository"
+)
+
+/*
+manejarBorrador implementa POST /api/v1/invoices/draft: valida el comprobante igual que
+la emisión y lo guarda en estado draft, sin generar XML ni enviarlo a SUNAT, para que
+pase por una revisión interna antes de emitirlo con POST /api/v1/documents/{id}/emitir.
+
+El borrador guarda el comprobante ya preparado (número normalizado, tipo asignado,
+leyendas y redondeo), de modo que al emitirlo conserva el mismo document_id. Volver a
+enviar un borrador con el mismo número lo reemplaza; un número ya emitido responde 409.
+Los borradores no consumen correlativo.
+*/
+func manejarBorrador(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var documento models.ComprobanteBase
+	if err := json.NewDecoder(r.Body).Decode(&documento); err != nil {
+		responderErrorJSON(w, err, "Error al leer JSON: ")
+		return
+	}
+
+	opciones := opcionesProceso{
+		AutoTipo: r.URL.Query().Get("autoTipo") == "true",
+		Destino:  r.URL.Query().Get("destino"),
+		APIKey:   clienteAutenticado(r),
+	}
+	advertencias, errProc := prepararComprobante(&documento, opciones)
+	if errProc != nil {
+		escribirErrorProceso(w, r, errProc)
+		return
+	}
+
+	// El destino se valida ahora y se guarda para usarlo al emitir
+	nombreDestino, _, err := appConfig.Destino(documento.Emisor.RUC, opciones.Destino)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	documentID := models.GenerateDocumentID(documento.Emisor.RUC, documento.TipoDocumento, documento.Serie, documento.Numero)
+	if previo, err := docRepo.GetByID(documentID); err == nil {
+		if previo.Estado != models.StatusDraft {
+			http.Error(w, "El comprobante "+documentID+" ya fue registrado (estado: "+previo.Estado+")", http.StatusConflict)
+			return
+		}
+		if _, err := docRepo.EliminarBorrador(documentID); err != nil {
+			http.Error(w, "Error al reemplazar el borrador: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	payload, err := json.Marshal(documento)
+	if err != nil {
+		http.Error(w, "Error al serializar el comprobante: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	borrador := &models.Document{
+		ID:                documentID,
+		RUC:               documento.Emisor.RUC,
+		TipoDoc:           documento.TipoDocumento,
+		Serie:             documento.Serie,
+		Numero:            documento.Numero,
+		Cliente:           documento.Cliente.RazonSocial,
+		ClienteDoc:        documento.Cliente.NumeroDoc,
+		Total:             documento.TotalImportePagar,
+		Moneda:            documento.Moneda,
+		FechaEmision:      documento.FechaEmision,
+		Estado:            models.StatusDraft,
+		Destino:           nombreDestino,
+		ReferenciaExterna: documento.ReferenciaExterna,
+		Payload:           string(payload),
+		APIKey:            opciones.APIKey,
+	}
+	borrador.AplicarDesglose(documento)
+	if err := docRepo.Create(borrador); err != nil {
+		http.Error(w, "Error al guardar el borrador: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	auditRepo.CreateLog(documentID, repository.ActionDraftCreated, "Borrador guardado, pendiente de emisión", r.RemoteAddr)
+
+	escribirRespuesta(w, r, http.StatusCreated, models.BorradorResponse{
+		DocumentID:   documentID,
+		Estado:       models.StatusDraft,
+		Description:  fmt.Sprintf("Borrador del comprobante %s-%s guardado; no se envió a SUNAT", documento.Serie, documento.Numero),
+		EmitirURL:    fmt.Sprintf("/api/v1/documents/%s/emitir", documentID),
+		Advertencias: advertencias,
+	})
+}
+
+/*
+emitirBorrador procesa un borrador con el flujo completo de emisión (XML, firma, envío
+a SUNAT y PDF) y responde igual que POST /api/v1/invoices. Se vuelve a validar, ya que
+la configuración o la fecha pueden haber cambiado desde que se guardó.
+
+POST /api/v1/documents/{id}/emitir[?contingencia=true&incluirPDF=base64]
+*/
+func emitirBorrador(w http.ResponseWriter, r *http.Request, documentID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	doc, err := docRepo.GetByID(documentID)
+	if err != nil {
+		http.Error(w, "Documento no encontrado", http.StatusNotFound)
+		return
+	}
+	if doc.Estado != models.StatusDraft {
+		http.Error(w, "El documento "+documentID+" no es un borrador (estado: "+doc.Estado+")", http.StatusConflict)
+		return
+	}
+
+	var documento models.ComprobanteBase
+	if err := json.Unmarshal([]byte(doc.Payload), &documento); err != nil {
+		http.Error(w, "Error al leer el borrador: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	opciones := opcionesProceso{
+		Contingencia: r.URL.Query().Get("contingencia") == "true",
+		Destino:      doc.Destino,
+		APIKey:       clienteAutenticado(r),
+		IncluirPDF:   r.URL.Query().Get("incluirPDF") == "base64",
+		Borrador:     true,
+	}
+	status, response, errProc := procesarComprobante(documento, opciones, r.RemoteAddr)
+	if errProc != nil {
+		escribirErrorProceso(w, r, errProc)
+		return
+	}
+	escribirRespuesta(w, r, status, response)
+}
@@ -0,0 +1,326 @@
+/*
+Catálogos SUNAT y estándares internacionales
+===========================================
+
+Este paquete centraliza los códigos válidos de los catálogos usados en la
+generación y validación de comprobantes electrónicos, para que validator y
+converters compartan una única fuente de verdad.
+*/
+package catalogos
+
+import (
+	"math"
+	"strings"
+)
+
+// CodigoPaisPorDefecto se usa cuando el comprobante no informa código de país
+const CodigoPaisPorDefecto = "PE"
+
+// PaisesISO3166 contiene los códigos de país ISO 3166-1 alfa-2 vigentes
+var PaisesISO3166 = map[string]bool{
+	"AD": true, "AE": true, "AF": true, "AG": true, "AI": true, "AL": true, "AM": true, "AO": true, "AQ": true, "AR": true,
+	"AS": true, "AT": true, "AU": true, "AW": true, "AX": true, "AZ": true, "BA": true, "BB": true, "BD": true, "BE": true,
+	"BF": true, "BG": true, "BH": true, "BI": true, "BJ": true, "BL": true, "BM": true, "BN": true, "BO": true, "BQ": true,
+	"BR": true, "BS": true, "BT": true, "BV": true, "BW": true, "BY": true, "BZ": true, "CA": true, "CC": true, "CD": true,
+	"CF": true, "CG": true, "CH": true, "CI": true, "CK": true, "CL": true, "CM": true, "CN": true, "CO": true, "CR": true,
+	"CU": true, "CV": true, "CW": true, "CX": true, "CY": true, "CZ": true, "DE": true, "DJ": true, "DK": true, "DM": true,
+	"DO": true, "DZ": true, "EC": true, "EE": true, "EG": true, "EH": true, "ER": true, "ES": true, "ET": true, "FI": true,
+	"FJ": true, "FK": true, "FM": true, "FO": true, "FR": true, "GA": true, "GB": true, "GD": true, "GE": true, "GF": true,
+	"GG": true, "GH": true, "GI": true, "GL": true, "GM": true, "GN": true, "GP": true, "GQ": true, "GR": true, "GS": true,
+	"GT": true, "GU": true, "GW": true, "GY": true, "HK": true, "HM": true, "HN": true, "HR": true, "HT": true, "HU": true,
+	"ID": true, "IE": true, "IL": true, "IM": true, "IN": true, "IO": true, "IQ": true, "IR": true, "IS": true, "IT": true,
+	"JE": true, "JM": true, "JO": true, "JP": true, "KE": true, "KG": true, "KH": true, "KI": true, "KM": true, "KN": true,
+	"KP": true, "KR": true, "KW": true, "KY": true, "KZ": true, "LA": true, "LB": true, "LC": true, "LI": true, "LK": true,
+	"LR": true, "LS": true, "LT": true, "LU": true, "LV": true, "LY": true, "MA": true, "MC": true, "MD": true, "ME": true,
+	"MF": true, "MG": true, "MH": true, "MK": true, "ML": true, "MM": true, "MN": true, "MO": true, "MP": true, "MQ": true,
+	"MR": true, "MS": true, "MT": true, "MU": true, "MV": true, "MW": true, "MX": true, "MY": true, "MZ": true, "NA": true,
+	"NC": true, "NE": true, "NF": true, "NG": true, "NI": true, "NL": true, "NO": true, "NP": true, "NR": true, "NU": true,
+	"NZ": true, "OM": true, "PA": true, "PE": true, "PF": true, "PG": true, "PH": true, "PK": true, "PL": true, "PM": true,
+	"PN": true, "PR": true, "PS": true, "PT": true, "PW": true, "PY": true, "QA": true, "RE": true, "RO": true, "RS": true,
+	"RU": true, "RW": true, "SA": true, "SB": true, "SC": true, "SD": true, "SE": true, "SG": true, "SH": true, "SI": true,
+	"SJ": true, "SK": true, "SL": true, "SM": true, "SN": true, "SO": true, "SR": true, "SS": true, "ST": true, "SV": true,
+	"SX": true, "SY": true, "SZ": true, "TC": true, "TD": true, "TF": true, "TG": true, "TH": true, "TJ": true, "TK": true,
+	"TL": true, "TM": true, "TN": true, "TO": true, "TR": true, "TT": true, "TV": true, "TW": true, "TZ": true, "UA": true,
+	"UG": true, "UM": true, "US": true, "UY": true, "UZ": true, "VA": true, "VC": true, "VE": true, "VG": true, "VI": true,
+	"VN": true, "VU": true, "WF": true, "WS": true, "YE": true, "YT": true, "ZA": true, "ZM": true, "ZW": true,
+}
+
+// CargosCatalogo53 contiene los códigos de cargo del catálogo 53 soportados a nivel
+// de documento. Solo se admiten cargos que no afectan la base imponible del IGV.
+var CargosCatalogo53 = map[string]string{
+	"45": "FISE",
+	"46": "Recargo al consumo y/o propinas",
+	"48": "Cargos que no afectan la base imponible del IGV/IVAP",
+}
+
+// DescuentosCatalogo53 contiene los códigos de descuento global del catálogo 53 soportados
+var DescuentosCatalogo53 = map[string]string{
+	"02": "Descuentos globales que afectan la base imponible del IGV/IVAP",
+	"03": "Descuentos globales que no afectan la base imponible del IGV/IVAP",
+}
+
+// DescuentosLineaCatalogo53 contiene los códigos de descuento del catálogo 53 admitidos
+// a nivel de ítem (cac:AllowanceCharge de la línea)
+var DescuentosLineaCatalogo53 = map[string]string{
+	"00": "Descuentos que afectan la base imponible del IGV/IVAP",
+	"01": "Descuentos que no afectan la base imponible del IGV/IVAP",
+}
+
+// CodigoRetencionIGV código del catálogo 53 para la retención del IGV
+const CodigoRetencionIGV = "62"
+
+// TasaRetencionIGV tasa general de retención del IGV (3%), usada si no se informa otra
+const TasaRetencionIGV = 0.03
+
+// DescuentoAfectaBase indica si el descuento reduce la base imponible (y por ende el IGV):
+// 02 a nivel de documento y 00 a nivel de ítem
+func DescuentoAfectaBase(codigo string) bool {
+	return codigo == "02" || codigo == "00"
+}
+
+// LeyendaMontoEnLetras código de la leyenda obligatoria con el importe total en letras
+const LeyendaMontoEnLetras = "1000"
+
+// Leyendas obligatorias según el contenido del comprobante
+const (
+	LeyendaGratuita   = "1002" // Hay ítems de transferencia gratuita (afectación 21)
+	LeyendaPercepcion = "2000" // Factura con percepción
+	LeyendaDetraccion = "2006" // Operación sujeta a detracción (tipo de operación 10xx)
+)
+
+// LeyendasCatalogo52 contiene los códigos de leyenda del catálogo 52
+var LeyendasCatalogo52 = map[string]string{
+	"1000": "Monto expresado en letras",
+	"1002": "Transferencia gratuita de un bien y/o servicio prestado gratuitamente",
+	"2000": "Comprobante de percepción",
+	"2001": "Bienes transferidos en la Amazonía región selva para ser consumidos en la misma",
+	"2002": "Servicios prestados en la Amazonía región selva para ser consumidos en la misma",
+	"2003": "Contratos de construcción ejecutados en la Amazonía región selva",
+	"2004": "Agencia de viaje - paquete turístico",
+	"2005": "Venta realizada por emisor itinerante",
+	"2006": "Operación sujeta a detracción",
+	"2007": "Operación sujeta al IVAP",
+	"2008": "Venta exonerada del IGV-ISC-IPM, prohibida la venta fuera de la zona comercial de Tacna",
+	"2009": "Primera venta de mercancía identificable entre usuarios de la zona comercial",
+	"2010": "Restitución simplificado de derechos arancelarios",
+	"2011": "Exportación de servicios - Decreto Legislativo N° 919",
+}
+
+// TiposDocumentoCatalogo01 contiene los comprobantes del catálogo 01 que emite el
+// servicio, con el nombre que SUNAT usa en la descripción del CDR
+var TiposDocumentoCatalogo01 = map[string]string{
+	"01": "Factura",
+	"03": "Boleta",
+	"07": "Nota de Credito",
+	"08": "Nota de Debito",
+}
+
+// MotivosNotaCreditoCatalogo09 contiene los tipos de nota de crédito del catálogo 09
+var MotivosNotaCreditoCatalogo09 = map[string]string{
+	"01": "Anulación de la operación",
+	"02": "Anulación por error en el RUC",
+	"03": "Corrección por error en la descripción",
+	"04": "Descuento global",
+	"05": "Descuento por ítem",
+	"06": "Devolución total",
+	"07": "Devolución por ítem",
+	"08": "Bonificación",
+	"09": "Disminución en el valor",
+	"10": "Otros conceptos",
+	"11": "Ajustes de operaciones de exportación",
+	"12": "Ajustes afectos al IVAP",
+	"13": "Corrección del monto neto pendiente de pago y/o las fechas de vencimiento",
+}
+
+// MotivosNotaDebitoCatalogo10 contiene los tipos de nota de débito del catálogo 10
+var MotivosNotaDebitoCatalogo10 = map[string]string{
+	"01": "Intereses por mora",
+	"02": "Aumento en el valor",
+	"03": "Penalidades / otros conceptos",
+	"11": "Ajustes de operaciones de exportación",
+	"12": "Ajustes afectos al IVAP",
+}
+
+// TipoOperacionPorDefecto venta interna, usada cuando el comprobante no informa tipo de operación
+const TipoOperacionPorDefecto = "0101"
+
+// TipoOperacionPercepcion venta interna sujeta a percepción (catálogo 51)
+const TipoOperacionPercepcion = "2001"
+
+// TiposOperacionCatalogo51 contiene los tipos de operación del catálogo 51 para facturas y boletas
+var TiposOperacionCatalogo51 = map[string]string{
+	"0101": "Venta interna",
+	"0112": "Venta interna - sustenta gastos deducibles persona natural",
+	"0113": "Venta interna - NRUS",
+	"0200": "Exportación de bienes",
+	"0201": "Exportación de servicios - prestación de servicios realizados íntegramente en el país",
+	"0202": "Exportación de servicios - prestación de servicios de hospedaje no domiciliado",
+	"0203": "Exportación de servicios - transporte de navieras",
+	"0204": "Exportación de servicios - servicios a naves y aeronaves de bandera extranjera",
+	"0205": "Exportación de servicios - servicios que conformen un paquete turístico",
+	"0206": "Exportación de servicios - servicios complementarios al transporte de carga",
+	"0207": "Exportación de servicios - suministro de energía eléctrica a favor de sujetos domiciliados en ZED",
+	"0208": "Exportación de servicios - prestación de servicios realizados parcialmente en el extranjero",
+	"0401": "Ventas no domiciliados que no califican como exportación",
+	"1001": "Operación sujeta a detracción",
+	"1002": "Operación sujeta a detracción - recursos hidrobiológicos",
+	"1003": "Operación sujeta a detracción - servicios de transporte de pasajeros",
+	"1004": "Operación sujeta a detracción - servicios de transporte de carga",
+	"2001": "Operación sujeta a percepción",
+}
+
+// NormalizarTipoOperacion retorna el tipo de operación o el default "0101" si viene vacío
+func NormalizarTipoOperacion(codigo string) string {
+	codigo = strings.TrimSpace(codigo)
+	if codigo == "" {
+		return TipoOperacionPorDefecto
+	}
+	return codigo
+}
+
+// EsOperacionExportacion indica si el tipo de operación corresponde a una exportación (02xx)
+func EsOperacionExportacion(codigo string) bool {
+	return strings.HasPrefix(codigo, "02")
+}
+
+// EsOperacionDetraccion indica si el tipo de operación está sujeto a detracción (10xx)
+func EsOperacionDetraccion(codigo string) bool {
+	return strings.HasPrefix(codigo, "10")
+}
+
+// TipoComprobantePorCliente determina el tipo de comprobante (catálogo 01) según el tipo de
+// documento del cliente (catálogo 06): RUC emite factura, cualquier otro caso boleta
+func TipoComprobantePorCliente(tipoDocCliente string) string {
+	if strings.TrimSpace(tipoDocCliente) == "6" {
+		return "01"
+	}
+	return "03"
+}
+
+// Tasas (%) de los tributos que gravan las afectaciones del catálogo 07
+const (
+	TasaIGV  = 18.0 // IGV, afectaciones 10 a 16
+	TasaIVAP = 4.0  // Impuesto a la Venta del Arroz Pilado, afectación 17
+)
+
+// AfectacionIVAP tipo de afectación del catálogo 07 gravado con IVAP en lugar de IGV
+const AfectacionIVAP = "17"
+
+// Códigos del catálogo 05 de los tributos que gravan las afectaciones
+const (
+	CodigoTributoIGV  = "1000"
+	CodigoTributoIVAP = "1016"
+)
+
+// TasaAfectacion retorna la tasa (%) del tributo que grava el tipo de afectación del
+// catálogo 07: 18% para las gravadas con IGV (10-16), 4% para IVAP (17) y 0 para las demás
+func TasaAfectacion(tipoAfectacion string) float64 {
+	switch tipoAfectacion {
+	case "10", "11", "12", "13", "14", "15", "16":
+		return TasaIGV
+	case AfectacionIVAP:
+		return TasaIVAP
+	}
+	return 0
+}
+
+// EsOperacionGratuita indica si el tipo de afectación del catálogo 07 corresponde a una
+// transferencia a título gratuito: retiros y bonificaciones gravados (11-16), exonerados
+// (21) e inafectos (31-37)
+func EsOperacionGratuita(tipoAfectacion string) bool {
+	switch tipoAfectacion {
+	case "11", "12", "13", "14", "15", "16", "21", "31", "32", "33", "34", "35", "36", "37":
+		return true
+	}
+	return false
+}
+
+// CodigoTributoISC código del catálogo 05 del Impuesto Selectivo al Consumo
+const CodigoTributoISC = "2000"
+
+// SistemasISCCatalogo08 contiene los sistemas de cálculo del ISC
+var SistemasISCCatalogo08 = map[string]string{
+	"01": "Sistema al valor",
+	"02": "Aplicación del monto fijo",
+	"03": "Sistema de precios de venta al público",
+}
+
+// SistemaISCAlValor sistema del catálogo 08 en que el ISC es un porcentaje del valor de venta
+const SistemaISCAlValor = "01"
+
+// CodigoTributoICBPER código del catálogo 05 del impuesto al consumo de bolsas plásticas
+const CodigoTributoICBPER = "7152"
+
+// factoresICBPER monto por bolsa plástica (S/) según el año de emisión (Ley 30884).
+// Desde 2023 se mantiene el último factor.
+var factoresICBPER = []struct {
+	Desde  string
+	Factor float64
+}{
+	{"2019-08-01", 0.10},
+	{"2020-01-01", 0.20},
+	{"2021-01-01", 0.30},
+	{"2022-01-01", 0.40},
+	{"2023-01-01", 0.50},
+}
+
+// FactorICBPER retorna el monto por bolsa vigente en la fecha de emisión (YYYY-MM-DD),
+// o 0 si la fecha es anterior a la creación del impuesto
+func FactorICBPER(fechaEmision string) float64 {
+	var factor float64
+	for _, f := range factoresICBPER {
+		if fechaEmision >= f.Desde {
+			factor = f.Factor
+		}
+	}
+	return factor
+}
+
+// PorcentajesPercepcionCatalogo22 contiene la tasa (%) de cada régimen de percepción del catálogo 22
+var PorcentajesPercepcionCatalogo22 = map[string]float64{
+	"01": 2.00, // Percepción venta interna
+	"02": 1.00, // Percepción a la adquisición de combustible
+	"03": 0.50, // Percepción realizada al agente de percepción con tasa especial
+}
+
+// MontoPercepcion calcula la percepción del régimen sobre la base (precio de venta con IGV),
+// redondeada a 2 decimales. Retorna false si el régimen no existe.
+func MontoPercepcion(regimen string, base float64) (float64, bool) {
+	porcentaje, ok := PorcentajesPercepcionCatalogo22[regimen]
+	if !ok {
+		return 0, false
+	}
+	return math.Round(base*porcentaje) / 100, true
+}
+
+// UnidadesIndivisibles contiene las unidades de medida (catálogo 03, UN/ECE rec 20) que
+// solo admiten cantidades enteras; las demás (KGM, LTR, MTR, HUR, etc.) admiten decimales
+var UnidadesIndivisibles = map[string]string{
+	"NIU": "Unidad (bienes)",
+	"C62": "Uno (unidad)",
+	"ZZ":  "Unidad (servicios)",
+	"BX":  "Caja",
+	"PK":  "Paquete",
+	"SET": "Juego",
+	"PR":  "Par",
+	"DZN": "Docena",
+	"BG":  "Bolsa",
+	"BO":  "Botella",
+	"CA":  "Lata",
+	"CEN": "Ciento de unidades",
+	"MIL": "Millar",
+}
+
+// EsCodigoPaisValido indica si el código es un ISO 3166-1 alfa-2 válido
+func EsCodigoPaisValido(codigo string) bool {
+	return PaisesISO3166[strings.ToUpper(codigo)]
+}
+
+// NormalizarCodigoPais retorna el código en mayúsculas o el default "PE" si viene vacío
+func NormalizarCodigoPais(codigo string) string {
+	codigo = strings.ToUpper(strings.TrimSpace(codigo))
+	if codigo == "" {
+		return CodigoPaisPorDefecto
+	}
+	return codigo
+}
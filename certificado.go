@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"ubl-go-conversor/signature"
+)
+
+/*
+manejarDiagnosticoCertificado responde GET /api/v1/certificate[?ruc=] con los datos del
+certificado con que se firmarían los comprobantes del RUC (o el general sin ruc):
+sujeto, emisor, fechas de vigencia y si es de prueba. Un certificado vencido no es un
+error de la consulta: se informa con vigente=false y el motivo. Requiere una API key
+administrativa.
+*/
+func manejarDiagnosticoCertificado(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ruc := r.URL.Query().Get("ruc")
+	origen := "pkcs12"
+	if firmanteHSM != nil {
+		origen = "pkcs11"
+	}
+
+	firmante, err := obtenerFirmante(ruc)
+	if err != nil {
+		http.Error(w, "Error al cargar certificado: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ruc":         ruc,
+		"origen":      origen,
+		"ambiente":    appConfig.SUNAT.Ambiente,
+		"certificado": signature.NuevoCertInfo(firmante.Certificado(), time.Now()),
+	})
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"ubl-go-conversor/models"
+)
+
+/*
+encolarComprobante implementa el modo asíncrono (?async=true) del endpoint de facturas.
+
+Prepara y valida el comprobante en la misma request con prepararComprobante (los
+errores de datos se responden de inmediato, igual que en el endpoint síncrono) y lo
+guarda en la cola de BD; responde 202 con el document_id en estado queued. Los
+workers de la cola ejecutan luego el mismo flujo que el endpoint síncrono.
+*/
+func encolarComprobante(w http.ResponseWriter, r *http.Request, documento models.ComprobanteBase, opciones opcionesProceso) {
+	// Misma preparación y validación que el endpoint síncrono: lo que allí se rechaza
+	// con 400 no debe encolarse para fallar después en el worker
+	if _, errProc := prepararComprobante(&documento, opciones); errProc != nil {
+		escribirErrorProceso(w, r, errProc)
+		return
+	}
+	if _, _, err := appConfig.Destino(documento.Emisor.RUC, opciones.Destino); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	documentID := models.GenerateDocumentID(documento.Emisor.RUC, documento.TipoDocumento, documento.Serie, documento.Numero)
+
+	// Un mismo comprobante no puede estar dos veces en la cola ni volver a emitirse
+	activo, err := colaRepo.GetActivoByDocumentID(documentID)
+	if err != nil {
+		http.Error(w, "Error al consultar la cola: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if activo != nil {
+		http.Error(w, "El comprobante "+documentID+" ya está en la cola de procesamiento", http.StatusConflict)
+		return
+	}
+	if doc, err := docRepo.GetByID(documentID); err == nil && doc.Estado != models.StatusError {
+		http.Error(w, "El comprobante "+documentID+" ya fue registrado (estado: "+doc.Estado+")", http.StatusConflict)
+		return
+	}
+
+	payload, err := json.Marshal(documento)
+	if err != nil {
+		http.Error(w, "Error al serializar el comprobante: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	item := &models.ColaDocumento{
+		DocumentID:      documentID,
+		Payload:         string(payload),
+		Contingencia:    opciones.Contingencia,
+		Destino:         opciones.Destino,
+		APIKey:          opciones.APIKey,
+		Estado:          models.ColaQueued,
+		UserIP:          r.RemoteAddr,
+		DisponibleDesde: time.Now(),
+	}
+	if err := colaRepo.Encolar(item); err != nil {
+		http.Error(w, "Error al encolar el comprobante: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	escribirRespuesta(w, r, http.StatusAccepted, models.EncoladoResponse{
+		DocumentID:  documentID,
+		Estado:      models.ColaQueued,
+		Description: "Comprobante encolado, consulte el estado para obtener el resultado de SUNAT",
+		StatusURL:   fmt.Sprintf("/api/v1/documents/%s/status", documentID),
+	})
+}
+
+/*
+iniciarWorkersCola arranca QUEUE_WORKERS goroutines que procesan la cola asíncrona.
+
+La concurrencia y el ritmo hacia SUNAT siguen controlados globalmente en utils, por
+lo que los workers comparten el rate limit con los endpoints síncronos y el batch.
+*/
+func iniciarWorkersCola() {
+	workers := appConfig.Queue.Workers
+	if workers < 1 {
+		return
+	}
+
+	// Documentos que quedaron a medio procesar por un reinicio vuelven a la cola
+	if reiniciados, err := colaRepo.ReiniciarEnProceso(); err != nil {
+		log.Println("Error reiniciando la cola:", err)
+	} else if reiniciados > 0 {
+		log.Printf("Cola: %d documentos en proceso devueltos a la cola", reiniciados)
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				if !procesarSiguienteEnCola() {
+					time.Sleep(appConfig.Queue.PollInterval)
+				}
+			}
+		}()
+	}
+	fmt.Printf("Cola asíncrona: %d workers\n", workers)
+}
+
+// procesarSiguienteEnCola procesa un comprobante de la cola. Retorna false si la cola
+// estaba vacía (o no pudo consultarse) para que el worker espere antes de reintentar.
+func procesarSiguienteEnCola() bool {
+	item, err := colaRepo.Tomar()
+	if err != nil {
+		log.Println("Error consultando la cola:", err)
+		return false
+	}
+	if item == nil {
+		return false
+	}
+
+	// Un panic en el flujo no debe detener el worker
+	defer func() {
+		if rec := recover(); rec != nil {
+			colaRepo.MarcarFallido(item.ID, fmt.Sprintf("error interno: %v", rec))
+		}
+	}()
+
+	var documento models.ComprobanteBase
+	if err := json.Unmarshal([]byte(item.Payload), &documento); err != nil {
+		colaRepo.MarcarFallido(item.ID, "payload inválido: "+err.Error())
+		return true
+	}
+
+	// Un intento anterior fallido deja el documento en processing/error; el reintento lo
+	// reprocesa en el mismo registro (ver comprobarReenvio)
+	opciones := opcionesProceso{
+		Contingencia: item.Contingencia,
+		Destino:      item.Destino,
+		APIKey:       item.APIKey,
+		Reintento:    item.Intentos > 1,
+	}
+	_, _, errProc := procesarComprobante(documento, opciones, item.UserIP)
+	switch {
+	case errProc == nil:
+		colaRepo.MarcarCompletado(item.ID)
+	case errProc.Status >= http.StatusInternalServerError && item.Intentos < appConfig.Queue.MaxAttempts:
+		// Errores del servidor o de SUNAT: reintentar más tarde con espera creciente
+		espera := appConfig.Queue.RetryDelay * time.Duration(item.Intentos)
+		colaRepo.Reencolar(item.ID, errProc.Mensaje, time.Now().Add(espera))
+		log.Printf("Cola: %s falló (intento %d), se reintenta en %s: %s", item.DocumentID, item.Intentos, espera, errProc.Mensaje)
+	default:
+		colaRepo.MarcarFallido(item.ID, errProc.Mensaje)
+	}
+	return true
+}
+
+// consultarEstadoCola responde el estado de un documento que aún no se registra en BD
+// porque está en la cola (o falló en ella). Retorna false si no está en la cola.
+func consultarEstadoCola(w http.ResponseWriter, documentID string) bool {
+	item, err := colaRepo.GetUltimoByDocumentID(documentID)
+	if err != nil {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"document_id":      item.DocumentID,
+		"estado":           item.Estado,
+		"intentos":         item.Intentos,
+		"error":            item.Error,
+		"disponible_desde": item.DisponibleDesde,
+		"created_at":       item.CreatedAt,
+	})
+	return true
+}
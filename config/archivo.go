@@ -0,0 +1,184 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Archivo de configuración opcional (CONFIG_FILE; si no se indica se usa config.yaml,
+config.yml o config.json, el primero que exista). Permite estructuras anidadas que las
+variables de entorno planas no expresan bien, como la configuración de cada emisor:
+
+	variables:            # Cualquier variable de entorno, con prioridad sobre env y .env
+	  SUNAT_AMBIENTE: produccion
+	  SERVER_PORT: 8080
+	destinos:             # Igual que SUNAT_DESTINO_<NOMBRE>_*
+	  nubefact:
+	    tipo: ose
+	    url: https://ose.nubefact.com/ol-ti-itcpe/billService
+	    usuario: 20123456789MODDATOS
+	    clave: secreto
+	emisores:
+	  - ruc: "20123456789"
+	    certificado: {ruta: certificados/empresa.pfx, clave: secreto}
+	    destino: nubefact
+	    series: {"01": F002, "03": B002}
+	    seriesAutorizadas: {"01": [F001, F002], "03": [B001, B002]}
+	    unidadMedida: ZZ    # Igual que DEFAULT_UNIT_CODE
+	    leyendas:
+	      - {codigo: "2006", descripcion: "Operación sujeta al SPOT"}
+	leyendas:             # Igual que LEYENDAS_EMISOR_FILE ("*" aplica a cualquier RUC)
+	  "*":
+	    - {codigo: "2000", descripcion: "COMPROBANTE DE PERCEPCIÓN"}
+
+Un JSON con la misma estructura también es válido. Lo que el archivo no especifica se
+toma de las variables de entorno y .env como siempre.
+*/
+
+// archivosConfigPorDefecto se buscan en el directorio de trabajo si no hay CONFIG_FILE
+var archivosConfigPorDefecto = []string{"config.yaml", "config.yml", "config.json"}
+
+type archivoConfig struct {
+	Variables map[string]string             `yaml:"variables"`
+	Destinos  map[string]destinoArchivo     `yaml:"destinos"`
+	Emisores  []emisorArchivo               `yaml:"emisores"`
+	Leyendas  map[string][]LeyendaPlantilla `yaml:"leyendas"`
+}
+
+type destinoArchivo struct {
+	Tipo    string `yaml:"tipo"` // "sol", "ose" o "gre" (por defecto "ose")
+	URL     string `yaml:"url"`
+	Usuario string `yaml:"usuario"`
+	Clave   string `yaml:"clave"`
+	Token   string `yaml:"token"`
+}
+
+type emisorArchivo struct {
+	RUC         string             `yaml:"ruc"`
+	Certificado CertificadoEmisor  `yaml:"certificado"`
+	Destino     string             `yaml:"destino"` // Destino de envío por defecto del RUC
+	Series      map[string]string  `yaml:"series"`  // Tipo de comprobante -> serie (?autoTipo=true)
+	Leyendas    []LeyendaPlantilla `yaml:"leyendas"`
+
+	// Tipo de comprobante -> series declaradas ante SUNAT (igual que SERIES_AUTORIZADAS)
+	SeriesAutorizadas map[string][]string `yaml:"seriesAutorizadas"`
+
+	// Política de redondeo del importe a pagar (igual que ROUNDING_MODE)
+	Redondeo string `yaml:"redondeo"`
+
+	// Unidad de medida de los ítems que no la informan (igual que DEFAULT_UNIT_CODE)
+	UnidadMedida string `yaml:"unidadMedida"`
+}
+
+// leerArchivoConfig lee el archivo de configuración, o retorna nil si no hay ninguno.
+// Un archivo indicado que no existe o no se puede interpretar detiene el arranque, para
+// no emitir con una configuración distinta a la esperada (ej: beta en lugar de producción).
+func leerArchivoConfig() *archivoConfig {
+	ruta := os.Getenv("CONFIG_FILE")
+	if ruta == "" {
+		for _, nombre := range archivosConfigPorDefecto {
+			if _, err := os.Stat(nombre); err == nil {
+				ruta = nombre
+				break
+			}
+		}
+	}
+	if ruta == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(ruta)
+	if err != nil {
+		log.Fatalf("No se pudo leer el archivo de configuración %s: %v", ruta, err)
+	}
+	var archivo archivoConfig
+	if err := yaml.Unmarshal(data, &archivo); err != nil {
+		log.Fatalf("El archivo de configuración %s no es YAML/JSON válido: %v", ruta, err)
+	}
+	log.Printf("Configuración cargada desde %s", ruta)
+	return &archivo
+}
+
+// aplicarVariables exporta las variables del archivo al entorno, reemplazando las de env
+// y .env, para que el resto de Load las lea con getEnv como cualquier otra variable
+func (a *archivoConfig) aplicarVariables() {
+	if a == nil {
+		return
+	}
+	for clave, valor := range a.Variables {
+		os.Setenv(clave, valor)
+	}
+}
+
+// aplicarEstructuras agrega a la configuración ya cargada los destinos, leyendas y
+// emisores del archivo. Ante un mismo nombre o RUC, el archivo prevalece.
+func (a *archivoConfig) aplicarEstructuras(config *Config) {
+	if a == nil {
+		return
+	}
+
+	for nombre, destino := range a.Destinos {
+		nombre = strings.ToLower(strings.TrimSpace(nombre))
+		tipo := strings.ToLower(destino.Tipo)
+		if tipo == "" {
+			tipo = "ose"
+		}
+		config.Destinos.Lista[nombre] = DestinoSUNAT{
+			Tipo:     tipo,
+			URL:      destino.URL,
+			Username: destino.Usuario,
+			Password: destino.Clave,
+			Token:    destino.Token,
+		}
+	}
+
+	for ruc, leyendas := range a.Leyendas {
+		config.Leyendas.PorRUC[ruc] = filtrarLeyendas("CONFIG_FILE", ruc, leyendas)
+	}
+
+	for _, emisor := range a.Emisores {
+		ruc := strings.TrimSpace(emisor.RUC)
+		if !esRUC(ruc) {
+			log.Printf("Warning: RUC inválido en los emisores de CONFIG_FILE: %s", emisor.RUC)
+			continue
+		}
+
+		if emisor.Certificado.Path != "" {
+			config.Emisores.Certificados[ruc] = emisor.Certificado
+		}
+		if nombre := strings.ToLower(strings.TrimSpace(emisor.Destino)); nombre != "" {
+			if _, ok := config.Destinos.Lista[nombre]; ok {
+				config.Destinos.PorRUC[ruc] = nombre
+			} else {
+				log.Printf("Warning: el emisor %s usa el destino '%s', que no está configurado", ruc, nombre)
+			}
+		}
+		if len(emisor.Series) > 0 {
+			series := map[string]string{}
+			for tipoDoc, serie := range emisor.Series {
+				series[tipoDoc] = strings.ToUpper(strings.TrimSpace(serie))
+			}
+			config.AutoTipo.Series[ruc] = series
+		}
+		if len(emisor.Leyendas) > 0 {
+			config.Leyendas.PorRUC[ruc] = filtrarLeyendas("CONFIG_FILE", ruc, emisor.Leyendas)
+		}
+		if len(emisor.SeriesAutorizadas) > 0 {
+			autorizadas := map[string][]string{}
+			for tipoDoc, series := range emisor.SeriesAutorizadas {
+				autorizadas[tipoDoc] = normalizarSeries(series)
+			}
+			config.Emisores.SeriesAutorizadas[ruc] = autorizadas
+		}
+		if emisor.Redondeo != "" {
+			config.Emisores.ModoRedondeoPorRUC[ruc] = validarModoRedondeo("CONFIG_FILE ("+ruc+")", emisor.Redondeo)
+		}
+		if unidad := strings.ToUpper(strings.TrimSpace(emisor.UnidadMedida)); unidad != "" {
+			config.Emisores.UnidadMedidaPorRUC[ruc] = unidad
+		}
+	}
+}
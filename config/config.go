@@ -1,32 +1,211 @@
 package config
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ubl-go-conversor/catalogos"
+	"ubl-go-conversor/models"
 
 	"github.com/joho/godotenv"
 )
 
+// Ambientes de SUNAT, cada uno con su propio certificado
+const (
+	AmbienteBeta       = "beta"
+	AmbienteProduccion = "produccion"
+)
+
+// Fuentes de la clave privada de firma
+const (
+	FuenteClavePKCS12 = "pkcs12" // Archivo .pfx (CERT_PATH / CERT_BASE64)
+	FuenteClavePKCS11 = "pkcs11" // HSM vía PKCS#11, la clave no sale del dispositivo
+)
+
+// Tipo del certificado de firma (CERT_TYPE); "prueba" o "real" reemplazan la detección
+// por el subject cuando esta se equivoca
+const (
+	CertificadoAuto   = "auto"   // Detectar por el subject (palabras de prueba o autofirmado)
+	CertificadoPrueba = "prueba" // Certificado de prueba/demostración
+	CertificadoReal   = "real"   // Certificado emitido para producción
+)
+
+// Tratamiento de los documentos que SUNAT acepta con observaciones (SUNAT_OBSERVADOS)
+const (
+	ObservadosAceptar        = "aceptar"         // Éxito con advertencia (HTTP 200, estado observed)
+	ObservadosRequiereAccion = "requiere_accion" // Requiere corrección (HTTP 422, estado action_required)
+)
+
+// RetryPolicy define la política de reintentos para un tipo de operación SUNAT
+type RetryPolicy struct {
+	MaxAttempts int           // Número máximo de intentos (1 = sin reintentos)
+	Backoff     time.Duration // Espera inicial entre intentos (se duplica en cada reintento)
+}
+
+// DestinoSUNAT webservice al que se envían los comprobantes (SOL directo, OSE o GRE)
+type DestinoSUNAT struct {
+	Tipo     string // "sol", "ose" o "gre"
+	URL      string
+	Username string
+	Password string
+	Token    string // Token Bearer para la API REST (GRE)
+}
+
+// LeyendaPlantilla leyenda que se agrega automáticamente a los comprobantes de un emisor
+type LeyendaPlantilla struct {
+	Codigo      string `json:"codigo" yaml:"codigo"` // Código del catálogo 52
+	Descripcion string `json:"descripcion" yaml:"descripcion"`
+}
+
+// CertificadoEmisor certificado PFX propio de un emisor (CONFIG_FILE), usado en lugar
+// del certificado general al firmar sus comprobantes
+type CertificadoEmisor struct {
+	Path     string `yaml:"ruta"`
+	Password string `yaml:"clave"`
+}
+
 type Config struct {
 	SUNAT struct {
-		URL      string
-		Username string
-		Password string
+		URL        string
+		ConsultURL string // Servicio de consulta de CDR (getStatusCdr)
+		Ambiente   string // "beta" o "produccion", determina el certificado a usar
+		Username   string
+		Password   string
+		Observados string // Tratamiento de documentos observados: "aceptar" o "requiere_accion"
+	}
+	Emisores struct {
+		Autorizados  map[string]bool              // RUCs habilitados para emitir (vacío = cualquier RUC)
+		Certificados map[string]CertificadoEmisor // RUC -> certificado propio (CONFIG_FILE)
+		// RUC -> tipo de comprobante -> series declaradas ante SUNAT ("*" aplica a cualquier RUC)
+		SeriesAutorizadas map[string]map[string][]string
+		// Política de redondeo del importe a pagar: por defecto (ROUNDING_MODE) y por RUC (CONFIG_FILE)
+		ModoRedondeo       string
+		ModoRedondeoPorRUC map[string]string
+		// Unidad de medida de los ítems que no la informan: por defecto (DEFAULT_UNIT_CODE) y por RUC (CONFIG_FILE)
+		UnidadMedida       string
+		UnidadMedidaPorRUC map[string]string
+	}
+	Destinos struct {
+		Lista      map[string]DestinoSUNAT // Destinos configurados por nombre ("sol" siempre existe)
+		PorDefecto string                  // Destino usado si el request y el RUC no indican otro
+		PorRUC     map[string]string       // RUC -> nombre del destino
+	}
+	Network struct {
+		Timeout     time.Duration // Timeout de cada request HTTP a SUNAT
+		SendBill    RetryPolicy   // Envío individual (puede duplicar, reintentar con cuidado)
+		SendSummary RetryPolicy   // Envío de resúmenes y comunicaciones de baja
+		GetStatus   RetryPolicy   // Consultas de estado (idempotentes)
+
+		MaxConcurrent int           // Requests simultáneos permitidos hacia SUNAT
+		MinInterval   time.Duration // Intervalo mínimo entre requests a SUNAT
+	}
+	Batch struct {
+		Workers      int   // Documentos procesados en paralelo por request batch
+		MaxDocuments int   // Máximo de documentos por request batch
+		MaxBodyBytes int64 // Tamaño máximo del body de una request batch (BATCH_MAX_BODY_MB)
+	}
+	Queue struct {
+		Workers      int           // Workers que procesan la cola asíncrona (0 = desactivada)
+		PollInterval time.Duration // Espera entre consultas cuando la cola está vacía
+		MaxAttempts  int           // Intentos antes de marcar un documento como fallido
+		RetryDelay   time.Duration // Espera base entre reintentos (se multiplica por el intento)
+	}
+	EnvioProgramado struct {
+		Interval time.Duration // Frecuencia con que se revisan los envíos programados (0 = desactivado)
+	}
+	Verify struct {
+		RequestsPerMinute int // Consultas por minuto y por IP al endpoint público /verify (0 = sin límite)
+	}
+	AutoTipo struct {
+		Series map[string]map[string]string // RUC -> tipo de comprobante -> serie ("*" aplica a cualquier RUC)
+	}
+	Leyendas struct {
+		PorRUC map[string][]LeyendaPlantilla // RUC -> leyendas del emisor ("*" aplica a cualquier RUC)
+	}
+	Validation struct {
+		PlazoEnvio         string  // Fecha de emisión fuera de plazo: "advertir", "rechazar" o "ignorar"
+		ClienteIgualEmisor string  // Cliente con el mismo RUC del emisor: "advertir", "rechazar" o "ignorar"
+		ProporcionIGV      string  // IGV desproporcionado respecto al gravado: "advertir", "rechazar" o "ignorar"
+		MaxProporcionIGV   float64 // Proporción máxima IGV/gravado antes de advertir (ej: 0.20)
+		DecimalesCantidad  string  // Cantidad fraccionaria en unidad indivisible (NIU): "advertir", "rechazar" o "ignorar"
+	}
+	Auth struct {
+		Keys      map[string]string // API key -> identificador del cliente (vacío = sin autenticación)
+		AdminKeys map[string]string // API keys con permisos administrativos -> identificador
 	}
 	Server struct {
-		Port string
-		Host string
+		Port         string
+		Host         string
+		MaxBodyBytes int64 // Tamaño máximo del body JSON de una request (SERVER_MAX_BODY_MB)
 	}
 	Certificate struct {
 		Path     string
+		PathBeta string // Certificado para el ambiente beta (CERT_PATH_BETA)
+		PathProd string // Certificado para producción (CERT_PATH_PROD)
 		Password string
+		Base64   string // Contenido del PFX en base64 (CERT_BASE64), alternativa a Path
+		Priority string // Fuente preferida si ambas están configuradas: "path" o "base64"
+		Tipo     string // Tipo del certificado en uso: "auto" (detectar por el subject), "prueba" o "real"
+
+		ExpiryWarningDays int // Días antes del vencimiento a partir de los cuales se advierte al arrancar
+	}
+	Signature struct {
+		Canonicalization string // Algoritmo de canonicalización XMLDSig (exc-c14n, c14n11, etc.)
+		PrefixList       string // Prefijos inclusivos para C14N exclusivo (separados por espacio)
+		NamespacePrefix  string // Prefijo del namespace de la firma ("ds" por defecto, "none" = sin prefijo)
+		KeySource        string // Fuente de la clave: "pkcs12" (archivo) o "pkcs11" (HSM)
+	}
+	PKCS11 struct {
+		Module     string // Ruta de la librería PKCS#11 del HSM
+		TokenLabel string // Etiqueta del token
+		PIN        string // PIN de usuario (PKCS11_PIN o PKCS11_PIN_BASE64)
+		KeyLabel   string // Etiqueta del par de claves y del certificado en el token
+		CertPath   string // Certificado del firmante (PEM/DER) si no está en el token
+	}
+	Storage struct {
+		Tipo     string // "local" (por defecto) o "s3"
+		LocalDir string // Directorio donde se copian los archivos ("" = donde se generan)
+
+		S3Endpoint  string // URL del servicio S3 o compatible (MinIO, etc.)
+		S3Region    string
+		S3Bucket    string
+		S3AccessKey string
+		S3SecretKey string
+		S3Prefix    string // Prefijo de las claves de los objetos (ej: "cpe/")
+	}
+	Files struct {
+		NamePattern string // Plantilla de nombres de archivo (XML, PDF, ZIP, CDR), ej: "{serie}-{numero}"
+	}
+	XML struct {
+		Minify bool   // Generar XML sin indentación (menor tamaño de envío)
+		Indent string // Indentación usada cuando no se minifica
+	}
+	PDF struct {
+		Timeout time.Duration // Tiempo máximo de generación del PDF (0 = sin límite)
+	}
+	Mail struct {
+		NotificarRechazos bool // Avisar por correo al emisor (Emisor.Correo) de rechazos y observaciones
+		Host              string
+		Port              string
+		Username          string
+		Password          string
+		From              string // Remitente de las notificaciones
+		// Enlace al documento incluido en el correo; {id} se reemplaza por el document_id
+		DocumentURL string
 	}
 	Database struct {
-		Host     string
-		Port     string
-		Name     string
-		User     string
-		Password string
+		Host               string
+		Port               string
+		Name               string
+		User               string
+		Password           string
+		SlowQueryThreshold time.Duration // Umbral para registrar consultas lentas (0 = desactivado)
 	}
 	Environment string
 	LogLevel    string
@@ -38,20 +217,142 @@ func Load() *Config {
 		log.Println("Warning: .env file not found, using environment variables")
 	}
 
+	// Archivo de configuración opcional (YAML/JSON): sus variables prevalecen sobre env y .env
+	archivo := leerArchivoConfig()
+	archivo.aplicarVariables()
+
 	config := &Config{}
 
 	// Configuración SUNAT
 	config.SUNAT.URL = getEnv("SUNAT_URL", "https://e-beta.sunat.gob.pe/ol-ti-itcpfegem-beta/billService")
+	config.SUNAT.Ambiente = getEnv("SUNAT_AMBIENTE", ambientePorURL(config.SUNAT.URL))
+	config.SUNAT.ConsultURL = getEnv("SUNAT_CONSULT_URL", consultURLPorAmbiente(config.SUNAT.Ambiente))
 	config.SUNAT.Username = getEnv("SUNAT_USERNAME", "MODDATOS")
-	config.SUNAT.Password = getEnv("SUNAT_PASSWORD", "MODDATOS")
+	config.SUNAT.Password = getEnvSecret("SUNAT_PASSWORD", "MODDATOS")
+	config.SUNAT.Observados = getEnv("SUNAT_OBSERVADOS", ObservadosAceptar)
+	if config.SUNAT.Observados != ObservadosAceptar && config.SUNAT.Observados != ObservadosRequiereAccion {
+		log.Printf("Warning: SUNAT_OBSERVADOS=%s no reconocido (use %s o %s), se usa %s",
+			config.SUNAT.Observados, ObservadosAceptar, ObservadosRequiereAccion, ObservadosAceptar)
+		config.SUNAT.Observados = ObservadosAceptar
+	}
+
+	// Verificación pública de comprobantes para receptores
+	config.Verify.RequestsPerMinute = getEnvInt("VERIFY_RATE_LIMIT_PER_MINUTE", 30)
+
+	// Emisores autorizados (escenario multi-emisor), formato "20123456789,20987654321"
+	config.Emisores.Autorizados = parseEmisoresAutorizados(getEnv("EMISORES_AUTORIZADOS", ""))
+	config.Emisores.Certificados = map[string]CertificadoEmisor{}
+	// Series autorizadas por emisor, formato "RUC:01=F001|F002,03=B001;*:01=F001" (vacío = sin restricción)
+	config.Emisores.SeriesAutorizadas = parseSeriesAutorizadas(getEnv("SERIES_AUTORIZADAS", ""))
+	// Redondeo del importe a pagar ("centimo", "10-centimos", ...); vacío = se respeta el del request
+	config.Emisores.ModoRedondeo = validarModoRedondeo("ROUNDING_MODE", getEnv("ROUNDING_MODE", ""))
+	config.Emisores.ModoRedondeoPorRUC = map[string]string{}
+	// Unidad de medida (catálogo 03) usada si el ítem no la envía, ej: NIU (bienes) o ZZ (servicios)
+	config.Emisores.UnidadMedida = strings.ToUpper(strings.TrimSpace(getEnv("DEFAULT_UNIT_CODE", "NIU")))
+	config.Emisores.UnidadMedidaPorRUC = map[string]string{}
+
+	// Destinos de envío: "sol" usa la configuración SUNAT_*, los demás se declaran en SUNAT_DESTINOS
+	loadDestinos(config)
+
+	// Configuración de red y reintentos por tipo de operación SUNAT
+	config.Network.Timeout = time.Duration(getEnvInt("SUNAT_TIMEOUT_SECONDS", 60)) * time.Second
+	config.Network.SendBill = getRetryPolicy("SENDBILL", 1, 2000)
+	config.Network.SendSummary = getRetryPolicy("SENDSUMMARY", 2, 2000)
+	config.Network.GetStatus = getRetryPolicy("GETSTATUS", 5, 1000)
+	config.Network.MaxConcurrent = getEnvInt("SUNAT_MAX_CONCURRENT", 4)
+	config.Network.MinInterval = time.Duration(getEnvInt("SUNAT_MIN_INTERVAL_MS", 0)) * time.Millisecond
+
+	// Configuración del endpoint batch
+	config.Batch.Workers = getEnvInt("BATCH_WORKERS", 4)
+	config.Batch.MaxDocuments = getEnvInt("BATCH_MAX_DOCUMENTS", 100)
+	config.Batch.MaxBodyBytes = int64(getEnvInt("BATCH_MAX_BODY_MB", 50)) << 20
+
+	// Cola de procesamiento asíncrono (?async=true)
+	config.Queue.Workers = getEnvInt("QUEUE_WORKERS", 2)
+	config.Queue.PollInterval = time.Duration(getEnvInt("QUEUE_POLL_INTERVAL_MS", 2000)) * time.Millisecond
+	config.Queue.MaxAttempts = getEnvInt("QUEUE_MAX_ATTEMPTS", 5)
+	config.Queue.RetryDelay = time.Duration(getEnvInt("QUEUE_RETRY_DELAY_SECONDS", 60)) * time.Second
+	config.EnvioProgramado.Interval = time.Duration(getEnvInt("SCHEDULED_SEND_INTERVAL_SECONDS", 60)) * time.Second
+
+	// Series usadas al determinar automáticamente el tipo de comprobante (?autoTipo=true)
+	config.AutoTipo.Series = parseSeriesAutomaticas(getEnv("AUTO_SERIES", "*:01=F001,03=B001"))
+
+	// Leyendas corporativas por emisor, agregadas a cada comprobante
+	config.Leyendas.PorRUC = loadLeyendasEmisor(getEnv("LEYENDAS_EMISOR_FILE", ""))
+
+	// Configuración de validaciones
+	config.Validation.PlazoEnvio = getEnv("VALIDATION_PLAZO_ENVIO", "advertir")
+	config.Validation.ClienteIgualEmisor = getEnv("VALIDATION_CLIENTE_IGUAL_EMISOR", "advertir")
+	config.Validation.ProporcionIGV = getEnv("VALIDATION_PROPORCION_IGV", "advertir")
+	config.Validation.MaxProporcionIGV = getEnvFloat("VALIDATION_MAX_PROPORCION_IGV", 0.20)
+	config.Validation.DecimalesCantidad = getEnv("VALIDATION_DECIMALES_CANTIDAD", "advertir")
 
 	// Configuración del servidor
 	config.Server.Port = getEnv("SERVER_PORT", "8080")
 	config.Server.Host = getEnv("SERVER_HOST", "localhost")
+	config.Server.MaxBodyBytes = int64(getEnvInt("SERVER_MAX_BODY_MB", 10)) << 20
+
+	// Autenticación por API key (header X-API-Key), formato "cliente:clave,cliente2:clave2"
+	config.Auth.Keys = parseAPIKeys("API_KEYS", getEnvSecret("API_KEYS", ""))
+	config.Auth.AdminKeys = parseAPIKeys("API_ADMIN_KEYS", getEnvSecret("API_ADMIN_KEYS", ""))
 
 	// Configuración de certificados
 	config.Certificate.Path = getEnv("CERT_PATH", "certificados/certificado_prueba.pfx")
-	config.Certificate.Password = getEnv("CERT_PASSWORD", "institutoisi")
+	config.Certificate.PathBeta = getEnv("CERT_PATH_BETA", "")
+	config.Certificate.PathProd = getEnv("CERT_PATH_PROD", "")
+	config.Certificate.Password = getEnvSecret("CERT_PASSWORD", "institutoisi")
+	config.Certificate.Base64 = getEnv("CERT_BASE64", "")
+	config.Certificate.Priority = getEnv("CERT_PRIORITY", "path")
+	config.Certificate.ExpiryWarningDays = getEnvInt("CERT_EXPIRY_WARNING_DAYS", 30)
+	config.Certificate.Tipo = getEnv("CERT_TYPE", CertificadoAuto)
+	if config.Certificate.Tipo != CertificadoAuto && config.Certificate.Tipo != CertificadoPrueba && config.Certificate.Tipo != CertificadoReal {
+		log.Printf("Warning: CERT_TYPE=%s no reconocido (use %s, %s o %s), se usa %s",
+			config.Certificate.Tipo, CertificadoAuto, CertificadoPrueba, CertificadoReal, CertificadoAuto)
+		config.Certificate.Tipo = CertificadoAuto
+	}
+
+	// Configuración de firma digital
+	config.Signature.Canonicalization = getEnv("SIGN_C14N_ALGORITHM", "exc-c14n")
+	config.Signature.PrefixList = getEnv("SIGN_C14N_PREFIX_LIST", "")
+	config.Signature.NamespacePrefix = getEnv("SIGN_NAMESPACE_PREFIX", "ds")
+	config.Signature.KeySource = getEnv("SIGN_KEY_SOURCE", FuenteClavePKCS12)
+
+	// Clave en HSM (solo si SIGN_KEY_SOURCE=pkcs11)
+	config.PKCS11.Module = getEnv("PKCS11_MODULE", "")
+	config.PKCS11.TokenLabel = getEnv("PKCS11_TOKEN_LABEL", "")
+	config.PKCS11.PIN = getEnvSecret("PKCS11_PIN", "")
+	config.PKCS11.KeyLabel = getEnv("PKCS11_KEY_LABEL", "")
+	config.PKCS11.CertPath = getEnv("PKCS11_CERT_PATH", "")
+
+	// Almacenamiento de XML, ZIP, PDF y CDR: filesystem local o S3/compatible
+	config.Storage.Tipo = getEnv("STORAGE_TYPE", "local")
+	config.Storage.LocalDir = getEnv("STORAGE_LOCAL_DIR", "")
+	config.Storage.S3Endpoint = getEnv("S3_ENDPOINT", "https://s3.amazonaws.com")
+	config.Storage.S3Region = getEnv("S3_REGION", "us-east-1")
+	config.Storage.S3Bucket = getEnv("S3_BUCKET", "")
+	config.Storage.S3AccessKey = getEnv("S3_ACCESS_KEY", "")
+	config.Storage.S3SecretKey = getEnvSecret("S3_SECRET_KEY", "")
+	config.Storage.S3Prefix = getEnv("S3_PREFIX", "")
+
+	// Plantilla de nombres de los archivos generados
+	config.Files.NamePattern = getEnv("FILE_NAME_PATTERN", "{ruc}-{tipo}-{serie}-{numero}")
+
+	// Configuración de generación de XML
+	config.XML.Minify = getEnvBool("XML_MINIFY", false)
+	config.XML.Indent = getEnv("XML_INDENT", "  ")
+
+	// Generación del PDF: si supera el timeout se emite el comprobante sin PDF
+	config.PDF.Timeout = time.Duration(getEnvInt("PDF_TIMEOUT_SECONDS", 10)) * time.Second
+
+	// Notificación por correo al emisor de documentos rechazados u observados (desactivada por defecto)
+	config.Mail.NotificarRechazos = getEnvBool("MAIL_NOTIFY_REJECTED", false)
+	config.Mail.Host = getEnv("SMTP_HOST", "")
+	config.Mail.Port = getEnv("SMTP_PORT", "587")
+	config.Mail.Username = getEnv("SMTP_USERNAME", "")
+	config.Mail.Password = getEnvSecret("SMTP_PASSWORD", "")
+	config.Mail.From = getEnv("MAIL_FROM", "")
+	config.Mail.DocumentURL = getEnv("MAIL_DOCUMENT_URL",
+		"http://"+config.Server.Host+":"+config.Server.Port+"/api/v1/documents/{id}/status")
 
 	// Configuración de base de datos
 	config.Database.Host = getEnv("DB_HOST", "localhost")
@@ -59,11 +360,15 @@ func Load() *Config {
 	config.Database.Name = getEnv("DB_NAME", "facturacion_electronica")
 	config.Database.User = getEnv("DB_USER", "postgres")
 	config.Database.Password = getEnv("DB_PASSWORD", "password")
+	config.Database.SlowQueryThreshold = time.Duration(getEnvInt("DB_SLOW_QUERY_MS", 200)) * time.Millisecond
 
 	// Configuración general
 	config.Environment = getEnv("ENVIRONMENT", "development")
 	config.LogLevel = getEnv("LOG_LEVEL", "info")
 
+	// Destinos, leyendas y configuración por emisor del archivo de configuración
+	archivo.aplicarEstructuras(config)
+
 	return config
 }
 
@@ -72,4 +377,431 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+// getEnvSecret lee un secreto desde <KEY>_BASE64 (decodificado) o, si no existe, desde <KEY>
+func getEnvSecret(key, defaultValue string) string {
+	if encoded := os.Getenv(key + "_BASE64"); encoded != "" {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err == nil {
+			return string(decoded)
+		}
+		log.Printf("Warning: %s_BASE64 no es base64 válido, se ignora", key)
+	}
+	return getEnv(key, defaultValue)
+}
+
+/*
+CertificateData retorna el contenido del certificado PFX.
+
+Si están configurados CERT_PATH y CERT_BASE64, CERT_PRIORITY define cuál se usa
+("path" por defecto). Con solo una fuente configurada se usa esa.
+*/
+func (c *Config) CertificateData() ([]byte, error) {
+	if c.Certificate.Base64 != "" && (c.Certificate.Priority == "base64" || c.Certificate.Path == "") {
+		data, err := base64.StdEncoding.DecodeString(c.Certificate.Base64)
+		if err != nil {
+			return nil, fmt.Errorf("CERT_BASE64 no es base64 válido: %v", err)
+		}
+		return data, nil
+	}
+
+	data, err := os.ReadFile(c.CertificatePath())
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo PFX: %v", err)
+	}
+	return data, nil
+}
+
+// CertificadoFirma retorna el contenido y la contraseña del PFX con que firma el RUC:
+// el certificado propio del emisor si está configurado, o el certificado general
+func (c *Config) CertificadoFirma(ruc string) ([]byte, string, error) {
+	if propio, ok := c.Emisores.Certificados[ruc]; ok {
+		data, err := os.ReadFile(propio.Path)
+		if err != nil {
+			return nil, "", fmt.Errorf("error leyendo PFX del emisor %s: %v", ruc, err)
+		}
+		return data, propio.Password, nil
+	}
+
+	data, err := c.CertificateData()
+	return data, c.Certificate.Password, err
+}
+
+// ObservadosRequierenAccion indica si un documento observado por SUNAT debe tratarse
+// como un resultado que requiere corrección en lugar de una aceptación con advertencia
+func (c *Config) ObservadosRequierenAccion() bool {
+	return c.SUNAT.Observados == ObservadosRequiereAccion
+}
+
+// EnlaceDocumento retorna el enlace al documento que se incluye en las notificaciones por correo
+func (c *Config) EnlaceDocumento(documentID string) string {
+	return strings.ReplaceAll(c.Mail.DocumentURL, "{id}", documentID)
+}
+
+// CertificatePath retorna la ruta del certificado del ambiente SUNAT configurado,
+// usando CERT_PATH cuando no hay una ruta específica para el ambiente
+func (c *Config) CertificatePath() string {
+	switch {
+	case c.SUNAT.Ambiente == AmbienteProduccion && c.Certificate.PathProd != "":
+		return c.Certificate.PathProd
+	case c.SUNAT.Ambiente == AmbienteBeta && c.Certificate.PathBeta != "":
+		return c.Certificate.PathBeta
+	}
+	return c.Certificate.Path
+}
+
+// CertificatePaths retorna los certificados PFX configurados por variable de entorno
+// (CERT_PATH, CERT_PATH_BETA, CERT_PATH_PROD), sin repetir rutas
+func (c *Config) CertificatePaths() map[string]string {
+	rutas := map[string]string{}
+	vistas := map[string]bool{}
+	for _, par := range [][2]string{
+		{"CERT_PATH", c.Certificate.Path},
+		{"CERT_PATH_BETA", c.Certificate.PathBeta},
+		{"CERT_PATH_PROD", c.Certificate.PathProd},
+	} {
+		if par[1] == "" || vistas[par[1]] {
+			continue
+		}
+		vistas[par[1]] = true
+		rutas[par[0]] = par[1]
+	}
+	return rutas
+}
+
+// SerieAutomatica retorna la serie configurada para el RUC y tipo de comprobante,
+// usando la entrada "*" si el RUC no tiene series propias
+func (c *Config) SerieAutomatica(ruc, tipoDoc string) string {
+	if serie := c.AutoTipo.Series[ruc][tipoDoc]; serie != "" {
+		return serie
+	}
+	return c.AutoTipo.Series["*"][tipoDoc]
+}
+
+// parseSeriesAutomaticas interpreta el formato "RUC:01=F001,03=B001;*:01=F002,03=B002"
+func parseSeriesAutomaticas(valor string) map[string]map[string]string {
+	series := map[string]map[string]string{}
+	for _, grupo := range strings.Split(valor, ";") {
+		ruc, asignaciones, ok := strings.Cut(strings.TrimSpace(grupo), ":")
+		if !ok {
+			if grupo != "" {
+				log.Printf("Warning: grupo inválido en AUTO_SERIES: %s", grupo)
+			}
+			continue
+		}
+		series[ruc] = map[string]string{}
+		for _, asignacion := range strings.Split(asignaciones, ",") {
+			tipoDoc, serie, ok := strings.Cut(strings.TrimSpace(asignacion), "=")
+			if !ok {
+				log.Printf("Warning: serie inválida en AUTO_SERIES: %s", asignacion)
+				continue
+			}
+			series[ruc][tipoDoc] = strings.ToUpper(serie)
+		}
+	}
+	return series
+}
+
+/*
+SerieAutorizada indica si la serie está declarada para el RUC y tipo de comprobante.
+Se usan las series propias del RUC o, si no tiene, las de "*". Un tipo sin series
+configuradas no tiene restricción, para poder habilitar el control por tipo.
+*/
+func (c *Config) SerieAutorizada(ruc, tipoDoc, serie string) bool {
+	series, ok := c.Emisores.SeriesAutorizadas[ruc][tipoDoc]
+	if !ok {
+		series, ok = c.Emisores.SeriesAutorizadas["*"][tipoDoc]
+	}
+	if !ok {
+		return true
+	}
+	for _, autorizada := range series {
+		if strings.EqualFold(autorizada, serie) {
+			return true
+		}
+	}
+	return false
+}
+
+// SeriesAutorizadasDe retorna las series autorizadas que aplican al RUC y tipo (para mensajes)
+func (c *Config) SeriesAutorizadasDe(ruc, tipoDoc string) []string {
+	if series, ok := c.Emisores.SeriesAutorizadas[ruc][tipoDoc]; ok {
+		return series
+	}
+	return c.Emisores.SeriesAutorizadas["*"][tipoDoc]
+}
+
+// parseSeriesAutorizadas interpreta el formato "RUC:01=F001|F002,03=B001;*:01=F001"
+func parseSeriesAutorizadas(valor string) map[string]map[string][]string {
+	autorizadas := map[string]map[string][]string{}
+	for _, grupo := range strings.Split(valor, ";") {
+		ruc, asignaciones, ok := strings.Cut(strings.TrimSpace(grupo), ":")
+		if !ok {
+			if strings.TrimSpace(grupo) != "" {
+				log.Printf("Warning: grupo inválido en SERIES_AUTORIZADAS: %s", grupo)
+			}
+			continue
+		}
+		ruc = strings.TrimSpace(ruc)
+		if ruc != "*" && !esRUC(ruc) {
+			log.Printf("Warning: RUC inválido en SERIES_AUTORIZADAS: %s", ruc)
+			continue
+		}
+		autorizadas[ruc] = map[string][]string{}
+		for _, asignacion := range strings.Split(asignaciones, ",") {
+			tipoDoc, series, ok := strings.Cut(strings.TrimSpace(asignacion), "=")
+			if !ok {
+				log.Printf("Warning: asignación inválida en SERIES_AUTORIZADAS: %s", asignacion)
+				continue
+			}
+			autorizadas[ruc][tipoDoc] = normalizarSeries(strings.Split(series, "|"))
+		}
+	}
+	return autorizadas
+}
+
+// normalizarSeries pasa las series a mayúsculas y descarta las vacías
+func normalizarSeries(series []string) []string {
+	normalizadas := []string{}
+	for _, serie := range series {
+		if serie = strings.ToUpper(strings.TrimSpace(serie)); serie != "" {
+			normalizadas = append(normalizadas, serie)
+		}
+	}
+	return normalizadas
+}
+
+// ModoRedondeo retorna la política de redondeo del emisor: la propia del RUC o, si no
+// tiene, la de ROUNDING_MODE. Vacío indica que no se aplica ninguna política.
+func (c *Config) ModoRedondeo(ruc string) string {
+	if modo, ok := c.Emisores.ModoRedondeoPorRUC[ruc]; ok {
+		return modo
+	}
+	return c.Emisores.ModoRedondeo
+}
+
+// UnidadMedida retorna la unidad de medida por defecto del emisor: la propia del RUC o,
+// si no tiene, la de DEFAULT_UNIT_CODE
+func (c *Config) UnidadMedida(ruc string) string {
+	if unidad, ok := c.Emisores.UnidadMedidaPorRUC[ruc]; ok {
+		return unidad
+	}
+	return c.Emisores.UnidadMedida
+}
+
+// validarModoRedondeo descarta con una advertencia los modos de redondeo no soportados
+func validarModoRedondeo(origen, modo string) string {
+	modo = strings.ToLower(strings.TrimSpace(modo))
+	if modo == "" {
+		return ""
+	}
+	if _, ok := models.PoliticasRedondeo[modo]; !ok {
+		log.Printf("Warning: modo de redondeo '%s' no reconocido en %s, no se aplica redondeo", modo, origen)
+		return ""
+	}
+	return modo
+}
+
+// EmisorAutorizado indica si el RUC puede emitir comprobantes. Sin EMISORES_AUTORIZADOS
+// configurado no hay restricción.
+func (c *Config) EmisorAutorizado(ruc string) bool {
+	return len(c.Emisores.Autorizados) == 0 || c.Emisores.Autorizados[ruc]
+}
+
+// parseEmisoresAutorizados interpreta la lista de RUCs separados por coma
+func parseEmisoresAutorizados(valor string) map[string]bool {
+	emisores := map[string]bool{}
+	for _, ruc := range strings.Split(valor, ",") {
+		ruc = strings.TrimSpace(ruc)
+		if ruc == "" {
+			continue
+		}
+		if !esRUC(ruc) {
+			log.Printf("Warning: RUC inválido en EMISORES_AUTORIZADOS: %s", ruc)
+			continue
+		}
+		emisores[ruc] = true
+	}
+	return emisores
+}
+
+// esRUC verifica el formato de un RUC (11 dígitos)
+func esRUC(ruc string) bool {
+	return len(ruc) == 11 && strings.Trim(ruc, "0123456789") == ""
+}
+
+// parseAPIKeys interpreta el formato "cliente:clave,cliente2:clave2" y retorna un mapa
+// clave -> cliente. En BD y en los logs solo se registra el identificador del cliente.
+func parseAPIKeys(variable, valor string) map[string]string {
+	claves := map[string]string{}
+	for _, par := range strings.Split(valor, ",") {
+		par = strings.TrimSpace(par)
+		if par == "" {
+			continue
+		}
+		cliente, clave, ok := strings.Cut(par, ":")
+		if !ok || cliente == "" || clave == "" {
+			log.Printf("Warning: entrada inválida en %s (se espera cliente:clave)", variable)
+			continue
+		}
+		claves[clave] = cliente
+	}
+	return claves
+}
+
+// LeyendasEmisor retorna las leyendas configuradas para el RUC seguidas de las comunes ("*")
+func (c *Config) LeyendasEmisor(ruc string) []LeyendaPlantilla {
+	leyendas := append([]LeyendaPlantilla{}, c.Leyendas.PorRUC[ruc]...)
+	return append(leyendas, c.Leyendas.PorRUC["*"]...)
+}
+
+// loadLeyendasEmisor lee el archivo JSON de plantillas de leyendas con el formato
+// {"20123456789": [{"codigo": "2006", "descripcion": "..."}], "*": [...]}.
+// Las leyendas con códigos fuera del catálogo 52 se descartan con una advertencia.
+func loadLeyendasEmisor(ruta string) map[string][]LeyendaPlantilla {
+	plantillas := map[string][]LeyendaPlantilla{}
+	if ruta == "" {
+		return plantillas
+	}
+
+	data, err := os.ReadFile(ruta)
+	if err != nil {
+		log.Printf("Warning: no se pudo leer LEYENDAS_EMISOR_FILE (%s): %v", ruta, err)
+		return plantillas
+	}
+	var leidas map[string][]LeyendaPlantilla
+	if err := json.Unmarshal(data, &leidas); err != nil {
+		log.Printf("Warning: LEYENDAS_EMISOR_FILE (%s) no es un JSON válido: %v", ruta, err)
+		return plantillas
+	}
+
+	for ruc, leyendas := range leidas {
+		plantillas[ruc] = filtrarLeyendas("LEYENDAS_EMISOR_FILE", ruc, leyendas)
+	}
+	return plantillas
+}
+
+// filtrarLeyendas descarta con una advertencia las leyendas sin descripción o con
+// códigos fuera del catálogo 52
+func filtrarLeyendas(origen, ruc string, leyendas []LeyendaPlantilla) []LeyendaPlantilla {
+	var validas []LeyendaPlantilla
+	for _, leyenda := range leyendas {
+		leyenda.Codigo = strings.TrimSpace(leyenda.Codigo)
+		if _, ok := catalogos.LeyendasCatalogo52[leyenda.Codigo]; !ok || strings.TrimSpace(leyenda.Descripcion) == "" {
+			log.Printf("Warning: leyenda inválida para %s en %s (código '%s')", ruc, origen, leyenda.Codigo)
+			continue
+		}
+		validas = append(validas, leyenda)
+	}
+	return validas
+}
+
+// loadDestinos carga los destinos de envío. Cada nombre listado en SUNAT_DESTINOS
+// (ej: "nubefact,gre") se configura con SUNAT_DESTINO_<NOMBRE>_TIPO, _URL, _USUARIO,
+// _CLAVE, _TOKEN y _RUCS (RUCs que lo usan por defecto, separados por coma)
+func loadDestinos(config *Config) {
+	config.Destinos.Lista = map[string]DestinoSUNAT{
+		"sol": {
+			Tipo:     "sol",
+			URL:      config.SUNAT.URL,
+			Username: config.SUNAT.Username,
+			Password: config.SUNAT.Password,
+		},
+	}
+	config.Destinos.PorRUC = map[string]string{}
+	config.Destinos.PorDefecto = strings.ToLower(getEnv("SUNAT_DESTINO_DEFAULT", "sol"))
+
+	for _, nombre := range strings.Split(getEnv("SUNAT_DESTINOS", ""), ",") {
+		nombre = strings.ToLower(strings.TrimSpace(nombre))
+		if nombre == "" {
+			continue
+		}
+		prefijo := "SUNAT_DESTINO_" + strings.ToUpper(nombre) + "_"
+		config.Destinos.Lista[nombre] = DestinoSUNAT{
+			Tipo:     strings.ToLower(getEnv(prefijo+"TIPO", "ose")),
+			URL:      getEnv(prefijo+"URL", ""),
+			Username: getEnv(prefijo+"USUARIO", ""),
+			Password: getEnvSecret(prefijo+"CLAVE", ""),
+			Token:    getEnvSecret(prefijo+"TOKEN", ""),
+		}
+		for _, ruc := range strings.Split(getEnv(prefijo+"RUCS", ""), ",") {
+			if ruc = strings.TrimSpace(ruc); ruc != "" {
+				config.Destinos.PorRUC[ruc] = nombre
+			}
+		}
+	}
+}
+
+// Destino resuelve el destino de envío: el indicado en el request, el asignado al RUC
+// o el destino por defecto, en ese orden
+func (c *Config) Destino(ruc, solicitado string) (string, DestinoSUNAT, error) {
+	nombre := strings.ToLower(strings.TrimSpace(solicitado))
+	if nombre == "" {
+		nombre = c.Destinos.PorRUC[ruc]
+	}
+	if nombre == "" {
+		nombre = c.Destinos.PorDefecto
+	}
+
+	destino, ok := c.Destinos.Lista[nombre]
+	if !ok {
+		return "", DestinoSUNAT{}, fmt.Errorf("destino SUNAT '%s' no configurado", nombre)
+	}
+	return nombre, destino, nil
+}
+
+// ambientePorURL deduce el ambiente a partir del endpoint de SUNAT
+func ambientePorURL(url string) string {
+	if strings.Contains(strings.ToLower(url), "beta") {
+		return AmbienteBeta
+	}
+	return AmbienteProduccion
+}
+
+// consultURLPorAmbiente retorna el servicio de consulta de CDR del mismo ambiente que el
+// envío, para no consultar en producción los comprobantes enviados a beta
+func consultURLPorAmbiente(ambiente string) string {
+	if ambiente == AmbienteBeta {
+		return "https://e-beta.sunat.gob.pe/ol-it-wsconscpegem-beta/billConsultService"
+	}
+	return "https://e-factura.sunat.gob.pe/ol-it-wsconscpegem/billConsultService"
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Printf("Warning: valor inválido para %s, usando %d", key, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+		log.Printf("Warning: valor inválido para %s, usando %g", key, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+		log.Printf("Warning: valor inválido para %s, usando %t", key, defaultValue)
+	}
+	return defaultValue
+}
+
+// getRetryPolicy lee SUNAT_RETRY_<OPERACION>_MAX_ATTEMPTS y SUNAT_RETRY_<OPERACION>_BACKOFF_MS
+func getRetryPolicy(operation string, defaultAttempts, defaultBackoffMs int) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: getEnvInt("SUNAT_RETRY_"+operation+"_MAX_ATTEMPTS", defaultAttempts),
+		Backoff:     time.Duration(getEnvInt("SUNAT_RETRY_"+operation+"_BACKOFF_MS", defaultBackoffMs)) * time.Millisecond,
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"ubl-go-conversor/models"
+	"ubl-go-conversor/utils"
+)
+
+/*
+consultarDocumentoSUNAT es el endpoint GET /api/v1/documents/{id}/consultar, que
+recupera de SUNAT la respuesta de un documento y actualiza su estado en BD:
+  - Con ticket (envío asíncrono) consulta getStatus: 98 responde 202 para volver a
+    consultar más tarde; 99 registra el rechazo o el error informado por SUNAT
+  - Sin ticket consulta getStatusCdr por RUC, tipo, serie y número. Es el caso de un
+    sendBill que dio timeout y dejó el documento en processing sin CDR
+
+Los documentos en contingencia (pending_send) o con envío programado (scheduled) aún
+no se enviaron, por lo que SUNAT no tiene respuesta para ellos.
+*/
+func consultarDocumentoSUNAT(w http.ResponseWriter, r *http.Request, documentID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	doc, err := docRepo.GetByID(documentID)
+	if err != nil {
+		http.Error(w, "Documento no encontrado", http.StatusNotFound)
+		return
+	}
+
+	var cdrInfo *models.CDRInfo
+	switch {
+	case doc.Ticket != "":
+		estadoTicket, err := consultarTicketDocumento(doc, r.RemoteAddr)
+		if err != nil {
+			escribirErrorConsulta(w, r, "Error al consultar el ticket en SUNAT", err)
+			return
+		}
+		if estadoTicket.EnProceso {
+			escribirRespuesta(w, r, http.StatusAccepted, models.APIResponse{
+				Estado:      models.StatusTicketPending,
+				Code:        estadoTicket.StatusCode,
+				Description: fmt.Sprintf("El ticket %s aún está en proceso en SUNAT", doc.Ticket),
+			})
+			return
+		}
+		cdrInfo = estadoTicket.CDR
+	case doc.Estado == models.StatusPendingSend:
+		http.Error(w, "El documento "+documentID+" está en contingencia y aún no fue enviado a SUNAT", http.StatusConflict)
+		return
+	case doc.Estado == models.StatusScheduled:
+		http.Error(w, "El documento "+documentID+" tiene el envío a SUNAT programado y aún no fue enviado", http.StatusConflict)
+		return
+	default:
+		cdrInfo, err = utils.ConsultarCDR(doc.RUC, doc.TipoDoc, doc.Serie, doc.Numero, "cdr")
+		if err != nil {
+			escribirErrorConsulta(w, r, "Error al consultar el CDR en SUNAT", err)
+			return
+		}
+		registrarCDRConsultado(doc.ID, cdrInfo, r.RemoteAddr)
+	}
+
+	escribirRespuesta(w, r, statusHTTPSegunCDR(cdrInfo.Estado), models.APIResponse{
+		Estado:      cdrInfo.Estado,
+		Code:        cdrInfo.ResponseCode,
+		Description: cdrInfo.Description,
+		CDRZip:      cdrInfo.CDRZipBase64,
+
+		Observaciones: cdrInfo.Observaciones,
+	})
+}
+
+// registrarCDRConsultado actualiza el estado del documento con el CDR obtenido por
+// getStatusCdr y guarda el CDR junto a los demás archivos del documento
+func registrarCDRConsultado(documentID string, cdrInfo *models.CDRInfo, userIP string) {
+	registrarEstadoCDR(documentID, cdrInfo, userIP)
+	persistirArchivos(documentID, userIP, cdrInfo.CDRZipPath)
+	docRepo.UpdateCDRPath(documentID, cdrInfo.CDRZipPath)
+	guardarContenidosBD(documentID, userIP, "", cdrInfo.CDRZipPath, "")
+}
+
+// escribirErrorConsulta responde 502 cuando la consulta a SUNAT no pudo completarse
+func escribirErrorConsulta(w http.ResponseWriter, r *http.Request, descripcion string, err error) {
+	escribirRespuesta(w, r, http.StatusBadGateway, models.ErrorResponse{
+		Estado:      "error",
+		Code:        "502",
+		Description: descripcion,
+		Details:     err.Error(),
+	})
+}
@@ -7,7 +7,7 @@ con las extensiones específicas de SUNAT para facturación electrónica en Per
 
 Funciones principales:
 1. ConvertirFacturaAUBL() - Transforma ComprobanteBase a estructura UBL
-2. GenerarXMLBF() - Serializa la estructura UBL a archivo XML válido
+2. GenerarXMLBF() - Serializa la estructura UBL a archivo XML válido (indentado o minificado)
 3. Funciones de mapeo para cada sección del documento UBL
 
 Cumple con:
@@ -25,7 +25,10 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strings"
+	"unicode/utf8"
 
+	"ubl-go-conversor/catalogos"
 	"ubl-go-conversor/models"
 )
 
@@ -86,6 +89,7 @@ type Invoice struct {
 	
 	// ==================== CONDICIONES DE PAGO ====================
 	PaymentTerms            []PaymentTerms          `xml:"cac:PaymentTerms,omitempty"` // Forma de pago y cuotas
+	AllowanceCharges        []AllowanceCharge       `xml:"cac:AllowanceCharge,omitempty"` // Cargos y descuentos globales (catálogo 53)
 	
 	// ==================== TOTALES E IMPUESTOS ====================
 	TaxTotal                []TaxTotal              `xml:"cac:TaxTotal"`       // Resumen de impuestos (IGV)
@@ -105,6 +109,7 @@ type InvoiceLine struct {
 	InvoicedQuantity    InvoicedQuantity   `xml:"cbc:InvoicedQuantity"`
 	LineExtensionAmount AmountWithCurrency `xml:"cbc:LineExtensionAmount"`
 	PricingReference    PricingReference   `xml:"cac:PricingReference"`
+	AllowanceCharges    []AllowanceCharge  `xml:"cac:AllowanceCharge,omitempty"` // Descuentos del ítem (catálogo 53)
 	TaxTotal            TaxTotal           `xml:"cac:TaxTotal"`
 	Item                Item               `xml:"cac:Item"`
 	Price               Price              `xml:"cac:Price"`
@@ -137,6 +142,21 @@ type Item struct {
 	Description               CDATAString               `xml:"cbc:Description"`
 	SellersItemIdentification SellersItemIdentification `xml:"cac:SellersItemIdentification"`
 	CommodityClassification   CommodityClassification   `xml:"cac:CommodityClassification"`
+	AdditionalItemProperty    []AdditionalItemProperty  `xml:"cac:AdditionalItemProperty,omitempty"`
+}
+
+// AdditionalItemProperty representa una propiedad adicional del ítem (lote, vencimiento, serie)
+type AdditionalItemProperty struct {
+	Name     CDATAString `xml:"cbc:Name"`
+	NameCode *NameCode   `xml:"cbc:NameCode,omitempty"`
+	Value    CDATAString `xml:"cbc:Value"`
+}
+
+type NameCode struct {
+	Value          string `xml:",chardata"`
+	ListName       string `xml:"listName,attr"`
+	ListAgencyName string `xml:"listAgencyName,attr"`
+	ListURI        string `xml:"listURI,attr"`
 }
 
 type SellersItemIdentification struct {
@@ -174,13 +194,18 @@ Proceso de conversión:
 El resultado es una estructura Invoice lista para serializar a XML válido.
 */
 func ConvertirFacturaAUBL(f models.ComprobanteBase) Invoice {
+	// Quien convierte sin pasar por el API puede usar el atajo descuentoGlobal
+	f.IncorporarDescuentoGlobal()
+
 	// Tipo de operación según catálogo 51 de SUNAT
-	// 0101 = Venta interna (operación más común)
-	profileID := "0101"
+	// 0101 = Venta interna (operación más común, usada si no se informa)
+	// 2001 = Venta interna con percepción (se asigna automáticamente)
+	profileID := tipoOperacionFactura(f)
 	
 	// Convertir leyendas del comprobante (ej: importe en letras) a elementos UBL Note
+	// sin códigos repetidos y con la leyenda 1000 presente exactamente una vez
 	notes := []Note{}
-	for _, leyenda := range f.Leyendas {
+	for _, leyenda := range NormalizarLeyendas(f) {
 		notes = append(notes, Note{
 			Value:            leyenda.Descripcion, // Texto de la leyenda
 			LanguageLocaleID: leyenda.Codigo,      // Código de tipo de leyenda (catálogo 52)
@@ -201,6 +226,11 @@ func ConvertirFacturaAUBL(f models.ComprobanteBase) Invoice {
 		extensiones = append(extensiones, *percepcion)
 	}
 
+	// SUNAT valida que LineCountNumeric sea igual a la cantidad de cac:InvoiceLine, por eso
+	// se cuenta sobre las líneas generadas y no sobre los ítems recibidos: si crearLineas
+	// llega a omitir o consolidar ítems, el conteo sigue siendo correcto
+	lineas := crearLineas(f.Items, f.Moneda)
+
 	invoice := Invoice{
 		XmlnsXsi:  "http://www.w3.org/2001/XMLSchema-instance",
 		XmlnsXsd:  "http://www.w3.org/2001/XMLSchema",
@@ -228,20 +258,21 @@ func ConvertirFacturaAUBL(f models.ComprobanteBase) Invoice {
 			SchemeAgencyName: "PE:SUNAT",
 			SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo51",
 		},
-		ID:                      f.Serie + "-" + f.Numero,
+		ID:                      models.FormatearIDComprobante(f.Serie, f.Numero),
 		IssueDate:               f.FechaEmision,
 		IssueTime:               f.HoraEmision,
 		DueDate:                 f.FechaVencimiento,
 		InvoiceTypeCode:         crearInvoiceTypeCode(f),
 		DocumentCurrencyCode:    crearCurrencyCode(f.Moneda),
-		LineCountNumeric:        len(f.Items),
+		LineCountNumeric:        len(lineas),
 		Signature:               crearFirma(f),
 		AccountingSupplierParty: crearEmisor(f.Emisor),
 		AccountingCustomerParty: crearCliente(f.Cliente),
 		PaymentTerms:            crearPaymentTerms(f),
+		AllowanceCharges:        crearAllowanceCharges(f),
 		TaxTotal:                crearTaxTotals(f),
 		LegalMonetaryTotal:      crearTotalesMonetarios(f),
-		InvoiceLines:            crearLineas(f.Items, f.Moneda),
+		InvoiceLines:            lineas,
 		Notes:                   notes,
 	}
 
@@ -254,10 +285,20 @@ func crearInvoiceTypeCode(f models.ComprobanteBase) InvoiceTypeCode {
 		ListAgencyName: "PE:SUNAT",
 		ListName:       "Tipo de Documento",
 		ListURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo01",
-		ListID:         "0101",
+		ListID:         tipoOperacionFactura(f), // Tipo de operación (catálogo 51)
 	}
 }
 
+// tipoOperacionFactura retorna el tipo de operación del catálogo 51. Una venta interna
+// con percepción se declara como 2001, en sincronía con la extensión de crearPercepcion
+func tipoOperacionFactura(f models.ComprobanteBase) string {
+	tipoOperacion := catalogos.NormalizarTipoOperacion(f.TipoOperacion)
+	if tipoOperacion == catalogos.TipoOperacionPorDefecto && crearPercepcion(f) != nil {
+		return catalogos.TipoOperacionPercepcion
+	}
+	return tipoOperacion
+}
+
 func crearCurrencyCode(moneda string) DocumentCurrencyCode {
 	return DocumentCurrencyCode{
 		Value:          moneda,
@@ -267,15 +308,93 @@ func crearCurrencyCode(moneda string) DocumentCurrencyCode {
 	}
 }
 
+/*
+OpcionesXML controla el formato del XML generado.
+
+- Minificado: sin saltos de línea ni indentación (menor tamaño del ZIP)
+- Indentacion: cadena usada por nivel cuando no se minifica (default 2 espacios)
+
+La firma funciona igual en ambos casos porque se calcula sobre el XML ya serializado.
+*/
+type OpcionesXML struct {
+	Minificado  bool
+	Indentacion string
+}
+
+// GenerarXMLBF genera el XML indentado con 2 espacios
 func GenerarXMLBF(f models.ComprobanteBase, rutaArchivo string) error {
-	invoice := ConvertirFacturaAUBL(f)
-	xmlData, err := xml.MarshalIndent(invoice, "", "  ")
+	return GenerarXMLBFConOpciones(f, rutaArchivo, OpcionesXML{Indentacion: "  "})
+}
+
+// GenerarXMLBFConOpciones genera el XML UBL indentado o minificado según las opciones
+func GenerarXMLBFConOpciones(f models.ComprobanteBase, rutaArchivo string, opciones OpcionesXML) error {
+	return escribirXML(ConvertirFacturaAUBL(f), rutaArchivo, opciones)
+}
+
+// GenerarXMLComprobante genera el XML UBL según el tipo de documento: factura o boleta
+// (Invoice), nota de crédito (CreditNote) o nota de débito (DebitNote)
+func GenerarXMLComprobante(f models.ComprobanteBase, rutaArchivo string, opciones OpcionesXML) error {
+	switch f.TipoDocumento {
+	case "01", "03":
+		return GenerarXMLBFConOpciones(f, rutaArchivo, opciones)
+	case "07":
+		return escribirXML(ConvertirNotaCreditoAUBL(f), rutaArchivo, opciones)
+	case "08":
+		return escribirXML(ConvertirNotaDebitoAUBL(f), rutaArchivo, opciones)
+	default:
+		return fmt.Errorf("tipo de documento no soportado: %s", f.TipoDocumento)
+	}
+}
+
+// escribirXML serializa el documento UBL y lo escribe como UTF-8 con la declaración de SUNAT
+func escribirXML(documento interface{}, rutaArchivo string, opciones OpcionesXML) error {
+	var xmlData []byte
+	var err error
+	if opciones.Minificado {
+		xmlData, err = xml.Marshal(documento)
+	} else {
+		xmlData, err = xml.MarshalIndent(documento, "", opciones.Indentacion)
+	}
 	if err != nil {
 		return fmt.Errorf("error al serializar XML: %v", err)
 	}
 	xmlString := xml.Header + string(xmlData)
 	xmlString = limpiarXML(xmlString)
-	return os.WriteFile(rutaArchivo, []byte(xmlString), 0644)
+
+	contenido, err := codificarUTF8(xmlString)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(rutaArchivo, contenido, 0644)
+}
+
+// DeclaracionXML es la declaración exacta que SUNAT espera al inicio del archivo
+const DeclaracionXML = `<?xml version="1.0" encoding="UTF-8"?>`
+
+// bomUTF8 marca de orden de bytes que algunos editores anteponen; SUNAT rechaza archivos con BOM
+const bomUTF8 = "\uFEFF"
+
+/*
+codificarUTF8 garantiza que el XML se escriba como UTF-8 sin BOM y con la declaración
+exacta: elimina el BOM y cualquier declaración previa (que limpiarXML podría haber
+dejado alterada) y antepone DeclaracionXML. Verifica además que el contenido sea
+UTF-8 válido para que tildes y ñ lleguen íntegras a SUNAT.
+*/
+func codificarUTF8(xmlStr string) ([]byte, error) {
+	xmlStr = strings.TrimLeft(strings.TrimPrefix(xmlStr, bomUTF8), " \t\r\n")
+	if strings.HasPrefix(xmlStr, "<?xml") {
+		fin := strings.Index(xmlStr, "?>")
+		if fin < 0 {
+			return nil, fmt.Errorf("declaración XML malformada")
+		}
+		xmlStr = strings.TrimLeft(xmlStr[fin+2:], " \t\r\n")
+	}
+
+	if !utf8.ValidString(xmlStr) {
+		return nil, fmt.Errorf("el XML contiene caracteres que no son UTF-8 válido")
+	}
+
+	return []byte(DeclaracionXML + "\n" + xmlStr), nil
 }
 
 func limpiarXML(xmlStr string) string {
@@ -0,0 +1,99 @@
+package converters
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"ubl-go-conversor/models"
+)
+
+// facturaPrueba retorna una factura gravada mínima con la razón social indicada
+func facturaPrueba(razonSocial string) models.ComprobanteBase {
+	return models.ComprobanteBase{
+		TipoDocumento: "01",
+		Serie:         "F001",
+		Numero:        "1",
+		FechaEmision:  "2026-10-17",
+		HoraEmision:   "10:00:00",
+		Moneda:        "PEN",
+		Emisor: models.Emisor{
+			RUC:          "20123456789",
+			RazonSocial:  razonSocial,
+			Ubigeo:       "150101",
+			Direccion:    "Av. José Gálvez 123",
+			Departamento: "LIMA",
+			Provincia:    "LIMA",
+			Distrito:     "LIMA",
+			CodigoPais:   "PE",
+		},
+		Cliente: models.Cliente{
+			NumeroDoc:   "20987654321",
+			RazonSocial: "CLIENTE SAC",
+			TipoDoc:     "6",
+			CodigoPais:  "PE",
+		},
+		TotalGravado:      100,
+		TotalIGV:          18,
+		TotalPrecioVenta:  118,
+		TotalImportePagar: 118,
+		Items: []models.ItemComprobante{{
+			ID:                  "1",
+			Cantidad:            1,
+			UnidadMedida:        "NIU",
+			Descripcion:         "Café de exportación",
+			ValorUnitario:       100,
+			PrecioVentaUnitario: 118,
+			ValorTotal:          100,
+			IGV:                 18,
+			CodigoTipoPrecio:    "01",
+			TipoAfectacionIGV:   "10",
+			UNSPSC:              "10101501",
+		}},
+	}
+}
+
+// TestGenerarXMLUTF8SinBOM verifica que el archivo no comience con BOM, tenga la
+// declaración exacta y conserve los caracteres multibyte (tildes, ñ) en UTF-8
+func TestGenerarXMLUTF8SinBOM(t *testing.T) {
+	razonSocial := "Compañía Ñandú S.A.C."
+	ruta := filepath.Join(t.TempDir(), "F001-1.xml")
+	if err := GenerarXMLBF(facturaPrueba(razonSocial), ruta); err != nil {
+		t.Fatalf("error generando XML: %v", err)
+	}
+	contenido, err := os.ReadFile(ruta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.HasPrefix(contenido, []byte{0xEF, 0xBB, 0xBF}) {
+		t.Fatal("el XML comienza con BOM (EF BB BF)")
+	}
+	if !bytes.HasPrefix(contenido, []byte(DeclaracionXML)) {
+		t.Errorf("el XML debe comenzar con %s", DeclaracionXML)
+	}
+	if !utf8.Valid(contenido) {
+		t.Fatal("el XML no es UTF-8 válido")
+	}
+	for _, texto := range []string{razonSocial, "Café de exportación", "José Gálvez"} {
+		if !strings.Contains(string(contenido), texto) {
+			t.Errorf("el XML no conserva el texto %q", texto)
+		}
+	}
+}
+
+// TestCodificarUTF8DescartaBOM verifica que un BOM y una declaración previa se
+// reemplacen por la declaración exacta
+func TestCodificarUTF8DescartaBOM(t *testing.T) {
+	contenido, err := codificarUTF8("\uFEFF<?xml version='1.0' encoding='utf-8'?>\n<a>Ñandú</a>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	esperado := DeclaracionXML + "\n<a>Ñandú</a>"
+	if string(contenido) != esperado {
+		t.Errorf("esperado %q, obtenido %q", esperado, contenido)
+	}
+}
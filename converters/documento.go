@@ -4,8 +4,10 @@ package converters
 import (
 	"encoding/xml"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
+	"ubl-go-conversor/catalogos"
 	"ubl-go-conversor/models"
 )
 
@@ -174,17 +176,27 @@ type TaxTotal struct {
 	TaxSubtotal []TaxSubtotal        `xml:"cac:TaxSubtotal"`
 }
 
+// TaxSubtotal subtotal de un tributo. Los tributos por unidad (ICBPER) no tienen base
+// imponible: informan la cantidad en BaseUnitMeasure y el monto unitario en la categoría
 type TaxSubtotal struct {
-	TaxableAmount AmountWithCurrency `xml:"cbc:TaxableAmount"`
-	TaxAmount     AmountWithCurrency `xml:"cbc:TaxAmount"`
-	TaxCategory   TaxCategory        `xml:"cac:TaxCategory"`
+	TaxableAmount   *AmountWithCurrency `xml:"cbc:TaxableAmount,omitempty"`
+	TaxAmount       AmountWithCurrency  `xml:"cbc:TaxAmount"`
+	BaseUnitMeasure *BaseUnitMeasure    `xml:"cbc:BaseUnitMeasure,omitempty"`
+	TaxCategory     TaxCategory         `xml:"cac:TaxCategory"`
+}
+
+type BaseUnitMeasure struct {
+	Value    float64 `xml:",chardata"`
+	UnitCode string  `xml:"unitCode,attr"`
 }
 
 type TaxCategory struct {
-	ID                     TaxCategoryID          `xml:"cbc:ID"`
-	Percent                *float64               `xml:"cbc:Percent"`
-	TaxExemptionReasonCode TaxExemptionReasonCode `xml:"cbc:TaxExemptionReasonCode,omitempty"`
-	TaxScheme              TaxScheme              `xml:"cac:TaxScheme"`
+	ID                     *TaxCategoryID          `xml:"cbc:ID,omitempty"`
+	Percent                *float64                `xml:"cbc:Percent,omitempty"`
+	PerUnitAmount          *AmountWithCurrency     `xml:"cbc:PerUnitAmount,omitempty"`
+	TaxExemptionReasonCode *TaxExemptionReasonCode `xml:"cbc:TaxExemptionReasonCode,omitempty"`
+	TierRange              string                  `xml:"cbc:TierRange,omitempty"` // Sistema de cálculo del ISC (catálogo 08)
+	TaxScheme              TaxScheme               `xml:"cac:TaxScheme"`
 }
 
 type TaxCategoryID struct {
@@ -216,9 +228,29 @@ type TaxSchemeID struct {
 }
 
 type LegalMonetaryTotal struct {
-	LineExtensionAmount AmountWithCurrency `xml:"cbc:LineExtensionAmount"`
-	TaxInclusiveAmount  AmountWithCurrency `xml:"cbc:TaxInclusiveAmount"`
-	PayableAmount       AmountWithCurrency `xml:"cbc:PayableAmount"`
+	LineExtensionAmount   AmountWithCurrency  `xml:"cbc:LineExtensionAmount"`
+	TaxInclusiveAmount    AmountWithCurrency  `xml:"cbc:TaxInclusiveAmount"`
+	AllowanceTotalAmount  *AmountWithCurrency `xml:"cbc:AllowanceTotalAmount,omitempty"`
+	ChargeTotalAmount     *AmountWithCurrency `xml:"cbc:ChargeTotalAmount,omitempty"`
+	// Ajuste por la política de redondeo del emisor (PayableAmount ya lo incluye)
+	PayableRoundingAmount *AmountWithCurrency `xml:"cbc:PayableRoundingAmount,omitempty"`
+	PayableAmount         AmountWithCurrency  `xml:"cbc:PayableAmount"`
+}
+
+// AllowanceCharge representa un cargo (ChargeIndicator=true) o descuento (false)
+type AllowanceCharge struct {
+	ChargeIndicator           bool                      `xml:"cbc:ChargeIndicator"`
+	AllowanceChargeReasonCode AllowanceChargeReasonCode `xml:"cbc:AllowanceChargeReasonCode"`
+	MultiplierFactorNumeric   float64                   `xml:"cbc:MultiplierFactorNumeric,omitempty"`
+	Amount                    AmountWithCurrency        `xml:"cbc:Amount"`
+	BaseAmount                *AmountWithCurrency       `xml:"cbc:BaseAmount,omitempty"`
+}
+
+type AllowanceChargeReasonCode struct {
+	Value          string `xml:",chardata"`
+	ListAgencyName string `xml:"listAgencyName,attr"`
+	ListName       string `xml:"listName,attr"`
+	ListURI        string `xml:"listURI,attr"`
 }
 
 type AmountWithCurrency struct {
@@ -241,7 +273,7 @@ type SUNATPerception struct {
 // Estructura para la firma digital
 func crearFirma(f models.ComprobanteBase) Signature {
 	return Signature{
-		ID: f.Serie + "-" + f.Numero,
+		ID: models.FormatearIDComprobante(f.Serie, f.Numero),
 		SignatoryParty: SignatoryParty{
 			PartyIdentification: PartyIdentification{
 				ID: IDWithScheme{
@@ -304,7 +336,7 @@ func crearEmisor(emisor models.Emisor) AccountingSupplierParty {
 						SchemeAgencyName: "PE:INEI",
 					},
 					AddressTypeCode: AddressTypeCode{
-						Value:          "0000",
+						Value:          codigoEstablecimiento(emisor.CodigoEstablecimiento),
 						ListAgencyName: "PE:SUNAT",
 						ListName:       "Establecimientos anexos",
 					},
@@ -316,7 +348,7 @@ func crearEmisor(emisor models.Emisor) AccountingSupplierParty {
 					},
 					Country: Country{
 						IdentificationCode: CountryCode{
-							Value:          emisor.CodigoPais,
+							Value:          catalogos.NormalizarCodigoPais(emisor.CodigoPais),
 							ListID:         "ISO 3166-1",
 							ListAgencyName: "United Nations Economic Commission for Europe",
 							ListName:       "Country",
@@ -331,6 +363,14 @@ func crearEmisor(emisor models.Emisor) AccountingSupplierParty {
 	}
 }
 
+// codigoEstablecimiento retorna el establecimiento anexo del emisor, "0000" (principal) si no se indica
+func codigoEstablecimiento(codigo string) string {
+	if codigo == "" {
+		return "0000"
+	}
+	return codigo
+}
+
 // crear cliente (Quien recibe el comprobante)
 func crearCliente(cliente models.Cliente) AccountingCustomerParty {
 	return AccountingCustomerParty{
@@ -387,7 +427,7 @@ func crearCliente(cliente models.Cliente) AccountingCustomerParty {
 					},
 					Country: Country{
 						IdentificationCode: CountryCode{
-							Value:          cliente.CodigoPais,
+							Value:          catalogos.NormalizarCodigoPais(cliente.CodigoPais),
 							ListID:         "ISO 3166-1",
 							ListAgencyName: "United Nations Economic Commission for Europe",
 							ListName:       "Country",
@@ -399,50 +439,109 @@ func crearCliente(cliente models.Cliente) AccountingCustomerParty {
 	}
 }
 
-// crea los totales de impuestos
+// calculadoresTributo generan los cac:TaxSubtotal de cada esquema tributario del
+// documento (catálogo 05), en el orden en que se declaran: IGV (1000 y afectaciones
+// exoneradas/inafectas), ISC (2000), ICBPER (7152). Un esquema sin montos no aporta subtotales.
+var calculadoresTributo = []func(models.ComprobanteBase) []TaxSubtotal{
+	subtotalesIGV,
+	subtotalesISC,
+	subtotalesICBPER,
+}
+
+// crea los totales de impuestos: un TaxSubtotal por cada esquema presente y el total
+// consolidado de todos los tributos en TaxAmount
 func crearTaxTotals(f models.ComprobanteBase) []TaxTotal {
-	// Acumulador de subtotales por tipo de afectación IGV
-	var percent float64
+	var taxSubtotals []TaxSubtotal
+	for _, calcular := range calculadoresTributo {
+		taxSubtotals = append(taxSubtotals, calcular(f)...)
+	}
 
-	subtotales := map[string]struct {
-		Base, IGV, Porcentaje float64
-	}{}
+	return []TaxTotal{{
+		TaxAmount:   newAmount(totalTributos(taxSubtotals), f.Moneda),
+		TaxSubtotal: taxSubtotals,
+	}}
+}
+
+// totalTributos suma el impuesto de los subtotales. El IGV referencial de las operaciones
+// gratuitas (9996) se informa en su subtotal pero no forma parte del total cobrado.
+func totalTributos(subtotales []TaxSubtotal) float64 {
+	var total float64
+	for _, s := range subtotales {
+		if s.TaxCategory.TaxScheme.ID.Value == "9996" {
+			continue
+		}
+		total += s.TaxAmount.Value
+	}
+	return round(total)
+}
+
+// subtotalesIGV agrupa las líneas por esquema tributario del catálogo 05 (1000 IGV,
+// 1016 IVAP, 9995 exportación, 9996 gratuitas, 9997 exoneradas, 9998 inafectas): SUNAT
+// rechaza un esquema repetido, por lo que afectaciones distintas del mismo esquema
+// (ej: 10 y 11, o 30 y 31) se informan en un único subtotal
+func subtotalesIGV(f models.ComprobanteBase) []TaxSubtotal {
+	type subtotal struct {
+		Base, IGV  float64
+		Afectacion string // Afectación representativa para la categoría del esquema
+	}
+	subtotales := map[string]subtotal{}
 
 	for _, item := range f.Items {
+		esquema := obtenerCodigoTributo(item.TipoAfectacionIGV)
+		s := subtotales[esquema]
+		s.Base += item.BaseIGV()
+		s.IGV += item.IGV
+		if s.Afectacion == "" || item.TipoAfectacionIGV < s.Afectacion {
+			s.Afectacion = item.TipoAfectacionIGV
+		}
+		subtotales[esquema] = s
+	}
 
-		switch item.TipoAfectacionIGV {
-		case "10", "11", "12", "13", "14", "15", "16", "17":
-			percent = 18.00
-		default:
-			percent = 0.00
+	// Los descuentos globales que afectan la base (02) reducen proporcionalmente
+	// la base y el IGV de las operaciones gravadas (IGV e IVAP)
+	if descuentoBase := sumarDescuentos(f.Descuentos, true); descuentoBase > 0 {
+		var baseGravada float64
+		for _, s := range subtotales {
+			if esGravado(s.Afectacion) {
+				baseGravada += s.Base
+			}
 		}
+		if baseGravada > 0 {
+			factor := (baseGravada - descuentoBase) / baseGravada
+			for esquema, s := range subtotales {
+				if esGravado(s.Afectacion) {
+					s.Base = round(s.Base * factor)
+					s.IGV = round(s.IGV * factor)
+					subtotales[esquema] = s
+				}
+			}
+		}
+	}
 
-		s := subtotales[item.TipoAfectacionIGV]
-		s.Base += item.ValorTotal
-		s.IGV += item.IGV
-		s.Porcentaje = percent
-		subtotales[item.TipoAfectacionIGV] = s
+	// Orden estable por código de esquema para que el XML no dependa del orden del map
+	esquemas := make([]string, 0, len(subtotales))
+	for esquema := range subtotales {
+		esquemas = append(esquemas, esquema)
 	}
+	sort.Strings(esquemas)
 
 	var taxSubtotals []TaxSubtotal
-	var totalIGV float64
-
-	for tipo, s := range subtotales {
-		item := models.ItemComprobante{
-			TipoAfectacionIGV: tipo,
+	for _, esquema := range esquemas {
+		s := subtotales[esquema]
+		// Total de operaciones gratuitas: suma de los valores referenciales (cbc:TaxableAmount del 9996)
+		if esquema == "9996" {
+			s.Base = f.TotalOperacionesGratuitas()
 		}
+		// La categoría es la del esquema: el motivo de afectación solo se informa en la línea
+		categoria := newTaxCategory(models.ItemComprobante{TipoAfectacionIGV: s.Afectacion})
+		categoria.TaxExemptionReasonCode = nil
 		taxSubtotals = append(taxSubtotals, TaxSubtotal{
-			TaxableAmount: newAmount(s.Base, f.Moneda),
-			TaxAmount:     newAmount(s.IGV, f.Moneda),
-			TaxCategory:   newTaxCategory(item),
+			TaxableAmount: floatPtrAmount(round(s.Base), f.Moneda),
+			TaxAmount:     newAmount(round(s.IGV), f.Moneda),
+			TaxCategory:   categoria,
 		})
-		totalIGV += s.IGV
 	}
-
-	return []TaxTotal{{
-		TaxAmount:    newAmount(totalIGV, f.Moneda),
-		TaxSubtotal: taxSubtotals,
-	}}
+	return taxSubtotals
 }
 
 // crea los totales monetarios
@@ -466,13 +565,17 @@ func crearTotalesMonetarios(f models.ComprobanteBase) LegalMonetaryTotal {
 		}
 	}
 
-	return LegalMonetaryTotal{
+	// Los descuentos globales que afectan la base se restan del valor de venta
+	lineExtensionAmount -= sumarDescuentos(f.Descuentos, true)
+
+	totales := LegalMonetaryTotal{
 		LineExtensionAmount: AmountWithCurrency{
-			Value:      lineExtensionAmount,
+			Value:      round(lineExtensionAmount),
 			CurrencyID: f.Moneda,
 		},
+		// Valor de venta más todos los tributos del TaxTotal (IGV, ISC, ICBPER)
 		TaxInclusiveAmount: AmountWithCurrency{
-			Value:      f.TotalPrecioVenta,
+			Value:      round(lineExtensionAmount + totalTributos(crearTaxTotals(f)[0].TaxSubtotal)),
 			CurrencyID: f.Moneda,
 		},
 		PayableAmount: AmountWithCurrency{
@@ -480,6 +583,105 @@ func crearTotalesMonetarios(f models.ComprobanteBase) LegalMonetaryTotal {
 			CurrencyID: f.Moneda,
 		},
 	}
+
+	// Descuentos globales que no afectan la base (se aplican después del IGV)
+	if totalDescuentos := sumarDescuentos(f.Descuentos, false); totalDescuentos > 0 {
+		totales.AllowanceTotalAmount = floatPtrAmount(totalDescuentos, f.Moneda)
+	}
+
+	// Cargos a nivel de documento (ej: recargo al consumo)
+	if totalCargos := sumarCargos(f.Cargos); totalCargos > 0 {
+		totales.ChargeTotalAmount = floatPtrAmount(totalCargos, f.Moneda)
+	}
+
+	// Redondeo del importe a pagar según la política del emisor (ej: múltiplos de 0.10)
+	if f.MontoRedondeo != 0 {
+		totales.PayableRoundingAmount = floatPtrAmount(round(f.MontoRedondeo), f.Moneda)
+	}
+
+	return totales
+}
+
+// crearAllowanceCharges convierte los descuentos y cargos del documento a cac:AllowanceCharge
+func crearAllowanceCharges(f models.ComprobanteBase) []AllowanceCharge {
+	var charges []AllowanceCharge
+	for _, descuento := range f.Descuentos {
+		charges = append(charges, newAllowanceCharge(false, descuento, f.Moneda))
+	}
+	for _, cargo := range f.Cargos {
+		charges = append(charges, newAllowanceCharge(true, cargo, f.Moneda))
+	}
+	// La retención del IGV se informa como un AllowanceCharge más (código 62) que no altera
+	// los totales del comprobante, solo el monto neto pendiente de pago
+	if f.Retencion != nil {
+		charges = append(charges, newAllowanceCharge(false, retencionComoCargo(f), f.Moneda))
+	}
+	return charges
+}
+
+// retencionComoCargo completa la retención con la tasa y base por defecto para el XML
+func retencionComoCargo(f models.ComprobanteBase) models.CargoDescuento {
+	retencion := models.CargoDescuento{
+		Codigo:    catalogos.CodigoRetencionIGV,
+		Factor:    f.Retencion.Factor,
+		Monto:     f.Retencion.Monto,
+		MontoBase: f.Retencion.MontoBase,
+	}
+	if retencion.Factor == 0 {
+		retencion.Factor = catalogos.TasaRetencionIGV
+	}
+	if retencion.MontoBase == 0 {
+		retencion.MontoBase = f.TotalImportePagar
+	}
+	return retencion
+}
+
+// newAllowanceCharge crea un cac:AllowanceCharge (ChargeIndicator true=cargo, false=descuento)
+func newAllowanceCharge(esCargo bool, cd models.CargoDescuento, moneda string) AllowanceCharge {
+	charge := AllowanceCharge{
+		ChargeIndicator: esCargo,
+		AllowanceChargeReasonCode: AllowanceChargeReasonCode{
+			Value:          cd.Codigo,
+			ListAgencyName: "PE:SUNAT",
+			ListName:       "Cargo/descuento",
+			ListURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo53",
+		},
+		MultiplierFactorNumeric: cd.Factor,
+		Amount:                  newAmount(cd.Monto, moneda),
+	}
+	if cd.MontoBase > 0 {
+		charge.BaseAmount = floatPtrAmount(cd.MontoBase, moneda)
+	}
+	return charge
+}
+
+// sumarDescuentos retorna el total de descuentos globales que afectan (o no) la base imponible
+func sumarDescuentos(descuentos []models.CargoDescuento, afectanBase bool) float64 {
+	var total float64
+	for _, descuento := range descuentos {
+		if catalogos.DescuentoAfectaBase(descuento.Codigo) == afectanBase {
+			total += descuento.Monto
+		}
+	}
+	return round(total)
+}
+
+// esGravado indica si el tipo de afectación IGV corresponde a una operación gravada
+func esGravado(tipoAfectacionIGV string) bool {
+	switch tipoAfectacionIGV {
+	case "10", "11", "12", "13", "14", "15", "16", "17":
+		return true
+	}
+	return false
+}
+
+// sumarCargos retorna el total de cargos a nivel de documento
+func sumarCargos(cargos []models.CargoDescuento) float64 {
+	var total float64
+	for _, cargo := range cargos {
+		total += cargo.Monto
+	}
+	return round(total)
 }
 
 // crearLineasFactura convierte los items a líneas UBL
@@ -493,6 +695,8 @@ func crearLineas(items []models.ItemComprobante, moneda string) []InvoiceLine {
 			price = item.ValorUnitario
 		}
 
+		// SUNAT exige el número de línea secuencial (1, 2, 3...): se usa la posición del
+		// ítem aunque el cliente envíe su propio ID (ver models.ItemComprobante.CodigoVendedor)
 		lines = append(lines, InvoiceLine{
 			ID: strconv.Itoa(i + 1),
 			InvoicedQuantity: InvoicedQuantity{
@@ -513,29 +717,22 @@ func crearLineas(items []models.ItemComprobante, moneda string) []InvoiceLine {
 					},
 				},
 			},
-			TaxTotal: TaxTotal{
-				TaxAmount: newAmount(item.IGV, moneda),
-				TaxSubtotal: []TaxSubtotal{
-					{
-						TaxableAmount: newAmount(item.ValorTotal, moneda),
-						TaxAmount:     newAmount(item.IGV, moneda),
-						TaxCategory:   newTaxCategory(item),
-					},
-				},
-			},
+			AllowanceCharges: crearDescuentosLinea(item, moneda),
+			TaxTotal:         crearTaxTotalLinea(item, moneda),
 			Item: Item{
 				Description: CDATAString{Value: item.Descripcion},
 				SellersItemIdentification: SellersItemIdentification{
-					ID: CDATAString{Value: item.CodigoProducto},
+					ID: CDATAString{Value: item.CodigoVendedor()},
 				},
 				CommodityClassification: CommodityClassification{
 					ItemClassificationCode: ItemClassificationCode{
-						Value:          item.UNSPSC,
+						Value:          codigoClasificacion(item),
 						ListID:         "UNSPSC",
 						ListAgencyName: "GS1 US",
 						ListName:       "Item Classification",
 					},
 				},
+				AdditionalItemProperty: crearPropiedadesItem(item.PropiedadesAdicionales),
 			},
 			Price: Price{
 				PriceAmount: newAmount(priceAmount, moneda),
@@ -545,6 +742,55 @@ func crearLineas(items []models.ItemComprobante, moneda string) []InvoiceLine {
 	return lines
 }
 
+// crearDescuentosLinea convierte los descuentos del ítem a cac:AllowanceCharge de la línea.
+// SUNAT exige el factor y la base en los descuentos por ítem: la base por defecto es el
+// valor bruto de la línea y el factor se deriva del monto cuando el cliente no lo envía.
+func crearDescuentosLinea(item models.ItemComprobante, moneda string) []AllowanceCharge {
+	var charges []AllowanceCharge
+	for _, descuento := range item.Descuentos {
+		if descuento.MontoBase == 0 {
+			descuento.MontoBase = item.ValorBruto()
+		}
+		if descuento.Factor == 0 && descuento.MontoBase > 0 {
+			descuento.Factor = math.Round(descuento.Monto/descuento.MontoBase*100000) / 100000
+		}
+		charges = append(charges, newAllowanceCharge(false, descuento, moneda))
+	}
+	return charges
+}
+
+// codigoClasificacion retorna el código de producto que va en cac:CommodityClassification.
+// El código de producto SUNAT (catálogo 25) se basa en UNSPSC y SUNAT lo lee de este mismo
+// elemento, por eso tiene prioridad sobre el UNSPSC cuando se envía (productos regulados
+// como medicamentos o combustibles exigen el código SUNAT específico).
+func codigoClasificacion(item models.ItemComprobante) string {
+	if item.CodigoProductoSUNAT != "" {
+		return item.CodigoProductoSUNAT
+	}
+	return item.UNSPSC
+}
+
+// crearPropiedadesItem convierte las propiedades adicionales del ítem a cac:AdditionalItemProperty
+func crearPropiedadesItem(propiedades []models.PropiedadItem) []AdditionalItemProperty {
+	var resultado []AdditionalItemProperty
+	for _, propiedad := range propiedades {
+		adicional := AdditionalItemProperty{
+			Name:  CDATAString{Value: propiedad.Nombre},
+			Value: CDATAString{Value: propiedad.Valor},
+		}
+		if propiedad.Codigo != "" {
+			adicional.NameCode = &NameCode{
+				Value:          propiedad.Codigo,
+				ListName:       "Propiedad del item",
+				ListAgencyName: "PE:SUNAT",
+				ListURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo55",
+			}
+		}
+		resultado = append(resultado, adicional)
+	}
+	return resultado
+}
+
 // Función para determinar el código de categoría de impuesto según el tipo de afectación
 func obtenerCodigoCategoriaTributo(tipoAfectacionIGV string) string {
 	switch tipoAfectacionIGV {
@@ -594,8 +840,10 @@ func obtenerCodigoCategoriaTributo(tipoAfectacionIGV string) string {
 // Función para determinar el código de tributo según el tipo de afectación
 func obtenerCodigoTributo(tipoAfectacionIGV string) string {
 	switch tipoAfectacionIGV {
-	case "10", "11", "12", "13", "14", "15", "16", "17": // Gravado
+	case "10", "11", "12", "13", "14", "15", "16": // Gravado
 		return "1000"
+	case "17": // Gravado - IVAP
+		return "1016"
 	case "20": // Exonerado
 		return "9997"
 	case "21": // Exonerado - Transferencia gratuita
@@ -612,8 +860,10 @@ func obtenerCodigoTributo(tipoAfectacionIGV string) string {
 // Función para determinar el nombre del tributo según el tipo de afectación
 func obtenerNombreTributo(tipoAfectacionIGV string) string {
 	switch tipoAfectacionIGV {
-	case "10", "11", "12", "13", "14", "15", "16", "17": // Gravado
+	case "10", "11", "12", "13", "14", "15", "16": // Gravado
 		return "IGV"
+	case "17": // Gravado - IVAP
+		return "IVAP"
 	case "20": // Exonerado
 		return "EXO"
 	case "21": // Exonerado - Transferencia gratuita
@@ -656,7 +906,7 @@ func crearPaymentTerms(f models.ComprobanteBase) []PaymentTerms {
 		{
 			ID:             "FormaPago",
 			PaymentMeansID: f.FormaPago,
-			Amount:         floatPtrAmount(f.TotalImportePagar, f.Moneda),
+			Amount:         floatPtrAmount(f.MontoNetoPendiente(), f.Moneda), // Neto de retención, si la hay
 		},
 	}
 
@@ -683,24 +933,128 @@ func newAmount(value float64, currency string) AmountWithCurrency {
 	return AmountWithCurrency{Value: value, CurrencyID: currency}
 }
 
-func newTaxCategory(item models.ItemComprobante) TaxCategory {
-	var percent float64
+// crearTaxTotalLinea genera el único cac:TaxTotal de la línea: el subtotal del ISC si lo
+// tiene, el de su afectación (cuya base incluye el ISC) y, si la línea incluye bolsas
+// plásticas, el del ICBPER
+func crearTaxTotalLinea(item models.ItemComprobante, moneda string) TaxTotal {
+	var subtotales []TaxSubtotal
+	if item.MontoISC > 0 {
+		subtotales = append(subtotales, TaxSubtotal{
+			TaxableAmount: floatPtrAmount(item.ValorTotal, moneda),
+			TaxAmount:     newAmount(item.MontoISC, moneda),
+			TaxCategory:   newTaxCategoryISC(floatPtr(item.PorcentajeISC), item.TipoSistemaISC),
+		})
+	}
+	subtotales = append(subtotales, TaxSubtotal{
+		TaxableAmount: floatPtrAmount(item.BaseIGV(), moneda),
+		TaxAmount:     newAmount(item.IGV, moneda),
+		TaxCategory:   newTaxCategory(item),
+	})
+	if item.CantidadBolsas > 0 {
+		factor := item.FactorICBPER
+		if factor == 0 {
+			factor = round(item.ICBPER / item.CantidadBolsas)
+		}
+		subtotales = append(subtotales, TaxSubtotal{
+			TaxAmount: newAmount(item.ICBPER, moneda),
+			BaseUnitMeasure: &BaseUnitMeasure{
+				Value:    item.CantidadBolsas,
+				UnitCode: "NIU",
+			},
+			TaxCategory: newTaxCategoryICBPER(floatPtrAmount(factor, moneda)),
+		})
+	}
+	return TaxTotal{
+		TaxAmount:   newAmount(round(item.MontoISC+item.IGV+item.ICBPER), moneda),
+		TaxSubtotal: subtotales,
+	}
+}
 
-	switch item.TipoAfectacionIGV {
-	case "10", "11", "12", "13", "14", "15", "16":
-		percent = 18.00
-	default:
-		percent = 0.00
+// subtotalesISC consolida el ISC de las líneas; la base es el valor de venta de las líneas con ISC
+func subtotalesISC(f models.ComprobanteBase) []TaxSubtotal {
+	var base float64
+	for _, item := range f.Items {
+		if item.MontoISC > 0 {
+			base += item.ValorTotal
+		}
+	}
+	total := f.SumaISC()
+	if total == 0 {
+		return nil
+	}
+	return []TaxSubtotal{{
+		TaxableAmount: floatPtrAmount(round(base), f.Moneda),
+		TaxAmount:     newAmount(total, f.Moneda),
+		TaxCategory:   newTaxCategoryISC(nil, ""),
+	}}
+}
+
+// newTaxCategoryISC categoría del ISC (2000); la tasa y el sistema de cálculo solo se informan en la línea
+func newTaxCategoryISC(porcentaje *float64, sistema string) TaxCategory {
+	categoria := TaxCategory{
+		Percent:   porcentaje,
+		TierRange: sistema,
+		TaxScheme: TaxScheme{
+			ID: TaxSchemeID{
+				Value:            catalogos.CodigoTributoISC,
+				SchemeID:         "UN/ECE 5153",
+				SchemeAgencyName: "PE:SUNAT",
+			},
+			Name:        "ISC",
+			TaxTypeCode: "EXC",
+		},
+	}
+	if porcentaje != nil {
+		categoria.ID = &TaxCategoryID{
+			Value:            "S",
+			SchemeID:         "UN/ECE 5305",
+			SchemeName:       "Tax Category Identifier",
+			SchemeAgencyName: "United Nations Economic Commission for Europe",
+		}
+	}
+	return categoria
+}
+
+// subtotalesICBPER consolida el impuesto a las bolsas plásticas de todas las líneas
+func subtotalesICBPER(f models.ComprobanteBase) []TaxSubtotal {
+	total := f.SumaICBPER()
+	if total == 0 {
+		return nil
+	}
+	return []TaxSubtotal{{
+		TaxAmount:   newAmount(total, f.Moneda),
+		TaxCategory: newTaxCategoryICBPER(nil),
+	}}
+}
+
+// newTaxCategoryICBPER categoría del ICBPER (7152); el monto por bolsa solo se informa en la línea
+func newTaxCategoryICBPER(montoUnitario *AmountWithCurrency) TaxCategory {
+	return TaxCategory{
+		PerUnitAmount: montoUnitario,
+		TaxScheme: TaxScheme{
+			ID: TaxSchemeID{
+				Value:            catalogos.CodigoTributoICBPER,
+				SchemeID:         "UN/ECE 5153",
+				SchemeAgencyName: "PE:SUNAT",
+			},
+			Name:        "ICBPER",
+			TaxTypeCode: "OTH",
+		},
 	}
+}
+
+func newTaxCategory(item models.ItemComprobante) TaxCategory {
+	// 18% para gravados con IGV (10-16), 4% para IVAP (17), 0% para las demás afectaciones
+	percent := catalogos.TasaAfectacion(item.TipoAfectacionIGV)
 	return TaxCategory{
-		ID: TaxCategoryID{
+		ID: &TaxCategoryID{
 			Value:            obtenerCodigoCategoriaTributo(item.TipoAfectacionIGV),
 			SchemeID:         "UN/ECE 5305",
 			SchemeName:       "Tax Category Identifier",
 			SchemeAgencyName: "United Nations Economic Commission for Europe",
 		},
 		Percent: floatPtr(percent),
-		TaxExemptionReasonCode: TaxExemptionReasonCode{
+		TaxExemptionReasonCode: &TaxExemptionReasonCode{
 			Value:          item.TipoAfectacionIGV,
 			ListAgencyName: "PE:SUNAT",
 			ListName:       "Afectacion del IGV",
@@ -718,31 +1072,24 @@ func newTaxCategory(item models.ItemComprobante) TaxCategory {
 	}
 }
 
+// crearPercepcion genera la extensión de percepción. La base es el precio de venta
+// incluido IGV (TotalPrecioVenta); el total cobrado es el importe a pagar más la percepción.
 func crearPercepcion(f models.ComprobanteBase) *UBLExtension {
 	if f.TipoDocumento != "01" {
 		return nil
 	}
-	var percent float64
-	switch f.TipoPercepcion {
-	case "01":
-		percent = 2.00
-	case "02":
-		percent = 1.00
-	case "03":
-		percent = 0.50
-	default:
+	percepcionMonto, ok := catalogos.MontoPercepcion(f.TipoPercepcion, f.TotalPrecioVenta)
+	if !ok {
 		return nil
 	}
-
-	percepcionMonto := round(f.TotalImportePagar * (percent / 100))
 	totalConPercepcion := round(f.TotalImportePagar + percepcionMonto)
 
 	return &UBLExtension{
 	ExtensionContent: ExtensionContent{
 		SUNATPerception: &SUNATPerception{
 			SystemCode:         f.TipoPercepcion,
-			Percent:            percent,
-			TotalInvoiceAmount: newAmount(f.TotalImportePagar, f.Moneda),
+			Percent:            catalogos.PorcentajesPercepcionCatalogo22[f.TipoPercepcion],
+			TotalInvoiceAmount: newAmount(f.TotalPrecioVenta, f.Moneda),
 			PerceptionAmount:   newAmount(percepcionMonto, f.Moneda),
 			PerceptionDate:     f.FechaEmision,
 			NetTotalPaid:       newAmount(totalConPercepcion, f.Moneda),
@@ -750,6 +1097,7 @@ func crearPercepcion(f models.ComprobanteBase) *UBLExtension {
 	},
 }
 }
+// round redondea al céntimo; la lógica de redondeo está centralizada en models
 func round(val float64) float64 {
-	return math.Round(val*100) / 100
+	return models.RedondearCentimo(val)
 }
@@ -0,0 +1,86 @@
+package converters
+
+import (
+	"testing"
+
+	"ubl-go-conversor/models"
+)
+
+// TestNewTaxCategoryTasaPorAfectacion verifica la tasa y el tributo de cada afectación
+// gravada: 18% de IGV (1000) para 10-16 y 4% de IVAP (1016) para 17
+func TestNewTaxCategoryTasaPorAfectacion(t *testing.T) {
+	casos := []struct {
+		afectacion string
+		tasa       float64
+		tributo    string
+		nombre     string
+	}{
+		{"10", 18, "1000", "IGV"},
+		{"11", 18, "1000", "IGV"},
+		{"12", 18, "1000", "IGV"},
+		{"13", 18, "1000", "IGV"},
+		{"14", 18, "1000", "IGV"},
+		{"15", 18, "1000", "IGV"},
+		{"16", 18, "1000", "IGV"},
+		{"17", 4, "1016", "IVAP"},
+	}
+
+	for _, c := range casos {
+		t.Run(c.afectacion, func(t *testing.T) {
+			categoria := newTaxCategory(models.ItemComprobante{TipoAfectacionIGV: c.afectacion})
+			if categoria.Percent == nil || *categoria.Percent != c.tasa {
+				t.Errorf("tasa: esperado %.0f, obtenido %v", c.tasa, categoria.Percent)
+			}
+			if categoria.TaxScheme.ID.Value != c.tributo {
+				t.Errorf("código de tributo: esperado %s, obtenido %s", c.tributo, categoria.TaxScheme.ID.Value)
+			}
+			if categoria.TaxScheme.Name != c.nombre {
+				t.Errorf("nombre de tributo: esperado %s, obtenido %s", c.nombre, categoria.TaxScheme.Name)
+			}
+			if categoria.ID == nil || categoria.ID.Value != "S" {
+				t.Errorf("categoría: esperado S, obtenido %v", categoria.ID)
+			}
+		})
+	}
+}
+
+// TestSubtotalesIGVUnoPorEsquema verifica que afectaciones distintas del mismo esquema
+// tributario (10 y 11 en 1000, 30 y 31 en 9998) se consoliden en un único subtotal
+func TestSubtotalesIGVUnoPorEsquema(t *testing.T) {
+	f := models.ComprobanteBase{
+		Moneda: "PEN",
+		Items: []models.ItemComprobante{
+			{TipoAfectacionIGV: "10", ValorTotal: 100, IGV: 18},
+			{TipoAfectacionIGV: "11", ValorTotal: 50, IGV: 9},
+			{TipoAfectacionIGV: "30", ValorTotal: 20},
+			{TipoAfectacionIGV: "31", ValorTotal: 10},
+			{TipoAfectacionIGV: "17", ValorTotal: 200, IGV: 8},
+		},
+	}
+
+	esperados := map[string]struct{ base, impuesto float64 }{
+		"1000": {150, 27},
+		"1016": {200, 8},
+		"9998": {30, 0},
+	}
+	subtotales := subtotalesIGV(f)
+	if len(subtotales) != len(esperados) {
+		t.Fatalf("esperado %d subtotales, obtenido %d", len(esperados), len(subtotales))
+	}
+	for _, s := range subtotales {
+		esquema := s.TaxCategory.TaxScheme.ID.Value
+		e, ok := esperados[esquema]
+		if !ok {
+			t.Errorf("esquema inesperado %s", esquema)
+			continue
+		}
+		delete(esperados, esquema)
+		if s.TaxableAmount.Value != e.base || s.TaxAmount.Value != e.impuesto {
+			t.Errorf("esquema %s: esperado base %.2f e impuesto %.2f, obtenido %.2f y %.2f",
+				esquema, e.base, e.impuesto, s.TaxableAmount.Value, s.TaxAmount.Value)
+		}
+	}
+	for esquema := range esperados {
+		t.Errorf("falta el subtotal del esquema %s", esquema)
+	}
+}
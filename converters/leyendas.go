@@ -0,0 +1,187 @@
+// Archivo: converters/leyendas.go
+package converters
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"ubl-go-conversor/catalogos"
+	"ubl-go-conversor/models"
+)
+
+/*
+NormalizarLeyendas deja las leyendas listas para el XML:
+- Elimina leyendas repetidas por código (se conserva la primera)
+- Garantiza que la leyenda 1000 (monto en letras) esté presente exactamente una vez,
+  generándola a partir del importe total si el cliente no la envió
+- Agrega las demás leyendas obligatorias que falten (ver leyendasObligatorias)
+
+Es idempotente, por lo que puede aplicarse antes de generar el PDF y nuevamente al convertir.
+*/
+func NormalizarLeyendas(f models.ComprobanteBase) []models.Leyenda {
+	leyendas := []models.Leyenda{}
+	vistos := map[string]bool{}
+	for _, leyenda := range f.Leyendas {
+		codigo := strings.TrimSpace(leyenda.Codigo)
+		if vistos[codigo] {
+			continue
+		}
+		vistos[codigo] = true
+		leyendas = append(leyendas, models.Leyenda{Codigo: codigo, Descripcion: leyenda.Descripcion})
+	}
+
+	if !vistos[catalogos.LeyendaMontoEnLetras] {
+		// La leyenda de monto en letras va primero, como en los ejemplos de SUNAT
+		leyendas = append([]models.Leyenda{{
+			Codigo:      catalogos.LeyendaMontoEnLetras,
+			Descripcion: MontoEnLetras(f.TotalImportePagar, f.Moneda),
+		}}, leyendas...)
+	}
+
+	for _, codigo := range leyendasObligatorias(f) {
+		if !vistos[codigo] {
+			vistos[codigo] = true
+			leyendas = append(leyendas, models.Leyenda{
+				Codigo:      codigo,
+				Descripcion: strings.ToUpper(catalogos.LeyendasCatalogo52[codigo]),
+			})
+		}
+	}
+
+	return leyendas
+}
+
+// leyendasObligatorias retorna los códigos de leyenda (además de la 1000) que SUNAT exige
+// según el contenido del comprobante: gratuitas, percepción y detracción
+func leyendasObligatorias(f models.ComprobanteBase) []string {
+	var codigos []string
+	for _, item := range f.Items {
+		if item.TipoAfectacionIGV == "21" {
+			codigos = append(codigos, catalogos.LeyendaGratuita)
+			break
+		}
+	}
+	if _, ok := catalogos.MontoPercepcion(f.TipoPercepcion, f.TotalPrecioVenta); ok && f.TipoDocumento == "01" {
+		codigos = append(codigos, catalogos.LeyendaPercepcion)
+	}
+	if catalogos.EsOperacionDetraccion(f.TipoOperacion) {
+		codigos = append(codigos, catalogos.LeyendaDetraccion)
+	}
+	return codigos
+}
+
+// CombinarLeyendas agrega al comprobante las leyendas de la plantilla del emisor.
+// Las leyendas enviadas en el documento tienen prioridad: una leyenda de la plantilla
+// se omite si el documento ya trae una con el mismo código.
+func CombinarLeyendas(propias, plantilla []models.Leyenda) []models.Leyenda {
+	presentes := map[string]bool{}
+	for _, leyenda := range propias {
+		presentes[strings.TrimSpace(leyenda.Codigo)] = true
+	}
+
+	leyendas := append([]models.Leyenda{}, propias...)
+	for _, leyenda := range plantilla {
+		if presentes[leyenda.Codigo] {
+			continue
+		}
+		presentes[leyenda.Codigo] = true
+		leyendas = append(leyendas, leyenda)
+	}
+	return leyendas
+}
+
+// MontoEnLetras expresa un importe en el formato de la leyenda 1000.
+// Ejemplo: 118.50 PEN -> "SON CIENTO DIECIOCHO CON 50/100 SOLES"
+func MontoEnLetras(monto float64, moneda string) string {
+	centimos := int64(math.Round(math.Abs(monto) * 100))
+	entero := centimos / 100
+
+	letras := "CERO"
+	if entero > 0 {
+		letras = enteroEnLetras(entero)
+	}
+
+	return fmt.Sprintf("SON %s CON %02d/100 %s", letras, centimos%100, nombreMoneda(moneda))
+}
+
+func nombreMoneda(moneda string) string {
+	switch moneda {
+	case "USD":
+		return "DÓLARES AMERICANOS"
+	case "EUR":
+		return "EUROS"
+	default:
+		return "SOLES"
+	}
+}
+
+var (
+	unidadesLetras = []string{"", "UNO", "DOS", "TRES", "CUATRO", "CINCO", "SEIS", "SIETE", "OCHO", "NUEVE",
+		"DIEZ", "ONCE", "DOCE", "TRECE", "CATORCE", "QUINCE", "DIECISÉIS", "DIECISIETE", "DIECIOCHO", "DIECINUEVE",
+		"VEINTE", "VEINTIUNO", "VEINTIDÓS", "VEINTITRÉS", "VEINTICUATRO", "VEINTICINCO", "VEINTISÉIS", "VEINTISIETE", "VEINTIOCHO", "VEINTINUEVE"}
+	decenasLetras  = []string{"", "", "", "TREINTA", "CUARENTA", "CINCUENTA", "SESENTA", "SETENTA", "OCHENTA", "NOVENTA"}
+	centenasLetras = []string{"", "CIENTO", "DOSCIENTOS", "TRESCIENTOS", "CUATROCIENTOS", "QUINIENTOS", "SEISCIENTOS", "SETECIENTOS", "OCHOCIENTOS", "NOVECIENTOS"}
+)
+
+// enteroEnLetras convierte un entero positivo (hasta miles de millones) a letras
+func enteroEnLetras(n int64) string {
+	var partes []string
+
+	if millones := n / 1000000; millones > 0 {
+		if millones == 1 {
+			partes = append(partes, "UN MILLÓN")
+		} else {
+			partes = append(partes, apocopar(enteroEnLetras(millones))+" MILLONES")
+		}
+	}
+
+	if miles := (n / 1000) % 1000; miles > 0 {
+		if miles == 1 {
+			partes = append(partes, "MIL")
+		} else {
+			partes = append(partes, apocopar(centenasEnLetras(int(miles)))+" MIL")
+		}
+	}
+
+	if resto := n % 1000; resto > 0 {
+		partes = append(partes, centenasEnLetras(int(resto)))
+	}
+
+	return strings.Join(partes, " ")
+}
+
+// centenasEnLetras convierte un número entre 1 y 999
+func centenasEnLetras(n int) string {
+	if n == 100 {
+		return "CIEN"
+	}
+
+	var partes []string
+	if c := n / 100; c > 0 {
+		partes = append(partes, centenasLetras[c])
+	}
+
+	switch resto := n % 100; {
+	case resto == 0:
+	case resto < 30:
+		partes = append(partes, unidadesLetras[resto])
+	case resto%10 == 0:
+		partes = append(partes, decenasLetras[resto/10])
+	default:
+		partes = append(partes, decenasLetras[resto/10]+" Y "+unidadesLetras[resto%10])
+	}
+
+	return strings.Join(partes, " ")
+}
+
+// apocopar ajusta "UNO" a "UN" delante de MIL/MILLONES (ej: VEINTIÚN MIL)
+func apocopar(letras string) string {
+	switch {
+	case strings.HasSuffix(letras, "VEINTIUNO"):
+		return strings.TrimSuffix(letras, "VEINTIUNO") + "VEINTIÚN"
+	case strings.HasSuffix(letras, "UNO"):
+		return strings.TrimSuffix(letras, "UNO") + "UN"
+	}
+	return letras
+}
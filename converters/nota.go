@@ -0,0 +1,284 @@
+/*
+Conversor de Notas de Crédito (07) y Débito (08) a XML UBL 2.1
+=============================================================
+
+Las notas reutilizan el emisor, cliente, cargos y descuentos globales, tributos,
+totales y líneas de la factura, y agregan los elementos propios de una nota:
+- cac:DiscrepancyResponse: comprobante afectado, tipo de nota (catálogo 09/10) y sustento
+- cac:BillingReference: comprobante afectado y su tipo (catálogo 01)
+
+La nota de débito informa sus totales en cac:RequestedMonetaryTotal en lugar de
+cac:LegalMonetaryTotal, y las líneas usan CreditedQuantity / DebitedQuantity.
+*/
+package converters
+
+import (
+	"encoding/xml"
+
+	"ubl-go-conversor/models"
+)
+
+// CreditNote representa la estructura raíz UBL 2.1 de la nota de crédito
+type CreditNote struct {
+	XMLName   xml.Name `xml:"CreditNote"`
+	XmlnsCac  string   `xml:"xmlns:cac,attr"`
+	XmlnsCbc  string   `xml:"xmlns:cbc,attr"`
+	XmlnsCcts string   `xml:"xmlns:ccts,attr"`
+	XmlnsDs   string   `xml:"xmlns:ds,attr"`
+	XmlnsExt  string   `xml:"xmlns:ext,attr"`
+	XmlnsQdt  string   `xml:"xmlns:qdt,attr"`
+	XmlnsSac  string   `xml:"xmlns:sac,attr"`
+	XmlnsUdt  string   `xml:"xmlns:udt,attr"`
+	Xmlns     string   `xml:"xmlns,attr"`
+
+	UBLExtensions        UBLExtensions        `xml:"ext:UBLExtensions"`
+	UBLVersionID         string               `xml:"cbc:UBLVersionID"`
+	CustomizationID      CustomizationID      `xml:"cbc:CustomizationID"`
+	ID                   string               `xml:"cbc:ID"`
+	IssueDate            string               `xml:"cbc:IssueDate"`
+	IssueTime            string               `xml:"cbc:IssueTime"`
+	Notes                []Note               `xml:"cbc:Note,omitempty"`
+	DocumentCurrencyCode DocumentCurrencyCode `xml:"cbc:DocumentCurrencyCode"`
+
+	DiscrepancyResponse DiscrepancyResponse `xml:"cac:DiscrepancyResponse"` // Motivo de la nota
+	BillingReference    BillingReference    `xml:"cac:BillingReference"`    // Comprobante afectado
+
+	Signature               Signature               `xml:"cac:Signature"`
+	AccountingSupplierParty AccountingSupplierParty `xml:"cac:AccountingSupplierParty"`
+	AccountingCustomerParty AccountingCustomerParty `xml:"cac:AccountingCustomerParty"`
+	AllowanceCharges        []AllowanceCharge       `xml:"cac:AllowanceCharge,omitempty"` // Cargos y descuentos globales (catálogo 53)
+	TaxTotal                []TaxTotal              `xml:"cac:TaxTotal"`
+	LegalMonetaryTotal      LegalMonetaryTotal      `xml:"cac:LegalMonetaryTotal"`
+	CreditNoteLines         []CreditNoteLine        `xml:"cac:CreditNoteLine"`
+}
+
+// DebitNote representa la estructura raíz UBL 2.1 de la nota de débito
+type DebitNote struct {
+	XMLName   xml.Name `xml:"DebitNote"`
+	XmlnsCac  string   `xml:"xmlns:cac,attr"`
+	XmlnsCbc  string   `xml:"xmlns:cbc,attr"`
+	XmlnsCcts string   `xml:"xmlns:ccts,attr"`
+	XmlnsDs   string   `xml:"xmlns:ds,attr"`
+	XmlnsExt  string   `xml:"xmlns:ext,attr"`
+	XmlnsQdt  string   `xml:"xmlns:qdt,attr"`
+	XmlnsSac  string   `xml:"xmlns:sac,attr"`
+	XmlnsUdt  string   `xml:"xmlns:udt,attr"`
+	Xmlns     string   `xml:"xmlns,attr"`
+
+	UBLExtensions        UBLExtensions        `xml:"ext:UBLExtensions"`
+	UBLVersionID         string               `xml:"cbc:UBLVersionID"`
+	CustomizationID      CustomizationID      `xml:"cbc:CustomizationID"`
+	ID                   string               `xml:"cbc:ID"`
+	IssueDate            string               `xml:"cbc:IssueDate"`
+	IssueTime            string               `xml:"cbc:IssueTime"`
+	Notes                []Note               `xml:"cbc:Note,omitempty"`
+	DocumentCurrencyCode DocumentCurrencyCode `xml:"cbc:DocumentCurrencyCode"`
+
+	DiscrepancyResponse DiscrepancyResponse `xml:"cac:DiscrepancyResponse"`
+	BillingReference    BillingReference    `xml:"cac:BillingReference"`
+
+	Signature               Signature               `xml:"cac:Signature"`
+	AccountingSupplierParty AccountingSupplierParty `xml:"cac:AccountingSupplierParty"`
+	AccountingCustomerParty AccountingCustomerParty `xml:"cac:AccountingCustomerParty"`
+	AllowanceCharges        []AllowanceCharge       `xml:"cac:AllowanceCharge,omitempty"` // Cargos y descuentos globales (catálogo 53)
+	TaxTotal                []TaxTotal              `xml:"cac:TaxTotal"`
+	RequestedMonetaryTotal  LegalMonetaryTotal      `xml:"cac:RequestedMonetaryTotal"`
+	DebitNoteLines          []DebitNoteLine         `xml:"cac:DebitNoteLine"`
+}
+
+// DiscrepancyResponse indica el comprobante afectado, el tipo de nota y su sustento
+type DiscrepancyResponse struct {
+	ReferenceID  string       `xml:"cbc:ReferenceID"`  // Serie-número del comprobante afectado
+	ResponseCode ResponseCode `xml:"cbc:ResponseCode"` // Tipo de nota (catálogo 09/10)
+	Description  CDATAString  `xml:"cbc:Description"`  // Sustento de la nota
+}
+
+type ResponseCode struct {
+	Value          string `xml:",chardata"`
+	ListAgencyName string `xml:"listAgencyName,attr"`
+	ListName       string `xml:"listName,attr"`
+	ListURI        string `xml:"listURI,attr"`
+}
+
+type BillingReference struct {
+	InvoiceDocumentReference DocumentReference `xml:"cac:InvoiceDocumentReference"`
+}
+
+type DocumentReference struct {
+	ID               string           `xml:"cbc:ID"`
+	DocumentTypeCode DocumentTypeCode `xml:"cbc:DocumentTypeCode"`
+}
+
+type DocumentTypeCode struct {
+	Value          string `xml:",chardata"`
+	ListAgencyName string `xml:"listAgencyName,attr"`
+	ListName       string `xml:"listName,attr"`
+	ListURI        string `xml:"listURI,attr"`
+}
+
+// CreditNoteLine es la línea de la nota de crédito; igual a InvoiceLine salvo la cantidad
+type CreditNoteLine struct {
+	ID                  string             `xml:"cbc:ID"`
+	CreditedQuantity    InvoicedQuantity   `xml:"cbc:CreditedQuantity"`
+	LineExtensionAmount AmountWithCurrency `xml:"cbc:LineExtensionAmount"`
+	PricingReference    PricingReference   `xml:"cac:PricingReference"`
+	AllowanceCharges    []AllowanceCharge  `xml:"cac:AllowanceCharge,omitempty"` // Descuentos del ítem (catálogo 53)
+	TaxTotal            TaxTotal           `xml:"cac:TaxTotal"`
+	Item                Item               `xml:"cac:Item"`
+	Price               Price              `xml:"cac:Price"`
+}
+
+// DebitNoteLine es la línea de la nota de débito; igual a InvoiceLine salvo la cantidad
+type DebitNoteLine struct {
+	ID                  string             `xml:"cbc:ID"`
+	DebitedQuantity     InvoicedQuantity   `xml:"cbc:DebitedQuantity"`
+	LineExtensionAmount AmountWithCurrency `xml:"cbc:LineExtensionAmount"`
+	PricingReference    PricingReference   `xml:"cac:PricingReference"`
+	AllowanceCharges    []AllowanceCharge  `xml:"cac:AllowanceCharge,omitempty"` // Descuentos del ítem (catálogo 53)
+	TaxTotal            TaxTotal           `xml:"cac:TaxTotal"`
+	Item                Item               `xml:"cac:Item"`
+	Price               Price              `xml:"cac:Price"`
+}
+
+// ConvertirNotaCreditoAUBL transforma una nota de crédito (07) a su estructura UBL
+func ConvertirNotaCreditoAUBL(f models.ComprobanteBase) CreditNote {
+	var lineas []CreditNoteLine
+	for _, linea := range crearLineas(f.Items, f.Moneda) {
+		lineas = append(lineas, CreditNoteLine{
+			ID:                  linea.ID,
+			CreditedQuantity:    linea.InvoicedQuantity,
+			LineExtensionAmount: linea.LineExtensionAmount,
+			PricingReference:    linea.PricingReference,
+			AllowanceCharges:    linea.AllowanceCharges,
+			TaxTotal:            linea.TaxTotal,
+			Item:                linea.Item,
+			Price:               linea.Price,
+		})
+	}
+
+	return CreditNote{
+		XmlnsCac:  "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2",
+		XmlnsCbc:  "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2",
+		XmlnsCcts: "urn:un:unece:uncefact:documentation:2",
+		XmlnsDs:   "http://www.w3.org/2000/09/xmldsig#",
+		XmlnsExt:  "urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2",
+		XmlnsQdt:  "urn:oasis:names:specification:ubl:schema:xsd:QualifiedDatatypes-2",
+		XmlnsSac:  "urn:sunat:names:specification:ubl:peru:schema:xsd:SunatAggregateComponents-1",
+		XmlnsUdt:  "urn:un:unece:uncefact:data:specification:UnqualifiedDataTypesSchemaModule:2",
+		Xmlns:     "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2",
+
+		UBLExtensions:           crearExtensionesNota(),
+		UBLVersionID:            "2.1",
+		CustomizationID:         CustomizationID{Value: "2.0", SchemeAgencyName: "PE:SUNAT"},
+		ID:                      models.FormatearIDComprobante(f.Serie, f.Numero),
+		IssueDate:               f.FechaEmision,
+		IssueTime:               f.HoraEmision,
+		Notes:                   crearNotasLeyenda(f),
+		DocumentCurrencyCode:    crearCurrencyCode(f.Moneda),
+		DiscrepancyResponse:     crearDiscrepancyResponse(f, "Tipo de nota de credito", "catalogo09"),
+		BillingReference:        crearBillingReference(f),
+		Signature:               crearFirma(f),
+		AccountingSupplierParty: crearEmisor(f.Emisor),
+		AccountingCustomerParty: crearCliente(f.Cliente),
+		AllowanceCharges:        crearAllowanceCharges(f),
+		TaxTotal:                crearTaxTotals(f),
+		LegalMonetaryTotal:      crearTotalesMonetarios(f),
+		CreditNoteLines:         lineas,
+	}
+}
+
+// ConvertirNotaDebitoAUBL transforma una nota de débito (08) a su estructura UBL
+func ConvertirNotaDebitoAUBL(f models.ComprobanteBase) DebitNote {
+	var lineas []DebitNoteLine
+	for _, linea := range crearLineas(f.Items, f.Moneda) {
+		lineas = append(lineas, DebitNoteLine{
+			ID:                  linea.ID,
+			DebitedQuantity:     linea.InvoicedQuantity,
+			LineExtensionAmount: linea.LineExtensionAmount,
+			PricingReference:    linea.PricingReference,
+			AllowanceCharges:    linea.AllowanceCharges,
+			TaxTotal:            linea.TaxTotal,
+			Item:                linea.Item,
+			Price:               linea.Price,
+		})
+	}
+
+	return DebitNote{
+		XmlnsCac:  "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2",
+		XmlnsCbc:  "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2",
+		XmlnsCcts: "urn:un:unece:uncefact:documentation:2",
+		XmlnsDs:   "http://www.w3.org/2000/09/xmldsig#",
+		XmlnsExt:  "urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2",
+		XmlnsQdt:  "urn:oasis:names:specification:ubl:schema:xsd:QualifiedDatatypes-2",
+		XmlnsSac:  "urn:sunat:names:specification:ubl:peru:schema:xsd:SunatAggregateComponents-1",
+		XmlnsUdt:  "urn:un:unece:uncefact:data:specification:UnqualifiedDataTypesSchemaModule:2",
+		Xmlns:     "urn:oasis:names:specification:ubl:schema:xsd:DebitNote-2",
+
+		UBLExtensions:           crearExtensionesNota(),
+		UBLVersionID:            "2.1",
+		CustomizationID:         CustomizationID{Value: "2.0", SchemeAgencyName: "PE:SUNAT"},
+		ID:                      models.FormatearIDComprobante(f.Serie, f.Numero),
+		IssueDate:               f.FechaEmision,
+		IssueTime:               f.HoraEmision,
+		Notes:                   crearNotasLeyenda(f),
+		DocumentCurrencyCode:    crearCurrencyCode(f.Moneda),
+		DiscrepancyResponse:     crearDiscrepancyResponse(f, "Tipo de nota de debito", "catalogo10"),
+		BillingReference:        crearBillingReference(f),
+		Signature:               crearFirma(f),
+		AccountingSupplierParty: crearEmisor(f.Emisor),
+		AccountingCustomerParty: crearCliente(f.Cliente),
+		AllowanceCharges:        crearAllowanceCharges(f),
+		TaxTotal:                crearTaxTotals(f),
+		RequestedMonetaryTotal:  crearTotalesMonetarios(f),
+		DebitNoteLines:          lineas,
+	}
+}
+
+// crearExtensionesNota retorna la extensión vacía donde se inserta la firma digital
+func crearExtensionesNota() UBLExtensions {
+	return UBLExtensions{UBLExtension: []UBLExtension{{ExtensionContent: ExtensionContent{}}}}
+}
+
+// crearNotasLeyenda convierte las leyendas normalizadas a elementos cbc:Note
+func crearNotasLeyenda(f models.ComprobanteBase) []Note {
+	notes := []Note{}
+	for _, leyenda := range NormalizarLeyendas(f) {
+		notes = append(notes, Note{Value: leyenda.Descripcion, LanguageLocaleID: leyenda.Codigo})
+	}
+	return notes
+}
+
+// crearDiscrepancyResponse mapea el motivo de la nota: ResponseCode es el código del
+// catálogo 09 (crédito) o 10 (débito) y Description el sustento enviado por el cliente
+func crearDiscrepancyResponse(f models.ComprobanteBase, listName, catalogo string) DiscrepancyResponse {
+	respuesta := DiscrepancyResponse{
+		ResponseCode: ResponseCode{
+			Value:          f.CodigoMotivo,
+			ListAgencyName: "PE:SUNAT",
+			ListName:       listName,
+			ListURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:" + catalogo,
+		},
+		Description: CDATAString{Value: f.DescripcionMotivo},
+	}
+	if f.DocumentoAfectado != nil {
+		respuesta.ReferenceID = models.FormatearIDComprobante(f.DocumentoAfectado.Serie, f.DocumentoAfectado.Numero)
+	}
+	return respuesta
+}
+
+// crearBillingReference identifica el comprobante afectado y su tipo (catálogo 01)
+func crearBillingReference(f models.ComprobanteBase) BillingReference {
+	var referencia BillingReference
+	if afectado := f.DocumentoAfectado; afectado != nil {
+		referencia.InvoiceDocumentReference = DocumentReference{
+			ID: models.FormatearIDComprobante(afectado.Serie, afectado.Numero),
+			DocumentTypeCode: DocumentTypeCode{
+				Value:          afectado.TipoDocumento,
+				ListAgencyName: "PE:SUNAT",
+				ListName:       "Tipo de Documento",
+				ListURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo01",
+			},
+		}
+	}
+	return referencia
+}
@@ -0,0 +1,40 @@
+package converters
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"ubl-go-conversor/models"
+)
+
+// TestNotasInformanCargosDescuentosGlobales verifica que las notas de crédito y débito
+// informen el cac:AllowanceCharge global (antes de cac:TaxTotal) que respalda el
+// AllowanceTotalAmount / ChargeTotalAmount de sus totales
+func TestNotasInformanCargosDescuentosGlobales(t *testing.T) {
+	f := facturaPrueba("EMPRESA SAC")
+	f.Serie = "FC01"
+	f.DocumentoAfectado = &models.DocumentoAfectado{TipoDocumento: "01", Serie: "F001", Numero: "1"}
+	f.CodigoMotivo = "01"
+	f.DescripcionMotivo = "Anulación de la operación"
+	f.Descuentos = []models.CargoDescuento{{Codigo: "03", Monto: 5}}
+	f.Cargos = []models.CargoDescuento{{Codigo: "48", Monto: 2}}
+
+	notas := map[string]interface{}{
+		"07": ConvertirNotaCreditoAUBL(f),
+		"08": ConvertirNotaDebitoAUBL(f),
+	}
+	for tipo, nota := range notas {
+		contenido, err := xml.Marshal(nota)
+		if err != nil {
+			t.Fatalf("nota %s: %v", tipo, err)
+		}
+		xmlNota := string(contenido)
+		if n := strings.Count(xmlNota, "<cac:AllowanceCharge>"); n != 2 {
+			t.Errorf("nota %s: esperado 2 cac:AllowanceCharge globales, obtenido %d", tipo, n)
+		}
+		if strings.Index(xmlNota, "<cac:AllowanceCharge>") > strings.Index(xmlNota, "<cac:TaxTotal>") {
+			t.Errorf("nota %s: cac:AllowanceCharge debe preceder a cac:TaxTotal", tipo)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+/*
+Conversor del Resumen Diario de Boletas (RC) a XML SummaryDocuments
+==================================================================
+
+Las boletas y sus notas no se envían una por una: se informan a SUNAT en un resumen
+diario (sendSummary), que responde con un ticket. Cada línea (sac:SummaryDocumentsLine)
+lleva el comprobante, la acción informada (catálogo 19: 1 adicionar, 2 modificar,
+3 anular), el importe total y los totales por tipo de operación (sac:BillingPayment).
+*/
+package converters
+
+import (
+	"encoding/xml"
+	"sort"
+
+	"ubl-go-conversor/catalogos"
+	"ubl-go-conversor/models"
+)
+
+// SummaryDocuments representa la estructura raíz del resumen diario (UBL 2.0)
+type SummaryDocuments struct {
+	XMLName  xml.Name `xml:"SummaryDocuments"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	XmlnsCac string   `xml:"xmlns:cac,attr"`
+	XmlnsCbc string   `xml:"xmlns:cbc,attr"`
+	XmlnsDs  string   `xml:"xmlns:ds,attr"`
+	XmlnsExt string   `xml:"xmlns:ext,attr"`
+	XmlnsSac string   `xml:"xmlns:sac,attr"`
+
+	UBLExtensions           UBLExtensions          `xml:"ext:UBLExtensions"`
+	UBLVersionID            string                 `xml:"cbc:UBLVersionID"`
+	CustomizationID         string                 `xml:"cbc:CustomizationID"`
+	ID                      string                 `xml:"cbc:ID"`            // RC-YYYYMMDD-NNN
+	ReferenceDate           string                 `xml:"cbc:ReferenceDate"` // Fecha de emisión de las boletas
+	IssueDate               string                 `xml:"cbc:IssueDate"`     // Fecha de generación del resumen
+	Signature               Signature              `xml:"cac:Signature"`
+	AccountingSupplierParty SummarySupplierParty   `xml:"cac:AccountingSupplierParty"`
+	Lines                   []SummaryDocumentsLine `xml:"sac:SummaryDocumentsLine"`
+}
+
+// SummarySupplierParty identifica al emisor con el esquema UBL 2.0 de los resúmenes
+type SummarySupplierParty struct {
+	CustomerAssignedAccountID string       `xml:"cbc:CustomerAssignedAccountID"`
+	AdditionalAccountID       string       `xml:"cbc:AdditionalAccountID"`
+	Party                     SummaryParty `xml:"cac:Party"`
+}
+
+type SummaryParty struct {
+	PartyLegalEntity SummaryLegalEntity `xml:"cac:PartyLegalEntity"`
+}
+
+type SummaryLegalEntity struct {
+	RegistrationName CDATAString `xml:"cbc:RegistrationName"`
+}
+
+// SummaryCustomerParty identifica al adquiriente de la boleta (documento y tipo)
+type SummaryCustomerParty struct {
+	CustomerAssignedAccountID string `xml:"cbc:CustomerAssignedAccountID"`
+	AdditionalAccountID       string `xml:"cbc:AdditionalAccountID"`
+}
+
+// SummaryDocumentsLine es un comprobante informado en el resumen
+type SummaryDocumentsLine struct {
+	LineID                  int                  `xml:"cbc:LineID"`
+	DocumentTypeCode        string               `xml:"cbc:DocumentTypeCode"`
+	ID                      string               `xml:"cbc:ID"`
+	AccountingCustomerParty SummaryCustomerParty `xml:"cac:AccountingCustomerParty"`
+	BillingReference        *BillingReference    `xml:"cac:BillingReference,omitempty"` // Solo notas
+	Status                  SummaryStatus        `xml:"cac:Status"`
+	TotalAmount             AmountWithCurrency   `xml:"sac:TotalAmount"`
+	BillingPayments         []BillingPayment     `xml:"sac:BillingPayment"`
+	TaxTotal                []SummaryTaxTotal    `xml:"cac:TaxTotal"`
+}
+
+type SummaryStatus struct {
+	ConditionCode string `xml:"cbc:ConditionCode"` // Catálogo 19
+}
+
+// BillingPayment total de un tipo de operación: 01 gravado, 02 exonerado, 03 inafecto,
+// 04 exportación, 05 gratuitas
+type BillingPayment struct {
+	PaidAmount    AmountWithCurrency `xml:"cbc:PaidAmount"`
+	InstructionID string             `xml:"cbc:InstructionID"`
+}
+
+type SummaryTaxTotal struct {
+	TaxAmount   AmountWithCurrency `xml:"cbc:TaxAmount"`
+	TaxSubtotal SummaryTaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+type SummaryTaxSubtotal struct {
+	TaxAmount   AmountWithCurrency `xml:"cbc:TaxAmount"`
+	TaxCategory SummaryTaxCategory `xml:"cac:TaxCategory"`
+}
+
+type SummaryTaxCategory struct {
+	TaxScheme TaxScheme `xml:"cac:TaxScheme"`
+}
+
+// ConvertirResumenAUBL transforma el resumen diario a su estructura SummaryDocuments.
+// id es el identificador RC-YYYYMMDD-NNN ya reservado.
+func ConvertirResumenAUBL(r models.ResumenDiario, id string) SummaryDocuments {
+	var lineas []SummaryDocumentsLine
+	for i, boleta := range r.Boletas {
+		lineas = append(lineas, crearLineaResumen(i+1, boleta))
+	}
+
+	return SummaryDocuments{
+		Xmlns:    "urn:sunat:names:specification:ubl:peru:schema:xsd:SummaryDocuments-1",
+		XmlnsCac: "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2",
+		XmlnsCbc: "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2",
+		XmlnsDs:  "http://www.w3.org/2000/09/xmldsig#",
+		XmlnsExt: "urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2",
+		XmlnsSac: "urn:sunat:names:specification:ubl:peru:schema:xsd:SunatAggregateComponents-1",
+
+		UBLExtensions:   crearExtensionesNota(),
+		UBLVersionID:    "2.0",
+		CustomizationID: "1.1",
+		ID:              id,
+		ReferenceDate:   r.FechaReferencia(),
+		IssueDate:       r.FechaGeneracion,
+		Signature: Signature{
+			ID: id,
+			SignatoryParty: SignatoryParty{
+				PartyIdentification: PartyIdentification{ID: IDWithScheme{Value: r.Emisor.RUC}},
+				PartyName:           PartyName{Name: CDATAString{Value: r.Emisor.RazonSocial}},
+			},
+			DigitalSignatureAttachment: DigitalSignatureAttachment{
+				ExternalReference: ExternalReference{URI: "#SignatureSP"},
+			},
+		},
+		AccountingSupplierParty: SummarySupplierParty{
+			CustomerAssignedAccountID: r.Emisor.RUC,
+			AdditionalAccountID:       "6",
+			Party: SummaryParty{
+				PartyLegalEntity: SummaryLegalEntity{RegistrationName: CDATAString{Value: r.Emisor.RazonSocial}},
+			},
+		},
+		Lines: lineas,
+	}
+}
+
+// crearLineaResumen mapea una boleta (o nota de boleta) a su línea del resumen
+func crearLineaResumen(numero int, boleta models.BoletaResumen) SummaryDocumentsLine {
+	f := boleta.Comprobante
+	linea := SummaryDocumentsLine{
+		LineID:           numero,
+		DocumentTypeCode: f.TipoDocumento,
+		ID:               models.FormatearIDComprobante(f.Serie, f.Numero),
+		AccountingCustomerParty: SummaryCustomerParty{
+			CustomerAssignedAccountID: f.Cliente.NumeroDoc,
+			AdditionalAccountID:       f.Cliente.TipoDoc,
+		},
+		Status:          SummaryStatus{ConditionCode: boleta.Estado},
+		TotalAmount:     newAmount(round(f.TotalImportePagar), f.Moneda),
+		BillingPayments: crearBillingPayments(f),
+		TaxTotal:        crearTaxTotalsResumen(f),
+	}
+	if f.TipoDocumento == "07" || f.TipoDocumento == "08" {
+		referencia := crearBillingReference(f)
+		linea.BillingReference = &referencia
+	}
+	return linea
+}
+
+// esquemasResumen son los tributos que se informan en el cac:TaxTotal de la línea del
+// resumen; las operaciones exoneradas, inafectas, de exportación y gratuitas solo van
+// en sac:BillingPayment
+var esquemasResumen = map[string]bool{
+	catalogos.CodigoTributoIGV:    true,
+	catalogos.CodigoTributoIVAP:   true,
+	catalogos.CodigoTributoISC:    true,
+	catalogos.CodigoTributoICBPER: true,
+}
+
+// crearTaxTotalsResumen arma un cac:TaxTotal por cada tributo de la boleta (IGV, IVAP,
+// ISC, ICBPER) con los mismos subtotales que el comprobante. El IGV siempre se
+// informa, aunque sea 0.
+func crearTaxTotalsResumen(f models.ComprobanteBase) []SummaryTaxTotal {
+	var subtotales []TaxSubtotal
+	for _, calcular := range calculadoresTributo {
+		subtotales = append(subtotales, calcular(f)...)
+	}
+
+	var totales []SummaryTaxTotal
+	conIGV := false
+	for _, s := range subtotales {
+		esquema := s.TaxCategory.TaxScheme
+		if !esquemasResumen[esquema.ID.Value] {
+			continue
+		}
+		conIGV = conIGV || esquema.ID.Value == catalogos.CodigoTributoIGV
+		totales = append(totales, newSummaryTaxTotal(s.TaxAmount.Value, f.Moneda, esquema.ID.Value, esquema.Name, esquema.TaxTypeCode))
+	}
+	if !conIGV {
+		totales = append([]SummaryTaxTotal{newSummaryTaxTotal(0, f.Moneda, catalogos.CodigoTributoIGV, "IGV", "VAT")}, totales...)
+	}
+	return totales
+}
+
+// newSummaryTaxTotal crea el cac:TaxTotal de un tributo en la línea del resumen
+func newSummaryTaxTotal(monto float64, moneda, codigo, nombre, tipo string) SummaryTaxTotal {
+	return SummaryTaxTotal{
+		TaxAmount: newAmount(round(monto), moneda),
+		TaxSubtotal: SummaryTaxSubtotal{
+			TaxAmount: newAmount(round(monto), moneda),
+			TaxCategory: SummaryTaxCategory{TaxScheme: TaxScheme{
+				ID:          TaxSchemeID{Value: codigo},
+				Name:        nombre,
+				TaxTypeCode: tipo,
+			}},
+		},
+	}
+}
+
+// crearBillingPayments agrupa el valor de venta de los ítems por tipo de operación,
+// en orden de código para que el XML no dependa del orden de los ítems
+func crearBillingPayments(f models.ComprobanteBase) []BillingPayment {
+	totales := map[string]float64{}
+	for _, item := range f.Items {
+		totales[instruccionResumen(item.TipoAfectacionIGV)] += item.ValorTotal
+	}
+
+	codigos := make([]string, 0, len(totales))
+	for codigo := range totales {
+		codigos = append(codigos, codigo)
+	}
+	sort.Strings(codigos)
+
+	var pagos []BillingPayment
+	for _, codigo := range codigos {
+		pagos = append(pagos, BillingPayment{
+			PaidAmount:    newAmount(round(totales[codigo]), f.Moneda),
+			InstructionID: codigo,
+		})
+	}
+	return pagos
+}
+
+// instruccionResumen retorna el tipo de operación del resumen según la afectación del IGV.
+// Las gratuitas (11-16, 21, 31-37) se informan como 05 antes de evaluar si son gravadas.
+func instruccionResumen(tipoAfectacionIGV string) string {
+	switch {
+	case catalogos.EsOperacionGratuita(tipoAfectacionIGV):
+		return "05"
+	case esGravado(tipoAfectacionIGV):
+		return "01"
+	case tipoAfectacionIGV == "20":
+		return "02"
+	case tipoAfectacionIGV == "40":
+		return "04"
+	default:
+		return "03"
+	}
+}
+
+// GenerarXMLResumen genera el XML SummaryDocuments del resumen diario
+func GenerarXMLResumen(r models.ResumenDiario, id, rutaArchivo string, opciones OpcionesXML) error {
+	return escribirXML(ConvertirResumenAUBL(r, id), rutaArchivo, opciones)
+}
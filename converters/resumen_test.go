@@ -0,0 +1,64 @@
+package converters
+
+import (
+	"testing"
+
+	"ubl-go-conversor/models"
+)
+
+// TestInstruccionResumen verifica el tipo de operación de cada afectación en el
+// resumen diario; las gratuitas se informan como 05 aunque sean gravadas o inafectas
+func TestInstruccionResumen(t *testing.T) {
+	casos := map[string]string{
+		"10": "01", "17": "01",
+		"20": "02",
+		"30": "03",
+		"40": "04",
+		"11": "05", "12": "05", "13": "05", "14": "05", "15": "05", "16": "05",
+		"21": "05",
+		"31": "05", "32": "05", "33": "05", "34": "05", "35": "05", "36": "05", "37": "05",
+	}
+	for afectacion, esperado := range casos {
+		if obtenido := instruccionResumen(afectacion); obtenido != esperado {
+			t.Errorf("afectación %s: esperado %s, obtenido %s", afectacion, esperado, obtenido)
+		}
+	}
+}
+
+// TestCrearTaxTotalsResumen verifica que la línea del resumen informe cada tributo de
+// la boleta (IGV, IVAP, ISC e ICBPER) y no solo el IGV
+func TestCrearTaxTotalsResumen(t *testing.T) {
+	f := models.ComprobanteBase{
+		Moneda: "PEN",
+		Items: []models.ItemComprobante{
+			{TipoAfectacionIGV: "10", ValorTotal: 100, MontoISC: 10, TipoSistemaISC: "01", IGV: 19.80},
+			{TipoAfectacionIGV: "17", ValorTotal: 50, IGV: 2},
+			{TipoAfectacionIGV: "10", ValorTotal: 0, CantidadBolsas: 2, ICBPER: 1},
+		},
+	}
+
+	esperados := map[string]float64{"1000": 19.80, "1016": 2, "2000": 10, "7152": 1}
+	totales := crearTaxTotalsResumen(f)
+	if len(totales) != len(esperados) {
+		t.Fatalf("esperado %d tributos, obtenido %d", len(esperados), len(totales))
+	}
+	for _, total := range totales {
+		codigo := total.TaxSubtotal.TaxCategory.TaxScheme.ID.Value
+		if monto, ok := esperados[codigo]; !ok || total.TaxAmount.Value != monto {
+			t.Errorf("tributo %s: esperado %.2f, obtenido %.2f", codigo, monto, total.TaxAmount.Value)
+		}
+	}
+}
+
+// TestCrearTaxTotalsResumenIGVCero verifica que el IGV se informe aunque la boleta
+// solo tenga operaciones exoneradas
+func TestCrearTaxTotalsResumenIGVCero(t *testing.T) {
+	f := models.ComprobanteBase{
+		Moneda: "PEN",
+		Items:  []models.ItemComprobante{{TipoAfectacionIGV: "20", ValorTotal: 100}},
+	}
+	totales := crearTaxTotalsResumen(f)
+	if len(totales) != 1 || totales[0].TaxSubtotal.TaxCategory.TaxScheme.ID.Value != "1000" || totales[0].TaxAmount.Value != 0 {
+		t.Errorf("se esperaba solo el IGV en 0, obtenido %+v", totales)
+	}
+}
@@ -6,7 +6,6 @@ import (
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 	"ubl-go-conversor/config"
 	"ubl-go-conversor/models"
 )
@@ -25,7 +24,7 @@ func Initialize(cfg *config.Config) error {
 
 	var err error
 	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger: newGormLogger(cfg),
 	})
 
 	if err != nil {
@@ -48,6 +47,8 @@ func AutoMigrate() error {
 		&models.Document{},
 		&models.DocumentItem{},
 		&models.AuditLog{},
+		&models.SerieCorrelativo{},
+		&models.ColaDocumento{},
 	)
 }
 
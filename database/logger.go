@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/logger"
+	"ubl-go-conversor/config"
+)
+
+/*
+slowQueryLogger envuelve el logger de GORM para registrar las consultas lentas
+en un log separado, independiente del nivel configurado. Así en producción el
+detalle SQL queda en Silent pero las consultas lentas siguen siendo visibles.
+*/
+type slowQueryLogger struct {
+	logger.Interface
+	threshold time.Duration
+	slowLog   *log.Logger
+}
+
+// LogMode mantiene el envoltorio al cambiar el nivel del logger interno
+func (l *slowQueryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &slowQueryLogger{
+		Interface: l.Interface.LogMode(level),
+		threshold: l.threshold,
+		slowLog:   l.slowLog,
+	}
+}
+
+// Trace registra la consulta en el log de lentas si supera el umbral y delega al logger base
+func (l *slowQueryLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if elapsed := time.Since(begin); l.threshold > 0 && elapsed > l.threshold {
+		sql, rows := fc()
+		l.slowLog.Printf("%.3fms (umbral %v) [rows:%d] %s", float64(elapsed.Nanoseconds())/1e6, l.threshold, rows, sql)
+	}
+	l.Interface.Trace(ctx, begin, fc, err)
+}
+
+// gormLogLevel deriva el nivel de log de GORM desde la configuración.
+// En producción siempre es Silent; en otros ambientes depende de LOG_LEVEL.
+func gormLogLevel(cfg *config.Config) logger.LogLevel {
+	if strings.EqualFold(cfg.Environment, "production") {
+		return logger.Silent
+	}
+
+	switch strings.ToLower(cfg.LogLevel) {
+	case "debug", "info":
+		return logger.Info
+	case "warn", "warning":
+		return logger.Warn
+	case "error":
+		return logger.Error
+	case "silent":
+		return logger.Silent
+	default:
+		return logger.Warn
+	}
+}
+
+// newGormLogger construye el logger de GORM con el nivel y umbral de consultas lentas configurados
+func newGormLogger(cfg *config.Config) logger.Interface {
+	base := logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+		SlowThreshold:             0, // Las consultas lentas se registran aparte
+		LogLevel:                  gormLogLevel(cfg),
+		IgnoreRecordNotFoundError: true,
+		Colorful:                  false,
+	})
+
+	return &slowQueryLogger{
+		Interface: base,
+		threshold: cfg.Database.SlowQueryThreshold,
+		slowLog:   log.New(os.Stderr, "[SLOW SQL] ", log.LstdFlags),
+	}
+}
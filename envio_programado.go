@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ubl-go-conversor/models"
+	"ubl-go-conversor/repository"
+	"ubl-go-conversor/utils"
+	"ubl-go-conversor/validator"
+)
+
+/*
+Envío diferido de comprobantes (?enviarEn=)
+===========================================
+
+Con ?enviarEn=2024-01-15T23:00:00 el comprobante se valida, se genera y se firma de
+inmediato, pero el envío a SUNAT queda programado: el documento pasa a scheduled con
+la fecha en envio_programado. Un scheduler interno revisa cada
+SCHEDULED_SEND_INTERVAL_SECONDS los envíos vencidos y los envía con el ZIP ya firmado.
+
+La hora sin zona se interpreta en hora de Perú. El momento debe ser futuro y estar
+dentro del plazo de envío de SUNAT para el tipo de comprobante.
+*/
+
+// ipScheduler identifica en la auditoría las acciones del scheduler de envíos
+const ipScheduler = "scheduler"
+
+// formatosEnviarEn son los formatos aceptados en ?enviarEn= (sin zona = hora de Perú)
+var formatosEnviarEn = []string{"2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+// parsearEnviarEn interpreta el parámetro ?enviarEn=; vacío retorna la fecha cero (envío inmediato)
+func parsearEnviarEn(valor string) (time.Time, error) {
+	if valor == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, valor); err == nil {
+		return t, nil
+	}
+	for _, formato := range formatosEnviarEn {
+		if t, err := time.ParseInLocation(formato, valor, validator.ZonaHorariaPeru); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("el parámetro enviarEn debe tener formato YYYY-MM-DDTHH:MM:SS (hora de Perú) o RFC 3339")
+}
+
+// verificarEnvioProgramado valida el envío diferido: no se combina con contingencia, debe
+// ser futuro y no puede exceder el plazo de envío de SUNAT contado desde la emisión
+func verificarEnvioProgramado(documento models.ComprobanteBase, opciones opcionesProceso, ahora time.Time) error {
+	if opciones.EnviarEn.IsZero() {
+		return nil
+	}
+	if opciones.Contingencia {
+		return fmt.Errorf("enviarEn no se puede combinar con contingencia=true")
+	}
+	if !opciones.EnviarEn.After(ahora) {
+		return fmt.Errorf("enviarEn (%s) debe ser posterior al momento actual", opciones.EnviarEn.In(validator.ZonaHorariaPeru).Format(time.RFC3339))
+	}
+
+	emision, err := time.ParseInLocation("2006-01-02", documento.FechaEmision, validator.ZonaHorariaPeru)
+	if err != nil {
+		return nil
+	}
+	plazo := validator.PlazoEnvioDias(documento.TipoDocumento, documento.Serie)
+	limite := emision.AddDate(0, 0, plazo+1) // Hasta el final del último día del plazo
+	if !opciones.EnviarEn.Before(limite) {
+		return fmt.Errorf("enviarEn excede el plazo de envío a SUNAT de %d días desde la emisión (%s); el envío debe programarse antes de %s",
+			plazo, documento.FechaEmision, limite.Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+// procesarEnvioProgramado persiste el documento firmado con su envío programado,
+// genera el PDF y arma la respuesta sin contactar a SUNAT
+func procesarEnvioProgramado(documento models.ComprobanteBase, documentID, nombreXML, zipPath, digest, signatureValue string, enviarEn time.Time, userIP string) models.APIResponse {
+	programado := enviarEn.In(validator.ZonaHorariaPeru).Format(time.RFC3339)
+	docRepo.ProgramarEnvio(documentID, enviarEn)
+	auditRepo.CreateLog(documentID, repository.ActionScheduled, "Envío a SUNAT programado para "+programado, userIP)
+
+	pdfPath := generarPDFDocumento(documento, documentID, digest, userIP)
+
+	persistirArchivos(documentID, userIP, nombreXML, pdfPath, zipPath)
+	docRepo.UpdateFilePaths(documentID, nombreXML, pdfPath, "", zipPath)
+	guardarContenidosBD(documentID, userIP, nombreXML, "", zipPath)
+	fmt.Println("ENVÍO PROGRAMADO: documento firmado, se enviará a SUNAT el", programado)
+
+	xmlContent, _ := ioutil.ReadFile(nombreXML)
+
+	return models.APIResponse{
+		Estado:          models.StatusScheduled,
+		Description:     fmt.Sprintf("El comprobante numero %s-%s, ha sido generado y se enviará a SUNAT el %s", documento.Serie, documento.Numero, programado),
+		Hash:            fmt.Sprintf("SHA1:%s|RSA:%s", digest, signatureValue),
+		XMLFirmado:      base64.StdEncoding.EncodeToString(xmlContent),
+		PDFURL:          construirPDFURL(documentID, pdfPath),
+		EnvioProgramado: programado,
+	}
+}
+
+// iniciarEnviosProgramados arranca el scheduler que envía los documentos programados
+// cuando llega su hora (SCHEDULED_SEND_INTERVAL_SECONDS=0 lo desactiva)
+func iniciarEnviosProgramados() {
+	intervalo := appConfig.EnvioProgramado.Interval
+	if intervalo <= 0 {
+		return
+	}
+	go func() {
+		for {
+			procesarEnviosProgramados(time.Now())
+			time.Sleep(intervalo)
+		}
+	}()
+	fmt.Printf("Envíos programados: revisión cada %s\n", intervalo)
+}
+
+// procesarEnviosProgramados envía los documentos cuyo envío programado ya venció
+func procesarEnviosProgramados(ahora time.Time) {
+	docs, err := docRepo.GetEnviosProgramados(ahora, appConfig.Batch.MaxDocuments)
+	if err != nil {
+		log.Println("Error consultando envíos programados:", err)
+		return
+	}
+	for i := range docs {
+		tomado, err := docRepo.TomarEnvioProgramado(docs[i].ID)
+		if err != nil {
+			log.Printf("Error tomando el envío programado de %s: %v", docs[i].ID, err)
+			continue
+		}
+		if !tomado {
+			continue
+		}
+		if err := enviarProgramado(&docs[i]); err != nil {
+			log.Printf("Error en el envío programado de %s: %v", docs[i].ID, err)
+			docRepo.UpdateStatus(docs[i].ID, models.StatusError, "", "Error en el envío programado: "+err.Error())
+			auditRepo.CreateLog(docs[i].ID, repository.ActionError, "Error en el envío programado: "+err.Error(), ipScheduler)
+		}
+	}
+}
+
+// enviarProgramado envía a SUNAT el ZIP ya firmado del documento y registra la respuesta
+// igual que la emisión inmediata: CDR (estado final) o ticket pendiente de consulta
+func enviarProgramado(doc *models.Document) (err error) {
+	// Un panic no debe detener el scheduler: el documento queda en error
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("error interno: %v", rec)
+		}
+	}()
+
+	zipPath := doc.ZIPPath
+	if zipPath == "" {
+		zipPath = "out/" + doc.ID + ".zip"
+	}
+	if err := restaurarZIP(doc.ID, zipPath); err != nil {
+		return err
+	}
+
+	nombreDestino, destinoConfig, err := appConfig.Destino(doc.RUC, doc.Destino)
+	if err != nil {
+		return err
+	}
+	destino := destinoEnvio(nombreDestino, destinoConfig)
+
+	auditRepo.CreateLog(doc.ID, repository.ActionSent, "ZIP enviado a "+destino.Nombre+" (envío programado)", ipScheduler)
+	envio, err := utils.EnviarComprobante(destino, doc.RUC, zipPath, "cdr")
+	if err != nil {
+		return fmt.Errorf("error al enviar a SUNAT: %v", err)
+	}
+
+	if envio.Ticket != "" {
+		docRepo.UpdateTicket(doc.ID, envio.Ticket)
+		auditRepo.CreateLog(doc.ID, repository.ActionTicketPending, "Envío asíncrono recibido con ticket "+envio.Ticket, ipScheduler)
+		return nil
+	}
+
+	registrarEstadoCDR(doc.ID, envio.CDR, ipScheduler)
+	persistirArchivos(doc.ID, ipScheduler, envio.CDR.CDRZipPath)
+	docRepo.UpdateCDRPath(doc.ID, envio.CDR.CDRZipPath)
+	guardarContenidosBD(doc.ID, ipScheduler, "", envio.CDR.CDRZipPath, "")
+	return nil
+}
+
+// restaurarZIP deja el ZIP firmado en el área de trabajo si ya no está (ej: la instancia
+// que lo generó no es la que lo envía), a partir del almacenamiento o de la copia en BD
+func restaurarZIP(documentID, zipPath string) error {
+	if _, err := os.Stat(zipPath); err == nil {
+		return nil
+	}
+	contenido, err := leerContenidoDocumento(documentID, zipPath, contenidoZIP)
+	if err != nil {
+		return fmt.Errorf("no se encontró el ZIP firmado: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(zipPath), 0755); err != nil {
+		return fmt.Errorf("error al crear carpeta del ZIP: %v", err)
+	}
+	return os.WriteFile(zipPath, contenido, 0644)
+}
+
+// enviarEnDesdeRequest lee ?enviarEn= y responde 400 si no es válido; retorna false si ya respondió
+func enviarEnDesdeRequest(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	enviarEn, err := parsearEnviarEn(r.URL.Query().Get("enviarEn"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	return enviarEn, true
+}
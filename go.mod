@@ -3,11 +3,14 @@ module ubl-go-conversor
 go 1.23.10
 
 require (
+	github.com/ThalesGroup/crypto11 v1.4.1           // Firma con claves en HSM vía PKCS#11 (solo con -tags pkcs11)
 	github.com/beevik/etree v1.5.1                    // Manipulación y parseo de documentos XML (generación UBL, inserción firmas)
 	github.com/google/uuid v1.6.0                     // Generación de UUIDs únicos para identificadores de documentos
 	github.com/joho/godotenv v1.5.1                   // Carga de configuración desde archivos .env (BD, SUNAT, certificados)
 	github.com/jung-kurt/gofpdf v1.16.2               // Generación de PDFs para representación impresa de facturas/boletas
 	github.com/russellhaering/goxmldsig v1.5.0        // Firma digital XMLDSig según estándares W3C y SUNAT
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e // Código QR de la representación impresa (Res. 155-2017/SUNAT)
+	gopkg.in/yaml.v3 v3.0.1                          // Archivo de configuración opcional en YAML/JSON (CONFIG_FILE)
 	gorm.io/driver/mysql v1.5.7                      // Driver MySQL para conexión de base de datos
 	gorm.io/gorm v1.25.12                            // ORM para persistencia de documentos y auditoría
 	software.sslmate.com/src/go-pkcs12 v0.5.0        // Decodificación de certificados digitales PKCS#12 (.pfx)
@@ -18,6 +21,9 @@ require (
 	github.com/jinzhu/inflection v1.0.0           // indirect - Singularización/pluralización de nombres de tablas GORM
 	github.com/jinzhu/now v1.1.5                  // indirect - Utilidades de tiempo y fecha para GORM
 	github.com/jonboulle/clockwork v0.5.0         // indirect - Abstracción de tiempo para testing en goxmldsig
+	github.com/miekg/pkcs11 v1.1.1                // indirect - Bindings PKCS#11 usados por crypto11
+	github.com/pkg/errors v0.9.1                  // indirect - Errores con contexto usados por crypto11
+	github.com/thales-e-security/pool v0.0.2      // indirect - Pool de sesiones PKCS#11 usado por crypto11
 	golang.org/x/crypto v0.11.0                   // indirect - Primitivas criptográficas (RSA, SHA1, certificados X.509)
 	golang.org/x/text v0.14.0                     // indirect - Procesamiento de texto y encoding para XML/SOAP
 )
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"ubl-go-conversor/models"
+)
+
+/*
+manejarConsultarTickets reconsulta en SUNAT todos los documentos con ticket pendiente
+(resúmenes diarios, bajas) y actualiza los que ya tienen CDR.
+
+Usa el mismo pool de workers que el batch (BATCH_WORKERS); la concurrencia y el
+ritmo hacia SUNAT se controlan globalmente en utils. Los tickets con código 98
+(aún en proceso) quedan en ticket_pending para la siguiente ejecución.
+
+Soporta ?limit=N para acotar la cantidad de documentos consultados.
+*/
+func manejarConsultarTickets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limite := appConfig.Batch.MaxDocuments
+	if valor := r.URL.Query().Get("limit"); valor != "" {
+		n, err := strconv.Atoi(valor)
+		if err != nil || n < 1 {
+			http.Error(w, "El parámetro limit debe ser un entero positivo", http.StatusBadRequest)
+			return
+		}
+		limite = n
+	}
+
+	docs, err := docRepo.GetTicketPending(limite)
+	if err != nil {
+		http.Error(w, "Error al obtener documentos con ticket pendiente: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resultados := make([]models.ConsultaTicketResultado, len(docs))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+
+	workers := appConfig.Batch.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for indice := range indices {
+				resultados[indice] = consultarTicketPendiente(&docs[indice], r.RemoteAddr)
+			}
+		}()
+	}
+
+	for i := range docs {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	response := models.ConsultaTicketsResponse{Total: len(resultados), Resultados: resultados}
+	for _, resultado := range resultados {
+		switch {
+		case resultado.Error != "":
+			response.Fallidos++
+		case resultado.Estado == models.StatusTicketPending:
+			response.EnProceso++
+		default:
+			response.Actualizados++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// consultarTicketPendiente consulta el ticket de un documento aislando errores y panics
+// para que no afecten al resto
+func consultarTicketPendiente(doc *models.Document, userIP string) (resultado models.ConsultaTicketResultado) {
+	resultado = models.ConsultaTicketResultado{
+		DocumentID: doc.ID,
+		Ticket:     doc.Ticket,
+		Estado:     models.StatusTicketPending,
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			resultado.Error = fmt.Sprintf("error interno: %v", rec)
+		}
+	}()
+
+	estadoTicket, err := consultarTicketDocumento(doc, userIP)
+	if err != nil {
+		resultado.Error = err.Error()
+		return resultado
+	}
+
+	resultado.Codigo = estadoTicket.StatusCode
+	if estadoTicket.EnProceso {
+		return resultado
+	}
+
+	actualizado, err := docRepo.GetByID(doc.ID)
+	if err == nil {
+		resultado.Estado = actualizado.Estado
+	}
+	resultado.Codigo = estadoTicket.CDR.ResponseCode
+	return resultado
+}
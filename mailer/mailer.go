@@ -0,0 +1,92 @@
+// Package mailer envía correos de notificación (documentos rechazados u observados,
+// etc.) a través de un servidor SMTP.
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Mensaje correo de texto plano a enviar
+type Mensaje struct {
+	Para   []string
+	Asunto string
+	Cuerpo string
+}
+
+// Mailer envía mensajes de correo
+type Mailer interface {
+	Enviar(mensaje Mensaje) error
+}
+
+// SMTP envía los correos con un servidor SMTP. Sin Usuario no se autentica
+// (relay interno); con Usuario usa PLAIN, que net/smtp solo permite sobre TLS.
+type SMTP struct {
+	Host      string
+	Port      string
+	Usuario   string
+	Clave     string
+	Remitente string
+}
+
+// NuevoSMTP crea el mailer SMTP, validando los datos mínimos del servidor
+func NuevoSMTP(host, port, usuario, clave, remitente string) (*SMTP, error) {
+	if strings.TrimSpace(host) == "" {
+		return nil, fmt.Errorf("no se configuró el servidor SMTP")
+	}
+	if strings.TrimSpace(remitente) == "" {
+		return nil, fmt.Errorf("no se configuró el remitente de los correos")
+	}
+	if port == "" {
+		port = "587"
+	}
+	return &SMTP{Host: host, Port: port, Usuario: usuario, Clave: clave, Remitente: remitente}, nil
+}
+
+// Enviar envía el mensaje en texto plano UTF-8
+func (s *SMTP) Enviar(mensaje Mensaje) error {
+	if len(mensaje.Para) == 0 {
+		return fmt.Errorf("el correo no tiene destinatarios")
+	}
+	contenido, err := construirMensaje(s.Remitente, mensaje)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Usuario != "" {
+		auth = smtp.PlainAuth("", s.Usuario, s.Clave, s.Host)
+	}
+	if err := smtp.SendMail(net.JoinHostPort(s.Host, s.Port), auth, s.Remitente, mensaje.Para, contenido); err != nil {
+		return fmt.Errorf("error enviando correo: %v", err)
+	}
+	return nil
+}
+
+// construirMensaje arma las cabeceras y el cuerpo (quoted-printable) del correo
+func construirMensaje(remitente string, mensaje Mensaje) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", remitente)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(mensaje.Para, ", "))
+	// El asunto puede llevar tildes: se codifica según RFC 2047
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mensaje.Asunto))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(mensaje.Cuerpo, "\n", "\r\n"))); err != nil {
+		return nil, fmt.Errorf("error codificando el correo: %v", err)
+	}
+	if err := qp.Close(); err != nil {
+		return nil, fmt.Errorf("error codificando el correo: %v", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -31,6 +31,8 @@ Arquitectura:
 package main
 
 import (
+	"context"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -38,7 +40,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"ubl-go-conversor/catalogos"
 	"ubl-go-conversor/config"
 	conversor "ubl-go-conversor/converters"
 	"ubl-go-conversor/database"
@@ -55,6 +62,8 @@ import (
 var appConfig *config.Config           // Configuración de la aplicación (.env)
 var docRepo *repository.DocumentRepository // Repositorio para operaciones de documentos
 var auditRepo *repository.AuditRepository   // Repositorio para logs de auditoría
+var colaRepo *repository.ColaRepository     // Cola de comprobantes asíncronos
+var firmanteHSM signature.Signer             // Sesión PKCS#11 abierta al arrancar (solo con SIGN_KEY_SOURCE=pkcs11)
 
 // main es el punto de entrada de la aplicación
 // Inicializa todos los componentes necesarios y arranca el servidor HTTP
@@ -67,16 +76,70 @@ func main() {
 		log.Fatal("Error inicializando base de datos:", err)
 	}
 	
+	// Configurar timeout y reintentos diferenciados por operación SUNAT
+	utils.ConfigurarRed(appConfig.Network.Timeout, map[string]utils.PoliticaReintento{
+		utils.OperacionSendBill:    {MaxIntentos: appConfig.Network.SendBill.MaxAttempts, Espera: appConfig.Network.SendBill.Backoff},
+		utils.OperacionSendSummary: {MaxIntentos: appConfig.Network.SendSummary.MaxAttempts, Espera: appConfig.Network.SendSummary.Backoff},
+		utils.OperacionGetStatus:   {MaxIntentos: appConfig.Network.GetStatus.MaxAttempts, Espera: appConfig.Network.GetStatus.Backoff},
+	})
+	// Límite de concurrencia y ritmo hacia SUNAT (aplica a envíos individuales y batch)
+	utils.ConfigurarLimiteSUNAT(appConfig.Network.MaxConcurrent, appConfig.Network.MinInterval)
+	// Servicio de consulta de CDR, usado para recuperar CDR de documentos ya registrados
+	utils.ConfigurarConsultaCDR(appConfig.SUNAT.ConsultURL, appConfig.SUNAT.Username, appConfig.SUNAT.Password)
+	
+	// Abrir la sesión con el HSM si la clave de firma reside en PKCS#11
+	inicializarFirmanteHSM()
+
+	// Evitar firmar en producción con un certificado de prueba (SUNAT lo rechaza)
+	verificarCertificadoAmbiente()
+	
 	// PASO 3: Inicializar repositorios para operaciones de base de datos
 	db := database.GetDB()
 	docRepo = repository.NewDocumentRepository(db)
 	auditRepo = repository.NewAuditRepository(db)
+	colaRepo = repository.NewColaRepository(db)
+
+	// Almacenamiento de XML, ZIP, PDF y CDR (filesystem local o S3)
+	inicializarAlmacenamiento()
+
+	// Aviso por correo al emisor de documentos rechazados u observados (MAIL_NOTIFY_REJECTED)
+	inicializarNotificaciones()
+
+	// Procesar en segundo plano los comprobantes recibidos con ?async=true
+	iniciarWorkersCola()
+
+	// Enviar a SUNAT los comprobantes programados con ?enviarEn= cuando llega su hora
+	iniciarEnviosProgramados()
 	
 	// PASO 4: Configurar rutas HTTP
+	// Todos los handlers se envuelven con recuperarPanic para responder 500 ante un panic
+	// y con autenticar para exigir la API key cuando hay claves configuradas
 	// POST /api/v1/invoices - Endpoint principal para crear facturas/boletas
-	http.HandleFunc("/api/v1/invoices", manerjarDocumento)
+	http.HandleFunc("/api/v1/invoices", recuperarPanic(autenticar(limitarBody(appConfig.Server.MaxBodyBytes, manerjarDocumento))))
+	// POST /api/v1/invoices/draft - Guarda un borrador validado sin enviarlo a SUNAT
+	http.HandleFunc("/api/v1/invoices/draft", recuperarPanic(autenticar(limitarBody(appConfig.Server.MaxBodyBytes, manejarBorrador))))
+	// POST /api/v1/invoices/batch - Procesa múltiples comprobantes en una sola request
+	http.HandleFunc("/api/v1/invoices/batch", recuperarPanic(autenticar(limitarBody(appConfig.Batch.MaxBodyBytes, manejarBatch))))
+	// POST /api/v1/summary - Resumen diario de boletas (SummaryDocuments) enviado con sendSummary
+	http.HandleFunc("/api/v1/summary", recuperarPanic(autenticar(limitarBody(appConfig.Server.MaxBodyBytes, manejarResumenDiario))))
 	// GET /api/v1/documents/{id}/{action} - Endpoints para consultar documentos
-	http.HandleFunc("/api/v1/documents/", manerjarDocumentos)
+	// GET /api/v1/documents?ruc=&estado=&desde=&hasta=&limit=&offset= - Listado con filtros combinados
+	http.HandleFunc("/api/v1/documents", recuperarPanic(autenticar(manejarListadoDocumentos)))
+	// GET /api/v1/documents/by-reference?ref=X[&ruc=] - Documentos por referencia externa del cliente
+	http.HandleFunc("/api/v1/documents/by-reference", recuperarPanic(autenticar(manejarBusquedaPorReferencia)))
+	http.HandleFunc("/api/v1/documents/", recuperarPanic(autenticar(manerjarDocumentos)))
+	// GET /api/v1/series/next - Siguiente número correlativo disponible por serie
+	http.HandleFunc("/api/v1/series/next", recuperarPanic(autenticar(manejarSiguienteNumero)))
+	// GET /api/v1/cdr/recuperar?ruc=&tipoDoc=&serie=&numero= - Recupera de SUNAT el CDR de un comprobante ya procesado
+	http.HandleFunc("/api/v1/cdr/recuperar", recuperarPanic(autenticar(manejarRecuperarCDR)))
+	// POST /api/v1/jobs/consultar-tickets - Reconsulta los tickets pendientes en SUNAT
+	http.HandleFunc("/api/v1/jobs/consultar-tickets", recuperarPanic(autenticar(manejarConsultarTickets)))
+	// GET /api/v1/usage?api_key=X&periodo=YYYYMM - Documentos emitidos por cliente (solo administradores)
+	http.HandleFunc("/api/v1/usage", recuperarPanic(soloAdmin(manejarUso)))
+	// GET /api/v1/certificate[?ruc=] - Diagnóstico del certificado de firma: sujeto, emisor y vigencia (solo administradores)
+	http.HandleFunc("/api/v1/certificate", recuperarPanic(soloAdmin(manejarDiagnosticoCertificado)))
+	// GET /api/v1/verify?ruc=&tipo=&serie=&numero=&monto=&fecha= - Verificación pública para receptores (sin API key, con límite por IP)
+	http.HandleFunc("/api/v1/verify", recuperarPanic(limitarPorIP(appConfig.Verify.RequestsPerMinute, manejarVerificacion)))
 	
 	// PASO 5: Arrancar servidor HTTP
 	serverAddr := ":" + appConfig.Server.Port
@@ -119,24 +182,360 @@ func manerjarDocumento(w http.ResponseWriter, r *http.Request) {
 	var documento models.ComprobanteBase
 	err := json.NewDecoder(r.Body).Decode(&documento)
 	if err != nil {
-		http.Error(w, "Error al leer JSON: "+err.Error(), http.StatusBadRequest)
+		responderErrorJSON(w, err, "Error al leer JSON: ")
 		return
 	}
 
+	// Parámetros de procesamiento tomados del query string
+	opciones := opcionesProceso{
+		ZipManual:    r.URL.Query().Get("zip"),
+		Contingencia: r.URL.Query().Get("contingencia") == "true",
+		AutoTipo:     r.URL.Query().Get("autoTipo") == "true",
+		Destino:      r.URL.Query().Get("destino"),
+		APIKey:       clienteAutenticado(r),
+		IncluirPDF:   r.URL.Query().Get("incluirPDF") == "base64",
+	}
+
+	// Con ?enviarEn= se firma ahora y el envío a SUNAT queda programado
+	enviarEn, ok := enviarEnDesdeRequest(w, r)
+	if !ok {
+		return
+	}
+	opciones.EnviarEn = enviarEn
+
+	// Con ?async=true el comprobante se encola y se responde de inmediato
+	if r.URL.Query().Get("async") == "true" {
+		if !opciones.EnviarEn.IsZero() {
+			http.Error(w, "enviarEn no se puede combinar con async=true", http.StatusBadRequest)
+			return
+		}
+		encolarComprobante(w, r, documento, opciones)
+		return
+	}
+
+	status, response, errProc := procesarComprobante(documento, opciones, r.RemoteAddr)
+	if errProc != nil {
+		escribirErrorProceso(w, r, errProc)
+		return
+	}
+
+	escribirRespuesta(w, r, status, response)
+}
+
+// opcionesProceso agrupa los parámetros opcionales del procesamiento de un comprobante
+type opcionesProceso struct {
+	ZipManual    string // Nombre de un ZIP ya existente en out/ (?zip=)
+	Contingencia bool   // Firmar sin enviar a SUNAT (?contingencia=true)
+	AutoTipo     bool   // Determinar factura/boleta según el cliente (?autoTipo=true)
+	Destino      string // Destino de envío configurado (?destino=), vacío = por RUC o por defecto
+	APIKey       string // Cliente autenticado que emite el documento (uso por API key)
+	IncluirPDF   bool   // Incluir el PDF en base64 en la respuesta (?incluirPDF=base64)
+	Borrador     bool   // Emisión de un borrador guardado (reemplaza el registro en estado draft)
+	Reintento    bool   // Reintento de la cola (reprocesa el documento que quedó en processing)
+	EnviarEn     time.Time // Envío a SUNAT programado (?enviarEn=); cero = envío inmediato
+}
+
+// errorProceso describe un error del flujo de emisión junto con su código HTTP
+type errorProceso struct {
+	Status  int                   // Código HTTP a responder
+	Mensaje string                // Mensaje de error en texto plano
+	Detalle *models.ErrorResponse // Respuesta JSON estructurada (ej: falla de envío a SUNAT)
+}
+
+func (e *errorProceso) Error() string {
+	return e.Mensaje
+}
+
+// fallarProceso construye el retorno de procesarComprobante para un error en texto plano
+func fallarProceso(status int, mensaje string) (int, models.APIResponse, *errorProceso) {
+	return 0, models.APIResponse{}, &errorProceso{Status: status, Mensaje: mensaje}
+}
+
+// verificarEmisorAutorizado valida el RUC del emisor contra EMISORES_AUTORIZADOS, antes
+// de intentar emitir y recibir de SUNAT un error poco claro
+func verificarEmisorAutorizado(ruc string) error {
+	if appConfig.EmisorAutorizado(ruc) {
+		return nil
+	}
+	return fmt.Errorf("el RUC emisor %s no está autorizado para emitir comprobantes en este servicio (EMISORES_AUTORIZADOS)", ruc)
+}
+
+// verificarSerieAutorizada valida que la serie esté declarada para el RUC y tipo de
+// comprobante (SERIES_AUTORIZADAS), antes de que SUNAT rechace una serie no declarada
+func verificarSerieAutorizada(documento models.ComprobanteBase) error {
+	ruc, tipoDoc, serie := documento.Emisor.RUC, documento.TipoDocumento, documento.Serie
+	if appConfig.SerieAutorizada(ruc, tipoDoc, serie) {
+		return nil
+	}
+	return fmt.Errorf("la serie %s no está autorizada para el RUC %s y tipo de comprobante %s (autorizadas: %s)",
+		serie, ruc, tipoDoc, strings.Join(appConfig.SeriesAutorizadasDe(ruc, tipoDoc), ", "))
+}
+
+/*
+completarDocumentoAfectado busca en BD el comprobante que corrige una nota de crédito/débito
+y completa su moneda y tipo de cambio:
+- La moneda del afectado se usa para validar que la nota esté en la misma moneda
+- Si la nota no informa tipo de cambio, se copia el del comprobante afectado
+
+Si el afectado no fue emitido por este servicio, se respeta lo que envió el cliente.
+*/
+func completarDocumentoAfectado(documento *models.ComprobanteBase) {
+	afectado := documento.DocumentoAfectado
+	if afectado == nil || (documento.TipoDocumento != "07" && documento.TipoDocumento != "08") {
+		return
+	}
+
+	id := models.GenerateDocumentID(documento.Emisor.RUC, afectado.TipoDocumento, afectado.Serie, models.NormalizarNumero(afectado.Numero))
+	original, err := docRepo.GetByID(id)
+	if err != nil {
+		return
+	}
+	afectado.Moneda = original.Moneda
+
+	var comprobante models.ComprobanteBase
+	if original.Payload != "" && json.Unmarshal([]byte(original.Payload), &comprobante) == nil {
+		afectado.TipoCambio = comprobante.TipoCambio
+	}
+	if documento.TipoCambio == 0 {
+		documento.TipoCambio = afectado.TipoCambio
+	}
+}
+
+// leyendasPlantilla convierte las leyendas configuradas para el emisor al modelo del comprobante
+func leyendasPlantilla(ruc string) []models.Leyenda {
+	var leyendas []models.Leyenda
+	for _, leyenda := range appConfig.LeyendasEmisor(ruc) {
+		leyendas = append(leyendas, models.Leyenda{Codigo: leyenda.Codigo, Descripcion: leyenda.Descripcion})
+	}
+	return leyendas
+}
+
+// asignarTipoAutomatico determina el tipo de comprobante si viene vacío (RUC -> factura,
+// DNI u otro -> boleta) y ajusta la serie si falta o no corresponde al tipo
+// (F para facturas, B para boletas), usando las series configuradas por RUC
+func asignarTipoAutomatico(documento *models.ComprobanteBase) {
+	if documento.TipoDocumento != "" {
+		return
+	}
+	documento.TipoDocumento = catalogos.TipoComprobantePorCliente(documento.Cliente.TipoDoc)
+
+	prefijo := "B"
+	if documento.TipoDocumento == "01" {
+		prefijo = "F"
+	}
+	if !strings.HasPrefix(strings.ToUpper(documento.Serie), prefijo) {
+		if serie := appConfig.SerieAutomatica(documento.Emisor.RUC, documento.TipoDocumento); serie != "" {
+			documento.Serie = serie
+		}
+	}
+}
+
+// registrarEstadoCDR actualiza el estado del documento en BD según el CDR de SUNAT
+// y registra la acción correspondiente en auditoría
+func registrarEstadoCDR(documentID string, cdrInfo *models.CDRInfo, userIP string) {
+	var estadoDB string
+	switch cdrInfo.Estado {
+	case "aprobada":
+		estadoDB = models.StatusApproved
+		auditRepo.CreateLog(documentID, repository.ActionApproved, "Documento aprobado por SUNAT", userIP)
+	case "rechazada":
+		estadoDB = models.StatusRejected
+		auditRepo.CreateLog(documentID, repository.ActionRejected, "Documento rechazado por SUNAT", userIP)
+	case "observada":
+		estadoDB = models.StatusObserved
+		if appConfig.ObservadosRequierenAccion() {
+			estadoDB = models.StatusActionRequired
+		}
+		auditRepo.CreateLog(documentID, repository.ActionError, "Documento observado por SUNAT", userIP)
+	default:
+		estadoDB = models.StatusError
+		auditRepo.CreateLog(documentID, repository.ActionError, "Error en respuesta SUNAT", userIP)
+	}
+
+	docRepo.UpdateStatus(documentID, estadoDB, cdrInfo.ResponseCode, cdrInfo.Description)
+	if len(cdrInfo.Observaciones) > 0 {
+		docRepo.UpdateObservaciones(documentID, cdrInfo.Observaciones)
+	}
+
+	// Avisar al emisor de los rechazos y observaciones para que actúe sin esperar a consultar
+	switch estadoDB {
+	case models.StatusRejected, models.StatusObserved, models.StatusActionRequired:
+		notificarResultadoSUNAT(documentID, estadoDB, cdrInfo, userIP)
+	}
+}
+
+// escribirErrorProceso responde el error estructurado en el formato pedido (JSON o XML)
+// y los demás como texto plano, salvo que el cliente pida XML
+func escribirErrorProceso(w http.ResponseWriter, r *http.Request, errProc *errorProceso) {
+	if errProc.Detalle != nil {
+		escribirRespuesta(w, r, errProc.Status, errProc.Detalle)
+		return
+	}
+	if prefiereXML(r) {
+		escribirRespuesta(w, r, errProc.Status, models.ErrorResponse{
+			Estado:      "error",
+			Code:        strconv.Itoa(errProc.Status),
+			Description: errProc.Mensaje,
+		})
+		return
+	}
+	http.Error(w, errProc.Mensaje, errProc.Status)
+}
+
+/*
+prepararComprobante normaliza y valida el comprobante antes de emitirlo: limpia textos,
+fechas y número, completa tipo, documento afectado, leyendas corporativas y redondeo,
+y aplica las validaciones SUNAT y las verificaciones configurables. Retorna las
+advertencias que no bloquean la emisión.
+
+Lo usan la emisión (procesarComprobante) y los borradores, que guardan el comprobante
+ya preparado para emitirlo después con el mismo document_id.
+*/
+func prepararComprobante(documento *models.ComprobanteBase, opciones opcionesProceso) ([]string, *errorProceso) {
+	// Quitar espacios sobrantes en todos los campos de texto (causa frecuente de observaciones)
+	models.NormalizarComprobante(documento)
+
+	// Rechazar de inmediato los RUC que no están habilitados para emitir en esta instalación
+	if err := verificarEmisorAutorizado(documento.Emisor.RUC); err != nil {
+		return nil, &errorProceso{Status: http.StatusForbidden, Mensaje: err.Error()}
+	}
+
+	// Aceptar fechas en formatos comunes (DD/MM/YYYY, etc.) y llevarlas al formato ISO de SUNAT
+	if err := models.NormalizarFechas(documento); err != nil {
+		return nil, &errorProceso{Status: http.StatusBadRequest, Mensaje: "Error de validación: " + err.Error()}
+	}
+
+	// Con ?autoTipo=true se completa factura/boleta y su serie según el cliente;
+	// la validación posterior verifica la coherencia del resultado
+	if opciones.AutoTipo {
+		asignarTipoAutomatico(documento)
+	}
+
+	// En notas de crédito/débito, tomar moneda y tipo de cambio del comprobante afectado
+	completarDocumentoAfectado(documento)
+
+	// Agregar las leyendas corporativas configuradas para el emisor (LEYENDAS_EMISOR_FILE)
+	documento.Leyendas = conversor.CombinarLeyendas(documento.Leyendas, leyendasPlantilla(documento.Emisor.RUC))
+
+	// El descuentoGlobal es un atajo: se suma a los descuentos del catálogo 53
+	documento.IncorporarDescuentoGlobal()
+
+	// Completar la unidad de medida de los ítems que no la envían (DEFAULT_UNIT_CODE)
+	unidadPorDefecto := appConfig.UnidadMedida(documento.Emisor.RUC)
+	sinUnidad := documento.CompletarUnidadMedida(unidadPorDefecto)
+
+	// Ajustar el importe a pagar según la política de redondeo del emisor (ROUNDING_MODE);
+	// la diferencia va en cbc:PayableRoundingAmount y la validación la considera
+	if modo := appConfig.ModoRedondeo(documento.Emisor.RUC); modo != "" {
+		documento.AplicarRedondeo(modo)
+	}
+
 	// Validar datos según normativas SUNAT (RUC, series, totales, etc.)
 	// El validator verifica reglas de negocio específicas de facturación electrónica
-	err = validator.ValidarComprobanteBase(documento)
+	err := validator.ValidarComprobanteBase(*documento)
 	if err != nil {
-		http.Error(w, "Error de validación: "+err.Error(), http.StatusBadRequest)
-		return
+		return nil, &errorProceso{Status: http.StatusBadRequest, Mensaje: "Error de validación: " + err.Error()}
+	}
+	if err := verificarSerieAutorizada(*documento); err != nil {
+		return nil, &errorProceso{Status: http.StatusBadRequest, Mensaje: "Error de validación: " + err.Error()}
 	}
 
+	// Advertir ítems posiblemente duplicados (no bloquea la emisión)
+	advertencias := validator.AdvertirItemsDuplicados(documento.Items)
+	if aviso := validator.AdvertirUnidadPorDefecto(sinUnidad, unidadPorDefecto); aviso != "" {
+		advertencias = append(advertencias, aviso)
+	}
+
+	// Verificaciones configurables: advertir, rechazar o ignorar según configuración
+	verificaciones := []struct {
+		modo  string
+		aviso string
+	}{
+		// Fecha de emisión fuera del plazo de envío
+		{appConfig.Validation.PlazoEnvio, validator.VerificarPlazoEnvio(*documento, time.Now())},
+		// Cliente con el mismo documento que el emisor (salvo autoconsumo declarado)
+		{appConfig.Validation.ClienteIgualEmisor, validator.VerificarClienteEmisor(*documento)},
+		// IGV desproporcionado respecto al gravado (ej: 180% por un error de decimales)
+		{appConfig.Validation.ProporcionIGV, validator.VerificarProporcionIGV(*documento, appConfig.Validation.MaxProporcionIGV)},
+		// Cantidades fraccionarias en unidades indivisibles (ej: 2.5 NIU)
+		{appConfig.Validation.DecimalesCantidad, validator.VerificarDecimalesCantidad(documento.Items)},
+	}
+	for _, v := range verificaciones {
+		if v.aviso == "" {
+			continue
+		}
+		switch v.modo {
+		case "rechazar":
+			return nil, &errorProceso{Status: http.StatusBadRequest, Mensaje: "Error de validación: " + v.aviso}
+		case "ignorar":
+		default:
+			advertencias = append(advertencias, v.aviso)
+		}
+	}
+
+	for _, advertencia := range advertencias {
+		fmt.Printf("Advertencia: %s\n", advertencia)
+	}
+
+	// Normalizar el número (sin ceros a la izquierda) para que el XML, los nombres
+	// de archivo y el ID en BD coincidan con el cbc:ID enviado a SUNAT
+	documento.Numero = models.NormalizarNumero(documento.Numero)
+
+	return advertencias, nil
+}
+
+/*
+procesarComprobante ejecuta el flujo completo de emisión de un comprobante:
+validación, persistencia, XML, firma, ZIP, envío a SUNAT y PDF.
+
+Retorna el código HTTP y la respuesta, o un errorProceso si algún paso falla.
+Es usado tanto por el endpoint individual como por el endpoint batch.
+*/
+func procesarComprobante(documento models.ComprobanteBase, opciones opcionesProceso, userIP string) (int, models.APIResponse, *errorProceso) {
+	advertencias, errProc := prepararComprobante(&documento, opciones)
+	if errProc != nil {
+		return 0, models.APIResponse{}, errProc
+	}
+
+	// Consolidar leyendas (sin repetidos y con el monto en letras) para que el XML y el PDF coincidan
+	documento.Leyendas = conversor.NormalizarLeyendas(documento)
+
+	// El envío programado debe ser futuro y caer dentro del plazo de envío de SUNAT
+	if err := verificarEnvioProgramado(documento, opciones, time.Now()); err != nil {
+		return fallarProceso(http.StatusBadRequest, "Error de validación: "+err.Error())
+	}
+
+	// Resolver el destino de envío (request, RUC o por defecto) antes de persistir
+	nombreDestino, destinoConfig, err := appConfig.Destino(documento.Emisor.RUC, opciones.Destino)
+	if err != nil {
+		return fallarProceso(http.StatusBadRequest, err.Error())
+	}
+	destino := destinoEnvio(nombreDestino, destinoConfig)
+
 	// ==================== PERSISTENCIA INICIAL ====================
 	
 	// Generar ID único del documento: RUC-TipoDoc-Serie-Numero
-	// Ejemplo: "20123456789-01-F001-00000123"
+	// Ejemplo: "20123456789-01-F001-123"
 	documentID := models.GenerateDocumentID(documento.Emisor.RUC, documento.TipoDocumento, documento.Serie, documento.Numero)
+
+	// Reenvío de un comprobante ya procesado: se devuelve la respuesta almacenada sin
+	// volver a enviarlo a SUNAT (solo los documentos en error se reprocesan)
+	previa, estadoPrevio, errProc := comprobarReenvio(documentID, userIP, opciones)
+	if errProc != nil {
+		return 0, models.APIResponse{}, errProc
+	} else if previa != nil {
+		if opciones.IncluirPDF {
+			adjuntarPDF(previa, documentID)
+		}
+		return statusHTTPSegunCDR(previa.Estado), *previa, nil
+	}
 	
+	// El comprobante ya normalizado se guarda para poder regenerar el XML más adelante
+	payload, err := json.Marshal(documento)
+	if err != nil {
+		return fallarProceso(http.StatusInternalServerError, "Error al serializar el comprobante: "+err.Error())
+	}
+
 	// Crear registro inicial en base de datos con estado "processing"
 	// Esto permite rastrear el documento desde el inicio del proceso
 	dbDocument := &models.Document{
@@ -149,17 +548,35 @@ func manerjarDocumento(w http.ResponseWriter, r *http.Request) {
 		ClienteDoc: documento.Cliente.NumeroDoc,   // DNI/RUC del cliente
 		Total:      documento.TotalImportePagar,   // Importe total a pagar
 		Moneda:     documento.Moneda,     // PEN, USD, EUR
+		FechaEmision: documento.FechaEmision, // YYYY-MM-DD (ya normalizada)
 		Estado:     models.StatusProcessing, // Estado inicial: "processing"
+		Destino:    nombreDestino,        // Webservice usado para el envío
+
+		ReferenciaExterna: documento.ReferenciaExterna, // ID de venta en el sistema del cliente
+		Payload:           string(payload),              // Comprobante procesado (regenerar-xml)
+		APIKey:            opciones.APIKey,              // Cliente que emitió el documento
 	}
+	dbDocument.AplicarDesglose(documento)
 	
 	// Guardar en base de datos - si falla, abortar proceso
-	if err := docRepo.Create(dbDocument); err != nil {
-		http.Error(w, "Error al crear documento en BD: "+err.Error(), http.StatusInternalServerError)
-		return
+	if estadoPrevio == "" {
+		if err := docRepo.Create(dbDocument); err != nil {
+			return fallarProceso(http.StatusInternalServerError, "Error al crear documento en BD: "+err.Error())
+		}
+		// Registrar acción de creación en logs de auditoría
+		auditRepo.CreateLog(documentID, repository.ActionCreated, "Documento creado", userIP)
+	} else {
+		// Reproceso de un documento en error: se reinicia el mismo registro
+		reiniciado, err := docRepo.ReiniciarParaReproceso(dbDocument, estadoPrevio)
+		if err != nil {
+			return fallarProceso(http.StatusInternalServerError, "Error al preparar el reproceso del documento: "+err.Error())
+		}
+		if !reiniciado {
+			return fallarProceso(http.StatusConflict, fmt.Sprintf("El documento %s ya está siendo reprocesado por otra solicitud", documentID))
+		}
+		auditRepo.CreateLog(documentID, repository.ActionCreated, "Documento reprocesado (estado anterior: "+estadoPrevio+")", userIP)
 	}
-	
-	// Registrar acción de creación en logs de auditoría
-	auditRepo.CreateLog(documentID, repository.ActionCreated, "Documento creado", r.RemoteAddr)
+	defer marcarErrorSiPanic(documentID, userIP)
 
 	// ==================== PASO 1: GENERACIÓN DE XML UBL 2.1 ====================
 	
@@ -167,46 +584,46 @@ func manerjarDocumento(w http.ResponseWriter, r *http.Request) {
 	if _, err := os.Stat("out"); os.IsNotExist(err) {
 		err = os.Mkdir("out", 0755)
 		if err != nil {
-			http.Error(w, "Error al crear carpeta: "+err.Error(), http.StatusInternalServerError)
-			return
+			return fallarProceso(http.StatusInternalServerError, "Error al crear carpeta: "+err.Error())
 		}
 	}
 
-	// Generar nombre del archivo XML con formato estándar SUNAT
-	// Formato: RUC-TipoDocumento-Serie-Numero.xml
-	// Ejemplo: "20123456789-01-F001-00000123.xml"
-	nombreXML := fmt.Sprintf("out/%s-%s-%s-%s.xml", documento.Emisor.RUC, documento.TipoDocumento, documento.Serie, documento.Numero)
+	// Generar nombre del archivo XML según la plantilla configurada
+	// Por defecto el formato estándar SUNAT: RUC-TipoDocumento-Serie-Numero.xml
+	// Ejemplo: "20123456789-01-F001-123.xml"
+	nombreXML := "out/" + models.GenerarNombreArchivo(documento, "xml", appConfig.Files.NamePattern)
 
-	// Generar XML UBL 2.1 según el tipo de documento
-	// Solo soporta facturas (01) y boletas (03) por ahora
-	if documento.TipoDocumento == "01" || documento.TipoDocumento == "03" {
-		// El conversor transforma la estructura ComprobanteBase a XML UBL 2.1
-		// Incluye todas las extensiones SUNAT requeridas y validaciones de estructura
-		err = conversor.GenerarXMLBF(documento, nombreXML)
-		if err != nil {
-			http.Error(w, "Error al generar XML: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		fmt.Printf("PASO 1: XML generado exitosamente: %s\n", nombreXML)
-	} else {
-		// Rechazar tipos de documento no implementados (notas de crédito/débito)
-		http.Error(w, "Tipo de documento no soportado: "+documento.TipoDocumento, http.StatusBadRequest)
-		return
+	// Generar XML UBL 2.1 según el tipo de documento: Invoice para facturas (01) y
+	// boletas (03), CreditNote/DebitNote para notas de crédito (07) y débito (08)
+	// El conversor transforma la estructura ComprobanteBase a XML UBL 2.1
+	// Incluye todas las extensiones SUNAT requeridas y validaciones de estructura
+	err = conversor.GenerarXMLComprobante(documento, nombreXML, conversor.OpcionesXML{
+		Minificado:  appConfig.XML.Minify,
+		Indentacion: appConfig.XML.Indent,
+	})
+	if err != nil {
+		return fallarProceso(http.StatusInternalServerError, "Error al generar XML: "+err.Error())
 	}
+	fmt.Printf("PASO 1: XML generado exitosamente: %s\n", nombreXML)
 
 	// ==================== PASO 2: FIRMA DIGITAL ====================
 	
-	// Firmar XML usando certificado digital PKCS#12
+	// Firmar XML con la clave configurada (PKCS#12 o HSM vía PKCS#11)
 	// La firma cumple con estándares XMLDSig y normativas SUNAT
 	// Retorna: digest (SHA1) y signatureValue (RSA)
-	digest, signatureValue, err := signature.FirmaXML(
-		nombreXML,                    // Archivo XML a firmar
-		appConfig.Certificate.Path,   // Ruta del certificado .pfx
-		appConfig.Certificate.Password, // Contraseña del certificado
+	// El certificado puede venir de CERT_PATH o de CERT_BASE64 según configuración
+	firmante, err := obtenerFirmante(documento.Emisor.RUC)
+	if err != nil {
+		return fallarProceso(http.StatusInternalServerError, "Error al cargar certificado: "+err.Error())
+	}
+
+	digest, signatureValue, err := signature.FirmarXMLConSigner(
+		nombreXML,       // Archivo XML a firmar
+		firmante,        // Clave privada y certificado del emisor
+		opcionesFirma(), // Canonicalización y prefijos configurados
 	)
 	if err != nil {
-		http.Error(w, "Error al firmar XML: "+err.Error(), http.StatusInternalServerError)
-		return
+		return fallarProceso(http.StatusInternalServerError, "Error al firmar XML: "+err.Error())
 	}
 
 	fmt.Println("PASO 2: XML firmado correctamente.")
@@ -215,101 +632,371 @@ func manerjarDocumento(w http.ResponseWriter, r *http.Request) {
 	
 	// Guardar hashes de la firma en base de datos para auditoría
 	docRepo.UpdateHashes(documentID, digest, signatureValue)
-	auditRepo.CreateLog(documentID, repository.ActionSigned, "XML firmado digitalmente", r.RemoteAddr)
+	auditRepo.CreateLog(documentID, repository.ActionSigned, "XML firmado digitalmente", userIP)
 	// Paso 3: Comprimir ZIP
 	var zipPath string
-	zipParam := r.URL.Query().Get("zip")
-	if zipParam != "" {
-		zipPath = "out/" + zipParam
+	if opciones.ZipManual != "" {
+		zipPath = "out/" + opciones.ZipManual
 		if _, err := os.Stat(zipPath); os.IsNotExist(err) {
-			http.Error(w, "ZIP especificado no encontrado: "+zipPath, http.StatusBadRequest)
-			return
+			return fallarProceso(http.StatusBadRequest, "ZIP especificado no encontrado: "+zipPath)
 		}
 		fmt.Println("PASO 3: ZIP proporcionado manualmente:", zipPath)
 	} else {
-		zipPath, err = utils.ZipXML(nombreXML)
+		// Dentro del ZIP el XML siempre lleva el nombre SUNAT, sea cual sea la plantilla
+		zipPath, err = utils.ZipXMLComo(nombreXML, documentID)
 		if err != nil {
-			http.Error(w, "Error al comprimir XML: "+err.Error(), http.StatusInternalServerError)
-			return
+			return fallarProceso(http.StatusInternalServerError, "Error al comprimir XML: "+err.Error())
 		}
 		fmt.Println("PASO 3: ZIP creado automáticamente:", zipPath)
 	}
 
-	// Paso 4: Construir SOAP
-	Usuario := appConfig.SUNAT.Username
-	Clave := appConfig.SUNAT.Password
+	// ==================== MODO CONTINGENCIA ====================
 
-	soapMessage, err := utils.BuildSOAP(documento.Emisor.RUC, Usuario, Clave, zipPath)
-	if err != nil {
-		http.Error(w, "Error al construir SOAP: "+err.Error(), http.StatusInternalServerError)
-		return
+	// Con ?contingencia=true el comprobante queda firmado localmente y pendiente
+	// de envío; se enviará a SUNAT cuando el servicio esté disponible
+	if opciones.Contingencia {
+		response := procesarContingencia(documento, documentID, nombreXML, zipPath, digest, signatureValue, userIP)
+		response.Advertencias = advertencias
+		if opciones.IncluirPDF {
+			adjuntarPDF(&response, documentID)
+		}
+		return http.StatusAccepted, response, nil
 	}
-	fmt.Println("PASO 4: SOAP generado.")
 
-	// Paso 5: Enviar a SUNAT
-	cdrInfo, err := utils.SendToSunatStructured(appConfig.SUNAT.URL, soapMessage, zipPath, "cdr")
+	// ==================== ENVÍO PROGRAMADO ====================
+
+	// Con ?enviarEn= el comprobante queda firmado y el scheduler lo envía a su hora
+	if !opciones.EnviarEn.IsZero() {
+		response := procesarEnvioProgramado(documento, documentID, nombreXML, zipPath, digest, signatureValue, opciones.EnviarEn, userIP)
+		response.Advertencias = advertencias
+		if opciones.IncluirPDF {
+			adjuntarPDF(&response, documentID)
+		}
+		return http.StatusAccepted, response, nil
+	}
+
+	// Paso 4 y 5: Construir el mensaje según el destino (SOAP con WS-Security para
+	// SOL/OSE, REST con token Bearer para GRE) y enviarlo
+	if utils.EsResumen(zipPath) {
+		auditRepo.CreateLog(documentID, repository.ActionSummarySent, "Resumen enviado con sendSummary a "+destino.Nombre, userIP)
+	} else {
+		auditRepo.CreateLog(documentID, repository.ActionSent, "ZIP enviado a "+destino.Nombre, userIP)
+	}
+	envio, err := utils.EnviarComprobante(destino, documento.Emisor.RUC, zipPath, "cdr")
 	if err != nil {
-		errorResponse := models.ErrorResponse{
-			Estado:      "error",
-			Code:        "500",
-			Description: "Error al enviar a SUNAT",
-			Details:     err.Error(),
+		// El documento queda en error (no en processing) para que el cliente pueda
+		// reintentarlo tras un timeout o falla de red (ver comprobarReenvio)
+		docRepo.UpdateStatus(documentID, models.StatusError, "", "Error al enviar a SUNAT: "+err.Error())
+		auditRepo.CreateLog(documentID, repository.ActionError, "Error al enviar a SUNAT: "+err.Error(), userIP)
+		return 0, models.APIResponse{}, &errorProceso{
+			Status:  http.StatusInternalServerError,
+			Mensaje: "Error al enviar a SUNAT: " + err.Error(),
+			Detalle: &models.ErrorResponse{
+				Estado:      "error",
+				Code:        "500",
+				Description: "Error al enviar a SUNAT",
+				Details:     err.Error(),
+			},
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(errorResponse)
-		return
 	}
+
+	// Los destinos asíncronos responden con un ticket que se consulta después
+	if envio.Ticket != "" {
+		response := procesarTicketRecibido(documento, documentID, nombreXML, zipPath, digest, signatureValue, envio.Ticket, userIP)
+		response.Advertencias = advertencias
+		if opciones.IncluirPDF {
+			adjuntarPDF(&response, documentID)
+		}
+		return http.StatusAccepted, response, nil
+	}
+	cdrInfo := envio.CDR
 	fmt.Println("PASO 5 y 6: CDR recibido.")
 
 	// Actualizar estado en BD según respuesta SUNAT
-	var estadoDB string
-	switch cdrInfo.Estado {
-	case "aprobada":
-		estadoDB = models.StatusApproved
-		auditRepo.CreateLog(documentID, repository.ActionApproved, "Documento aprobado por SUNAT", r.RemoteAddr)
-	case "rechazada":
-		estadoDB = models.StatusRejected
-		auditRepo.CreateLog(documentID, repository.ActionRejected, "Documento rechazado por SUNAT", r.RemoteAddr)
-	case "observada":
-		estadoDB = models.StatusObserved
-		auditRepo.CreateLog(documentID, repository.ActionError, "Documento observado por SUNAT", r.RemoteAddr)
-	default:
-		estadoDB = models.StatusError
-		auditRepo.CreateLog(documentID, repository.ActionError, "Error en respuesta SUNAT", r.RemoteAddr)
-	}
-	
-	docRepo.UpdateStatus(documentID, estadoDB, cdrInfo.ResponseCode, cdrInfo.Description)
+	registrarEstadoCDR(documentID, cdrInfo, userIP)
 
 	// Leer archivos para incluir en respuesta
 	xmlContent, _ := ioutil.ReadFile(nombreXML)
 	xmlBase64 := base64.StdEncoding.EncodeToString(xmlContent)
 	
-	// Generar PDF
-	pdfPath := pdf.GeneratePDFPath(documento)
-	err = pdf.GeneratePDF(documento, pdfPath)
-	if err != nil {
-		fmt.Printf("Warning: No se pudo generar PDF: %v\n", err)
-	}
+	// Generar PDF (ruta vacía si falla, para poder regenerarlo después)
+	pdfPath := generarPDFDocumento(documento, documentID, digest, userIP)
 	
 	// Actualizar rutas de archivos en BD
+	persistirArchivos(documentID, userIP, nombreXML, pdfPath, cdrInfo.CDRZipPath, zipPath)
 	docRepo.UpdateFilePaths(documentID, nombreXML, pdfPath, cdrInfo.CDRZipPath, zipPath)
+	guardarContenidosBD(documentID, userIP, nombreXML, cdrInfo.CDRZipPath, zipPath)
 	
-	pdfURL := fmt.Sprintf("http://%s:%s/api/v1/documents/%s/pdf", appConfig.Server.Host, appConfig.Server.Port, documentID)
+	pdfURL := construirPDFURL(documentID, pdfPath)
+
+	// Con SUNAT_OBSERVADOS=aceptar un documento observado es una aceptación con advertencia
+	if cdrInfo.Estado == "observada" && !appConfig.ObservadosRequierenAccion() {
+		advertencias = append(advertencias, fmt.Sprintf("SUNAT aceptó el comprobante con %d observación(es)", len(cdrInfo.Observaciones)))
+	}
 	
 	// Preparar respuesta según requerimientos
 	response := models.APIResponse{
 		Estado:      cdrInfo.Estado,
 		Code:        cdrInfo.ResponseCode,
-		Description: fmt.Sprintf("La Factura numero %s-%s, ha sido %s", documento.Serie, documento.Numero, cdrInfo.Estado),
+		Description: descripcionRespuesta(documento.TipoDocumento, documento.Serie, documento.Numero, cdrInfo.Estado),
 		Hash:        fmt.Sprintf("SHA1:%s|RSA:%s", digest, signatureValue),
 		CDRZip:      cdrInfo.CDRZipBase64,
 		XMLFirmado:  xmlBase64,
 		PDFURL:      pdfURL,
+
+		Advertencias:  advertencias,
+		Observaciones: cdrInfo.Observaciones,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	if opciones.IncluirPDF {
+		adjuntarPDF(&response, documentID)
+	}
+
+	return statusHTTPSegunCDR(cdrInfo.Estado), response, nil
+}
+
+// adjuntarPDF incluye en la respuesta el PDF del documento en base64 (?incluirPDF=base64),
+// para que el cliente no tenga que pedirlo en una segunda llamada
+func adjuntarPDF(response *models.APIResponse, documentID string) {
+	contenido, err := leerPDFDocumento(documentID, "")
+	if err != nil {
+		response.Advertencias = append(response.Advertencias, "No se pudo incluir el PDF en la respuesta: "+err.Error())
+		return
+	}
+	response.PDFBase64 = base64.StdEncoding.EncodeToString(contenido)
+}
+
+// statusHTTPSegunCDR retorna el código HTTP de la respuesta según el estado del CDR: un
+// documento observado responde 422 si SUNAT_OBSERVADOS exige corregirlo
+func statusHTTPSegunCDR(estadoCDR string) int {
+	if estadoCDR == "observada" && appConfig.ObservadosRequierenAccion() {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusOK
+}
+
+// generarPDFDocumento genera el PDF del comprobante y retorna su ruta. El digest es el
+// DigestValue de la firma del XML, usado como valor resumen en el código QR.
+// Si la generación falla retorna ruta vacía y registra el error en auditoría
+// para que el PDF pueda regenerarse más adelante. La generación se limita a PDF_TIMEOUT_SECONDS:
+// el PDF es secundario respecto al XML/CDR y no debe demorar la respuesta de emisión.
+func generarPDFDocumento(documento models.ComprobanteBase, documentID, digest, userIP string) string {
+	ctx := context.Background()
+	if appConfig.PDF.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, appConfig.PDF.Timeout)
+		defer cancel()
+	}
+
+	pdfPath := pdf.GeneratePDFPath(documento, appConfig.Files.NamePattern)
+	if err := pdf.GeneratePDFContext(ctx, documento, pdfPath, pdf.OpcionesPDF{Idioma: documento.IdiomaPDF, DigestValue: digest}); err != nil {
+		fmt.Printf("Warning: No se pudo generar PDF: %v\n", err)
+		auditRepo.CreateLog(documentID, repository.ActionPDFError, "Error generando PDF: "+err.Error(), userIP)
+		return ""
+	}
+	return pdfPath
+}
+
+// construirPDFURL arma la URL pública del PDF, vacía si el PDF no se generó
+func construirPDFURL(documentID, pdfPath string) string {
+	if pdfPath == "" {
+		return ""
+	}
+	return fmt.Sprintf("http://%s:%s/api/v1/documents/%s/pdf", appConfig.Server.Host, appConfig.Server.Port, documentID)
+}
+
+// procesarContingencia persiste el documento firmado como pendiente de envío,
+// genera el PDF y arma la respuesta sin contactar a SUNAT
+func procesarContingencia(documento models.ComprobanteBase, documentID, nombreXML, zipPath, digest, signatureValue, userIP string) models.APIResponse {
+	docRepo.UpdateStatus(documentID, models.StatusPendingSend, "", "Generado en modo contingencia, pendiente de envío a SUNAT")
+	auditRepo.CreateLog(documentID, repository.ActionPendingSend, "Documento firmado en modo contingencia", userIP)
+
+	pdfPath := generarPDFDocumento(documento, documentID, digest, userIP)
+
+	persistirArchivos(documentID, userIP, nombreXML, pdfPath, zipPath)
+	docRepo.UpdateFilePaths(documentID, nombreXML, pdfPath, "", zipPath)
+	guardarContenidosBD(documentID, userIP, nombreXML, "", zipPath)
+	fmt.Println("CONTINGENCIA: documento firmado y pendiente de envío a SUNAT.")
+
+	xmlContent, _ := ioutil.ReadFile(nombreXML)
+	pdfURL := construirPDFURL(documentID, pdfPath)
+
+	return models.APIResponse{
+		Estado:      "pendiente_envio",
+		Code:        "",
+		Description: fmt.Sprintf("El comprobante numero %s-%s, ha sido generado en modo contingencia y está pendiente de envío a SUNAT", documento.Serie, documento.Numero),
+		Hash:        fmt.Sprintf("SHA1:%s|RSA:%s", digest, signatureValue),
+		XMLFirmado:  base64.StdEncoding.EncodeToString(xmlContent),
+		PDFURL:      pdfURL,
+	}
+}
+
+// inicializarFirmanteHSM abre la sesión PKCS#11 una sola vez; la clave permanece en el
+// HSM y cada firma solo le envía el digest
+func inicializarFirmanteHSM() {
+	if appConfig.Signature.KeySource != config.FuenteClavePKCS11 {
+		return
+	}
+
+	var certificado []byte
+	if appConfig.PKCS11.CertPath != "" {
+		data, err := os.ReadFile(appConfig.PKCS11.CertPath)
+		if err != nil {
+			log.Fatal("Error leyendo certificado PKCS#11:", err)
+		}
+		certificado = data
+	}
+
+	firmante, err := signature.NuevoSignerPKCS11(signature.ConfigPKCS11{
+		Modulo:        appConfig.PKCS11.Module,
+		Token:         appConfig.PKCS11.TokenLabel,
+		PIN:           appConfig.PKCS11.PIN,
+		EtiquetaClave: appConfig.PKCS11.KeyLabel,
+		Certificado:   certificado,
+	})
+	if err != nil {
+		log.Fatal("Error inicializando firma PKCS#11:", err)
+	}
+	firmanteHSM = firmante
+	fmt.Printf("Firma con HSM PKCS#11: token %s, clave %s\n", appConfig.PKCS11.TokenLabel, appConfig.PKCS11.KeyLabel)
+}
+
+// obtenerFirmante retorna la sesión HSM abierta al arrancar o, por defecto, un firmante
+// PKCS#12 con el certificado propio del RUC emisor (CONFIG_FILE) o el del ambiente actual
+// (CERT_PATH / CERT_BASE64). Con ruc vacío se usa el certificado general.
+func obtenerFirmante(ruc string) (signature.Signer, error) {
+	if firmanteHSM != nil {
+		return firmanteHSM, nil
+	}
+	pfxData, password, err := appConfig.CertificadoFirma(ruc)
+	if err != nil {
+		return nil, err
+	}
+	return signature.NuevoSignerPKCS12(pfxData, password)
+}
+
+// opcionesFirma arma las opciones XMLDSig configuradas (canonicalización y prefijos)
+func opcionesFirma() signature.OpcionesFirma {
+	return signature.OpcionesFirma{
+		Canonicalizacion: appConfig.Signature.Canonicalization, // Algoritmo C14N configurado
+		PrefixList:       appConfig.Signature.PrefixList,       // Prefijos inclusivos
+		Prefijo:          appConfig.Signature.NamespacePrefix,  // Prefijo del namespace XMLDSig
+	}
+}
+
+// verificarCertificadoAmbiente comprueba que el certificado corresponda al ambiente SUNAT.
+// En producción un certificado de prueba detiene el arranque; en beta un certificado
+// real solo genera una advertencia.
+func verificarCertificadoAmbiente() {
+	firmante, err := obtenerFirmante("")
+	if err != nil {
+		log.Fatal("Error cargando certificado:", err)
+	}
+	cert := firmante.Certificado()
+	if err := signature.VerificarVigencia(cert, time.Now()); err != nil {
+		log.Fatalf("Certificado '%s' no vigente: %v", cert.Subject.CommonName, err)
+	}
+	advertirVencimientoCertificado("en uso", signature.NuevoCertInfo(cert, time.Now()))
+
+	esPrueba := esCertificadoDePrueba(cert)
+	switch {
+	case appConfig.SUNAT.Ambiente == config.AmbienteProduccion && esPrueba:
+		log.Fatalf("El certificado '%s' es de prueba y el ambiente SUNAT es producción; configure CERT_PATH_PROD "+
+			"(si es un certificado real detectado por error, configure CERT_TYPE=%s)", cert.Subject.CommonName, config.CertificadoReal)
+	case appConfig.SUNAT.Ambiente != config.AmbienteProduccion && !esPrueba:
+		log.Printf("Advertencia: se está usando un certificado real ('%s') en el ambiente %s", cert.Subject.CommonName, appConfig.SUNAT.Ambiente)
+	}
+	fmt.Printf("Certificado para ambiente %s: %s (vence el %s)\n", appConfig.SUNAT.Ambiente, cert.Subject.CommonName, cert.NotAfter.Format("2006-01-02"))
+
+	verificarCertificadosConfigurados()
+}
+
+// esCertificadoDePrueba aplica CERT_TYPE si se configuró "prueba" o "real"; con "auto"
+// detecta el tipo por el subject del certificado
+func esCertificadoDePrueba(cert *x509.Certificate) bool {
+	switch appConfig.Certificate.Tipo {
+	case config.CertificadoPrueba:
+		return true
+	case config.CertificadoReal:
+		return false
+	}
+	return signature.EsCertificadoDePrueba(cert)
+}
+
+// verificarCertificadosConfigurados valida los demás PFX configurados (por ejemplo el de
+// producción mientras se trabaja en beta) para detectar en el despliegue contraseñas
+// incorrectas o certificados vencidos. No detienen el arranque porque no se usan ahora.
+func verificarCertificadosConfigurados() {
+	enUso := appConfig.CertificatePath()
+	for variable, ruta := range appConfig.CertificatePaths() {
+		if ruta == enUso && firmanteHSM == nil {
+			continue
+		}
+		verificarCertificadoArchivo(variable, ruta, appConfig.Certificate.Password)
+	}
+
+	// Certificados propios de los emisores (CONFIG_FILE)
+	if firmanteHSM == nil {
+		for ruc, propio := range appConfig.Emisores.Certificados {
+			verificarCertificadoArchivo("del emisor "+ruc, propio.Path, propio.Password)
+		}
+	}
+}
+
+// verificarCertificadoArchivo advierte si el PFX no se puede leer, no abre con la
+// contraseña, no está vigente o está por vencer
+func verificarCertificadoArchivo(origen, ruta, password string) {
+	info, err := signature.ValidarCertificado(ruta, password)
+	if err != nil {
+		log.Printf("Advertencia: %s (%s): %v", origen, ruta, err)
+		return
+	}
+	advertirVencimientoCertificado(origen, info)
+}
+
+// advertirVencimientoCertificado avisa si el certificado vence dentro de CERT_EXPIRY_WARNING_DAYS
+func advertirVencimientoCertificado(origen string, info *signature.CertInfo) {
+	if info.DiasParaVencer <= appConfig.Certificate.ExpiryWarningDays {
+		log.Printf("Advertencia: el certificado %s ('%s') vence en %d días (%s)",
+			origen, info.Sujeto, info.DiasParaVencer, info.ValidoHasta.Format("2006-01-02"))
+	}
+}
+
+// procesarTicketRecibido guarda el ticket de un envío asíncrono, genera el PDF y arma
+// la respuesta; el CDR se obtiene luego con consultar-ticket o el job de tickets
+func procesarTicketRecibido(documento models.ComprobanteBase, documentID, nombreXML, zipPath, digest, signatureValue, ticket, userIP string) models.APIResponse {
+	docRepo.UpdateTicket(documentID, ticket)
+	auditRepo.CreateLog(documentID, repository.ActionTicketPending, "Envío asíncrono recibido con ticket "+ticket, userIP)
+
+	pdfPath := generarPDFDocumento(documento, documentID, digest, userIP)
+
+	docRepo.UpdateFilePaths(documentID, nombreXML, pdfPath, "", zipPath)
+	guardarContenidosBD(documentID, userIP, nombreXML, "", zipPath)
+	fmt.Println("PASO 5: ticket recibido:", ticket)
+
+	xmlContent, _ := ioutil.ReadFile(nombreXML)
+	pdfURL := construirPDFURL(documentID, pdfPath)
+
+	return models.APIResponse{
+		Estado:      models.StatusTicketPending,
+		Code:        ticket,
+		Description: fmt.Sprintf("El comprobante numero %s-%s fue recibido con el ticket %s, pendiente de consulta", documento.Serie, documento.Numero, ticket),
+		Hash:        fmt.Sprintf("SHA1:%s|RSA:%s", digest, signatureValue),
+		XMLFirmado:  base64.StdEncoding.EncodeToString(xmlContent),
+		PDFURL:      pdfURL,
+	}
+}
+
+// destinoEnvio convierte un destino de la configuración al tipo usado por utils
+func destinoEnvio(nombre string, d config.DestinoSUNAT) utils.Destino {
+	return utils.Destino{
+		Nombre:  nombre,
+		Tipo:    d.Tipo,
+		URL:     d.URL,
+		Usuario: d.Username,
+		Clave:   d.Password,
+		Token:   d.Token,
+	}
 }
 
 // manerjarDocumentos maneja las rutas de documentos (PDF, XML, etc.)
@@ -334,40 +1021,293 @@ func manerjarDocumentos(w http.ResponseWriter, r *http.Request) {
 		servirXML(w, r, documentID)
 	case "status":
 		consultarEstado(w, r, documentID)
+	case "consultar-ticket":
+		consultarTicket(w, r, documentID)
+	case "cdr-pdf":
+		servirCDRPDF(w, r, documentID)
+	case "regenerar-xml":
+		manejarRegenerarXML(w, r, documentID)
+	case "timeline":
+		consultarTimeline(w, r, documentID)
+	case "consultar":
+		consultarDocumentoSUNAT(w, r, documentID)
+	case "emitir":
+		emitirBorrador(w, r, documentID)
 	default:
-		http.Error(w, "Acción no soportada. Use: pdf, xml, status", http.StatusBadRequest)
+		http.Error(w, "Acción no soportada. Use: pdf, xml, status, consultar-ticket, consultar, cdr-pdf, regenerar-xml, timeline, emitir", http.StatusBadRequest)
+	}
+}
+
+// rutaArchivoDocumento obtiene la ruta guardada en BD del PDF o XML del documento
+// (que sigue la plantilla de nombres vigente al emitirlo), o la ruta estándar en out/
+func rutaArchivoDocumento(documentID, extension string) string {
+	if doc, err := docRepo.GetByID(documentID); err == nil {
+		switch {
+		case extension == "pdf" && doc.PDFPath != "":
+			return doc.PDFPath
+		case extension == "xml" && doc.XMLPath != "":
+			return doc.XMLPath
+		}
 	}
+	return fmt.Sprintf("out/%s.%s", documentID, extension)
 }
 
 // servirPDF sirve el archivo PDF del documento
 func servirPDF(w http.ResponseWriter, r *http.Request, documentID string) {
-	// Por ahora buscar en la carpeta out/ usando el documentID
-	pdfPath := fmt.Sprintf("out/%s.pdf", documentID)
-	
-	// Verificar si el archivo existe
-	if _, err := os.Stat(pdfPath); os.IsNotExist(err) {
-		http.Error(w, "PDF no encontrado", http.StatusNotFound)
+	// Leer el PDF desde el almacenamiento configurado o regenerarlo desde la BD
+	contenido, err := leerPDFDocumento(documentID, r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "PDF no encontrado para el documento "+documentID+", es posible que su generación haya fallado", http.StatusNotFound)
 		return
 	}
 	
 	// Servir el archivo PDF
 	w.Header().Set("Content-Type", "application/pdf")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%s.pdf", documentID))
-	http.ServeFile(w, r, pdfPath)
+	w.Write(contenido)
+}
+
+// leerPDFDocumento lee el PDF del documento desde el almacenamiento. Si el archivo no
+// existe en esta instancia, lo regenera con el comprobante y el DigestValue guardados en BD.
+func leerPDFDocumento(documentID, userIP string) ([]byte, error) {
+	contenido, err := leerArchivo(rutaArchivoDocumento(documentID, "pdf"))
+	if err == nil {
+		return contenido, nil
+	}
+
+	doc, errBD := docRepo.GetByID(documentID)
+	// Los resúmenes diarios no tienen representación impresa
+	if errBD != nil || doc.Payload == "" || doc.HashSHA1 == "" || doc.TipoDoc == models.TipoDocResumenDiario {
+		return nil, err
+	}
+	var documento models.ComprobanteBase
+	if errJSON := json.Unmarshal([]byte(doc.Payload), &documento); errJSON != nil {
+		return nil, err
+	}
+	pdfPath := generarPDFDocumento(documento, documentID, doc.HashSHA1, userIP)
+	if pdfPath == "" {
+		return nil, err
+	}
+	persistirArchivos(documentID, userIP, pdfPath)
+	return os.ReadFile(pdfPath)
 }
 
 // servirXML sirve el archivo XML del documento
 func servirXML(w http.ResponseWriter, r *http.Request, documentID string) {
-	xmlPath := fmt.Sprintf("out/%s.xml", documentID)
+	xmlPath := rutaArchivoDocumento(documentID, "xml")
 	
-	if _, err := os.Stat(xmlPath); os.IsNotExist(err) {
+	contenido, err := leerContenidoDocumento(documentID, xmlPath, contenidoXML)
+	if err != nil {
 		http.Error(w, "XML no encontrado", http.StatusNotFound)
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/xml")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.xml", documentID))
-	http.ServeFile(w, r, xmlPath)
+	w.Write(contenido)
+}
+
+// servirCDRPDF genera (o regenera) la constancia legible del CDR del documento y la sirve
+func servirCDRPDF(w http.ResponseWriter, r *http.Request, documentID string) {
+	doc, err := docRepo.GetByID(documentID)
+	if err != nil {
+		http.Error(w, "Documento no encontrado", http.StatusNotFound)
+		return
+	}
+	if doc.CDRPath == "" {
+		http.Error(w, "El documento "+documentID+" no tiene CDR de SUNAT", http.StatusNotFound)
+		return
+	}
+
+	cdrZip, err := leerContenidoDocumento(documentID, doc.CDRPath, contenidoCDR)
+	if err != nil {
+		http.Error(w, "CDR no encontrado para el documento "+documentID, http.StatusNotFound)
+		return
+	}
+	cdr, err := utils.LeerCDRContenido(doc.CDRPath, cdrZip)
+	if err != nil {
+		http.Error(w, "Error al leer el CDR: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// La constancia se guarda junto al CDR para no mezclarla con los PDF del comprobante
+	pdfPath := filepath.Join(filepath.Dir(doc.CDRPath), "CDR-"+documentID+".pdf")
+	os.MkdirAll(filepath.Dir(pdfPath), 0755)
+	if err := pdf.GenerarPDFCDR(*doc, *cdr, pdfPath); err != nil {
+		http.Error(w, "Error al generar el PDF del CDR: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=CDR-%s.pdf", documentID))
+	http.ServeFile(w, r, pdfPath)
+}
+
+/*
+consultarTicket consulta en SUNAT el ticket de un envío asíncrono y, si el CDR
+ya está listo, actualiza el estado del documento.
+
+Mientras SUNAT responda 98 (en proceso) el documento sigue en ticket_pending
+y se responde 202 para que el cliente vuelva a consultar.
+*/
+func consultarTicket(w http.ResponseWriter, r *http.Request, documentID string) {
+	doc, err := docRepo.GetByID(documentID)
+	if err != nil {
+		http.Error(w, "Documento no encontrado", http.StatusNotFound)
+		return
+	}
+	if doc.Ticket == "" {
+		http.Error(w, "El documento "+documentID+" no tiene ticket de envío asíncrono", http.StatusBadRequest)
+		return
+	}
+
+	estadoTicket, err := consultarTicketDocumento(doc, r.RemoteAddr)
+	if err != nil {
+		escribirErrorConsulta(w, r, "Error al consultar el ticket en SUNAT", err)
+		return
+	}
+
+	if estadoTicket.EnProceso {
+		escribirRespuesta(w, r, http.StatusAccepted, models.APIResponse{
+			Estado:      models.StatusTicketPending,
+			Code:        estadoTicket.StatusCode,
+			Description: fmt.Sprintf("El ticket %s aún está en proceso en SUNAT", doc.Ticket),
+		})
+		return
+	}
+
+	escribirRespuesta(w, r, statusHTTPSegunCDR(estadoTicket.CDR.Estado), models.APIResponse{
+		Estado:      estadoTicket.CDR.Estado,
+		Code:        estadoTicket.CDR.ResponseCode,
+		Description: estadoTicket.CDR.Description,
+		CDRZip:      estadoTicket.CDR.CDRZipBase64,
+
+		Observaciones: estadoTicket.CDR.Observaciones,
+	})
+}
+
+// consultarTicketDocumento consulta el ticket del documento y, si SUNAT ya entregó
+// el CDR, actualiza el estado y la ruta del CDR en BD
+func consultarTicketDocumento(doc *models.Document, userIP string) (*utils.EstadoTicket, error) {
+	zipName := doc.ID + ".zip"
+	if doc.ZIPPath != "" {
+		zipName = filepath.Base(doc.ZIPPath)
+	}
+
+	nombreDestino, destinoConfig, err := appConfig.Destino(doc.RUC, doc.Destino)
+	if err != nil {
+		return nil, err
+	}
+
+	estadoTicket, err := utils.ConsultarTicketDestino(destinoEnvio(nombreDestino, destinoConfig), doc.RUC, doc.Ticket, zipName, "cdr")
+	if err != nil {
+		return nil, err
+	}
+	if estadoTicket.EnProceso {
+		return estadoTicket, nil
+	}
+
+	registrarEstadoCDR(doc.ID, estadoTicket.CDR, userIP)
+	persistirArchivos(doc.ID, userIP, estadoTicket.CDR.CDRZipPath)
+	docRepo.UpdateCDRPath(doc.ID, estadoTicket.CDR.CDRZipPath)
+	guardarContenidosBD(doc.ID, userIP, "", estadoTicket.CDR.CDRZipPath, "")
+	return estadoTicket, nil
+}
+
+/*
+manejarListadoDocumentos lista documentos combinando filtros opcionales:
+- ruc, estado: coincidencia exacta
+- desde, hasta: fechas YYYY-MM-DD de creación, ambas inclusive
+- limit (por defecto 50, máximo 500) y offset para paginación
+
+Retorna el total de documentos que cumplen los filtros junto con la página pedida.
+*/
+func manejarListadoDocumentos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	var desde, hasta time.Time
+	var err error
+	if valor := query.Get("desde"); valor != "" {
+		if desde, err = time.ParseInLocation("2006-01-02", valor, time.Local); err != nil {
+			http.Error(w, "El parámetro desde debe tener formato YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	if valor := query.Get("hasta"); valor != "" {
+		if hasta, err = time.ParseInLocation("2006-01-02", valor, time.Local); err != nil {
+			http.Error(w, "El parámetro hasta debe tener formato YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		hasta = hasta.AddDate(0, 0, 1) // Incluir el día completo
+	}
+	if !desde.IsZero() && !hasta.IsZero() && !desde.Before(hasta) {
+		http.Error(w, "El rango de fechas es inválido: desde es posterior a hasta", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset := 50, 0
+	if valor := query.Get("limit"); valor != "" {
+		if limit, err = strconv.Atoi(valor); err != nil || limit < 1 || limit > 500 {
+			http.Error(w, "El parámetro limit debe estar entre 1 y 500", http.StatusBadRequest)
+			return
+		}
+	}
+	if valor := query.Get("offset"); valor != "" {
+		if offset, err = strconv.Atoi(valor); err != nil || offset < 0 {
+			http.Error(w, "El parámetro offset debe ser un entero no negativo", http.StatusBadRequest)
+			return
+		}
+	}
+
+	docs, total, err := docRepo.GetByFilters(query.Get("ruc"), query.Get("estado"), desde, hasta, limit, offset)
+	if err != nil {
+		http.Error(w, "Error al consultar documentos: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+		"documentos": docs,
+	})
+}
+
+// manejarBusquedaPorReferencia busca documentos por la referencia externa (ID de venta o
+// pedido en el sistema del cliente), opcionalmente acotando por RUC del emisor
+func manejarBusquedaPorReferencia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	referencia := strings.TrimSpace(r.URL.Query().Get("ref"))
+	if referencia == "" {
+		http.Error(w, "Parámetro requerido: ref", http.StatusBadRequest)
+		return
+	}
+
+	docs, err := docRepo.GetByReferenciaExterna(r.URL.Query().Get("ruc"), referencia)
+	if err != nil {
+		http.Error(w, "Error al consultar documentos: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(docs) == 0 {
+		http.Error(w, "No hay documentos con la referencia "+referencia, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"referencia": referencia,
+		"documentos": docs,
+	})
 }
 
 // consultarEstado consulta el estado del documento desde la BD
@@ -375,6 +1315,10 @@ func consultarEstado(w http.ResponseWriter, r *http.Request, documentID string)
 	// Buscar documento en la base de datos
 	doc, err := docRepo.GetByID(documentID)
 	if err != nil {
+		// Los documentos asíncronos no existen en BD hasta que un worker los procesa
+		if consultarEstadoCola(w, documentID) {
+			return
+		}
 		http.Error(w, "Documento no encontrado", http.StatusNotFound)
 		return
 	}
@@ -389,11 +1333,21 @@ func consultarEstado(w http.ResponseWriter, r *http.Request, documentID string)
 		"serie":         doc.Serie,
 		"numero":        doc.Numero,
 		"cliente":       doc.Cliente,
+		"referencia_externa": doc.ReferenciaExterna,
 		"total":         doc.Total,
 		"moneda":        doc.Moneda,
+		"desglose": map[string]float64{
+			"base_gravada":   doc.BaseGravada,
+			"base_exonerada": doc.BaseExonerada,
+			"base_inafecta":  doc.BaseInafecta,
+			"total_igv":      doc.TotalIGV,
+			"total_isc":      doc.TotalISC,
+		},
 		"estado":        doc.Estado,
 		"codigo_sunat":  doc.CodigoSUNAT,
+		"ticket":        doc.Ticket,
 		"mensaje_sunat": doc.MensajeSUNAT,
+		"observaciones": doc.Observaciones,
 		"created_at":    doc.CreatedAt,
 		"updated_at":    doc.UpdatedAt,
 		"processed_at":  doc.ProcessedAt,
@@ -414,6 +1368,50 @@ func consultarEstado(w http.ResponseWriter, r *http.Request, documentID string)
 	json.NewEncoder(w).Encode(status)
 }
 
+// manejarSiguienteNumero retorna el siguiente correlativo disponible para una serie
+// GET /api/v1/series/next?ruc=X&tipoDoc=01&serie=F001[&reservar=true]
+func manejarSiguienteNumero(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	ruc := query.Get("ruc")
+	tipoDoc := query.Get("tipoDoc")
+	serie := query.Get("serie")
+
+	if len(ruc) != 11 || tipoDoc == "" || serie == "" {
+		http.Error(w, "Parámetros requeridos: ruc (11 dígitos), tipoDoc y serie", http.StatusBadRequest)
+		return
+	}
+
+	var siguiente int64
+	var err error
+	reservar := query.Get("reservar") == "true"
+	if reservar {
+		// Reserva atómica para evitar que dos cajas obtengan el mismo número
+		siguiente, err = docRepo.ReservarNumero(ruc, tipoDoc, serie)
+	} else {
+		siguiente, err = docRepo.GetSiguienteNumero(ruc, tipoDoc, serie)
+	}
+	if err != nil {
+		http.Error(w, "Error al consultar correlativo: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"ruc":       ruc,
+		"tipoDoc":   tipoDoc,
+		"serie":     serie,
+		"siguiente": fmt.Sprintf("%d", siguiente),
+		"reservado": reservar,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // splitPath divide un path en partes separadas por /
 func splitPath(path string) []string {
 	var parts []string
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"ubl-go-conversor/models"
+	"ubl-go-conversor/repository"
+)
+
+/*
+recuperarPanic envuelve un handler HTTP para que un panic (por ejemplo, un nil pointer
+en el conversor con datos inesperados) no corte la conexión sin respuesta.
+
+Registra el stack trace y responde un ErrorResponse 500 al cliente.
+*/
+func recuperarPanic(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Printf("PANIC en %s %s: %v\n%s", r.Method, r.URL.Path, rec, debug.Stack())
+
+				escribirRespuesta(w, r, http.StatusInternalServerError, models.ErrorResponse{
+					Estado:      "error",
+					Code:        "500",
+					Description: "Error interno del servidor",
+					Details:     fmt.Sprintf("%v", rec),
+				})
+			}
+		}()
+
+		next(w, r)
+	}
+}
+
+// limitarBody corta la lectura del body al superar maxBytes, para que un payload enorme
+// no agote la memoria; el handler detecta el corte con responderErrorJSON (413)
+func limitarBody(maxBytes int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next(w, r)
+	}
+}
+
+// responderErrorJSON responde el error al decodificar el body: 413 si excedió el tamaño
+// máximo (limitarBody) o 400 con el mensaje indicado en cualquier otro caso
+func responderErrorJSON(w http.ResponseWriter, err error, mensaje string) {
+	var excedido *http.MaxBytesError
+	if errors.As(err, &excedido) {
+		http.Error(w, fmt.Sprintf("El body excede el tamaño máximo permitido de %d MB", excedido.Limit>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, mensaje+err.Error(), http.StatusBadRequest)
+}
+
+// claveCliente es la clave de contexto con el identificador del cliente autenticado
+type claveCliente struct{}
+
+/*
+autenticar exige el header X-API-Key cuando hay API keys configuradas (API_KEYS o
+API_ADMIN_KEYS) y deja en el contexto el identificador del cliente, que se registra
+en cada documento emitido. Sin claves configuradas el servicio no exige autenticación.
+*/
+func autenticar(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(appConfig.Auth.Keys) == 0 && len(appConfig.Auth.AdminKeys) == 0 {
+			next(w, r)
+			return
+		}
+
+		clave := r.Header.Get("X-API-Key")
+		cliente, ok := appConfig.Auth.Keys[clave]
+		if !ok {
+			cliente, ok = appConfig.Auth.AdminKeys[clave]
+		}
+		if clave == "" || !ok {
+			http.Error(w, "API key inválida o ausente (header X-API-Key)", http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), claveCliente{}, cliente)))
+	}
+}
+
+// soloAdmin restringe el endpoint a las API keys administrativas (API_ADMIN_KEYS)
+func soloAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cliente, ok := appConfig.Auth.AdminKeys[r.Header.Get("X-API-Key")]
+		if !ok {
+			http.Error(w, "Se requiere una API key administrativa (API_ADMIN_KEYS)", http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), claveCliente{}, cliente)))
+	}
+}
+
+// clienteAutenticado retorna el identificador del cliente de la request, vacío si el
+// servicio no exige autenticación
+func clienteAutenticado(r *http.Request) string {
+	cliente, _ := r.Context().Value(claveCliente{}).(string)
+	return cliente
+}
+
+/*
+limitarPorIP limita las requests por minuto de cada IP (ventana fija de un minuto).
+Pensado para endpoints públicos sin API key; al superar el límite responde 429 con
+Retry-After. Un límite 0 o negativo desactiva la restricción.
+*/
+func limitarPorIP(limite int, next http.HandlerFunc) http.HandlerFunc {
+	if limite <= 0 {
+		return next
+	}
+
+	var mu sync.Mutex
+	ventana := time.Now().Truncate(time.Minute)
+	conteo := map[string]int{}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		mu.Lock()
+		ahora := time.Now()
+		if actual := ahora.Truncate(time.Minute); actual.After(ventana) {
+			ventana = actual
+			conteo = map[string]int{}
+		}
+		conteo[ip]++
+		excedido := conteo[ip] > limite
+		mu.Unlock()
+
+		if excedido {
+			espera := ventana.Add(time.Minute).Sub(ahora)
+			w.Header().Set("Retry-After", strconv.Itoa(int(espera.Seconds())+1))
+			http.Error(w, "Demasiadas consultas, intente nuevamente en un minuto", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// marcarErrorSiPanic marca el documento como error en BD si ocurre un panic después de
+// crearlo, y relanza el panic para que lo maneje el middleware o el worker batch
+func marcarErrorSiPanic(documentID, userIP string) {
+	if rec := recover(); rec != nil {
+		mensaje := fmt.Sprintf("Error interno durante el procesamiento: %v", rec)
+		docRepo.UpdateStatus(documentID, models.StatusError, "", mensaje)
+		auditRepo.CreateLog(documentID, repository.ActionError, mensaje, userIP)
+		panic(rec)
+	}
+}
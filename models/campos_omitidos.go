@@ -0,0 +1,122 @@
+package models
+
+import "encoding/json"
+
+/*
+Go deserializa un número ausente en el JSON como 0, por lo que "cantidad": 0 y un
+ítem sin cantidad llegarían iguales al validador. Los UnmarshalJSON de este archivo
+decodifican los montos como json.RawMessage: un campo requerido que no vino en el
+payload queda registrado en CamposOmitidos(), mientras que un cero explícito se
+conserva como valor. Los montos pueden venir como número o texto (ver montos.go).
+
+Los comprobantes construidos en código (no desde JSON) no registran campos omitidos.
+*/
+
+// campoNumerico asocia el nombre JSON de un campo numérico con su valor crudo.
+// Solo los campos requeridos se reportan como omitidos.
+type campoNumerico struct {
+	nombre    string
+	valor     json.RawMessage
+	destino   *float64
+	requerido bool
+}
+
+// asignarCampos decodifica los valores presentes y retorna los nombres de los
+// requeridos omitidos, o un error si algún monto no tiene un formato reconocido
+func asignarCampos(campos []campoNumerico) ([]string, error) {
+	var omitidos []string
+	for _, campo := range campos {
+		valor, err := decodificarMonto(campo.nombre, campo.valor)
+		if err != nil {
+			return nil, err
+		}
+		if valor == nil {
+			if campo.requerido {
+				omitidos = append(omitidos, campo.nombre)
+			}
+			continue
+		}
+		*campo.destino = *valor
+	}
+	return omitidos, nil
+}
+
+func (c *ComprobanteBase) UnmarshalJSON(data []byte) error {
+	type comprobanteAlias ComprobanteBase
+	aux := struct {
+		*comprobanteAlias
+		TotalGravado      json.RawMessage `json:"totalGravado"`
+		TotalIGV          json.RawMessage `json:"totalIGV"`
+		TotalPrecioVenta  json.RawMessage `json:"totalPrecioVenta"`
+		TotalImportePagar json.RawMessage `json:"totalImportePagar"`
+		TotalGratuito     json.RawMessage `json:"totalGratuito"`
+		TotalISC          json.RawMessage `json:"totalISC"`
+		TotalICBPER       json.RawMessage `json:"totalICBPER"`
+		MontoPercepcion   json.RawMessage `json:"montoPercepcion"`
+		MontoRedondeo     json.RawMessage `json:"montoRedondeo"`
+		TipoCambio        json.RawMessage `json:"tipoCambio"`
+	}{comprobanteAlias: (*comprobanteAlias)(c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	omitidos, err := asignarCampos([]campoNumerico{
+		{nombre: "totalGravado", valor: aux.TotalGravado, destino: &c.TotalGravado},
+		{nombre: "totalIGV", valor: aux.TotalIGV, destino: &c.TotalIGV},
+		{nombre: "totalPrecioVenta", valor: aux.TotalPrecioVenta, destino: &c.TotalPrecioVenta, requerido: true},
+		{nombre: "totalImportePagar", valor: aux.TotalImportePagar, destino: &c.TotalImportePagar, requerido: true},
+		{nombre: "totalGratuito", valor: aux.TotalGratuito, destino: &c.TotalGratuito},
+		{nombre: "totalISC", valor: aux.TotalISC, destino: &c.TotalISC},
+		{nombre: "totalICBPER", valor: aux.TotalICBPER, destino: &c.TotalICBPER},
+		{nombre: "montoPercepcion", valor: aux.MontoPercepcion, destino: &c.MontoPercepcion},
+		{nombre: "montoRedondeo", valor: aux.MontoRedondeo, destino: &c.MontoRedondeo},
+		{nombre: "tipoCambio", valor: aux.TipoCambio, destino: &c.TipoCambio},
+	})
+	c.omitidos = omitidos
+	return err
+}
+
+// CamposOmitidos retorna los montos requeridos del comprobante que no vinieron en el JSON
+func (c ComprobanteBase) CamposOmitidos() []string {
+	return c.omitidos
+}
+
+func (i *ItemComprobante) UnmarshalJSON(data []byte) error {
+	type itemAlias ItemComprobante
+	aux := struct {
+		*itemAlias
+		Cantidad            json.RawMessage `json:"cantidad"`
+		ValorUnitario       json.RawMessage `json:"valorUnitario"`
+		PrecioVentaUnitario json.RawMessage `json:"precioVentaUnitario"`
+		ValorTotal          json.RawMessage `json:"valorTotal"`
+		IGV                 json.RawMessage `json:"igv"`
+		MontoISC            json.RawMessage `json:"montoISC"`
+		PorcentajeISC       json.RawMessage `json:"porcentajeISC"`
+		CantidadBolsas      json.RawMessage `json:"cantidadBolsas"`
+		FactorICBPER        json.RawMessage `json:"factorICBPER"`
+		ICBPER              json.RawMessage `json:"icbper"`
+	}{itemAlias: (*itemAlias)(i)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	omitidos, err := asignarCampos([]campoNumerico{
+		{nombre: "cantidad", valor: aux.Cantidad, destino: &i.Cantidad, requerido: true},
+		{nombre: "valorUnitario", valor: aux.ValorUnitario, destino: &i.ValorUnitario, requerido: true},
+		{nombre: "precioVentaUnitario", valor: aux.PrecioVentaUnitario, destino: &i.PrecioVentaUnitario},
+		{nombre: "valorTotal", valor: aux.ValorTotal, destino: &i.ValorTotal, requerido: true},
+		{nombre: "igv", valor: aux.IGV, destino: &i.IGV, requerido: true},
+		{nombre: "montoISC", valor: aux.MontoISC, destino: &i.MontoISC},
+		{nombre: "porcentajeISC", valor: aux.PorcentajeISC, destino: &i.PorcentajeISC},
+		{nombre: "cantidadBolsas", valor: aux.CantidadBolsas, destino: &i.CantidadBolsas},
+		{nombre: "factorICBPER", valor: aux.FactorICBPER, destino: &i.FactorICBPER},
+		{nombre: "icbper", valor: aux.ICBPER, destino: &i.ICBPER},
+	})
+	i.omitidos = omitidos
+	return err
+}
+
+// CamposOmitidos retorna los montos requeridos del ítem que no vinieron en el JSON
+func (i ItemComprobante) CamposOmitidos() []string {
+	return i.omitidos
+}
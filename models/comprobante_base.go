@@ -7,18 +7,109 @@ type ComprobanteBase struct {
 	HoraEmision       string        `json:"horaEmision"`
 	FechaVencimiento  string        `json:"fechaVencimiento,omitempty"`
 	TipoDocumento     string        `json:"tipoDocumento"`
+	TipoOperacion     string        `json:"tipoOperacion,omitempty"` // Catálogo 51 (por defecto 0101 venta interna)
 	Moneda            string        `json:"moneda"`
+	TipoCambio        float64       `json:"tipoCambio,omitempty"` // Tipo de cambio a soles cuando la moneda no es PEN
 	Emisor            Emisor        `json:"emisor"`
 	Cliente           Cliente       `json:"cliente"`
 	TotalGravado      float64       `json:"totalGravado"`
 	TotalIGV          float64       `json:"totalIGV"`
 	TotalPrecioVenta  float64       `json:"totalPrecioVenta"`
 	TotalImportePagar float64       `json:"totalImportePagar"`
+	TotalGratuito     float64       `json:"totalGratuito,omitempty"` // Valor referencial de las transferencias gratuitas (opcional, se verifica)
+	TotalISC          float64       `json:"totalISC,omitempty"` // Suma del ISC de los ítems (opcional, se verifica)
+	TotalICBPER       float64       `json:"totalICBPER,omitempty"` // Suma del ICBPER de los ítems (opcional, se verifica)
+	MontoRedondeo     float64       `json:"montoRedondeo,omitempty"` // Ajuste del importe a pagar por la política de redondeo (cbc:PayableRoundingAmount)
 	FormaPago		  string        `json:"formaPago"`
 	Cuotas            []Cuota       `json:"cuotas,omitempty"`
 	Items             []ItemComprobante `json:"items"`
 	Leyendas          []Leyenda     `json:"leyendas"`
-	TipoPercepcion    string        `json:"tipoPercepcion,omitempty"`
+	TipoPercepcion    string        `json:"tipoPercepcion,omitempty"` // Régimen de percepción (catálogo 22)
+	MontoPercepcion   float64       `json:"montoPercepcion,omitempty"` // Percepción calculada por el cliente (opcional, se verifica)
+	Retencion         *Retencion    `json:"retencion,omitempty"` // Retención del IGV cuando el cliente es agente de retención
+	Autoconsumo       bool          `json:"autoconsumo,omitempty"` // Permite que el cliente sea el mismo emisor (retiro de bienes)
+	ReferenciaExterna string        `json:"referenciaExterna,omitempty"` // ID de venta/pedido en el sistema del cliente (no va al XML)
+	IdiomaPDF         string        `json:"idiomaPDF,omitempty"` // Idioma de las etiquetas del PDF: "es" (por defecto) o "en"
+	Cargos            []CargoDescuento `json:"cargos,omitempty"`
+	Descuentos        []CargoDescuento `json:"descuentos,omitempty"` // Descuentos globales (02 afecta base, 03 no afecta)
+	DescuentoGlobal   *CargoDescuento  `json:"descuentoGlobal,omitempty"` // Atajo para un único descuento global; se incorpora a Descuentos
+	DocumentoAfectado *DocumentoAfectado `json:"documentoAfectado,omitempty"` // Comprobante que corrige una nota de crédito/débito
+	CodigoMotivo      string             `json:"codigoMotivo,omitempty"`      // Tipo de nota (catálogo 09 crédito, 10 débito)
+	DescripcionMotivo string             `json:"descripcionMotivo,omitempty"` // Sustento de la nota (cac:DiscrepancyResponse)
+
+	omitidos []string // Montos requeridos ausentes en el JSON (ver campos_omitidos.go)
+}
+
+// Retencion representa la retención del IGV aplicada por un cliente agente de retención
+// (cac:AllowanceCharge con código 62). El cliente retiene el monto y paga el neto.
+type Retencion struct {
+	Factor    float64 `json:"factor,omitempty"`    // Tasa en decimal (por defecto 0.03 = 3%)
+	Monto     float64 `json:"monto"`               // Monto retenido
+	MontoBase float64 `json:"montoBase,omitempty"` // Importe total sobre el que se retiene (por defecto el total a pagar)
+}
+
+// MontoNetoPendiente retorna el importe que efectivamente cobrará el emisor:
+// el total a pagar menos la retención del IGV, si la hay
+func (c ComprobanteBase) MontoNetoPendiente() float64 {
+	if c.Retencion == nil {
+		return c.TotalImportePagar
+	}
+	return RedondearCentimo(c.TotalImportePagar - c.Retencion.Monto)
+}
+
+// TotalOperacionesGratuitas suma el valor referencial de los ítems de transferencia
+// gratuita (afectación 21), que no forma parte del importe a pagar
+func (c ComprobanteBase) TotalOperacionesGratuitas() float64 {
+	var total float64
+	for _, item := range c.Items {
+		if item.TipoAfectacionIGV == "21" {
+			total += RedondearCentimo(item.ValorTotal)
+		}
+	}
+	return RedondearCentimo(total)
+}
+
+// SumaISC suma el Impuesto Selectivo al Consumo de los ítems
+func (c ComprobanteBase) SumaISC() float64 {
+	var total float64
+	for _, item := range c.Items {
+		total += RedondearCentimo(item.MontoISC)
+	}
+	return RedondearCentimo(total)
+}
+
+// BaseIGV retorna la base sobre la que se calcula el IGV (o IVAP) de la línea:
+// el valor de venta más el ISC, que forma parte de la base imponible
+func (i ItemComprobante) BaseIGV() float64 {
+	return i.ValorTotal + i.MontoISC
+}
+
+// SumaICBPER suma el impuesto a las bolsas plásticas de los ítems
+func (c ComprobanteBase) SumaICBPER() float64 {
+	var total float64
+	for _, item := range c.Items {
+		total += RedondearCentimo(item.ICBPER)
+	}
+	return RedondearCentimo(total)
+}
+
+// DocumentoAfectado identifica el comprobante que modifica una nota de crédito (07) o
+// débito (08). La moneda y el tipo de cambio se completan desde BD cuando el comprobante
+// fue emitido por este servicio.
+type DocumentoAfectado struct {
+	TipoDocumento string  `json:"tipoDocumento"`        // 01=Factura, 03=Boleta
+	Serie         string  `json:"serie"`
+	Numero        string  `json:"numero"`
+	Moneda        string  `json:"moneda,omitempty"`     // Moneda del comprobante afectado
+	TipoCambio    float64 `json:"tipoCambio,omitempty"` // Tipo de cambio del comprobante afectado
+}
+
+// CargoDescuento representa un cargo o descuento del documento o de un ítem (cac:AllowanceCharge)
+type CargoDescuento struct {
+	Codigo    string  `json:"codigo"`              // Código de motivo (catálogo 53)
+	Factor    float64 `json:"factor,omitempty"`    // Porcentaje en decimal (ej: 0.10 = 10%)
+	Monto     float64 `json:"monto"`               // Monto del cargo/descuento
+	MontoBase float64 `json:"montoBase,omitempty"` // Monto sobre el que se aplica el factor
 }
 type Leyenda struct {
 	Codigo      string `json:"codigo"`
@@ -35,6 +126,7 @@ type Emisor struct {
 	Distrito        string `json:"distrito"`
 	CodigoPais      string `json:"codigoPais"`
 	Correo          string `json:"correo"`
+	CodigoEstablecimiento string `json:"codigoEstablecimiento,omitempty"` // Código de establecimiento anexo SUNAT (default "0000")
 }
 
 type Cliente struct {
@@ -51,7 +143,7 @@ type Cliente struct {
 }
 
 type ItemComprobante struct {
-	ID                  string  `json:"id"`
+	ID                  string  `json:"id"` // Identificador del cliente; no es el número de línea UBL (ver CodigoVendedor)
 	Cantidad            float64 `json:"cantidad"`
 	UnidadMedida        string  `json:"unidadMedida"`
 	Descripcion         string  `json:"descripcion"`
@@ -65,6 +157,44 @@ type ItemComprobante struct {
 	TipoAfectacionIGV   string  `json:"tipoAfectacionIGV"`   
 	CodigoTributo       string  `json:"codigoTributo"`           
 	UNSPSC              string  `json:"unspsc"`
+	PropiedadesAdicionales []PropiedadItem `json:"propiedadesAdicionales,omitempty"` // Lote, vencimiento, serie, etc.
+	MontoISC            float64 `json:"montoISC,omitempty"`       // Impuesto Selectivo al Consumo de la línea
+	TipoSistemaISC      string  `json:"tipoSistemaISC,omitempty"` // Sistema de cálculo del ISC (catálogo 08)
+	PorcentajeISC       float64 `json:"porcentajeISC,omitempty"`  // Tasa (%) del ISC
+	CantidadBolsas      float64 `json:"cantidadBolsas,omitempty"` // Bolsas plásticas gravadas con ICBPER
+	FactorICBPER        float64 `json:"factorICBPER,omitempty"`   // Monto por bolsa (por defecto el vigente a la fecha de emisión)
+	ICBPER              float64 `json:"icbper,omitempty"`         // Impuesto al consumo de bolsas plásticas de la línea
+	Descuentos          []CargoDescuento `json:"descuentos,omitempty"` // Descuentos del ítem (00 afecta base, 01 no afecta)
+
+	omitidos []string // Montos requeridos ausentes en el JSON (ver campos_omitidos.go)
+}
+
+/*
+CodigoVendedor retorna el código del ítem para cac:SellersItemIdentification: el
+codigoProducto o, si no se envió, el ID del cliente.
+
+El cbc:ID de la línea UBL siempre es la posición del ítem (1, 2, 3...), como exige SUNAT,
+por lo que el ID del cliente no se usa como número de línea. Se conserva en el payload
+almacenado y, cuando no hay código de producto, como código del vendedor en el XML.
+*/
+func (i ItemComprobante) CodigoVendedor() string {
+	if i.CodigoProducto != "" {
+		return i.CodigoProducto
+	}
+	return i.ID
+}
+
+// ValorBruto retorna el valor de venta de la línea antes de descuentos (cantidad x valor unitario).
+// ValorTotal es el valor neto: el bruto menos los descuentos del ítem que afectan la base.
+func (i ItemComprobante) ValorBruto() float64 {
+	return RedondearCentimo(i.Cantidad * i.ValorUnitario)
+}
+
+// PropiedadItem es una propiedad adicional del ítem (cac:AdditionalItemProperty)
+type PropiedadItem struct {
+	Nombre string `json:"nombre"`           // Ej: "Lote", "Fecha de vencimiento", "Número de serie"
+	Codigo string `json:"codigo,omitempty"` // Código del catálogo 55 (opcional)
+	Valor  string `json:"valor"`
 }
 type Cuota struct {
 	NumeroCuota       string  `json:"numero"`       
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,30 +13,52 @@ type Document struct {
 	ID          string    `json:"id" gorm:"primaryKey;type:varchar(100)"`
 	RUC         string    `json:"ruc" gorm:"type:varchar(11);index"`
 	TipoDoc     string    `json:"tipo_doc" gorm:"type:varchar(2)"`
-	Serie       string    `json:"serie" gorm:"type:varchar(4)"`
+	Serie       string    `json:"serie" gorm:"type:varchar(8)"` // Serie del comprobante o fecha YYYYMMDD de los resúmenes
 	Numero      string    `json:"numero" gorm:"type:varchar(8)"`
 	Cliente     string    `json:"cliente" gorm:"type:varchar(500)"`
 	ClienteDoc  string    `json:"cliente_doc" gorm:"type:varchar(20)"`
 	Total       float64   `json:"total" gorm:"type:decimal(10,2)"`
 	Moneda      string    `json:"moneda" gorm:"type:varchar(3)"`
+	FechaEmision string   `json:"fecha_emision,omitempty" gorm:"type:varchar(10)"` // YYYY-MM-DD, usada en la verificación pública
+	ReferenciaExterna string `json:"referencia_externa,omitempty" gorm:"type:varchar(100);index"` // ID del sistema del cliente
+	Payload     string    `json:"-" gorm:"type:mediumtext"` // JSON del comprobante procesado, para regenerar el XML
+	APIKey      string    `json:"api_key,omitempty" gorm:"type:varchar(100);index"` // Cliente (API key) que emitió el documento
+	
+	// Desglose tributario (registro de ventas sin reparsear los XML)
+	BaseGravada   float64 `json:"base_gravada" gorm:"type:decimal(12,2);default:0"`
+	BaseExonerada float64 `json:"base_exonerada" gorm:"type:decimal(12,2);default:0"`
+	BaseInafecta  float64 `json:"base_inafecta" gorm:"type:decimal(12,2);default:0"`
+	TotalIGV      float64 `json:"total_igv" gorm:"type:decimal(12,2);default:0"`
+	TotalISC      float64 `json:"total_isc" gorm:"type:decimal(12,2);default:0"`
 	
 	// Estados y procesamiento
-	Estado      string    `json:"estado" gorm:"type:varchar(20);default:'pending'"` // pending, processing, approved, rejected, error
+	Estado      string    `json:"estado" gorm:"type:varchar(20);default:'pending';index:idx_documents_estado_fecha,priority:1"` // pending, processing, pending_send, ticket_pending, approved, rejected, error
 	CodigoSUNAT string    `json:"codigo_sunat" gorm:"type:varchar(10)"`
 	MensajeSUNAT string   `json:"mensaje_sunat" gorm:"type:text"`
+	Observaciones []string `json:"observaciones,omitempty" gorm:"serializer:json;type:text"` // Notas del CDR
+	Ticket      string    `json:"ticket,omitempty" gorm:"type:varchar(50);index"` // Ticket de envíos asíncronos (resúmenes, bajas)
+	Destino     string    `json:"destino,omitempty" gorm:"type:varchar(30)"` // Webservice usado (sol, OSE, gre)
+	EnvioProgramado *time.Time `json:"envio_programado,omitempty" gorm:"index"` // Momento del envío diferido a SUNAT (estado scheduled)
 	
 	// Archivos generados
 	XMLPath     string    `json:"xml_path" gorm:"type:varchar(500)"`
 	PDFPath     string    `json:"pdf_path" gorm:"type:varchar(500)"`
 	CDRPath     string    `json:"cdr_path" gorm:"type:varchar(500)"`
 	ZIPPath     string    `json:"zip_path" gorm:"type:varchar(500)"`
+
+	// Copia de los archivos en BD, para servirlos aunque el archivo no esté en el disco de
+	// esta instancia (varias instancias, contenedores efímeros). longblob admite hasta 4 GB,
+	// así los documentos con muchas líneas no se truncan. No se leen en los listados.
+	XMLContent  []byte    `json:"-" gorm:"type:longblob"`
+	CDRContent  []byte    `json:"-" gorm:"type:longblob"`
+	ZIPContent  []byte    `json:"-" gorm:"type:longblob"`
 	
 	// Hashes y firmas
 	HashSHA1    string    `json:"hash_sha1" gorm:"type:varchar(100)"`
 	HashRSA     string    `json:"hash_rsa" gorm:"type:varchar(500)"`
 	
 	// Metadata
-	CreatedAt   time.Time `json:"created_at"`
+	CreatedAt   time.Time `json:"created_at" gorm:"index;index:idx_documents_estado_fecha,priority:2"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	ProcessedAt *time.Time `json:"processed_at,omitempty"`
 	
@@ -65,10 +88,50 @@ type AuditLog struct {
 	DocumentID string    `json:"document_id" gorm:"type:varchar(100);index"`
 	Action     string    `json:"action" gorm:"type:varchar(50)"` // created, validated, signed, sent, approved, rejected
 	Details    string    `json:"details" gorm:"type:text"`
+	// Transición de estado del documento (solo en las acciones status_changed)
+	EstadoAnterior string    `json:"estado_anterior,omitempty" gorm:"type:varchar(30)"`
+	EstadoNuevo    string    `json:"estado_nuevo,omitempty" gorm:"type:varchar(30)"`
 	UserIP     string    `json:"user_ip" gorm:"type:varchar(45)"`
 	CreatedAt  time.Time `json:"created_at"`
 }
 
+// SerieCorrelativo guarda el último número reservado por RUC, tipo de documento y serie
+// Permite reservar correlativos de forma atómica entre múltiples cajas
+type SerieCorrelativo struct {
+	RUC          string    `json:"ruc" gorm:"primaryKey;type:varchar(11)"`
+	TipoDoc      string    `json:"tipo_doc" gorm:"primaryKey;type:varchar(2)"`
+	Serie        string    `json:"serie" gorm:"primaryKey;type:varchar(8)"`
+	UltimoNumero int64     `json:"ultimo_numero"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ColaDocumento es un comprobante recibido en modo asíncrono (?async=true), pendiente de
+// procesar por los workers de la cola. Persiste en BD para no perder documentos si SUNAT
+// no está disponible o el proceso se reinicia.
+type ColaDocumento struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	DocumentID      string    `json:"document_id" gorm:"type:varchar(100);index"`
+	Payload         string    `json:"-" gorm:"type:mediumtext"` // JSON del comprobante ya validado
+	Contingencia    bool      `json:"contingencia"`
+	Destino         string    `json:"destino,omitempty" gorm:"type:varchar(30)"`
+	APIKey          string    `json:"-" gorm:"type:varchar(100)"` // Cliente que encoló el documento
+	Estado          string    `json:"estado" gorm:"type:varchar(20);index:idx_cola_estado_disponible,priority:1"` // queued, processing, done, failed
+	Intentos        int       `json:"intentos"`
+	Error           string    `json:"error,omitempty" gorm:"type:text"`
+	UserIP          string    `json:"-" gorm:"type:varchar(45)"`
+	DisponibleDesde time.Time `json:"disponible_desde" gorm:"index:idx_cola_estado_disponible,priority:2"` // Espera entre reintentos
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Estados de un documento en la cola de procesamiento asíncrono
+const (
+	ColaQueued     = "queued"
+	ColaProcessing = "processing"
+	ColaDone       = "done"
+	ColaFailed     = "failed"
+)
+
 // BeforeCreate genera un UUID para nuevos documentos
 func (d *Document) BeforeCreate(tx *gorm.DB) error {
 	if d.ID == "" {
@@ -78,18 +141,62 @@ func (d *Document) BeforeCreate(tx *gorm.DB) error {
 }
 
 // GetDocumentID genera un ID único basado en RUC-TipoDoc-Serie-Numero
+// El número se normaliza igual que en el cbc:ID del XML
 func GenerateDocumentID(ruc, tipoDoc, serie, numero string) string {
-	return ruc + "-" + tipoDoc + "-" + serie + "-" + numero
+	return ruc + "-" + tipoDoc + "-" + FormatearIDComprobante(serie, numero)
+}
+
+// PatronNombreArchivoPorDefecto es el nombre estándar SUNAT: RUC-TipoDoc-Serie-Numero
+const PatronNombreArchivoPorDefecto = "{ruc}-{tipo}-{serie}-{numero}"
+
+// GenerarNombreArchivo aplica la plantilla de nombres a un comprobante. Admite {ruc},
+// {tipo}, {serie}, {numero} y {fecha}; si extension no está vacía se agrega como sufijo.
+// Ejemplo: "{serie}-{numero}" con "pdf" -> "F001-123.pdf"
+func GenerarNombreArchivo(doc ComprobanteBase, extension, patron string) string {
+	if patron == "" {
+		patron = PatronNombreArchivoPorDefecto
+	}
+	nombre := strings.NewReplacer(
+		"{ruc}", doc.Emisor.RUC,
+		"{tipo}", doc.TipoDocumento,
+		"{serie}", strings.ToUpper(strings.TrimSpace(doc.Serie)),
+		"{numero}", NormalizarNumero(doc.Numero),
+		"{fecha}", doc.FechaEmision,
+	).Replace(patron)
+
+	if extension != "" {
+		nombre += "." + extension
+	}
+	return nombre
+}
+
+// NormalizarNumero elimina los ceros a la izquierda del número correlativo ("00000123" → "123")
+func NormalizarNumero(numero string) string {
+	normalizado := strings.TrimLeft(strings.TrimSpace(numero), "0")
+	if normalizado == "" {
+		return "0"
+	}
+	return normalizado
+}
+
+// FormatearIDComprobante arma el ID SERIE-NUMERO que SUNAT espera en cbc:ID
+func FormatearIDComprobante(serie, numero string) string {
+	return strings.ToUpper(strings.TrimSpace(serie)) + "-" + NormalizarNumero(numero)
 }
 
 // DocumentStatus constantes para estados de documentos
 const (
-	StatusPending    = "pending"
-	StatusProcessing = "processing"
-	StatusApproved   = "approved"
-	StatusRejected   = "rejected"
-	StatusError      = "error"
-	StatusObserved   = "observed"
+	StatusPending        = "pending"
+	StatusProcessing     = "processing"
+	StatusApproved       = "approved"
+	StatusRejected       = "rejected"
+	StatusError          = "error"
+	StatusObserved       = "observed"
+	StatusPendingSend    = "pending_send"    // Firmado en contingencia, pendiente de envío a SUNAT
+	StatusTicketPending  = "ticket_pending"  // Enviado de forma asíncrona, ticket pendiente de consulta
+	StatusActionRequired = "action_required" // Observado por SUNAT y configurado para requerir corrección
+	StatusDraft          = "draft"           // Borrador validado, sin XML ni envío hasta emitirlo
+	StatusScheduled      = "scheduled"       // Firmado, con envío a SUNAT programado (?enviarEn=)
 )
 
 // DocumentType constantes para tipos de documentos
@@ -98,4 +205,24 @@ const (
 	TypeBoleta  = "03"
 	TypeCredito = "07"
 	TypeDebito  = "08"
-)
\ No newline at end of file
+)
+
+// AplicarDesglose copia al documento los montos desglosados del comprobante.
+// Las bases exonerada e inafecta se suman desde los ítems según su tipo de afectación
+// (las operaciones gratuitas no suman) y el ISC es la suma del ISC de los ítems.
+func (d *Document) AplicarDesglose(c ComprobanteBase) {
+	d.BaseGravada = c.TotalGravado
+	d.TotalIGV = c.TotalIGV
+	d.BaseExonerada = 0
+	d.BaseInafecta = 0
+	d.TotalISC = c.SumaISC()
+
+	for _, item := range c.Items {
+		switch item.TipoAfectacionIGV {
+		case "20", "40":
+			d.BaseExonerada += item.ValorTotal
+		case "30", "31", "32", "33", "34", "35", "36", "37":
+			d.BaseInafecta += item.ValorTotal
+		}
+	}
+}
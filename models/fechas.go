@@ -0,0 +1,77 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FormatoFechaSUNAT es el formato ISO que exige SUNAT en el XML (YYYY-MM-DD)
+const FormatoFechaSUNAT = "2006-01-02"
+
+// formatosFechaAceptados son los formatos de fecha reconocidos en el JSON de entrada.
+// Las fechas con barras o puntos se interpretan como día/mes/año (uso en Perú).
+var formatosFechaAceptados = []struct {
+	layout, descripcion string
+}{
+	{FormatoFechaSUNAT, "YYYY-MM-DD"},
+	{"02/01/2006", "DD/MM/YYYY"},
+	{"02-01-2006", "DD-MM-YYYY"},
+	{"02.01.2006", "DD.MM.YYYY"},
+	{"2006/01/02", "YYYY/MM/DD"},
+	{"20060102", "YYYYMMDD"},
+	{time.RFC3339, "YYYY-MM-DDTHH:MM:SSZ"},
+	{"2006-01-02T15:04:05", "YYYY-MM-DDTHH:MM:SS"},
+}
+
+// ParsearFecha interpreta una fecha en cualquiera de los formatos aceptados y la
+// retorna en formato YYYY-MM-DD. Una fecha vacía se retorna sin cambios.
+func ParsearFecha(texto string) (string, error) {
+	texto = strings.TrimSpace(texto)
+	if texto == "" {
+		return "", nil
+	}
+	for _, formato := range formatosFechaAceptados {
+		fecha, err := time.Parse(formato.layout, texto)
+		if err == nil {
+			return fecha.Format(FormatoFechaSUNAT), nil
+		}
+		// El formato coincide pero el día o el mes no existen (ej: 31/02/2024)
+		if errParseo, ok := err.(*time.ParseError); ok && errParseo.Message != "" {
+			return "", fmt.Errorf("fecha '%s' inexistente (%s)", texto, formato.descripcion)
+		}
+	}
+
+	aceptados := make([]string, len(formatosFechaAceptados))
+	for i, formato := range formatosFechaAceptados {
+		aceptados[i] = formato.descripcion
+	}
+	return "", fmt.Errorf("fecha '%s' con formato no reconocido (formatos aceptados: %s)", texto, strings.Join(aceptados, ", "))
+}
+
+// campoFecha referencia una fecha del comprobante junto con su nombre para los errores
+type campoFecha struct {
+	nombre string
+	valor  *string
+}
+
+// NormalizarFechas lleva a formato YYYY-MM-DD la fecha de emisión, la de vencimiento
+// y las de las cuotas. Retorna error indicando el campo si alguna no se reconoce.
+func NormalizarFechas(c *ComprobanteBase) error {
+	campos := []campoFecha{
+		{"fechaEmision", &c.FechaEmision},
+		{"fechaVencimiento", &c.FechaVencimiento},
+	}
+	for i := range c.Cuotas {
+		campos = append(campos, campoFecha{fmt.Sprintf("cuota %d: fechaVencimiento", i+1), &c.Cuotas[i].FechaVencimiento})
+	}
+
+	for _, campo := range campos {
+		fecha, err := ParsearFecha(*campo.valor)
+		if err != nil {
+			return fmt.Errorf("%s: %v", campo.nombre, err)
+		}
+		*campo.valor = fecha
+	}
+	return nil
+}
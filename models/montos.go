@@ -0,0 +1,178 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+Los montos del JSON de entrada se aceptan como número o como texto. En texto se
+admiten separadores de miles y notación científica, y se normalizan a float64:
+
+	1180.5, "1180.50", "1,180.50", "1 180.50", "1.180,50", "1.1805e3"
+
+Reglas para interpretar los separadores en un texto:
+- Con punto y coma a la vez, el último que aparece es el separador decimal
+- Con solo comas: varias comas son miles ("1,180,500"); una coma es decimal ("1180,5"),
+  salvo que la sigan exactamente 3 dígitos ("2,000" o "0,125"): ese caso es ambiguo y
+  se rechaza en lugar de adivinar
+- Con solo puntos: varios puntos son miles ("1.180.500"); uno solo es decimal
+- Los separadores de miles deben agrupar de a 3 dígitos ("1,18,0" es inválido) y el
+  primer grupo no puede comenzar con 0 ("0,125,000" es inválido)
+*/
+
+// gruposMiles valida la parte entera con separador de miles ya reemplazado por '_'
+var gruposMiles = regexp.MustCompile(`^[+-]?[1-9]\d{0,2}(_\d{3})+$`)
+
+// ParsearMonto interpreta un monto enviado como texto según las reglas de este archivo
+func ParsearMonto(texto string) (float64, error) {
+	limpio := strings.ReplaceAll(strings.TrimSpace(texto), " ", "")
+	if limpio == "" {
+		return 0, fmt.Errorf("monto vacío")
+	}
+
+	if comaAmbigua(limpio) {
+		return 0, fmt.Errorf("monto '%s' ambiguo: la coma puede ser separador de miles o decimal; envíe el monto sin separador de miles y con punto decimal (ej: 2000 o 0.125)", texto)
+	}
+
+	miles, decimal := separadoresMonto(limpio)
+	if miles != "" {
+		entero, fraccion := limpio, ""
+		if i := strings.LastIndex(limpio, decimal); decimal != "" && i >= 0 {
+			entero, fraccion = limpio[:i], limpio[i+1:]
+		}
+		entero = strings.ReplaceAll(entero, miles, "_")
+		if !gruposMiles.MatchString(entero) {
+			return 0, fmt.Errorf("monto '%s' con separadores de miles inválidos", texto)
+		}
+		limpio = strings.ReplaceAll(entero, "_", "")
+		if fraccion != "" {
+			limpio += "." + fraccion
+		}
+	} else if decimal == "," {
+		limpio = strings.Replace(limpio, ",", ".", 1)
+	}
+
+	valor, err := strconv.ParseFloat(limpio, 64)
+	if err != nil || math.IsNaN(valor) || math.IsInf(valor, 0) {
+		return 0, fmt.Errorf("monto '%s' no reconocido (ejemplos válidos: 1180.50, \"1,180.50\", \"1.180,50\", \"1.1805e3\")", texto)
+	}
+	return valor, nil
+}
+
+// separadoresMonto determina qué carácter separa miles y cuál decimales ("" si no hay)
+func separadoresMonto(texto string) (miles, decimal string) {
+	// La notación científica solo admite el punto decimal
+	if strings.ContainsAny(texto, "eE") {
+		return "", "."
+	}
+
+	puntos, comas := strings.Count(texto, "."), strings.Count(texto, ",")
+	switch {
+	case puntos > 0 && comas > 0:
+		if strings.LastIndex(texto, ",") > strings.LastIndex(texto, ".") {
+			return ".", ","
+		}
+		return ",", "."
+	case comas > 1:
+		return ",", ""
+	case comas == 1:
+		return "", ","
+	case puntos > 1:
+		return ".", ""
+	}
+	return "", "."
+}
+
+// comaAmbigua indica si el texto tiene una única coma, sin puntos, seguida de exactamente
+// 3 dígitos: "2,000" puede ser 2000 o 2.000 y "0,125" puede ser 125 o 0.125
+func comaAmbigua(texto string) bool {
+	if strings.Count(texto, ",") != 1 || strings.ContainsAny(texto, ".eE") {
+		return false
+	}
+	return len(texto)-strings.Index(texto, ",")-1 == 3
+}
+
+// decodificarMonto convierte el valor JSON crudo de un monto (número o texto).
+// Retorna nil si el campo no vino o es null.
+func decodificarMonto(nombre string, crudo json.RawMessage) (*float64, error) {
+	if len(crudo) == 0 || string(crudo) == "null" {
+		return nil, nil
+	}
+
+	var valor float64
+	if crudo[0] == '"' {
+		var texto string
+		if err := json.Unmarshal(crudo, &texto); err != nil {
+			return nil, err
+		}
+		v, err := ParsearMonto(texto)
+		if err != nil {
+			return nil, fmt.Errorf("campo %s: %v", nombre, err)
+		}
+		valor = v
+	} else if err := json.Unmarshal(crudo, &valor); err != nil {
+		return nil, fmt.Errorf("campo %s: se esperaba un número o un texto numérico, se recibió %s", nombre, crudo)
+	}
+	return &valor, nil
+}
+
+func (r *Retencion) UnmarshalJSON(data []byte) error {
+	type retencionAlias Retencion
+	aux := struct {
+		*retencionAlias
+		Factor    json.RawMessage `json:"factor"`
+		Monto     json.RawMessage `json:"monto"`
+		MontoBase json.RawMessage `json:"montoBase"`
+	}{retencionAlias: (*retencionAlias)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	_, err := asignarCampos([]campoNumerico{
+		{nombre: "retencion.factor", valor: aux.Factor, destino: &r.Factor},
+		{nombre: "retencion.monto", valor: aux.Monto, destino: &r.Monto},
+		{nombre: "retencion.montoBase", valor: aux.MontoBase, destino: &r.MontoBase},
+	})
+	return err
+}
+
+func (c *CargoDescuento) UnmarshalJSON(data []byte) error {
+	type cargoAlias CargoDescuento
+	aux := struct {
+		*cargoAlias
+		Factor    json.RawMessage `json:"factor"`
+		Monto     json.RawMessage `json:"monto"`
+		MontoBase json.RawMessage `json:"montoBase"`
+	}{cargoAlias: (*cargoAlias)(c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	_, err := asignarCampos([]campoNumerico{
+		{nombre: "factor", valor: aux.Factor, destino: &c.Factor},
+		{nombre: "monto", valor: aux.Monto, destino: &c.Monto},
+		{nombre: "montoBase", valor: aux.MontoBase, destino: &c.MontoBase},
+	})
+	return err
+}
+
+func (c *Cuota) UnmarshalJSON(data []byte) error {
+	type cuotaAlias Cuota
+	aux := struct {
+		*cuotaAlias
+		Importe json.RawMessage `json:"importe"`
+	}{cuotaAlias: (*cuotaAlias)(c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	_, err := asignarCampos([]campoNumerico{
+		{nombre: "cuotas.importe", valor: aux.Importe, destino: &c.Importe},
+	})
+	return err
+}
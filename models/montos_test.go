@@ -0,0 +1,35 @@
+package models
+
+import "testing"
+
+func TestParsearMonto(t *testing.T) {
+	validos := map[string]float64{
+		"1180.50":      1180.50,
+		"1,180.50":     1180.50,
+		"1 180.50":     1180.50,
+		"1.180,50":     1180.50,
+		"1,180,500":    1180500,
+		"1.180.500":    1180500,
+		"1180,5":       1180.5,
+		"0,12":         0.12,
+		"1.1805e3":     1180.5,
+		"-1,180.50":    -1180.50,
+		"12,345,678.9": 12345678.9,
+	}
+	for texto, esperado := range validos {
+		valor, err := ParsearMonto(texto)
+		if err != nil || valor != esperado {
+			t.Errorf("ParsearMonto(%q) = %v, %v; esperado %v", texto, valor, err, esperado)
+		}
+	}
+}
+
+// TestParsearMontoRechazaAmbiguos verifica que una coma seguida de 3 dígitos y un primer
+// grupo de miles en 0 se rechacen en lugar de interpretarse como miles
+func TestParsearMontoRechazaAmbiguos(t *testing.T) {
+	for _, texto := range []string{"0,125", "2,000", "-1,180", "0,125,000", "0.125.000", "0,125.50", "1,18,0"} {
+		if valor, err := ParsearMonto(texto); err == nil {
+			t.Errorf("ParsearMonto(%q) = %v; se esperaba error", texto, valor)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// espaciosMultiples coincide con secuencias de espacios, tabulaciones o saltos de línea
+var espaciosMultiples = regexp.MustCompile(`\s+`)
+
+/*
+NormalizarComprobante limpia los espacios en blanco de todos los campos de texto del
+comprobante antes de validarlo y convertirlo: quita espacios al inicio y al final y
+colapsa los espacios múltiples en uno solo.
+
+Recorre recursivamente las estructuras anidadas (emisor, cliente, ítems, leyendas,
+cuotas, cargos, descuentos), por lo que cubre automáticamente los campos que se agreguen.
+*/
+func NormalizarComprobante(c *ComprobanteBase) {
+	normalizarValor(reflect.ValueOf(c).Elem())
+}
+
+// NormalizarTexto aplica la normalización de espacios a un texto individual
+func NormalizarTexto(texto string) string {
+	return espaciosMultiples.ReplaceAllString(strings.TrimSpace(texto), " ")
+}
+
+func normalizarValor(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(NormalizarTexto(v.String()))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			normalizarValor(v.Field(i))
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			normalizarValor(v.Index(i))
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			normalizarValor(v.Elem())
+		}
+	}
+}
+
+// CompletarUnidadMedida asigna la unidad indicada a los ítems que no informan unidad de
+// medida (el XML quedaría con unitCode vacío, que SUNAT rechaza) y retorna la posición
+// (desde 1) de los ítems completados
+func (c *ComprobanteBase) CompletarUnidadMedida(unidad string) []int {
+	if unidad == "" {
+		return nil
+	}
+	var completados []int
+	for i := range c.Items {
+		if c.Items[i].UnidadMedida == "" {
+			c.Items[i].UnidadMedida = unidad
+			completados = append(completados, i+1)
+		}
+	}
+	return completados
+}
+
+// IncorporarDescuentoGlobal agrega el descuentoGlobal del payload a la lista de descuentos,
+// de modo que el conversor y el validador lo traten como cualquier cac:AllowanceCharge.
+// Deja el atajo en nil, así un payload ya preparado no duplica el descuento.
+func (c *ComprobanteBase) IncorporarDescuentoGlobal() {
+	if c.DescuentoGlobal == nil {
+		return
+	}
+	c.Descuentos = append(c.Descuentos, *c.DescuentoGlobal)
+	c.DescuentoGlobal = nil
+}
@@ -0,0 +1,70 @@
+package models
+
+import "math"
+
+/*
+Políticas de redondeo del importe a pagar
+=========================================
+
+Los montos se calculan al céntimo; el importe a pagar puede luego ajustarse según la
+política del emisor (ej: retail que cobra en múltiplos de 10 céntimos). La diferencia
+se informa en cbc:PayableRoundingAmount para que el XML cuadre con lo cobrado.
+*/
+
+// Modos de redondeo del importe a pagar
+const (
+	RedondeoCentimo           = "centimo"             // Al céntimo (sin ajuste adicional)
+	Redondeo10Centimos        = "10-centimos"         // Múltiplo de 0.10 hacia abajo, a favor del consumidor
+	Redondeo10CentimosCercano = "10-centimos-cercano" // Múltiplo de 0.10 más cercano
+	Redondeo50Centimos        = "50-centimos"         // Múltiplo de 0.50 hacia abajo, a favor del consumidor
+)
+
+// PoliticaRedondeo define la unidad (en céntimos) y el sentido del redondeo
+type PoliticaRedondeo struct {
+	Centimos   int64 // Unidad de redondeo en céntimos (1, 10, 50)
+	HaciaAbajo bool  // Truncar a la unidad en lugar de ir a la más cercana
+}
+
+// PoliticasRedondeo modos de redondeo soportados
+var PoliticasRedondeo = map[string]PoliticaRedondeo{
+	RedondeoCentimo:           {Centimos: 1},
+	Redondeo10Centimos:        {Centimos: 10, HaciaAbajo: true},
+	Redondeo10CentimosCercano: {Centimos: 10},
+	Redondeo50Centimos:        {Centimos: 50, HaciaAbajo: true},
+}
+
+// MaxMontoRedondeo límite que SUNAT admite para cbc:PayableRoundingAmount (en valor absoluto)
+const MaxMontoRedondeo = 1.0
+
+// RedondearCentimo redondea a 2 decimales como lo hace SUNAT
+func RedondearCentimo(x float64) float64 {
+	return math.Round(x*100) / 100
+}
+
+// RedondearSegunModo aplica la política de redondeo al monto. Un modo desconocido o
+// vacío redondea al céntimo.
+func RedondearSegunModo(x float64, modo string) float64 {
+	politica, ok := PoliticasRedondeo[modo]
+	if !ok || politica.Centimos <= 1 {
+		return RedondearCentimo(x)
+	}
+	// Se opera en céntimos enteros para no arrastrar errores de punto flotante
+	centimos := math.Round(x * 100)
+	unidades := centimos / float64(politica.Centimos)
+	if politica.HaciaAbajo {
+		unidades = math.Floor(unidades)
+	} else {
+		unidades = math.Round(unidades)
+	}
+	return unidades * float64(politica.Centimos) / 100
+}
+
+// AplicarRedondeo ajusta el importe a pagar según el modo y guarda la diferencia en
+// MontoRedondeo. Parte del importe sin redondeo previo, así que aplicarlo dos veces
+// (ej: al reprocesar un payload guardado) da el mismo resultado.
+func (c *ComprobanteBase) AplicarRedondeo(modo string) {
+	sinRedondeo := RedondearCentimo(c.TotalImportePagar - c.MontoRedondeo)
+	redondeado := RedondearSegunModo(sinRedondeo, modo)
+	c.MontoRedondeo = RedondearCentimo(redondeado - sinRedondeo)
+	c.TotalImportePagar = redondeado
+}
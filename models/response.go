@@ -1,29 +1,175 @@
 package models
 
+import "encoding/xml"
+
+// Las respuestas de emisión también se serializan como XML cuando el cliente lo pide
+// con el header Accept (sistemas legados); los tags xml usan los mismos nombres que json.
+
 // APIResponse estructura de respuesta según requerimientos funcionales
 type APIResponse struct {
-	Estado      string `json:"estado"`                // aceptado, observado, rechazado
-	Code        string `json:"code"`                  // Código de respuesta SUNAT
-	Description string `json:"description"`           // Descripción detallada
-	Hash        string `json:"hash,omitempty"`        // Hash del documento
-	CDRZip      string `json:"cdr_zip,omitempty"`     // CDR en base64
-	XMLFirmado  string `json:"xml_firmado,omitempty"` // XML firmado en base64
-	PDFURL      string `json:"pdf_url,omitempty"`     // URL del PDF (futuro)
+	XMLName     xml.Name `json:"-" xml:"respuesta"`
+	Estado      string   `json:"estado" xml:"estado"`                               // aceptado, observado, rechazado
+	Code        string   `json:"code" xml:"code"`                                   // Código de respuesta SUNAT
+	Description string   `json:"description" xml:"description"`                     // Descripción detallada
+	Hash        string   `json:"hash,omitempty" xml:"hash,omitempty"`               // Hash del documento
+	CDRZip      string   `json:"cdr_zip,omitempty" xml:"cdr_zip,omitempty"`         // CDR en base64
+	XMLFirmado  string   `json:"xml_firmado,omitempty" xml:"xml_firmado,omitempty"` // XML firmado en base64
+	PDFURL      string   `json:"pdf_url,omitempty" xml:"pdf_url,omitempty"`         // URL del PDF (futuro)
+	PDFBase64   string   `json:"pdf_base64,omitempty" xml:"pdf_base64,omitempty"`   // PDF embebido (?incluirPDF=base64)
+	Duplicado   bool     `json:"duplicado,omitempty" xml:"duplicado,omitempty"`     // Reenvío: respuesta almacenada, no se reenvió a SUNAT
+	EnvioProgramado string `json:"envio_programado,omitempty" xml:"envio_programado,omitempty"` // Momento del envío diferido a SUNAT (?enviarEn=)
+
+	Advertencias  []string `json:"advertencias,omitempty" xml:"advertencia,omitempty"`  // Advertencias que no bloquean la emisión
+	Observaciones []string `json:"observaciones,omitempty" xml:"observacion,omitempty"` // Observaciones de SUNAT en el CDR
+}
+
+// EncoladoResponse respuesta del modo asíncrono: el comprobante quedó en cola
+type EncoladoResponse struct {
+	XMLName     xml.Name `json:"-" xml:"encolado"`
+	DocumentID  string   `json:"document_id" xml:"document_id"`
+	Estado      string   `json:"estado" xml:"estado"` // queued
+	Description string   `json:"description" xml:"description"`
+	StatusURL   string   `json:"status_url" xml:"status_url"` // Endpoint para consultar el resultado
+}
+
+// BorradorResponse respuesta al guardar un borrador: validado y sin enviar a SUNAT
+type BorradorResponse struct {
+	XMLName      xml.Name `json:"-" xml:"borrador"`
+	DocumentID   string   `json:"document_id" xml:"document_id"`
+	Estado       string   `json:"estado" xml:"estado"` // draft
+	Description  string   `json:"description" xml:"description"`
+	EmitirURL    string   `json:"emitir_url" xml:"emitir_url"` // Endpoint para emitir el borrador
+	Advertencias []string `json:"advertencias,omitempty" xml:"advertencia,omitempty"`
+}
+
+// CDRRecuperadoResponse respuesta al recuperar de SUNAT el CDR de un comprobante.
+// DocumentID solo se informa si el comprobante existe en BD (su estado se actualizó).
+type CDRRecuperadoResponse struct {
+	XMLName       xml.Name `json:"-" xml:"cdr_recuperado"`
+	DocumentID    string   `json:"document_id,omitempty" xml:"document_id,omitempty"`
+	Estado        string   `json:"estado" xml:"estado"`
+	Code          string   `json:"code" xml:"code"`
+	Description   string   `json:"description" xml:"description"`
+	CDRZip        string   `json:"cdr_zip" xml:"cdr_zip"`
+	Observaciones []string `json:"observaciones,omitempty" xml:"observacion,omitempty"`
 }
 
 // ErrorResponse estructura para errores
 type ErrorResponse struct {
-	Estado      string `json:"estado"`      // "error"
-	Code        string `json:"code"`        // Código de error
-	Description string `json:"description"` // Descripción del error
-	Details     string `json:"details,omitempty"` // Detalles adicionales
+	XMLName     xml.Name `json:"-" xml:"error"`
+	Estado      string   `json:"estado" xml:"estado"`                       // "error"
+	Code        string   `json:"code" xml:"code"`                           // Código de error
+	Description string   `json:"description" xml:"description"`             // Descripción del error
+	Details     string   `json:"details,omitempty" xml:"details,omitempty"` // Detalles adicionales
 }
 
 // CDRInfo información extraída del CDR
 type CDRInfo struct {
 	ResponseCode string `json:"response_code"`
 	Description  string `json:"description"`
-	Estado       string `json:"estado"` // calculado basado en response_code
+	Estado       string `json:"estado"`                   // calculado basado en response_code
 	CDRZipBase64 string `json:"cdr_zip_base64,omitempty"` // CDR en base64
 	CDRZipPath   string `json:"cdr_zip_path,omitempty"`   // Ruta del archivo CDR
-}
\ No newline at end of file
+
+	Observaciones []string `json:"observaciones,omitempty"` // Notas del CDR (cbc:Note), una por observación
+}
+
+// CDRDetalle contiene los datos legibles de un CDR (ApplicationResponse) de SUNAT
+type CDRDetalle struct {
+	ID             string   `json:"id"`              // Identificador del CDR
+	FechaEmision   string   `json:"fecha_emision"`   // cbc:IssueDate
+	HoraEmision    string   `json:"hora_emision"`    // cbc:IssueTime
+	FechaRecepcion string   `json:"fecha_recepcion"` // cbc:ResponseDate
+	HoraRecepcion  string   `json:"hora_recepcion"`  // cbc:ResponseTime
+	DocumentoID    string   `json:"documento_id"`    // Comprobante al que responde (SERIE-NUMERO)
+	ResponseCode   string   `json:"response_code"`
+	Description    string   `json:"description"`
+	Estado         string   `json:"estado"` // aprobada, observada o rechazada
+	Observaciones  []string `json:"observaciones,omitempty"`
+}
+
+// BatchResponse respuesta del endpoint batch con resumen y detalle por documento
+type BatchResponse struct {
+	XMLName    xml.Name         `json:"-" xml:"batch"`
+	Resumen    BatchResumen     `json:"resumen" xml:"resumen"`
+	Resultados []BatchResultado `json:"resultados" xml:"resultados>resultado"`
+}
+
+// BatchResumen totales del procesamiento batch
+type BatchResumen struct {
+	Total    int `json:"total" xml:"total"`
+	Exitosos int `json:"exitosos" xml:"exitosos"`
+	Fallidos int `json:"fallidos" xml:"fallidos"`
+}
+
+// BatchResultado resultado individual de un documento dentro del batch
+type BatchResultado struct {
+	Indice    int            `json:"indice" xml:"indice"`                           // Posición en el array recibido
+	Documento string         `json:"documento" xml:"documento"`                     // Serie-Número del comprobante
+	Status    int            `json:"status" xml:"status"`                           // Código HTTP equivalente
+	Exitoso   bool           `json:"exitoso" xml:"exitoso"`                         // Aceptado, observado (SUNAT_OBSERVADOS=aceptar) o pendiente de envío
+	Respuesta *APIResponse   `json:"respuesta,omitempty" xml:"respuesta,omitempty"` // Respuesta si el flujo se completó
+	Error     *ErrorResponse `json:"error,omitempty" xml:"error,omitempty"`         // Error si el flujo falló
+}
+
+// ConsultaTicketsResponse resumen del job de reconsulta masiva de tickets pendientes
+type ConsultaTicketsResponse struct {
+	Total        int                       `json:"total"`
+	Actualizados int                       `json:"actualizados"` // Tickets con CDR, estado actualizado
+	EnProceso    int                       `json:"en_proceso"`   // SUNAT aún procesa (código 98)
+	Fallidos     int                       `json:"fallidos"`     // Error al consultar
+	Resultados   []ConsultaTicketResultado `json:"resultados"`
+}
+
+// ConsultaTicketResultado resultado de la consulta de un ticket
+type ConsultaTicketResultado struct {
+	DocumentID string `json:"document_id"`
+	Ticket     string `json:"ticket"`
+	Estado     string `json:"estado"`           // Estado resultante del documento
+	Codigo     string `json:"codigo,omitempty"` // Código de getStatus o del CDR
+	Error      string `json:"error,omitempty"`
+}
+
+// VerificacionResponse resultado de la verificación pública de un comprobante. Los datos
+// del comprobante solo se informan si coinciden el monto y la fecha consultados.
+type VerificacionResponse struct {
+	Valido        bool    `json:"valido"` // Aceptado por SUNAT (con o sin observaciones)
+	Estado        string  `json:"estado"` // aceptado, rechazado, pendiente, no_encontrado
+	Mensaje       string  `json:"mensaje"`
+	RUC           string  `json:"ruc,omitempty"`
+	TipoDocumento string  `json:"tipo_documento,omitempty"`
+	Serie         string  `json:"serie,omitempty"`
+	Numero        string  `json:"numero,omitempty"`
+	FechaEmision  string  `json:"fecha_emision,omitempty"`
+	Moneda        string  `json:"moneda,omitempty"`
+	Total         float64 `json:"total,omitempty"`
+}
+
+// UsoAPIKeyResponse documentos emitidos por un cliente (API key) en un periodo mensual
+type UsoAPIKeyResponse struct {
+	APIKey    string           `json:"api_key"`    // Identificador del cliente
+	Periodo   string           `json:"periodo"`    // Mes consultado (YYYYMM)
+	Total     int64            `json:"total"`      // Documentos registrados en el periodo
+	PorEstado map[string]int64 `json:"por_estado"` // Conteo por estado del documento
+}
+
+// ResumenResponse respuesta del envío de un resumen diario: SUNAT responde con un ticket
+type ResumenResponse struct {
+	XMLName     xml.Name             `json:"-" xml:"resumen"`
+	DocumentID  string               `json:"document_id" xml:"document_id"`
+	ID          string               `json:"id" xml:"id"`         // RC-YYYYMMDD-NNN
+	Estado      string               `json:"estado" xml:"estado"` // ticket_pending
+	Ticket      string               `json:"ticket" xml:"ticket"`
+	Description string               `json:"description" xml:"description"`
+	Hash        string               `json:"hash,omitempty" xml:"hash,omitempty"`
+	XMLFirmado  string               `json:"xml_firmado,omitempty" xml:"xml_firmado,omitempty"`
+	Totales     []TotalEstadoResumen `json:"totales" xml:"total"` // Cantidad e importe por estado (catálogo 19)
+}
+
+// TotalEstadoResumen cantidad de comprobantes e importe total informados con un estado
+type TotalEstadoResumen struct {
+	Estado      string  `json:"estado" xml:"estado"`
+	Descripcion string  `json:"descripcion" xml:"descripcion"`
+	Cantidad    int     `json:"cantidad" xml:"cantidad"`
+	Total       float64 `json:"total" xml:"total"`
+}
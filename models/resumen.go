@@ -0,0 +1,40 @@
+package models
+
+// TipoDocResumenDiario identifica al resumen diario en el nombre del archivo y en BD
+const TipoDocResumenDiario = "RC"
+
+// Estados de una línea del resumen diario (catálogo 19)
+const (
+	EstadoResumenAdicionar = "1"
+	EstadoResumenModificar = "2"
+	EstadoResumenAnular    = "3"
+)
+
+// EstadosResumen describe los estados del catálogo 19 (para validar y para los totales)
+var EstadosResumen = map[string]string{
+	EstadoResumenAdicionar: "Adicionar",
+	EstadoResumenModificar: "Modificar",
+	EstadoResumenAnular:    "Anular",
+}
+
+// ResumenDiario agrupa las boletas (y sus notas) emitidas en un mismo día para
+// informarlas a SUNAT con sendSummary en lugar de enviarlas una por una
+type ResumenDiario struct {
+	Emisor          Emisor          `json:"emisor"`
+	FechaGeneracion string          `json:"fechaGeneracion,omitempty"` // Fecha del resumen (por defecto hoy)
+	Boletas         []BoletaResumen `json:"boletas"`
+}
+
+// BoletaResumen es una línea del resumen: el comprobante y la acción que se informa
+type BoletaResumen struct {
+	Estado      string          `json:"estado"` // Catálogo 19: 1=adicionar, 2=modificar, 3=anular
+	Comprobante ComprobanteBase `json:"comprobante"`
+}
+
+// FechaReferencia es la fecha de emisión común a las boletas del resumen
+func (r ResumenDiario) FechaReferencia() string {
+	if len(r.Boletas) == 0 {
+		return ""
+	}
+	return r.Boletas[0].Comprobante.FechaEmision
+}
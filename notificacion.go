@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"ubl-go-conversor/mailer"
+	"ubl-go-conversor/models"
+	"ubl-go-conversor/repository"
+)
+
+// notificador envía los avisos por correo al emisor (nil = notificaciones desactivadas)
+var notificador mailer.Mailer
+
+// inicializarNotificaciones crea el mailer SMTP si MAIL_NOTIFY_REJECTED está activo
+func inicializarNotificaciones() {
+	cfg := appConfig.Mail
+	if !cfg.NotificarRechazos {
+		return
+	}
+	smtp, err := mailer.NuevoSMTP(cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.From)
+	if err != nil {
+		log.Fatalf("MAIL_NOTIFY_REJECTED=true requiere SMTP_HOST y MAIL_FROM: %v", err)
+	}
+	notificador = smtp
+	log.Printf("Notificación de rechazos por correo: SMTP %s:%s", cfg.Host, cfg.Port)
+}
+
+// notificarResultadoSUNAT avisa por correo al emisor (Emisor.Correo del comprobante) que
+// SUNAT rechazó u observó el documento. Se envía en segundo plano para no demorar la
+// respuesta; el resultado del envío queda en auditoría.
+func notificarResultadoSUNAT(documentID, estado string, cdrInfo *models.CDRInfo, userIP string) {
+	if notificador == nil {
+		return
+	}
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("Panic al notificar por correo el documento %s: %v", documentID, p)
+			}
+		}()
+
+		correo, err := correoEmisor(documentID)
+		if err != nil {
+			log.Printf("No se pudo notificar por correo el documento %s: %v", documentID, err)
+			return
+		}
+		if correo == "" {
+			return
+		}
+
+		err = notificador.Enviar(mensajeResultadoSUNAT(documentID, estado, cdrInfo, correo))
+		if err != nil {
+			log.Printf("Error notificando por correo el documento %s: %v", documentID, err)
+			auditRepo.CreateLog(documentID, repository.ActionNotification, "Error al notificar por correo a "+correo+": "+err.Error(), userIP)
+			return
+		}
+		auditRepo.CreateLog(documentID, repository.ActionNotification, "Notificación de estado "+estado+" enviada a "+correo, userIP)
+	}()
+}
+
+// correoEmisor obtiene el correo del emisor guardado en el payload del documento
+func correoEmisor(documentID string) (string, error) {
+	doc, err := docRepo.GetByID(documentID)
+	if err != nil {
+		return "", err
+	}
+	// Comprobantes y resúmenes guardan el emisor en la misma clave
+	var payload struct {
+		Emisor models.Emisor `json:"emisor"`
+	}
+	if doc.Payload != "" {
+		if err := json.Unmarshal([]byte(doc.Payload), &payload); err != nil {
+			return "", fmt.Errorf("payload inválido: %v", err)
+		}
+	}
+	return strings.TrimSpace(payload.Emisor.Correo), nil
+}
+
+// mensajeResultadoSUNAT arma el correo con el código, la descripción y las observaciones del CDR
+func mensajeResultadoSUNAT(documentID, estado string, cdrInfo *models.CDRInfo, correo string) mailer.Mensaje {
+	resultado := "rechazado"
+	if estado != models.StatusRejected {
+		resultado = "observado"
+	}
+
+	var cuerpo strings.Builder
+	fmt.Fprintf(&cuerpo, "SUNAT ha %s el comprobante %s.\n\n", resultado, documentID)
+	fmt.Fprintf(&cuerpo, "Código: %s\n", cdrInfo.ResponseCode)
+	fmt.Fprintf(&cuerpo, "Descripción: %s\n", cdrInfo.Description)
+	if len(cdrInfo.Observaciones) > 0 {
+		cuerpo.WriteString("\nObservaciones:\n")
+		for _, observacion := range cdrInfo.Observaciones {
+			fmt.Fprintf(&cuerpo, "- %s\n", observacion)
+		}
+	}
+	fmt.Fprintf(&cuerpo, "\nRevise el documento en: %s\n", appConfig.EnlaceDocumento(documentID))
+
+	return mailer.Mensaje{
+		Para:   []string{correo},
+		Asunto: fmt.Sprintf("Comprobante %s %s por SUNAT", documentID, resultado),
+		Cuerpo: cuerpo.String(),
+	}
+}
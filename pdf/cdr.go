@@ -0,0 +1,98 @@
+package pdf
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"ubl-go-conversor/models"
+)
+
+// GenerarPDFCDR genera una constancia legible del CDR de SUNAT: resultado, código,
+// descripción, observaciones, fecha de recepción y hash del comprobante
+func GenerarPDFCDR(documento models.Document, cdr models.CDRDetalle, outputPath string) error {
+	if err := verificarEspacioDisco(outputPath, espacioMinimoPDF); err != nil {
+		return err
+	}
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	// Comprimir los streams del PDF (flate): reduce el tamaño almacenado sin perder calidad
+	pdf.SetCompression(true)
+	pdf.AddPage()
+
+	// Header
+	pdf.SetFont("Arial", "B", 16)
+	pdf.Cell(0, 10, "CONSTANCIA DE RECEPCIÓN - SUNAT")
+	pdf.Ln(15)
+
+	// Resultado destacado
+	resultado := map[string]string{
+		"aprobada":  "ACEPTADO",
+		"observada": "ACEPTADO CON OBSERVACIONES",
+		"rechazada": "RECHAZADO",
+	}[cdr.Estado]
+	pdf.SetFont("Arial", "B", 14)
+	pdf.Cell(0, 10, fmt.Sprintf("Resultado: %s", resultado))
+	pdf.Ln(14)
+
+	// Comprobante
+	pdf.SetFont("Arial", "B", 12)
+	pdf.Cell(0, 8, "COMPROBANTE")
+	pdf.Ln(10)
+
+	pdf.SetFont("Arial", "", 10)
+	pdf.Cell(0, 6, fmt.Sprintf("Documento: %s-%s (tipo %s)", documento.Serie, documento.Numero, documento.TipoDoc))
+	pdf.Ln(6)
+	pdf.Cell(0, 6, fmt.Sprintf("RUC emisor: %s", documento.RUC))
+	pdf.Ln(6)
+	pdf.Cell(0, 6, fmt.Sprintf("Cliente: %s - %s", documento.ClienteDoc, documento.Cliente))
+	pdf.Ln(6)
+	pdf.Cell(0, 6, fmt.Sprintf("Importe total: %s %.2f", documento.Moneda, documento.Total))
+	pdf.Ln(6)
+	pdf.Cell(0, 6, fmt.Sprintf("Hash (DigestValue): %s", documento.HashSHA1))
+	pdf.Ln(12)
+
+	// Respuesta de SUNAT
+	pdf.SetFont("Arial", "B", 12)
+	pdf.Cell(0, 8, "RESPUESTA DE SUNAT")
+	pdf.Ln(10)
+
+	pdf.SetFont("Arial", "", 10)
+	pdf.Cell(0, 6, fmt.Sprintf("CDR: %s", cdr.ID))
+	pdf.Ln(6)
+	pdf.Cell(0, 6, fmt.Sprintf("Fecha de recepción: %s %s", cdr.FechaRecepcion, cdr.HoraRecepcion))
+	pdf.Ln(6)
+	pdf.Cell(0, 6, fmt.Sprintf("Fecha de emisión del CDR: %s %s", cdr.FechaEmision, cdr.HoraEmision))
+	pdf.Ln(6)
+	pdf.Cell(0, 6, fmt.Sprintf("Código: %s", cdr.ResponseCode))
+	pdf.Ln(6)
+	pdf.MultiCell(0, 6, fmt.Sprintf("Descripción: %s", cdr.Description), "", "L", false)
+	pdf.Ln(6)
+
+	// Observaciones (una por cbc:Note)
+	if len(cdr.Observaciones) > 0 {
+		pdf.SetFont("Arial", "B", 10)
+		pdf.Cell(0, 6, "OBSERVACIONES:")
+		pdf.Ln(8)
+
+		pdf.SetFont("Arial", "", 9)
+		for _, observacion := range cdr.Observaciones {
+			pdf.MultiCell(0, 5, "- "+strings.TrimSpace(observacion), "", "L", false)
+		}
+		pdf.Ln(8)
+	}
+
+	// Footer
+	pdf.SetFont("Arial", "I", 8)
+	pdf.Cell(0, 6, fmt.Sprintf("Constancia generada el %s", time.Now().Format("02/01/2006 15:04:05")))
+	pdf.Ln(4)
+	pdf.Cell(0, 6, "Representación impresa de la Constancia de Recepción (CDR) emitida por SUNAT")
+
+	if err := pdf.OutputFileAndClose(outputPath); err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("error escribiendo PDF del CDR: %v", err)
+	}
+	return nil
+}
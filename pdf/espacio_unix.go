@@ -0,0 +1,23 @@
+//go:build !windows
+
+package pdf
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+)
+
+// verificarEspacioDisco verifica que el directorio destino tenga al menos minBytes libres
+func verificarEspacioDisco(outputPath string, minBytes uint64) error {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(filepath.Dir(outputPath), &stat); err != nil {
+		return fmt.Errorf("no se pudo consultar el espacio en disco: %v", err)
+	}
+
+	disponible := stat.Bavail * uint64(stat.Bsize)
+	if disponible < minBytes {
+		return fmt.Errorf("espacio en disco insuficiente para el PDF (%d bytes libres)", disponible)
+	}
+	return nil
+}
@@ -1,48 +1,126 @@
 package pdf
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/jung-kurt/gofpdf"
+	"ubl-go-conversor/catalogos"
 	"ubl-go-conversor/models"
 )
 
-// GeneratePDF genera un PDF de representación impresa de la factura/boleta
-func GeneratePDF(documento models.ComprobanteBase, outputPath string) error {
+// espacioMinimoPDF es el espacio libre mínimo requerido antes de generar un PDF
+const espacioMinimoPDF = 5 * 1024 * 1024
+
+// altoPie es el alto de las dos líneas del pie de la representación impresa, en mm
+const altoPie = 10.0
+
+// OpcionesPDF configura la representación impresa
+type OpcionesPDF struct {
+	Idioma      string // "es" (por defecto) o "en"; solo cambia las etiquetas, no los datos
+	DigestValue string // DigestValue de la firma del XML, valor resumen del código QR
+}
+
+// GeneratePDF genera un PDF de representación impresa de la factura/boleta.
+// Con DigestValue incluye el código QR y el valor resumen exigidos por SUNAT.
+// Si la escritura falla se elimina el archivo parcial para no dejar PDFs corruptos.
+func GeneratePDF(documento models.ComprobanteBase, outputPath string, opciones OpcionesPDF) error {
+	return GeneratePDFContext(context.Background(), documento, outputPath, opciones)
+}
+
+// GeneratePDFContext genera el PDF como GeneratePDF, pero aborta si el contexto vence
+// antes de terminar (ej: descripciones enormes o miles de ítems). El PDF se arma en
+// memoria y solo se escribe a disco si terminó a tiempo, así una generación abandonada
+// no deja archivos a medias.
+func GeneratePDFContext(ctx context.Context, documento models.ComprobanteBase, outputPath string, opciones OpcionesPDF) error {
+	if err := verificarEspacioDisco(outputPath, espacioMinimoPDF); err != nil {
+		return err
+	}
+
+	type resultadoPDF struct {
+		contenido []byte
+		err       error
+	}
+	// Con buffer para que la goroutine termine aunque nadie espere su resultado
+	resultado := make(chan resultadoPDF, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				resultado <- resultadoPDF{err: fmt.Errorf("panic generando PDF: %v", r)}
+			}
+		}()
+		documentoPDF, err := construirPDF(documento, opciones)
+		if err != nil {
+			resultado <- resultadoPDF{err: err}
+			return
+		}
+		var buf bytes.Buffer
+		err = documentoPDF.Output(&buf)
+		resultado <- resultadoPDF{contenido: buf.Bytes(), err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("la generación del PDF se abortó: %v", ctx.Err())
+	case r := <-resultado:
+		if r.err != nil {
+			return fmt.Errorf("error generando PDF: %v", r.err)
+		}
+		if err := os.WriteFile(outputPath, r.contenido, 0644); err != nil {
+			os.Remove(outputPath)
+			return fmt.Errorf("error escribiendo PDF: %v", err)
+		}
+		return nil
+	}
+}
+
+// construirPDF arma la representación impresa en memoria, sin escribirla
+func construirPDF(documento models.ComprobanteBase, opciones OpcionesPDF) (*gofpdf.Fpdf, error) {
+	t := etiquetador(opciones.Idioma)
+
 	pdf := gofpdf.New("P", "mm", "A4", "")
+	// Comprimir los streams del PDF (flate): reduce el tamaño almacenado sin perder calidad
+	pdf.SetCompression(true)
 	pdf.AddPage()
 
 	// Título del documento
 	tipoDoc := "FACTURA ELECTRÓNICA"
-	if documento.TipoDocumento == "03" {
+	switch documento.TipoDocumento {
+	case "03":
 		tipoDoc = "BOLETA DE VENTA ELECTRÓNICA"
+	case "07":
+		tipoDoc = "NOTA DE CRÉDITO ELECTRÓNICA"
+	case "08":
+		tipoDoc = "NOTA DE DÉBITO ELECTRÓNICA"
 	}
 
 	// Header
 	pdf.SetFont("Arial", "B", 16)
-	pdf.Cell(0, 10, tipoDoc)
+	pdf.Cell(0, 10, t(tipoDoc))
 	pdf.Ln(15)
 
 	// Información del emisor
 	pdf.SetFont("Arial", "B", 12)
-	pdf.Cell(0, 8, "DATOS DEL EMISOR")
+	pdf.Cell(0, 8, t("DATOS DEL EMISOR"))
 	pdf.Ln(10)
 	
 	pdf.SetFont("Arial", "", 10)
 	pdf.Cell(0, 6, fmt.Sprintf("RUC: %s", documento.Emisor.RUC))
 	pdf.Ln(6)
-	pdf.Cell(0, 6, fmt.Sprintf("Razón Social: %s", documento.Emisor.RazonSocial))
+	pdf.Cell(0, 6, fmt.Sprintf("%s: %s", t("Razón Social"), documento.Emisor.RazonSocial))
 	pdf.Ln(6)
-	pdf.Cell(0, 6, fmt.Sprintf("Dirección: %s", documento.Emisor.Direccion))
+	pdf.Cell(0, 6, fmt.Sprintf("%s: %s", t("Dirección"), documento.Emisor.Direccion))
 	pdf.Ln(6)
-	pdf.Cell(0, 6, fmt.Sprintf("Distrito: %s - Provincia: %s - Departamento: %s", 
-		documento.Emisor.Distrito, documento.Emisor.Provincia, documento.Emisor.Departamento))
+	pdf.Cell(0, 6, fmt.Sprintf("%s: %s - %s: %s - %s: %s",
+		t("Distrito"), documento.Emisor.Distrito, t("Provincia"), documento.Emisor.Provincia, t("Departamento"), documento.Emisor.Departamento))
 	pdf.Ln(12)
 
 	// Información del cliente
 	pdf.SetFont("Arial", "B", 12)
-	pdf.Cell(0, 8, "DATOS DEL CLIENTE")
+	pdf.Cell(0, 8, t("DATOS DEL CLIENTE"))
 	pdf.Ln(10)
 	
 	pdf.SetFont("Arial", "", 10)
@@ -52,45 +130,52 @@ func GeneratePDF(documento models.ComprobanteBase, outputPath string) error {
 	}
 	pdf.Cell(0, 6, fmt.Sprintf("%s: %s", tipoDocCliente, documento.Cliente.NumeroDoc))
 	pdf.Ln(6)
-	pdf.Cell(0, 6, fmt.Sprintf("Razón Social: %s", documento.Cliente.RazonSocial))
+	pdf.Cell(0, 6, fmt.Sprintf("%s: %s", t("Razón Social"), documento.Cliente.RazonSocial))
 	pdf.Ln(6)
 	if documento.Cliente.Direccion != "" {
-		pdf.Cell(0, 6, fmt.Sprintf("Dirección: %s", documento.Cliente.Direccion))
+		pdf.Cell(0, 6, fmt.Sprintf("%s: %s", t("Dirección"), documento.Cliente.Direccion))
 		pdf.Ln(6)
 	}
 	pdf.Ln(12)
 
 	// Información del comprobante
 	pdf.SetFont("Arial", "B", 12)
-	pdf.Cell(0, 8, "INFORMACIÓN DEL COMPROBANTE")
+	pdf.Cell(0, 8, t("INFORMACIÓN DEL COMPROBANTE"))
 	pdf.Ln(10)
 	
 	pdf.SetFont("Arial", "", 10)
-	pdf.Cell(0, 6, fmt.Sprintf("Serie y Número: %s-%s", documento.Serie, documento.Numero))
+	pdf.Cell(0, 6, fmt.Sprintf("%s: %s-%s", t("Serie y Número"), documento.Serie, documento.Numero))
 	pdf.Ln(6)
-	pdf.Cell(0, 6, fmt.Sprintf("Fecha de Emisión: %s", documento.FechaEmision))
+	pdf.Cell(0, 6, fmt.Sprintf("%s: %s", t("Fecha de Emisión"), documento.FechaEmision))
 	pdf.Ln(6)
-	pdf.Cell(0, 6, fmt.Sprintf("Hora de Emisión: %s", documento.HoraEmision))
+	pdf.Cell(0, 6, fmt.Sprintf("%s: %s", t("Hora de Emisión"), documento.HoraEmision))
 	pdf.Ln(6)
-	pdf.Cell(0, 6, fmt.Sprintf("Moneda: %s", documento.Moneda))
+	pdf.Cell(0, 6, fmt.Sprintf("%s: %s", t("Moneda"), documento.Moneda))
+	pdf.Ln(6)
+	pdf.Cell(0, 6, fmt.Sprintf("%s: %s", t("Forma de Pago"), documento.FormaPago))
+	pdf.Ln(6)
+	// Las notas indican el comprobante que modifican y el motivo
+	if afectado := documento.DocumentoAfectado; afectado != nil {
+		pdf.Cell(0, 6, fmt.Sprintf("%s: %s-%s", t("Documento que modifica"), afectado.Serie, afectado.Numero))
+		pdf.Ln(6)
+		pdf.MultiCell(0, 6, fmt.Sprintf("%s: %s - %s", t("Motivo"), documento.CodigoMotivo, documento.DescripcionMotivo), "", "L", false)
+	}
 	pdf.Ln(6)
-	pdf.Cell(0, 6, fmt.Sprintf("Forma de Pago: %s", documento.FormaPago))
-	pdf.Ln(12)
 
 	// Detalle de items
 	pdf.SetFont("Arial", "B", 12)
-	pdf.Cell(0, 8, "DETALLE DE PRODUCTOS/SERVICIOS")
+	pdf.Cell(0, 8, t("DETALLE DE PRODUCTOS/SERVICIOS"))
 	pdf.Ln(10)
 
 	// Headers de la tabla
 	pdf.SetFont("Arial", "B", 8)
-	pdf.Cell(15, 8, "Item")
-	pdf.Cell(50, 8, "Descripción")
-	pdf.Cell(20, 8, "Cantidad")
-	pdf.Cell(25, 8, "V. Unitario")
-	pdf.Cell(25, 8, "V. Total")
-	pdf.Cell(20, 8, "IGV")
-	pdf.Cell(25, 8, "P. Unitario")
+	pdf.Cell(15, 8, t("Item"))
+	pdf.Cell(50, 8, t("Descripción"))
+	pdf.Cell(20, 8, t("Cantidad"))
+	pdf.Cell(25, 8, t("V. Unitario"))
+	pdf.Cell(25, 8, t("V. Total"))
+	pdf.Cell(20, 8, t("IGV"))
+	pdf.Cell(25, 8, t("P. Unitario"))
 	pdf.Ln(8)
 
 	// Línea divisoria
@@ -108,6 +193,28 @@ func GeneratePDF(documento models.ComprobanteBase, outputPath string) error {
 		pdf.Cell(20, 6, fmt.Sprintf("%.2f", item.IGV))
 		pdf.Cell(25, 6, fmt.Sprintf("%.2f", item.PrecioVentaUnitario))
 		pdf.Ln(6)
+
+		// Propiedades adicionales (lote, vencimiento, serie) bajo la descripción
+		if len(item.PropiedadesAdicionales) > 0 {
+			pdf.SetFont("Arial", "I", 7)
+			for _, propiedad := range item.PropiedadesAdicionales {
+				pdf.Cell(15, 4, "")
+				pdf.Cell(0, 4, truncateString(fmt.Sprintf("%s: %s", propiedad.Nombre, propiedad.Valor), 60))
+				pdf.Ln(4)
+			}
+			pdf.SetFont("Arial", "", 8)
+		}
+
+		// Descuentos del ítem (el V. Total ya es el neto de los descuentos que afectan la base)
+		if len(item.Descuentos) > 0 {
+			pdf.SetFont("Arial", "I", 7)
+			for _, descuento := range item.Descuentos {
+				pdf.Cell(15, 4, "")
+				pdf.Cell(0, 4, t(fmt.Sprintf("Descuento: -%.2f", descuento.Monto)))
+				pdf.Ln(4)
+			}
+			pdf.SetFont("Arial", "", 8)
+		}
 	}
 
 	pdf.Ln(8)
@@ -115,24 +222,99 @@ func GeneratePDF(documento models.ComprobanteBase, outputPath string) error {
 	// Totales
 	pdf.SetFont("Arial", "B", 10)
 	pdf.Cell(130, 6, "")
-	pdf.Cell(30, 6, "Sub Total:")
+	pdf.Cell(30, 6, t("Sub Total:"))
 	pdf.Cell(30, 6, fmt.Sprintf("%.2f", documento.TotalGravado))
 	pdf.Ln(6)
 	
 	pdf.Cell(130, 6, "")
-	pdf.Cell(30, 6, "IGV (18%):")
+	pdf.Cell(30, 6, t("IGV (18%):"))
 	pdf.Cell(30, 6, fmt.Sprintf("%.2f", documento.TotalIGV))
 	pdf.Ln(6)
+
+	// Impuesto Selectivo al Consumo
+	if totalISC := documento.SumaISC(); totalISC > 0 {
+		pdf.Cell(130, 6, "")
+		pdf.Cell(30, 6, "ISC:")
+		pdf.Cell(30, 6, fmt.Sprintf("%.2f", totalISC))
+		pdf.Ln(6)
+	}
+
+	// Impuesto al consumo de bolsas plásticas
+	if totalICBPER := documento.SumaICBPER(); totalICBPER > 0 {
+		pdf.Cell(130, 6, "")
+		pdf.Cell(30, 6, "ICBPER:")
+		pdf.Cell(30, 6, fmt.Sprintf("%.2f", totalICBPER))
+		pdf.Ln(6)
+	}
+
+	// Valor referencial de las transferencias gratuitas (no suma al total)
+	if totalGratuito := documento.TotalOperacionesGratuitas(); totalGratuito > 0 {
+		pdf.Cell(130, 6, "")
+		pdf.Cell(30, 6, t("Op. Gratuitas:"))
+		pdf.Cell(30, 6, fmt.Sprintf("%.2f", totalGratuito))
+		pdf.Ln(6)
+	}
 	
+	// Descuentos globales
+	for _, descuento := range documento.Descuentos {
+		etiqueta := t("Descuento global:")
+		if catalogos.DescuentoAfectaBase(descuento.Codigo) {
+			etiqueta = t("Dscto. global (base imponible):")
+		}
+		pdf.Cell(90, 6, "")
+		pdf.Cell(70, 6, etiqueta)
+		pdf.Cell(30, 6, fmt.Sprintf("-%.2f", descuento.Monto))
+		pdf.Ln(6)
+	}
+
+	// Cargos a nivel de documento (ej: recargo al consumo)
+	for _, cargo := range documento.Cargos {
+		descripcion := catalogos.CargosCatalogo53[cargo.Codigo]
+		if cargo.Factor > 0 {
+			descripcion = fmt.Sprintf("%s (%.0f%%)", descripcion, cargo.Factor*100)
+		}
+		pdf.Cell(90, 6, "")
+		pdf.Cell(70, 6, truncateString(descripcion, 45)+":")
+		pdf.Cell(30, 6, fmt.Sprintf("%.2f", cargo.Monto))
+		pdf.Ln(6)
+	}
+
+	// Ajuste por la política de redondeo del emisor (ya incluido en el total)
+	if documento.MontoRedondeo != 0 {
+		pdf.Cell(130, 6, "")
+		pdf.Cell(30, 6, t("Redondeo:"))
+		pdf.Cell(30, 6, fmt.Sprintf("%.2f", documento.MontoRedondeo))
+		pdf.Ln(6)
+	}
+
 	pdf.Cell(130, 6, "")
-	pdf.Cell(30, 6, "TOTAL:")
+	pdf.Cell(30, 6, t("TOTAL:"))
 	pdf.Cell(30, 6, fmt.Sprintf("%.2f", documento.TotalImportePagar))
-	pdf.Ln(12)
+	pdf.Ln(6)
+
+	// Retención del IGV: el cliente agente de retención paga el neto
+	if documento.Retencion != nil {
+		factor := documento.Retencion.Factor
+		if factor == 0 {
+			factor = catalogos.TasaRetencionIGV
+		}
+		pdf.SetFont("Arial", "", 10)
+		pdf.Cell(90, 6, "")
+		pdf.Cell(70, 6, fmt.Sprintf("%s (%.0f%%):", t("Retención IGV"), factor*100))
+		pdf.Cell(30, 6, fmt.Sprintf("-%.2f", documento.Retencion.Monto))
+		pdf.Ln(6)
+		pdf.SetFont("Arial", "B", 10)
+		pdf.Cell(130, 6, "")
+		pdf.Cell(30, 6, t("NETO A COBRAR:"))
+		pdf.Cell(30, 6, fmt.Sprintf("%.2f", documento.MontoNetoPendiente()))
+		pdf.Ln(6)
+	}
+	pdf.Ln(6)
 
 	// Leyendas
 	if len(documento.Leyendas) > 0 {
 		pdf.SetFont("Arial", "B", 10)
-		pdf.Cell(0, 6, "OBSERVACIONES:")
+		pdf.Cell(0, 6, t("OBSERVACIONES:"))
 		pdf.Ln(8)
 		
 		pdf.SetFont("Arial", "", 9)
@@ -143,22 +325,41 @@ func GeneratePDF(documento models.ComprobanteBase, outputPath string) error {
 		pdf.Ln(8)
 	}
 
-	// Footer
+	// Footer. Con código QR, el QR va en la esquina inferior izquierda de la última
+	// página y el pie se imprime a su lado; si el contenido llega hasta esa zona, ambos
+	// pasan a una página nueva
+	xPie := pdf.GetX()
+	if opciones.DigestValue != "" {
+		_, altoPagina := pdf.GetPageSize()
+		_, _, _, margenInferior := pdf.GetMargins()
+		yQR := altoPagina - margenInferior - ladoQR
+		if pdf.GetY() > yQR {
+			pdf.AddPage()
+		}
+		if err := agregarQR(pdf, ContenidoQR(documento, opciones.DigestValue), 10, yQR); err != nil {
+			return nil, err
+		}
+		xPie = 10 + ladoQR + 4
+		pdf.SetXY(xPie, yQR+ladoQR-altoPie-5)
+
+		// Valor resumen (DigestValue de la firma) para validar el comprobante
+		pdf.SetFont("Arial", "", 8)
+		pdf.Cell(0, 5, fmt.Sprintf("%s %s", t("Valor resumen:"), opciones.DigestValue))
+		pdf.Ln(5)
+		pdf.SetX(xPie)
+	}
 	pdf.SetFont("Arial", "I", 8)
-	pdf.Cell(0, 6, fmt.Sprintf("Documento generado el %s", time.Now().Format("02/01/2006 15:04:05")))
+	pdf.Cell(0, 6, fmt.Sprintf("%s %s", t("Documento generado el"), time.Now().Format("02/01/2006 15:04:05")))
 	pdf.Ln(4)
-	pdf.Cell(0, 6, "Representación impresa de comprobante electrónico")
+	pdf.SetX(xPie)
+	pdf.Cell(0, 6, t("Representación impresa de comprobante electrónico"))
 
-	return pdf.OutputFileAndClose(outputPath)
+	return pdf, nil
 }
 
-// GeneratePDFPath genera la ruta donde se guardará el PDF
-func GeneratePDFPath(documento models.ComprobanteBase) string {
-	return fmt.Sprintf("out/%s-%s-%s-%s.pdf", 
-		documento.Emisor.RUC, 
-		documento.TipoDocumento, 
-		documento.Serie, 
-		documento.Numero)
+// GeneratePDFPath genera la ruta donde se guardará el PDF según la plantilla de nombres
+func GeneratePDFPath(documento models.ComprobanteBase, patron string) string {
+	return "out/" + models.GenerarNombreArchivo(documento, "pdf", patron)
 }
 
 // truncateString trunca un string si es muy largo
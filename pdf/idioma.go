@@ -0,0 +1,66 @@
+package pdf
+
+// Idiomas soportados en la representación impresa
+const (
+	IdiomaEspanol = "es"
+	IdiomaIngles  = "en"
+)
+
+// traduccionesIngles contiene las etiquetas del PDF en inglés, indexadas por su texto
+// en español. Los datos del comprobante (nombres, montos, leyendas) no se traducen.
+var traduccionesIngles = map[string]string{
+	"FACTURA ELECTRÓNICA":             "ELECTRONIC INVOICE",
+	"BOLETA DE VENTA ELECTRÓNICA":     "ELECTRONIC SALES RECEIPT",
+	"NOTA DE CRÉDITO ELECTRÓNICA":     "ELECTRONIC CREDIT NOTE",
+	"NOTA DE DÉBITO ELECTRÓNICA":      "ELECTRONIC DEBIT NOTE",
+	"DATOS DEL EMISOR":                "ISSUER DATA",
+	"DATOS DEL CLIENTE":               "CUSTOMER DATA",
+	"INFORMACIÓN DEL COMPROBANTE":     "DOCUMENT INFORMATION",
+	"DETALLE DE PRODUCTOS/SERVICIOS":  "PRODUCTS/SERVICES DETAIL",
+	"Razón Social":                    "Company Name",
+	"Dirección":                       "Address",
+	"Distrito":                        "District",
+	"Provincia":                       "Province",
+	"Departamento":                    "Department",
+	"Serie y Número":                  "Series and Number",
+	"Fecha de Emisión":                "Issue Date",
+	"Hora de Emisión":                 "Issue Time",
+	"Moneda":                          "Currency",
+	"Forma de Pago":                   "Payment Terms",
+	"Documento que modifica":          "Amended document",
+	"Motivo":                          "Reason",
+	"Item":                            "Item",
+	"Descripción":                     "Description",
+	"Cantidad":                        "Quantity",
+	"V. Unitario":                     "Unit Value",
+	"V. Total":                        "Total Value",
+	"IGV":                             "VAT",
+	"P. Unitario":                     "Unit Price",
+	"Sub Total:":                      "Subtotal:",
+	"IGV (18%):":                      "VAT (18%):",
+	"Op. Gratuitas:":                  "Free transfers:",
+	"Descuento global:":               "Global discount:",
+	"Dscto. global (base imponible):": "Global discount (tax base):",
+	"Redondeo:":                       "Rounding:",
+	"TOTAL:":                          "TOTAL:",
+	"Retención IGV":                   "VAT withholding",
+	"NETO A COBRAR:":                  "NET AMOUNT DUE:",
+	"Valor resumen:":                  "Digest value:",
+	"OBSERVACIONES:":                  "NOTES:",
+	"Documento generado el":           "Document generated on",
+	"Representación impresa de comprobante electrónico": "Printed representation of electronic document",
+}
+
+// etiquetador retorna la función que traduce las etiquetas al idioma indicado.
+// Un idioma vacío o no soportado usa español.
+func etiquetador(idioma string) func(string) string {
+	if idioma != IdiomaIngles {
+		return func(texto string) string { return texto }
+	}
+	return func(texto string) string {
+		if traduccion, ok := traduccionesIngles[texto]; ok {
+			return traduccion
+		}
+		return texto
+	}
+}
@@ -0,0 +1,57 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/skip2/go-qrcode"
+	"ubl-go-conversor/models"
+)
+
+// ladoQR es el tamaño del código QR impreso, en mm (SUNAT exige al menos 2 cm)
+const ladoQR = 30.0
+
+/*
+ContenidoQR arma el texto del código QR de la representación impresa según la
+Resolución 155-2017/SUNAT, separado por "|":
+
+	RUC|TIPO|SERIE|NUMERO|IGV|TOTAL|FECHA EMISIÓN|TIPO DOC. ADQUIRENTE|NÚMERO DOC. ADQUIRENTE|VALOR RESUMEN|
+
+El valor resumen es el DigestValue de la firma del XML enviado a SUNAT, tal como
+aparece en ds:DigestValue; con cualquier otro valor el verificador no valida el QR.
+*/
+func ContenidoQR(documento models.ComprobanteBase, digestValue string) string {
+	campos := []string{
+		documento.Emisor.RUC,
+		documento.TipoDocumento,
+		documento.Serie,
+		documento.Numero,
+		fmt.Sprintf("%.2f", documento.TotalIGV),
+		fmt.Sprintf("%.2f", documento.TotalImportePagar),
+		documento.FechaEmision,
+		documento.Cliente.TipoDoc,
+		documento.Cliente.NumeroDoc,
+		digestValue,
+	}
+	return strings.Join(campos, "|") + "|"
+}
+
+// pixelesPorModulo es la resolución del PNG del QR. Cada módulo es un bloque de píxeles
+// exactos (sin reescalado), suficiente para imprimirlo nítido a ladoQR mm; una imagen
+// mayor solo agranda el PDF almacenado.
+const pixelesPorModulo = 4
+
+// agregarQR imprime el código QR en la posición indicada
+func agregarQR(pdf *gofpdf.Fpdf, contenido string, x, y float64) error {
+	// Un tamaño negativo indica a go-qrcode píxeles por módulo en lugar del ancho total
+	png, err := qrcode.Encode(contenido, qrcode.Medium, -pixelesPorModulo)
+	if err != nil {
+		return fmt.Errorf("error generando código QR: %v", err)
+	}
+	opciones := gofpdf.ImageOptions{ImageType: "PNG"}
+	pdf.RegisterImageOptionsReader("qr", opciones, bytes.NewReader(png))
+	pdf.ImageOptions("qr", x, y, ladoQR, ladoQR, false, opciones, 0, "")
+	return nil
+}
@@ -0,0 +1,59 @@
+package pdf
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"ubl-go-conversor/models"
+	"ubl-go-conversor/signature"
+)
+
+// xmlPrueba es un documento UBL mínimo con el punto de inserción de la firma; el QR solo
+// necesita su DigestValue
+const xmlPrueba = `<?xml version="1.0" encoding="UTF-8"?>
+<Invoice xmlns="urn:oasis:names:specification:ubl:schema:xsd:Invoice-2" xmlns:ext="urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2" xmlns:cbc="urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"><ext:UBLExtensions><ext:UBLExtension><ext:ExtensionContent></ext:ExtensionContent></ext:UBLExtension></ext:UBLExtensions><cbc:UBLVersionID>2.1</cbc:UBLVersionID><cbc:ID>F001-123</cbc:ID></Invoice>`
+
+var digestValueRegex = regexp.MustCompile(`<(?:\w+:)?DigestValue>([^<]+)</(?:\w+:)?DigestValue>`)
+
+// TestContenidoQRUsaDigestValueFirmado verifica que el valor resumen del QR sea el
+// ds:DigestValue del XML firmado, el mismo que retorna signature.FirmaXML
+func TestContenidoQRUsaDigestValueFirmado(t *testing.T) {
+	rutaXML := filepath.Join(t.TempDir(), "F001-123.xml")
+	if err := os.WriteFile(rutaXML, []byte(xmlPrueba), 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest, _, err := signature.FirmaXML(rutaXML, "../certificados/certificado_prueba.pfx", "institutoisi")
+	if err != nil {
+		t.Fatalf("error firmando XML: %v", err)
+	}
+
+	firmado, err := os.ReadFile(rutaXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coincidencia := digestValueRegex.FindSubmatch(firmado)
+	if coincidencia == nil {
+		t.Fatal("el XML firmado no contiene DigestValue")
+	}
+	if string(coincidencia[1]) != digest {
+		t.Fatalf("FirmaXML retornó %s pero el XML contiene %s", digest, coincidencia[1])
+	}
+
+	// Solo los campos que forman parte del QR
+	documento := models.ComprobanteBase{
+		TipoDocumento:     "01",
+		Serie:             "F001",
+		Numero:            "123",
+		FechaEmision:      "2026-10-17",
+		Emisor:            models.Emisor{RUC: "20123456789"},
+		Cliente:           models.Cliente{TipoDoc: "6", NumeroDoc: "20987654321"},
+		TotalIGV:          18,
+		TotalImportePagar: 118,
+	}
+	esperado := "20123456789|01|F001|123|18.00|118.00|2026-10-17|6|20987654321|" + digest + "|"
+	if obtenido := ContenidoQR(documento, digest); obtenido != esperado {
+		t.Errorf("contenido del QR: esperado %s, obtenido %s", esperado, obtenido)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+
+	"ubl-go-conversor/models"
+	"ubl-go-conversor/utils"
+)
+
+// tiposConCDR son los comprobantes con CDR individual en SUNAT (los resúmenes y
+// comunicaciones de baja se consultan por ticket)
+var tiposConCDR = map[string]bool{"01": true, "03": true, "07": true, "08": true}
+
+var (
+	rucRecuperacion    = regexp.MustCompile(`^\d{11}$`)
+	numeroRecuperacion = regexp.MustCompile(`^\d{1,8}$`)
+)
+
+/*
+manejarRecuperarCDR es el endpoint GET /api/v1/cdr/recuperar?ruc=&tipoDoc=&serie=&numero=,
+que obtiene de SUNAT (getStatusCdr) el CDR de un comprobante ya procesado. Sirve para
+recuperar el CDR perdido de un documento aceptado, incluso si no fue emitido por este
+servicio. Si el documento existe en BD se actualiza su estado y se guarda el CDR.
+*/
+func manejarRecuperarCDR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	ruc, tipoDoc, serie, numero := q.Get("ruc"), q.Get("tipoDoc"), q.Get("serie"), q.Get("numero")
+	if !rucRecuperacion.MatchString(ruc) || serie == "" || !numeroRecuperacion.MatchString(numero) {
+		http.Error(w, "Parámetros requeridos: ruc (11 dígitos), tipoDoc, serie y numero (hasta 8 dígitos)", http.StatusBadRequest)
+		return
+	}
+	if !tiposConCDR[tipoDoc] {
+		http.Error(w, "tipoDoc inválido: use 01, 03, 07 u 08 (los resúmenes se consultan por ticket)", http.StatusBadRequest)
+		return
+	}
+	numero = models.NormalizarNumero(numero)
+
+	cdrInfo, err := utils.ObtenerCDRDesdeServicio(ruc, tipoDoc, serie, numero)
+	if err != nil {
+		escribirErrorConsulta(w, r, "Error al recuperar el CDR desde SUNAT", err)
+		return
+	}
+
+	respuesta := models.CDRRecuperadoResponse{
+		Estado:        cdrInfo.Estado,
+		Code:          cdrInfo.ResponseCode,
+		Description:   cdrInfo.Description,
+		CDRZip:        cdrInfo.CDRZipBase64,
+		Observaciones: cdrInfo.Observaciones,
+	}
+
+	// Un borrador nunca se envió: el CDR de SUNAT no puede corresponderle
+	documentID := models.GenerateDocumentID(ruc, tipoDoc, serie, numero)
+	if doc, err := docRepo.GetByID(documentID); err == nil && doc.Estado != models.StatusDraft {
+		registrarCDRConsultado(doc.ID, cdrInfo, r.RemoteAddr)
+		respuesta.DocumentID = doc.ID
+	}
+
+	escribirRespuesta(w, r, statusHTTPSegunCDR(cdrInfo.Estado), respuesta)
+}
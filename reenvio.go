@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"ubl-go-conversor/catalogos"
+	"ubl-go-conversor/models"
+	"ubl-go-conversor/repository"
+)
+
+// estadosTerminales son los estados con respuesta definitiva de SUNAT (CDR), junto con
+// el estado del CDR que se informa al cliente en un reenvío
+var estadosTerminales = map[string]string{
+	models.StatusApproved:       "aprobada",
+	models.StatusObserved:       "observada",
+	models.StatusActionRequired: "observada",
+	models.StatusRejected:       "rechazada",
+}
+
+/*
+comprobarReenvio resuelve el reenvío de un comprobante que ya existe en BD (ej: un
+reintento del cliente tras un timeout en la respuesta), para no enviarlo dos veces a SUNAT:
+- Si ya tiene CDR (estado terminal) retorna la respuesta almacenada con duplicado=true
+- Si quedó en error (ej: timeout o falla de red al enviar a SUNAT) retorna su estado para
+  reprocesarlo en el mismo registro, conservando su auditoría
+- Un reintento de la cola también reprocesa el documento que su intento anterior dejó
+  en processing
+- Si es un borrador solo se reemplaza al emitirlo (POST /documents/{id}/emitir)
+- En cualquier otro estado (en proceso, contingencia, ticket) retorna un error 409
+
+Retorna la respuesta almacenada, o el estado previo del documento a reprocesar (vacío si
+no existe y puede registrarse normalmente).
+*/
+func comprobarReenvio(documentID, userIP string, opciones opcionesProceso) (*models.APIResponse, string, *errorProceso) {
+	previo, err := docRepo.GetByID(documentID)
+	if err != nil {
+		return nil, "", nil
+	}
+
+	if _, ok := estadosTerminales[previo.Estado]; ok {
+		auditRepo.CreateLog(documentID, repository.ActionDuplicateResend, "Reenvío del documento, se devolvió la respuesta almacenada", userIP)
+		response := respuestaAlmacenada(previo)
+		return &response, "", nil
+	}
+
+	if previo.Estado == models.StatusError || (opciones.Reintento && previo.Estado == models.StatusProcessing) {
+		return nil, previo.Estado, nil
+	}
+
+	if previo.Estado == models.StatusDraft {
+		if !opciones.Borrador {
+			return nil, "", &errorProceso{
+				Status:  http.StatusConflict,
+				Mensaje: fmt.Sprintf("El documento %s es un borrador; emítalo con POST /api/v1/documents/%s/emitir", documentID, documentID),
+			}
+		}
+		if _, err := docRepo.EliminarBorrador(documentID); err != nil {
+			return nil, "", &errorProceso{Status: http.StatusInternalServerError, Mensaje: "Error al preparar la emisión del borrador: " + err.Error()}
+		}
+		return nil, "", nil
+	}
+
+	return nil, "", &errorProceso{
+		Status:  http.StatusConflict,
+		Mensaje: fmt.Sprintf("El documento %s ya fue recibido y está en estado %s; consulte su estado en lugar de reenviarlo", documentID, previo.Estado),
+	}
+}
+
+// respuestaAlmacenada reconstruye desde BD la respuesta de un documento ya procesado
+// (CDR, XML firmado y hashes), tal como se devolvió en la emisión original
+func respuestaAlmacenada(doc *models.Document) models.APIResponse {
+	estado := estadosTerminales[doc.Estado]
+
+	var xmlBase64, cdrBase64 string
+	if contenido, err := leerContenidoDocumento(doc.ID, doc.XMLPath, contenidoXML); err == nil {
+		xmlBase64 = base64.StdEncoding.EncodeToString(contenido)
+	}
+	if contenido, err := leerContenidoDocumento(doc.ID, doc.CDRPath, contenidoCDR); err == nil {
+		cdrBase64 = base64.StdEncoding.EncodeToString(contenido)
+	}
+
+	return models.APIResponse{
+		Estado:      estado,
+		Code:        doc.CodigoSUNAT,
+		Description: descripcionRespuesta(doc.TipoDoc, doc.Serie, doc.Numero, estado),
+		Hash:        fmt.Sprintf("SHA1:%s|RSA:%s", doc.HashSHA1, doc.HashRSA),
+		CDRZip:      cdrBase64,
+		XMLFirmado:  xmlBase64,
+		PDFURL:      construirPDFURL(doc.ID, doc.PDFPath),
+		Duplicado:   true,
+
+		Observaciones: doc.Observaciones,
+	}
+}
+
+// descripcionRespuesta arma la descripción de la respuesta con el nombre del tipo de
+// comprobante, como la del CDR (ej: "La Nota de Credito numero FC01-1, ha sido aprobada")
+func descripcionRespuesta(tipoDoc, serie, numero, estado string) string {
+	nombre, ok := catalogos.TiposDocumentoCatalogo01[tipoDoc]
+	if !ok {
+		return fmt.Sprintf("El comprobante numero %s-%s, ha sido %s", serie, numero, estado)
+	}
+	return fmt.Sprintf("La %s numero %s-%s, ha sido %s", nombre, serie, numero, estado)
+}
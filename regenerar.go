@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	conversor "ubl-go-conversor/converters"
+	"ubl-go-conversor/models"
+	"ubl-go-conversor/repository"
+	"ubl-go-conversor/signature"
+	"ubl-go-conversor/utils"
+)
+
+// estadosRegenerables son los estados en los que SUNAT aún no aceptó el comprobante,
+// por lo que su XML puede reemplazarse (ej: tras corregir un error del conversor)
+var estadosRegenerables = map[string]bool{
+	models.StatusError:       true,
+	models.StatusRejected:    true,
+	models.StatusPendingSend: true,
+	models.StatusScheduled:   true,
+}
+
+// errRegeneracion es un error de regenerar-xml atribuible al estado del documento (409)
+type errRegeneracion struct{ mensaje string }
+
+func (e *errRegeneracion) Error() string { return e.mensaje }
+
+/*
+manejarRegenerarXML es el endpoint administrativo POST /api/v1/documents/{id}/regenerar-xml.
+
+Sin parámetros retorna el XML regenerado (sin firmar) para revisarlo sin modificar
+nada. Con ?firmar=true reemplaza el XML del documento, lo firma y recrea el ZIP, de
+modo que un reenvío (contingencia o reproceso) usa la versión corregida.
+*/
+func manejarRegenerarXML(w http.ResponseWriter, r *http.Request, documentID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	contenido, err := regenerarXML(documentID, r.URL.Query().Get("firmar") == "true", r.RemoteAddr)
+	if err != nil {
+		var errEstado *errRegeneracion
+		switch {
+		case errors.As(err, &errEstado):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Error al regenerar XML: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(contenido)
+}
+
+// regenerarXML convierte nuevamente a XML el comprobante guardado en BD con la versión
+// actual del conversor. Con firmar=true reemplaza el XML del documento por la versión
+// firmada y actualiza hashes y ZIP; sin firmar no modifica ningún archivo.
+func regenerarXML(documentID string, firmar bool, userIP string) ([]byte, error) {
+	doc, err := docRepo.GetByID(documentID)
+	if err != nil {
+		return nil, &errRegeneracion{"documento no encontrado: " + documentID}
+	}
+	if !estadosRegenerables[doc.Estado] {
+		return nil, &errRegeneracion{fmt.Sprintf("el documento está en estado %s; solo se regeneran documentos no aceptados por SUNAT (error, rejected, pending_send)", doc.Estado)}
+	}
+	if doc.Payload == "" {
+		return nil, &errRegeneracion{"el documento no tiene el comprobante almacenado (emitido antes de guardar el payload)"}
+	}
+
+	var documento models.ComprobanteBase
+	if err := json.Unmarshal([]byte(doc.Payload), &documento); err != nil {
+		return nil, fmt.Errorf("payload almacenado inválido: %v", err)
+	}
+
+	nombreXML := doc.XMLPath
+	if nombreXML == "" {
+		nombreXML = "out/" + models.GenerarNombreArchivo(documento, "xml", appConfig.Files.NamePattern)
+	}
+	if !firmar {
+		// Vista previa: se genera en un archivo temporal para no tocar el XML firmado
+		nombreXML += ".regenerado.tmp"
+		defer os.Remove(nombreXML)
+	}
+
+	if err := conversor.GenerarXMLComprobante(documento, nombreXML, conversor.OpcionesXML{
+		Minificado:  appConfig.XML.Minify,
+		Indentacion: appConfig.XML.Indent,
+	}); err != nil {
+		return nil, fmt.Errorf("error al generar XML: %v", err)
+	}
+
+	if firmar {
+		firmante, err := obtenerFirmante(documento.Emisor.RUC)
+		if err != nil {
+			return nil, fmt.Errorf("error al cargar certificado: %v", err)
+		}
+		digest, signatureValue, err := signature.FirmarXMLConSigner(nombreXML, firmante, opcionesFirma())
+		if err != nil {
+			return nil, fmt.Errorf("error al firmar XML: %v", err)
+		}
+		zipPath, err := utils.ZipXMLComo(nombreXML, documentID)
+		if err != nil {
+			return nil, fmt.Errorf("error al comprimir XML: %v", err)
+		}
+
+		docRepo.UpdateHashes(documentID, digest, signatureValue)
+		persistirArchivos(documentID, userIP, nombreXML, zipPath)
+		docRepo.UpdateFilePaths(documentID, nombreXML, doc.PDFPath, doc.CDRPath, zipPath)
+		guardarContenidosBD(documentID, userIP, nombreXML, "", zipPath)
+		auditRepo.CreateLog(documentID, repository.ActionXMLRegenerated, "XML regenerado y firmado con la versión actual del conversor", userIP)
+	}
+
+	return os.ReadFile(nombreXML)
+}
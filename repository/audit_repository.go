@@ -33,6 +33,16 @@ func (r *AuditRepository) GetLogsByDocumentID(documentID string) ([]models.Audit
 	return logs, err
 }
 
+// GetTimeline obtiene los logs de un documento en orden cronológico, para reconstruir
+// su línea de tiempo de estados
+func (r *AuditRepository) GetTimeline(documentID string) ([]models.AuditLog, error) {
+	var logs []models.AuditLog
+	err := r.db.Where("document_id = ?", documentID).
+		Order("created_at ASC, id ASC").
+		Find(&logs).Error
+	return logs, err
+}
+
 // GetRecentLogs obtiene los logs más recientes
 func (r *AuditRepository) GetRecentLogs(limit int) ([]models.AuditLog, error) {
 	var logs []models.AuditLog
@@ -44,11 +54,21 @@ func (r *AuditRepository) GetRecentLogs(limit int) ([]models.AuditLog, error) {
 
 // Actions constantes para acciones de auditoría
 const (
-	ActionCreated   = "created"
-	ActionValidated = "validated"
-	ActionSigned    = "signed"
-	ActionSent      = "sent"
-	ActionApproved  = "approved"
-	ActionRejected  = "rejected"
-	ActionError     = "error"
+	ActionCreated         = "created"
+	ActionValidated       = "validated"
+	ActionSigned          = "signed"
+	ActionSent            = "sent"
+	ActionApproved        = "approved"
+	ActionRejected        = "rejected"
+	ActionError           = "error"
+	ActionPendingSend     = "pending_send"
+	ActionPDFError        = "pdf_error"
+	ActionTicketPending   = "ticket_pending"
+	ActionXMLRegenerated  = "xml_regenerated"
+	ActionDuplicateResend = "duplicate_resend"
+	ActionStatusChanged   = "status_changed"
+	ActionSummarySent     = "summary_sent"
+	ActionDraftCreated    = "draft_created"
+	ActionNotification    = "notification"
+	ActionScheduled       = "scheduled"
 )
\ No newline at end of file
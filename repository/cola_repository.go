@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"ubl-go-conversor/models"
+)
+
+// ColaRepository gestiona la cola de comprobantes de procesamiento asíncrono
+type ColaRepository struct {
+	db *gorm.DB
+}
+
+func NewColaRepository(db *gorm.DB) *ColaRepository {
+	return &ColaRepository{db: db}
+}
+
+// Encolar registra un comprobante pendiente de procesar
+func (r *ColaRepository) Encolar(item *models.ColaDocumento) error {
+	return r.db.Create(item).Error
+}
+
+// GetActivoByDocumentID retorna el elemento en cola o en proceso del documento, o nil si no hay
+func (r *ColaRepository) GetActivoByDocumentID(documentID string) (*models.ColaDocumento, error) {
+	var item models.ColaDocumento
+	err := r.db.Where("document_id = ? AND estado IN ?", documentID, []string{models.ColaQueued, models.ColaProcessing}).
+		First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetUltimoByDocumentID retorna el elemento más reciente de la cola para el documento
+func (r *ColaRepository) GetUltimoByDocumentID(documentID string) (*models.ColaDocumento, error) {
+	var item models.ColaDocumento
+	err := r.db.Where("document_id = ?", documentID).Order("id DESC").First(&item).Error
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+/*
+Tomar reserva el siguiente comprobante disponible de la cola (estado queued y fuera de
+su espera de reintento) y lo pasa a processing, incrementando los intentos.
+
+La reserva es un UPDATE condicionado al estado, por lo que dos workers (o dos instancias)
+no pueden tomar el mismo elemento. Retorna nil si no hay nada disponible.
+*/
+func (r *ColaRepository) Tomar() (*models.ColaDocumento, error) {
+	for {
+		var item models.ColaDocumento
+		err := r.db.Where("estado = ? AND disponible_desde <= ?", models.ColaQueued, time.Now()).
+			Order("id").
+			First(&item).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result := r.db.Model(&models.ColaDocumento{}).
+			Where("id = ? AND estado = ?", item.ID, models.ColaQueued).
+			Updates(map[string]interface{}{
+				"estado":   models.ColaProcessing,
+				"intentos": gorm.Expr("intentos + 1"),
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			item.Estado = models.ColaProcessing
+			item.Intentos++
+			return &item, nil
+		}
+		// Otro worker lo tomó primero; intentar con el siguiente
+	}
+}
+
+// MarcarCompletado registra que el comprobante fue procesado
+func (r *ColaRepository) MarcarCompletado(id uint) error {
+	return r.db.Model(&models.ColaDocumento{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"estado": models.ColaDone, "error": ""}).Error
+}
+
+// MarcarFallido registra un error definitivo (no se reintenta)
+func (r *ColaRepository) MarcarFallido(id uint, mensaje string) error {
+	return r.db.Model(&models.ColaDocumento{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"estado": models.ColaFailed, "error": mensaje}).Error
+}
+
+// Reencolar devuelve el comprobante a la cola para reintentarlo a partir de disponibleDesde
+func (r *ColaRepository) Reencolar(id uint, mensaje string, disponibleDesde time.Time) error {
+	return r.db.Model(&models.ColaDocumento{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"estado":           models.ColaQueued,
+			"error":            mensaje,
+			"disponible_desde": disponibleDesde,
+		}).Error
+}
+
+// ReiniciarEnProceso devuelve a la cola los elementos que quedaron en processing por un
+// reinicio del servicio. Debe llamarse al arrancar, antes de iniciar los workers
+// (supone una sola instancia procesando la cola).
+func (r *ColaRepository) ReiniciarEnProceso() (int64, error) {
+	result := r.db.Model(&models.ColaDocumento{}).Where("estado = ?", models.ColaProcessing).
+		Update("estado", models.ColaQueued)
+	return result.RowsAffected, result.Error
+}
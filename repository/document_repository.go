@@ -1,9 +1,11 @@
 package repository
 
 import (
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"ubl-go-conversor/models"
 )
 
@@ -17,13 +19,22 @@ func NewDocumentRepository(db *gorm.DB) *DocumentRepository {
 
 // Create crea un nuevo documento en la base de datos
 func (r *DocumentRepository) Create(doc *models.Document) error {
-	return r.db.Create(doc).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(doc).Error; err != nil {
+			return err
+		}
+		return registrarTransicion(tx, doc.ID, "", doc.Estado)
+	})
 }
 
+// columnasContenido son las copias de los archivos en BD: pueden pesar varios MB, por lo
+// que las consultas de documentos no las leen y se obtienen aparte con GetContents
+var columnasContenido = []string{"xml_content", "cdr_content", "zip_content"}
+
 // GetByID busca un documento por su ID
 func (r *DocumentRepository) GetByID(id string) (*models.Document, error) {
 	var doc models.Document
-	err := r.db.Preload("Items").First(&doc, "id = ?", id).Error
+	err := r.db.Omit(columnasContenido...).Preload("Items").First(&doc, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -33,13 +44,25 @@ func (r *DocumentRepository) GetByID(id string) (*models.Document, error) {
 // GetByRUCSerieNumero busca un documento por RUC, serie y número
 func (r *DocumentRepository) GetByRUCSerieNumero(ruc, serie, numero string) (*models.Document, error) {
 	var doc models.Document
-	err := r.db.Preload("Items").First(&doc, "ruc = ? AND serie = ? AND numero = ?", ruc, serie, numero).Error
+	err := r.db.Omit(columnasContenido...).Preload("Items").First(&doc, "ruc = ? AND serie = ? AND numero = ?", ruc, serie, numero).Error
 	if err != nil {
 		return nil, err
 	}
 	return &doc, nil
 }
 
+// GetByReferenciaExterna busca los documentos asociados a una referencia del sistema del
+// cliente (puede haber varios, ej: un rechazo y su reemisión), opcionalmente por RUC
+func (r *DocumentRepository) GetByReferenciaExterna(ruc, referencia string) ([]models.Document, error) {
+	var docs []models.Document
+	query := r.db.Omit(columnasContenido...).Where("referencia_externa = ?", referencia)
+	if ruc != "" {
+		query = query.Where("ruc = ?", ruc)
+	}
+	err := query.Order("created_at DESC").Find(&docs).Error
+	return docs, err
+}
+
 // Update actualiza un documento existente
 func (r *DocumentRepository) Update(doc *models.Document) error {
 	return r.db.Save(doc).Error
@@ -58,7 +81,52 @@ func (r *DocumentRepository) UpdateStatus(id, estado, codigoSUNAT, mensajeSUNAT
 		updates["processed_at"] = time.Now()
 	}
 	
-	return r.db.Model(&models.Document{}).Where("id = ?", id).Updates(updates).Error
+	return r.actualizarEstado(id, estado, updates)
+}
+
+// actualizarEstado aplica updates (que incluyen el nuevo estado) y registra la transición
+// desde el estado anterior en la misma transacción
+func (r *DocumentRepository) actualizarEstado(id, estado string, updates map[string]interface{}) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var estados []string
+		err := tx.Model(&models.Document{}).Where("id = ?", id).Pluck("estado", &estados).Error
+		if err != nil {
+			return err
+		}
+		var anterior string
+		if len(estados) > 0 {
+			anterior = estados[0]
+		}
+		if err := tx.Model(&models.Document{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+			return err
+		}
+		if anterior == estado {
+			return nil
+		}
+		return registrarTransicion(tx, id, anterior, estado)
+	})
+}
+
+// registrarTransicion deja en la auditoría el paso de un estado a otro del documento
+func registrarTransicion(tx *gorm.DB, id, anterior, nuevo string) error {
+	detalle := "Estado inicial: " + nuevo
+	if anterior != "" {
+		detalle = anterior + " -> " + nuevo
+	}
+	return tx.Create(&models.AuditLog{
+		DocumentID:     id,
+		Action:         ActionStatusChanged,
+		Details:        detalle,
+		EstadoAnterior: anterior,
+		EstadoNuevo:    nuevo,
+	}).Error
+}
+
+// UpdateObservaciones guarda las observaciones del CDR (se serializan como JSON)
+func (r *DocumentRepository) UpdateObservaciones(id string, observaciones []string) error {
+	return r.db.Model(&models.Document{}).Where("id = ?", id).
+		Select("observaciones", "updated_at").
+		Updates(&models.Document{Observaciones: observaciones, UpdatedAt: time.Now()}).Error
 }
 
 // UpdateFilePaths actualiza las rutas de archivos generados
@@ -73,6 +141,55 @@ func (r *DocumentRepository) UpdateFilePaths(id string, xmlPath, pdfPath, cdrPat
 	return r.db.Model(&models.Document{}).Where("id = ?", id).Updates(updates).Error
 }
 
+// UpdateContents guarda en BD el contenido de los archivos XML, CDR y ZIP del documento.
+// Los contenidos nil no se modifican (ej: el CDR llega después del envío).
+func (r *DocumentRepository) UpdateContents(id string, xml, cdr, zip []byte) error {
+	updates := map[string]interface{}{}
+	if xml != nil {
+		updates["xml_content"] = xml
+	}
+	if cdr != nil {
+		updates["cdr_content"] = cdr
+	}
+	if zip != nil {
+		updates["zip_content"] = zip
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	updates["updated_at"] = time.Now()
+	return r.db.Model(&models.Document{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// GetContents obtiene solo el contenido de los archivos guardados en BD del documento
+func (r *DocumentRepository) GetContents(id string) (*models.Document, error) {
+	var doc models.Document
+	err := r.db.Select(append([]string{"id"}, columnasContenido...)).First(&doc, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// UpdateTicket guarda el ticket de un envío asíncrono y deja el documento pendiente de consulta
+func (r *DocumentRepository) UpdateTicket(id, ticket string) error {
+	updates := map[string]interface{}{
+		"ticket":     ticket,
+		"estado":     models.StatusTicketPending,
+		"updated_at": time.Now(),
+	}
+	return r.actualizarEstado(id, models.StatusTicketPending, updates)
+}
+
+// UpdateCDRPath actualiza solo la ruta del CDR (recibido después del envío, ej: por ticket)
+func (r *DocumentRepository) UpdateCDRPath(id, cdrPath string) error {
+	updates := map[string]interface{}{
+		"cdr_path":   cdrPath,
+		"updated_at": time.Now(),
+	}
+	return r.db.Model(&models.Document{}).Where("id = ?", id).Updates(updates).Error
+}
+
 // UpdateHashes actualiza los hashes de firma digital
 func (r *DocumentRepository) UpdateHashes(id, hashSHA1, hashRSA string) error {
 	updates := map[string]interface{}{
@@ -86,7 +203,7 @@ func (r *DocumentRepository) UpdateHashes(id, hashSHA1, hashRSA string) error {
 // GetByRUC obtiene todos los documentos de un RUC
 func (r *DocumentRepository) GetByRUC(ruc string, limit, offset int) ([]models.Document, error) {
 	var docs []models.Document
-	err := r.db.Where("ruc = ?", ruc).
+	err := r.db.Omit(columnasContenido...).Where("ruc = ?", ruc).
 		Order("created_at DESC").
 		Limit(limit).
 		Offset(offset).
@@ -97,7 +214,7 @@ func (r *DocumentRepository) GetByRUC(ruc string, limit, offset int) ([]models.D
 // GetByStatus obtiene documentos por estado
 func (r *DocumentRepository) GetByStatus(estado string, limit, offset int) ([]models.Document, error) {
 	var docs []models.Document
-	err := r.db.Where("estado = ?", estado).
+	err := r.db.Omit(columnasContenido...).Where("estado = ?", estado).
 		Order("created_at DESC").
 		Limit(limit).
 		Offset(offset).
@@ -105,11 +222,202 @@ func (r *DocumentRepository) GetByStatus(estado string, limit, offset int) ([]mo
 	return docs, err
 }
 
+// GetByFilters obtiene documentos combinando los filtros informados: RUC, estado y rango
+// de fechas de creación (los valores vacíos o cero no filtran). Retorna además el total
+// de documentos que cumplen los filtros, para paginación.
+func (r *DocumentRepository) GetByFilters(ruc, estado string, desde, hasta time.Time, limit, offset int) ([]models.Document, int64, error) {
+	query := r.db.Model(&models.Document{})
+	if ruc != "" {
+		query = query.Where("ruc = ?", ruc)
+	}
+	if estado != "" {
+		query = query.Where("estado = ?", estado)
+	}
+	if !desde.IsZero() {
+		query = query.Where("created_at >= ?", desde)
+	}
+	if !hasta.IsZero() {
+		query = query.Where("created_at < ?", hasta)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var docs []models.Document
+	err := query.Omit(columnasContenido...).Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&docs).Error
+	return docs, total, err
+}
+
+// ProgramarEnvio deja el documento firmado en estado scheduled hasta el momento indicado
+func (r *DocumentRepository) ProgramarEnvio(id string, enviarEn time.Time) error {
+	updates := map[string]interface{}{
+		"estado":           models.StatusScheduled,
+		"envio_programado": enviarEn,
+		"updated_at":       time.Now(),
+	}
+	return r.actualizarEstado(id, models.StatusScheduled, updates)
+}
+
+// GetEnviosProgramados obtiene los documentos programados cuyo envío vence hasta el
+// momento indicado, en el orden en que se programaron
+func (r *DocumentRepository) GetEnviosProgramados(hasta time.Time, limit int) ([]models.Document, error) {
+	var docs []models.Document
+	err := r.db.Omit(columnasContenido...).
+		Where("estado = ? AND envio_programado <= ?", models.StatusScheduled, hasta).
+		Order("envio_programado ASC").
+		Limit(limit).
+		Find(&docs).Error
+	return docs, err
+}
+
+// TomarEnvioProgramado pasa un documento programado a processing solo si sigue en
+// scheduled, para que dos instancias del scheduler no lo envíen dos veces.
+// Retorna false si otra instancia ya lo tomó.
+func (r *DocumentRepository) TomarEnvioProgramado(id string) (bool, error) {
+	tomado := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Document{}).
+			Where("id = ? AND estado = ?", id, models.StatusScheduled).
+			Updates(map[string]interface{}{"estado": models.StatusProcessing, "updated_at": time.Now()})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		tomado = true
+		return registrarTransicion(tx, id, models.StatusScheduled, models.StatusProcessing)
+	})
+	return tomado, err
+}
+
+// GetTicketPending obtiene los documentos con ticket pendiente de consulta en SUNAT,
+// del más antiguo al más reciente
+func (r *DocumentRepository) GetTicketPending(limit int) ([]models.Document, error) {
+	var docs []models.Document
+	err := r.db.Omit(columnasContenido...).Where("estado = ? AND ticket <> ''", models.StatusTicketPending).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&docs).Error
+	return docs, err
+}
+
+// estadosNumeroConsumido son los estados en los que el número ya fue emitido
+// (firmado o enviado a SUNAT); los borradores no consumen correlativo
+var estadosNumeroConsumido = []string{
+	models.StatusProcessing,
+	models.StatusPendingSend,
+	models.StatusScheduled,
+	models.StatusTicketPending,
+	models.StatusApproved,
+	models.StatusObserved,
+	models.StatusActionRequired,
+	models.StatusRejected,
+	models.StatusError,
+}
+
+// GetUltimoNumero obtiene el último número emitido para un RUC, tipo de documento y serie
+// Retorna 0 si la serie aún no tiene documentos
+func (r *DocumentRepository) GetUltimoNumero(ruc, tipoDoc, serie string) (int64, error) {
+	return ultimoNumeroEmitido(r.db, ruc, tipoDoc, serie)
+}
+
+// ultimoNumeroEmitido consulta el máximo número emitido usando la conexión o transacción recibida
+func ultimoNumeroEmitido(db *gorm.DB, ruc, tipoDoc, serie string) (int64, error) {
+	var ultimo int64
+	err := db.Model(&models.Document{}).
+		Select("COALESCE(MAX(CAST(numero AS UNSIGNED)), 0)").
+		Where("ruc = ? AND tipo_doc = ? AND serie = ? AND estado IN ?", ruc, tipoDoc, serie, estadosNumeroConsumido).
+		Scan(&ultimo).Error
+	return ultimo, err
+}
+
+// GetSiguienteNumero retorna el siguiente número disponible sin reservarlo,
+// considerando tanto los documentos emitidos como los números ya reservados
+func (r *DocumentRepository) GetSiguienteNumero(ruc, tipoDoc, serie string) (int64, error) {
+	ultimo, err := r.GetUltimoNumero(ruc, tipoDoc, serie)
+	if err != nil {
+		return 0, err
+	}
+
+	var correlativo models.SerieCorrelativo
+	err = r.db.First(&correlativo, "ruc = ? AND tipo_doc = ? AND serie = ?", ruc, tipoDoc, serie).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+	if correlativo.UltimoNumero > ultimo {
+		ultimo = correlativo.UltimoNumero
+	}
+
+	return ultimo + 1, nil
+}
+
+// ReservarNumero reserva atómicamente el siguiente número de la serie.
+// Usa SELECT ... FOR UPDATE para evitar que dos cajas obtengan el mismo número.
+func (r *DocumentRepository) ReservarNumero(ruc, tipoDoc, serie string) (int64, error) {
+	var reservado int64
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var correlativo models.SerieCorrelativo
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&correlativo, "ruc = ? AND tipo_doc = ? AND serie = ?", ruc, tipoDoc, serie).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		ultimo, err := ultimoNumeroEmitido(tx, ruc, tipoDoc, serie)
+		if err != nil {
+			return err
+		}
+		if correlativo.UltimoNumero > ultimo {
+			ultimo = correlativo.UltimoNumero
+		}
+
+		reservado = ultimo + 1
+		correlativo.RUC = ruc
+		correlativo.TipoDoc = tipoDoc
+		correlativo.Serie = serie
+		correlativo.UltimoNumero = reservado
+		return tx.Save(&correlativo).Error
+	})
+
+	return reservado, err
+}
+
 // Delete elimina un documento (soft delete)
 func (r *DocumentRepository) Delete(id string) error {
 	return r.db.Delete(&models.Document{}, "id = ?", id).Error
 }
 
+// ReiniciarParaReproceso reemplaza en el mismo registro los datos de un documento cuyo
+// procesamiento no terminó (estadoPrevio: processing o error) para volver a emitirlo con
+// el mismo ID. Conserva la fecha de creación y la auditoría, y registra la transición.
+// Retorna false si el documento ya no está en estadoPrevio (otra solicitud lo tomó).
+func (r *DocumentRepository) ReiniciarParaReproceso(doc *models.Document, estadoPrevio string) (bool, error) {
+	reiniciado := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Document{}).
+			Where("id = ? AND estado = ?", doc.ID, estadoPrevio).
+			Select("*").Omit("id", "created_at", clause.Associations).
+			Updates(doc)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		reiniciado = true
+		return registrarTransicion(tx, doc.ID, estadoPrevio, doc.Estado)
+	})
+	return reiniciado, err
+}
+
+// EliminarBorrador elimina un borrador para emitirlo con el mismo ID; no afecta a los
+// documentos que ya pasaron a emisión
+func (r *DocumentRepository) EliminarBorrador(id string) (bool, error) {
+	result := r.db.Where("id = ? AND estado = ?", id, models.StatusDraft).Delete(&models.Document{})
+	return result.RowsAffected > 0, result.Error
+}
+
 // CreateItem crea un item de documento
 func (r *DocumentRepository) CreateItem(item *models.DocumentItem) error {
 	return r.db.Create(item).Error
@@ -120,6 +428,29 @@ func (r *DocumentRepository) CreateItems(items []models.DocumentItem) error {
 	return r.db.Create(&items).Error
 }
 
+// GetUsoPorAPIKey cuenta los documentos emitidos por un cliente entre desde (inclusive)
+// y hasta (exclusive), agrupados por estado
+func (r *DocumentRepository) GetUsoPorAPIKey(apiKey string, desde, hasta time.Time) (map[string]int64, error) {
+	var filas []struct {
+		Estado   string
+		Cantidad int64
+	}
+	err := r.db.Model(&models.Document{}).
+		Select("estado, COUNT(*) AS cantidad").
+		Where("api_key = ? AND created_at >= ? AND created_at < ?", apiKey, desde, hasta).
+		Group("estado").
+		Scan(&filas).Error
+	if err != nil {
+		return nil, err
+	}
+
+	porEstado := map[string]int64{}
+	for _, fila := range filas {
+		porEstado[fila.Estado] = fila.Cantidad
+	}
+	return porEstado, nil
+}
+
 // GetDocumentStats obtiene estadísticas de documentos
 func (r *DocumentRepository) GetDocumentStats(ruc string) (map[string]interface{}, error) {
 	var stats struct {
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/*
+Las respuestas de emisión (APIResponse, ErrorResponse, batch y encolado) se serializan
+como JSON por defecto, o como XML cuando el header Accept lo prefiere
+(application/xml o text/xml), para sistemas legados que no manejan JSON.
+*/
+
+// escribirRespuesta serializa la respuesta en el formato que prefiere el cliente
+func escribirRespuesta(w http.ResponseWriter, r *http.Request, status int, respuesta interface{}) {
+	if prefiereXML(r) {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write([]byte(xml.Header))
+		xml.NewEncoder(w).Encode(respuesta)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(respuesta)
+}
+
+// prefiereXML indica si el header Accept da a XML una preferencia (q) mayor que a JSON.
+// Sin header, con */* o con empate se responde JSON.
+func prefiereXML(r *http.Request) bool {
+	var calidadXML, calidadJSON float64
+	for _, rango := range strings.Split(r.Header.Get("Accept"), ",") {
+		tipo, parametros, err := mime.ParseMediaType(strings.TrimSpace(rango))
+		if err != nil {
+			continue
+		}
+		calidad := 1.0
+		if q, ok := parametros["q"]; ok {
+			if valor, err := strconv.ParseFloat(q, 64); err == nil {
+				calidad = valor
+			}
+		}
+		switch tipo {
+		case "application/xml", "text/xml":
+			calidadXML = max(calidadXML, calidad)
+		case "application/json":
+			calidadJSON = max(calidadJSON, calidad)
+		}
+	}
+	return calidadXML > calidadJSON
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	conversor "ubl-go-conversor/converters"
+	"ubl-go-conversor/models"
+	"ubl-go-conversor/repository"
+	"ubl-go-conversor/signature"
+	"ubl-go-conversor/utils"
+	"ubl-go-conversor/validator"
+)
+
+/*
+manejarResumenDiario recibe las boletas de un día y las informa a SUNAT en un resumen
+diario (SummaryDocuments), en lugar de enviarlas una por una.
+
+Flujo:
+ 1. Validar el resumen: mismo emisor y fecha de emisión, estado del catálogo 19 por línea
+ 2. Reservar el correlativo del día y armar el ID RC-YYYYMMDD-NNN
+ 3. Generar el XML, firmarlo y comprimirlo con el nombre SUNAT (RUC-RC-YYYYMMDD-NNN)
+ 4. Enviarlo con sendSummary y guardar el ticket; el CDR se obtiene luego con
+    consultar-ticket o el job de tickets pendientes
+
+POST /api/v1/summary[?destino=]
+*/
+func manejarResumenDiario(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var resumen models.ResumenDiario
+	if err := json.NewDecoder(r.Body).Decode(&resumen); err != nil {
+		responderErrorJSON(w, err, "Error al leer JSON: ")
+		return
+	}
+	userIP := r.RemoteAddr
+
+	// El emisor del resumen se normaliza igual que el de un comprobante
+	cabecera := models.ComprobanteBase{Emisor: resumen.Emisor}
+	models.NormalizarComprobante(&cabecera)
+	resumen.Emisor = cabecera.Emisor
+	if err := verificarEmisorAutorizado(resumen.Emisor.RUC); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	for i := range resumen.Boletas {
+		boleta := &resumen.Boletas[i]
+		boleta.Estado = strings.TrimSpace(boleta.Estado)
+		models.NormalizarComprobante(&boleta.Comprobante)
+		if err := models.NormalizarFechas(&boleta.Comprobante); err != nil {
+			http.Error(w, fmt.Sprintf("Error de validación: boleta %d: %v", i+1, err), http.StatusBadRequest)
+			return
+		}
+		boleta.Comprobante.Numero = models.NormalizarNumero(boleta.Comprobante.Numero)
+	}
+	if resumen.FechaGeneracion == "" {
+		resumen.FechaGeneracion = validator.FechaHoyPeru(time.Now())
+	}
+
+	if err := validator.ValidarResumenDiario(resumen); err != nil {
+		http.Error(w, "Error de validación: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// El resumen se envía con sendSummary (SOAP); GRE no admite resúmenes
+	nombreDestino, destinoConfig, err := appConfig.Destino(resumen.Emisor.RUC, r.URL.Query().Get("destino"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	destino := destinoEnvio(nombreDestino, destinoConfig)
+	if destino.Tipo == utils.DestinoGRE {
+		http.Error(w, "El destino "+nombreDestino+" no admite resúmenes diarios", http.StatusBadRequest)
+		return
+	}
+
+	// ==================== CORRELATIVO DEL DÍA ====================
+
+	// El correlativo se reserva por fecha de generación (serie = YYYYMMDD)
+	fecha := strings.ReplaceAll(resumen.FechaGeneracion, "-", "")
+	correlativo, err := docRepo.ReservarNumero(resumen.Emisor.RUC, models.TipoDocResumenDiario, fecha)
+	if err != nil {
+		http.Error(w, "Error al reservar el correlativo del resumen: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resumenID := fmt.Sprintf("%s-%s-%03d", models.TipoDocResumenDiario, fecha, correlativo)
+	// GenerateDocumentID quitaría los ceros del correlativo, que SUNAT exige en el nombre del archivo
+	documentID := resumen.Emisor.RUC + "-" + resumenID
+
+	payload, err := json.Marshal(resumen)
+	if err != nil {
+		http.Error(w, "Error al serializar el resumen: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// El total del resumen en BD suma las ventas informadas; las anulaciones no son ventas
+	totales := totalesResumen(resumen)
+	var total float64
+	for _, t := range totales {
+		if t.Estado != models.EstadoResumenAnular {
+			total += t.Total
+		}
+	}
+
+	dbDocument := &models.Document{
+		ID:           documentID,
+		RUC:          resumen.Emisor.RUC,
+		TipoDoc:      models.TipoDocResumenDiario,
+		Serie:        fecha,
+		Numero:       strconv.FormatInt(correlativo, 10),
+		Total:        total,
+		Moneda:       resumen.Boletas[0].Comprobante.Moneda,
+		FechaEmision: resumen.FechaGeneracion,
+		Estado:       models.StatusProcessing,
+		Destino:      nombreDestino,
+		Payload:      string(payload),
+		APIKey:       clienteAutenticado(r),
+	}
+	if err := docRepo.Create(dbDocument); err != nil {
+		http.Error(w, "Error al crear el resumen en BD: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	auditRepo.CreateLog(documentID, repository.ActionCreated, fmt.Sprintf("Resumen diario creado con %d comprobante(s)", len(resumen.Boletas)), userIP)
+	defer marcarErrorSiPanic(documentID, userIP)
+
+	// fallar deja el resumen en error para que no quede en processing indefinidamente
+	fallar := func(status int, mensaje string) {
+		docRepo.UpdateStatus(documentID, models.StatusError, "", mensaje)
+		auditRepo.CreateLog(documentID, repository.ActionError, mensaje, userIP)
+		http.Error(w, mensaje, status)
+	}
+
+	// ==================== XML, FIRMA Y ZIP ====================
+
+	if err := os.MkdirAll("out", 0755); err != nil {
+		fallar(http.StatusInternalServerError, "Error al crear carpeta: "+err.Error())
+		return
+	}
+	nombreXML := "out/" + documentID + ".xml"
+	err = conversor.GenerarXMLResumen(resumen, resumenID, nombreXML, conversor.OpcionesXML{
+		Minificado:  appConfig.XML.Minify,
+		Indentacion: appConfig.XML.Indent,
+	})
+	if err != nil {
+		fallar(http.StatusInternalServerError, "Error al generar XML: "+err.Error())
+		return
+	}
+
+	firmante, err := obtenerFirmante(resumen.Emisor.RUC)
+	if err != nil {
+		fallar(http.StatusInternalServerError, "Error al cargar certificado: "+err.Error())
+		return
+	}
+	digest, signatureValue, err := signature.FirmarXMLConSigner(nombreXML, firmante, opcionesFirma())
+	if err != nil {
+		fallar(http.StatusInternalServerError, "Error al firmar XML: "+err.Error())
+		return
+	}
+	docRepo.UpdateHashes(documentID, digest, signatureValue)
+	auditRepo.CreateLog(documentID, repository.ActionSigned, "XML firmado digitalmente", userIP)
+
+	zipPath, err := utils.ZipXMLComo(nombreXML, documentID)
+	if err != nil {
+		fallar(http.StatusInternalServerError, "Error al comprimir XML: "+err.Error())
+		return
+	}
+
+	// ==================== ENVÍO (sendSummary) ====================
+
+	auditRepo.CreateLog(documentID, repository.ActionSummarySent, "Resumen enviado con sendSummary a "+destino.Nombre, userIP)
+	envio, err := utils.EnviarComprobante(destino, resumen.Emisor.RUC, zipPath, "cdr")
+	if err != nil {
+		docRepo.UpdateStatus(documentID, models.StatusError, "", err.Error())
+		auditRepo.CreateLog(documentID, repository.ActionError, "Error al enviar a SUNAT: "+err.Error(), userIP)
+		escribirRespuesta(w, r, http.StatusInternalServerError, models.ErrorResponse{
+			Estado:      "error",
+			Code:        "500",
+			Description: "Error al enviar a SUNAT",
+			Details:     err.Error(),
+		})
+		return
+	}
+	if envio.Ticket == "" {
+		fallar(http.StatusBadGateway, "SUNAT no devolvió un ticket para el resumen")
+		return
+	}
+
+	docRepo.UpdateTicket(documentID, envio.Ticket)
+	auditRepo.CreateLog(documentID, repository.ActionTicketPending, "Resumen recibido con ticket "+envio.Ticket, userIP)
+	persistirArchivos(documentID, userIP, nombreXML, zipPath)
+	docRepo.UpdateFilePaths(documentID, nombreXML, "", "", zipPath)
+	guardarContenidosBD(documentID, userIP, nombreXML, "", zipPath)
+
+	xmlContent, _ := ioutil.ReadFile(nombreXML)
+	escribirRespuesta(w, r, http.StatusAccepted, models.ResumenResponse{
+		DocumentID:  documentID,
+		ID:          resumenID,
+		Estado:      models.StatusTicketPending,
+		Ticket:      envio.Ticket,
+		Description: fmt.Sprintf("El resumen %s con %d comprobante(s) fue recibido con el ticket %s, pendiente de consulta", resumenID, len(resumen.Boletas), envio.Ticket),
+		Hash:        fmt.Sprintf("SHA1:%s|RSA:%s", digest, signatureValue),
+		XMLFirmado:  base64.StdEncoding.EncodeToString(xmlContent),
+		Totales:     totales,
+	})
+}
+
+// totalesResumen cuenta los comprobantes y suma sus importes por estado (catálogo 19)
+func totalesResumen(resumen models.ResumenDiario) []models.TotalEstadoResumen {
+	var totales []models.TotalEstadoResumen
+	for _, estado := range []string{models.EstadoResumenAdicionar, models.EstadoResumenModificar, models.EstadoResumenAnular} {
+		t := models.TotalEstadoResumen{Estado: estado, Descripcion: models.EstadosResumen[estado]}
+		for _, boleta := range resumen.Boletas {
+			if boleta.Estado == estado {
+				t.Cantidad++
+				t.Total += boleta.Comprobante.TotalImportePagar
+			}
+		}
+		if t.Cantidad > 0 {
+			t.Total = models.RedondearCentimo(t.Total)
+			totales = append(totales, t)
+		}
+	}
+	return totales
+}
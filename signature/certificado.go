@@ -0,0 +1,131 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// marcasCertificadoPrueba son palabras que identifican a los certificados de
+// prueba/demostración (SUNAT beta, proveedores de certificados de demostración) cuando
+// aparecen completas en el CN, O u OU del subject
+var marcasCertificadoPrueba = map[string]bool{
+	"PRUEBA": true, "PRUEBAS": true, "DEMO": true, "DEMOSTRACION": true, "TEST": true, "BETA": true,
+}
+
+// sinTildes normaliza las vocales acentuadas para comparar palabras del subject
+var sinTildes = strings.NewReplacer("Á", "A", "É", "E", "Í", "I", "Ó", "O", "Ú", "U")
+
+// CargarCertificado decodifica el PKCS#12 y retorna el certificado X.509 del firmante
+func CargarCertificado(pfxData []byte, pfxPassword string) (*x509.Certificate, error) {
+	_, cert, err := pkcs12.Decode(pfxData, pfxPassword)
+	if err != nil {
+		return nil, errorPFX(err)
+	}
+	return cert, nil
+}
+
+// CertInfo resume los datos del certificado para diagnóstico
+type CertInfo struct {
+	Sujeto         string    `json:"sujeto"`
+	Emisor         string    `json:"emisor"`
+	NumeroSerie    string    `json:"numero_serie"`
+	ValidoDesde    time.Time `json:"valido_desde"`
+	ValidoHasta    time.Time `json:"valido_hasta"`
+	DiasParaVencer int       `json:"dias_para_vencer"`
+	Vigente        bool      `json:"vigente"`
+	EsPrueba       bool      `json:"es_prueba"`
+	Error          string    `json:"error,omitempty"` // Motivo por el que no está vigente
+}
+
+// NuevoCertInfo arma el resumen de diagnóstico del certificado a la fecha indicada
+func NuevoCertInfo(cert *x509.Certificate, ahora time.Time) *CertInfo {
+	info := &CertInfo{
+		Sujeto:         cert.Subject.String(),
+		Emisor:         cert.Issuer.String(),
+		NumeroSerie:    cert.SerialNumber.String(),
+		ValidoDesde:    cert.NotBefore,
+		ValidoHasta:    cert.NotAfter,
+		DiasParaVencer: DiasParaVencer(cert, ahora),
+		Vigente:        true,
+		EsPrueba:       EsCertificadoDePrueba(cert),
+	}
+	if err := VerificarVigencia(cert, ahora); err != nil {
+		info.Vigente = false
+		info.Error = err.Error()
+	}
+	return info
+}
+
+/*
+ValidarCertificado lee el PKCS#12, verifica su vigencia y retorna sus datos (sujeto,
+emisor y fechas). Si el certificado no está vigente retorna también el CertInfo junto
+con el error, para poder mostrar las fechas en el diagnóstico.
+*/
+func ValidarCertificado(pfxPath, password string) (*CertInfo, error) {
+	pfxData, err := os.ReadFile(pfxPath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo PFX: %v", err)
+	}
+	cert, err := CargarCertificado(pfxData, password)
+	if err != nil {
+		return nil, err
+	}
+	info := NuevoCertInfo(cert, time.Now())
+	if !info.Vigente {
+		return info, errors.New(info.Error)
+	}
+	return info, nil
+}
+
+// errorPFX distingue una contraseña incorrecta de un archivo que no es un PKCS#12 válido
+func errorPFX(err error) error {
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return errors.New("la contraseña del PFX es incorrecta")
+	}
+	return fmt.Errorf("error decodificando PFX (estructura inválida o archivo dañado): %v", err)
+}
+
+// VerificarVigencia retorna un error si el certificado aún no es válido o ya venció
+func VerificarVigencia(cert *x509.Certificate, ahora time.Time) error {
+	if ahora.Before(cert.NotBefore) {
+		return fmt.Errorf("el certificado aún no es válido (vigente desde el %s)", cert.NotBefore.Format("2006-01-02"))
+	}
+	if ahora.After(cert.NotAfter) {
+		return fmt.Errorf("el certificado venció el %s", cert.NotAfter.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// DiasParaVencer retorna los días que faltan para que el certificado venza
+func DiasParaVencer(cert *x509.Certificate, ahora time.Time) int {
+	return int(math.Floor(cert.NotAfter.Sub(ahora).Hours() / 24))
+}
+
+// EsCertificadoDePrueba indica si el certificado parece ser de prueba: el CN, O u OU de
+// su subject contienen una palabra de prueba/demostración o es autofirmado (subject
+// igual al issuer). Se comparan palabras completas para que razones sociales como
+// "ALFABETA S.A.C." no se confundan con un certificado beta.
+func EsCertificadoDePrueba(cert *x509.Certificate) bool {
+	campos := append([]string{cert.Subject.CommonName}, cert.Subject.Organization...)
+	campos = append(campos, cert.Subject.OrganizationalUnit...)
+	for _, campo := range campos {
+		palabras := strings.FieldsFunc(sinTildes.Replace(strings.ToUpper(campo)), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, palabra := range palabras {
+			if marcasCertificadoPrueba[palabra] {
+				return true
+			}
+		}
+	}
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer)
+}
@@ -0,0 +1,77 @@
+package signature
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// certificadoEmitido crea un certificado con el subject indicado firmado por una CA
+// distinta, para que la detección no dependa de que sea autofirmado
+func certificadoEmitido(t *testing.T, subject pkix.Name) *x509.Certificate {
+	t.Helper()
+	clave, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ENTIDAD DE CERTIFICACION", Organization: []string{"CA PERU"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	plantilla := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, plantilla, ca, &clave.PublicKey, clave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// TestEsCertificadoDePrueba verifica que solo las palabras completas del CN, O u OU
+// marquen al certificado como de prueba
+func TestEsCertificadoDePrueba(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		subject  pkix.Name
+		esperado bool
+	}{
+		{"demostración en el CN", pkix.Name{CommonName: "REPRESENTANTE LEGAL - CERTIFICADO PARA DEMOSTRACIÓN"}, true},
+		{"prueba en el OU", pkix.Name{CommonName: "JUAN PEREZ", OrganizationalUnit: []string{"CERTIFICADO DE PRUEBA"}}, true},
+		{"beta en la O", pkix.Name{CommonName: "JUAN PEREZ", Organization: []string{"SUNAT BETA"}}, true},
+		{"razón social con BETA", pkix.Name{CommonName: "JUAN PEREZ", Organization: []string{"ALFABETA S.A.C."}}, false},
+		{"razón social con TEST", pkix.Name{CommonName: "CONTESTA PERU E.I.R.L.", Organization: []string{"TESTIGOS DEL SUR S.A."}}, false},
+		{"certificado real", pkix.Name{CommonName: "EMPRESA SAC", Organization: []string{"EMPRESA SAC"}}, false},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			if obtenido := EsCertificadoDePrueba(certificadoEmitido(t, c.subject)); obtenido != c.esperado {
+				t.Errorf("esperado %t, obtenido %t", c.esperado, obtenido)
+			}
+		})
+	}
+}
+
+// TestEsCertificadoDePruebaAutofirmado verifica que un certificado autofirmado se
+// considere de prueba aunque su subject no tenga marcas
+func TestEsCertificadoDePruebaAutofirmado(t *testing.T) {
+	if !EsCertificadoDePrueba(signerPrueba(t).certificado) {
+		t.Error("un certificado autofirmado debe considerarse de prueba")
+	}
+}
@@ -0,0 +1,238 @@
+package signature
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Namespaces UBL usados para ubicar la firma dentro del comprobante
+const (
+	namespaceExt = "urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2"
+	namespaceCac = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	namespaceCbc = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+)
+
+// Algoritmos XMLDSig que SUNAT acepta en la firma del comprobante
+var (
+	algoritmosCanonicalizacion = map[string]bool{
+		"http://www.w3.org/2001/10/xml-exc-c14n#":                      true,
+		"http://www.w3.org/2001/10/xml-exc-c14n#WithComments":          true,
+		"http://www.w3.org/TR/2001/REC-xml-c14n-20010315":              true,
+		"http://www.w3.org/TR/2001/REC-xml-c14n-20010315#WithComments": true,
+		"http://www.w3.org/2006/12/xml-c14n11":                         true,
+		"http://www.w3.org/2006/12/xml-c14n11#WithComments":            true,
+	}
+	algoritmosFirma = map[string]bool{
+		"http://www.w3.org/2000/09/xmldsig#rsa-sha1":        true,
+		"http://www.w3.org/2001/04/xmldsig-more#rsa-sha256": true,
+	}
+	algoritmosDigest = map[string]bool{
+		"http://www.w3.org/2000/09/xmldsig#sha1":  true,
+		"http://www.w3.org/2001/04/xmlenc#sha256": true,
+	}
+)
+
+// transformEnveloped transformación obligatoria de una firma enveloped
+const transformEnveloped = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+
+/*
+ValidarEstructuraFirma revisa la firma de un XML ya firmado contra el esquema XMLDSig
+y las restricciones adicionales de SUNAT, para detectar localmente problemas que SUNAT
+rechazaría con códigos de error de firma difíciles de diagnosticar.
+
+Verifica:
+- Una única <ds:Signature>, dentro de <ext:ExtensionContent>, con atributo Id
+- Que cac:Signature/.../cbc:URI del comprobante apunte a ese Id (#SignatureSP)
+- SignedInfo, SignatureValue y KeyInfo en el orden del esquema
+- Algoritmos de canonicalización, firma y digest permitidos
+- Una única Reference al documento completo (URI="") con la transformación enveloped
+- KeyInfo/X509Data/X509Certificate con un certificado X.509 válido
+
+No valida la firma criptográficamente. Retorna todos los problemas encontrados en un solo error.
+*/
+func ValidarEstructuraFirma(xmlData []byte) error {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(xmlData); err != nil {
+		return fmt.Errorf("error leyendo XML firmado: %v", err)
+	}
+	root := doc.Root()
+	if root == nil {
+		return fmt.Errorf("el XML firmado no tiene elemento raíz")
+	}
+
+	firmas := doc.FindElements(rutaFirma("//Signature"))
+	if len(firmas) == 0 {
+		return fmt.Errorf("estructura de firma inválida: no se encontró <Signature> de XMLDSig")
+	}
+	if len(firmas) > 1 {
+		return fmt.Errorf("estructura de firma inválida: el documento tiene %d firmas XMLDSig, se espera una", len(firmas))
+	}
+	firma := firmas[0]
+
+	var problemas []string
+	agregar := func(formato string, args ...interface{}) {
+		problemas = append(problemas, fmt.Sprintf(formato, args...))
+	}
+
+	// ==================== UBICACIÓN E ID ====================
+
+	if padre := firma.Parent(); padre == nil || padre.Tag != "ExtensionContent" || padre.NamespaceURI() != namespaceExt {
+		agregar("la firma debe estar dentro de <ext:ExtensionContent>")
+	}
+	id := firma.SelectAttrValue("Id", "")
+	if id == "" {
+		agregar("la firma no tiene atributo Id")
+	}
+	if uri := referenciaFirmaUBL(root); uri != "" && uri != "#"+id {
+		agregar("cac:Signature referencia %s pero el Id de la firma es '%s'", uri, id)
+	}
+
+	// ==================== ORDEN DE LOS HIJOS ====================
+
+	// Esquema XMLDSig: SignedInfo, SignatureValue, KeyInfo?, Object*
+	orden := []string{"SignedInfo", "SignatureValue", "KeyInfo"}
+	var hijos []string
+	for _, hijo := range firma.ChildElements() {
+		if hijo.NamespaceURI() == namespaceXMLDSig && hijo.Tag != "Object" {
+			hijos = append(hijos, hijo.Tag)
+		}
+	}
+	if strings.Join(hijos, ",") != strings.Join(orden, ",") {
+		agregar("la firma debe contener SignedInfo, SignatureValue y KeyInfo en ese orden (tiene: %s)", strings.Join(hijos, ", "))
+	}
+
+	// ==================== SIGNEDINFO ====================
+
+	if signedInfo := hijoFirma(firma, "SignedInfo"); signedInfo != nil {
+		validarAlgoritmo(hijoFirma(signedInfo, "CanonicalizationMethod"), "CanonicalizationMethod", algoritmosCanonicalizacion, agregar)
+		validarAlgoritmo(hijoFirma(signedInfo, "SignatureMethod"), "SignatureMethod", algoritmosFirma, agregar)
+
+		referencias := hijosFirma(signedInfo, "Reference")
+		if len(referencias) != 1 {
+			agregar("SignedInfo debe tener una única Reference (tiene %d)", len(referencias))
+		}
+		for _, ref := range referencias {
+			if uri := ref.SelectAttr("URI"); uri == nil || uri.Value != "" {
+				agregar("la Reference debe firmar el documento completo (URI=\"\")")
+			}
+			enveloped := false
+			if transforms := hijoFirma(ref, "Transforms"); transforms != nil {
+				for _, t := range hijosFirma(transforms, "Transform") {
+					if t.SelectAttrValue("Algorithm", "") == transformEnveloped {
+						enveloped = true
+					}
+				}
+			}
+			if !enveloped {
+				agregar("la Reference no incluye la transformación enveloped-signature")
+			}
+			validarAlgoritmo(hijoFirma(ref, "DigestMethod"), "DigestMethod", algoritmosDigest, agregar)
+			validarBase64(hijoFirma(ref, "DigestValue"), "DigestValue", agregar)
+		}
+	}
+
+	validarBase64(hijoFirma(firma, "SignatureValue"), "SignatureValue", agregar)
+
+	// ==================== KEYINFO ====================
+
+	if keyInfo := hijoFirma(firma, "KeyInfo"); keyInfo != nil {
+		var certificado *etree.Element
+		if x509Data := hijoFirma(keyInfo, "X509Data"); x509Data != nil {
+			certificado = hijoFirma(x509Data, "X509Certificate")
+		}
+		if certificado == nil {
+			agregar("KeyInfo no contiene X509Data/X509Certificate")
+		} else if der, ok := validarBase64(certificado, "X509Certificate", agregar); ok {
+			if _, err := x509.ParseCertificate(der); err != nil {
+				agregar("X509Certificate no es un certificado X.509 válido: %v", err)
+			}
+		}
+	}
+
+	if len(problemas) > 0 {
+		return fmt.Errorf("estructura de firma inválida: %s", strings.Join(problemas, "; "))
+	}
+	return nil
+}
+
+// referenciaFirmaUBL obtiene cac:Signature/cac:DigitalSignatureAttachment/cac:ExternalReference/cbc:URI
+// del comprobante, o "" si no existe
+func referenciaFirmaUBL(root *etree.Element) string {
+	for _, signature := range root.ChildElements() {
+		if signature.Tag != "Signature" || signature.NamespaceURI() != namespaceCac {
+			continue
+		}
+		adjunto := hijo(signature, "DigitalSignatureAttachment", namespaceCac)
+		if adjunto == nil {
+			continue
+		}
+		if ref := hijo(adjunto, "ExternalReference", namespaceCac); ref != nil {
+			if uri := hijo(ref, "URI", namespaceCbc); uri != nil {
+				return strings.TrimSpace(uri.Text())
+			}
+		}
+	}
+	return ""
+}
+
+// hijo retorna el primer hijo directo con el nombre local y namespace indicados
+func hijo(e *etree.Element, tag, namespace string) *etree.Element {
+	for _, c := range e.ChildElements() {
+		if c.Tag == tag && c.NamespaceURI() == namespace {
+			return c
+		}
+	}
+	return nil
+}
+
+// hijoFirma retorna el primer hijo directo XMLDSig con el nombre local indicado
+func hijoFirma(e *etree.Element, tag string) *etree.Element {
+	return hijo(e, tag, namespaceXMLDSig)
+}
+
+// hijosFirma retorna todos los hijos directos XMLDSig con el nombre local indicado
+func hijosFirma(e *etree.Element, tag string) []*etree.Element {
+	var elementos []*etree.Element
+	for _, c := range e.ChildElements() {
+		if c.Tag == tag && c.NamespaceURI() == namespaceXMLDSig {
+			elementos = append(elementos, c)
+		}
+	}
+	return elementos
+}
+
+// validarAlgoritmo comprueba que el elemento exista y declare un Algorithm permitido
+func validarAlgoritmo(e *etree.Element, nombre string, permitidos map[string]bool, agregar func(string, ...interface{})) {
+	if e == nil {
+		agregar("falta %s", nombre)
+		return
+	}
+	algoritmo := e.SelectAttrValue("Algorithm", "")
+	if !permitidos[algoritmo] {
+		agregar("%s con algoritmo no permitido por SUNAT: '%s'", nombre, algoritmo)
+	}
+}
+
+// validarBase64 comprueba que el elemento exista y contenga base64 no vacío; retorna el contenido decodificado
+func validarBase64(e *etree.Element, nombre string, agregar func(string, ...interface{})) ([]byte, bool) {
+	if e == nil {
+		agregar("falta %s", nombre)
+		return nil, false
+	}
+	// El base64 puede venir partido en líneas
+	texto := strings.Join(strings.Fields(e.Text()), "")
+	if texto == "" {
+		agregar("%s está vacío", nombre)
+		return nil, false
+	}
+	datos, err := base64.StdEncoding.DecodeString(texto)
+	if err != nil {
+		agregar("%s no es base64 válido", nombre)
+		return nil, false
+	}
+	return datos, true
+}
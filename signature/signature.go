@@ -6,7 +6,7 @@ Este paquete maneja la firma digital de documentos XML según los estándares XM
 y las especificaciones técnicas de SUNAT para facturación electrónica.
 
 Funcionalidades:
-1. Carga de certificados digitales PKCS#12 (.pfx)
+1. Carga de certificados digitales PKCS#12 (.pfx) o claves en HSM (PKCS#11), ver Signer
 2. Firma XMLDSig enveloped del documento XML completo
 3. Inserción de la firma en la extensión UBL correcta
 4. Generación de DigestValue (SHA1) y SignatureValue (RSA)
@@ -23,15 +23,18 @@ La firma se inserta en <ext:ExtensionContent> del documento UBL.
 package signature
 
 import (
+	"bytes"
 	"crypto/rsa"
 	"crypto/x509"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/beevik/etree"
 	dsig "github.com/russellhaering/goxmldsig"
-	"software.sslmate.com/src/go-pkcs12"
 )
 
 /*
@@ -53,14 +56,124 @@ func (ks *X509KeyStore) GetKeyPair() (*rsa.PrivateKey, []byte, error) {
 	return ks.PrivateKey, ks.Certificate.Raw, nil
 }
 
+// Algoritmos de canonicalización soportados para la firma XMLDSig
+const (
+	C14NExclusive             = "exc-c14n"          // C14N 1.0 Exclusive (default SUNAT)
+	C14NExclusiveWithComments = "exc-c14n-comments" // C14N 1.0 Exclusive con comentarios
+	C14N10                    = "c14n10"            // C14N 1.0 inclusivo
+	C14N10WithComments        = "c14n10-comments"   // C14N 1.0 inclusivo con comentarios
+	C14N11                    = "c14n11"            // C14N 1.1
+	C14N11WithComments        = "c14n11-comments"   // C14N 1.1 con comentarios
+)
+
 /*
-FirmaXML es la función principal que firma digitalmente un archivo XML.
+OpcionesFirma agrupa los parámetros configurables del proceso de firma.
+
+- Canonicalizacion: algoritmo de canonicalización (ver constantes C14N*)
+- PrefixList: prefijos de namespace inclusivos, solo aplica a C14N exclusivo
+
+- Prefijo: prefijo del namespace XMLDSig ("" = "ds", PrefijoNinguno = sin prefijo)
+
+El valor cero equivale a la configuración por defecto requerida por SUNAT.
+*/
+type OpcionesFirma struct {
+	Canonicalizacion string
+	PrefixList       string
+	Prefijo          string
+}
+
+// PrefijoNinguno genera la firma sin prefijo, declarando XMLDSig como namespace por defecto de <Signature>
+const PrefijoNinguno = "none"
+
+// namespaceXMLDSig namespace de la firma digital
+const namespaceXMLDSig = "http://www.w3.org/2000/09/xmldsig#"
+
+// resolverPrefijo valida el prefijo configurado y lo traduce al valor que usa goxmldsig.
+// El prefijo no puede estar declarado en el documento con un namespace distinto a XMLDSig.
+func resolverPrefijo(opciones OpcionesFirma, root *etree.Element) (string, error) {
+	prefijo := strings.TrimSpace(opciones.Prefijo)
+	switch prefijo {
+	case "":
+		return dsig.DefaultPrefix, nil
+	case PrefijoNinguno:
+		return "", nil
+	}
+
+	if !regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`).MatchString(prefijo) || strings.HasPrefix(strings.ToLower(prefijo), "xml") {
+		return "", fmt.Errorf("prefijo de namespace de firma inválido: %s", prefijo)
+	}
+	if attr := root.SelectAttr("xmlns:" + prefijo); attr != nil && attr.Value != namespaceXMLDSig {
+		return "", fmt.Errorf("el prefijo de firma '%s' ya está declarado en el documento para %s", prefijo, attr.Value)
+	}
+	return prefijo, nil
+}
+
+// rutaFirma construye la ruta etree de un elemento de la firma filtrando por el namespace
+// XMLDSig, para encontrarlo con cualquier prefijo (o sin él) sin confundirlo con cac:Signature
+func rutaFirma(ruta string) string {
+	return ruta + "[namespace-uri()='" + namespaceXMLDSig + "']"
+}
+
+// crearCanonicalizador construye el canonicalizador de goxmldsig según las opciones
+func crearCanonicalizador(opciones OpcionesFirma) (dsig.Canonicalizer, error) {
+	prefixList := strings.TrimSpace(opciones.PrefixList)
+
+	switch strings.ToLower(strings.TrimSpace(opciones.Canonicalizacion)) {
+	case "", C14NExclusive:
+		return dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(prefixList), nil
+	case C14NExclusiveWithComments:
+		return dsig.MakeC14N10ExclusiveWithCommentsCanonicalizerWithPrefixList(prefixList), nil
+	case C14N10:
+		return dsig.MakeC14N10RecCanonicalizer(), nil
+	case C14N10WithComments:
+		return dsig.MakeC14N10WithCommentsCanonicalizer(), nil
+	case C14N11:
+		return dsig.MakeC14N11Canonicalizer(), nil
+	case C14N11WithComments:
+		return dsig.MakeC14N11WithCommentsCanonicalizer(), nil
+	default:
+		return nil, fmt.Errorf("algoritmo de canonicalización no soportado: %s", opciones.Canonicalizacion)
+	}
+}
+
+// asegurarDeclaracionUTF8 deja como primer nodo la declaración exacta
+// <?xml version="1.0" encoding="UTF-8"?>, reemplazando la existente si difiere
+func asegurarDeclaracionUTF8(doc *etree.Document) {
+	var declaraciones []*etree.ProcInst
+	for _, token := range doc.Child {
+		if pi, ok := token.(*etree.ProcInst); ok && pi.Target == "xml" {
+			declaraciones = append(declaraciones, pi)
+		}
+	}
+	for _, pi := range declaraciones {
+		doc.RemoveChild(pi)
+	}
+	doc.InsertChildAt(0, etree.NewProcInst("xml", `version="1.0" encoding="UTF-8"`))
+}
+
+// FirmaXML firma el XML con la configuración de canonicalización por defecto
+func FirmaXML(xmlPath, pfxPath, pfxPassword string) (string, string, error) {
+	return FirmaXMLConOpciones(xmlPath, pfxPath, pfxPassword, OpcionesFirma{})
+}
+
+// FirmaXMLConOpciones lee el certificado PKCS#12 desde disco y firma el XML
+func FirmaXMLConOpciones(xmlPath, pfxPath, pfxPassword string, opciones OpcionesFirma) (string, string, error) {
+	pfxData, err := os.ReadFile(pfxPath)
+	if err != nil {
+		return "", "", fmt.Errorf("error leyendo PFX: %v", err)
+	}
+	return FirmarXMLConCertificado(xmlPath, pfxData, pfxPassword, opciones)
+}
+
+/*
+FirmarXMLConCertificado es la función principal que firma digitalmente un archivo XML.
 Implementa el proceso completo de firma XMLDSig según especificaciones SUNAT.
 
 Parámetros:
 - xmlPath: Ruta del archivo XML a firmar
-- pfxPath: Ruta del certificado PKCS#12 (.pfx)
+- pfxData: Contenido del certificado PKCS#12 (.pfx), leído de disco o de CERT_BASE64
 - pfxPassword: Contraseña del certificado
+- opciones: Canonicalización y prefix list a utilizar
 
 Retorna:
 - string: DigestValue (hash SHA1 del contenido firmado)
@@ -69,14 +182,26 @@ Retorna:
 
 Proceso:
 1. Cargar y parsear el XML
-2. Extraer certificado del archivo PKCS#12
+2. Extraer certificado del contenido PKCS#12
 3. Configurar contexto de firma XMLDSig
 4. Firmar el documento completo (enveloped signature)
 5. Insertar firma en <ext:ExtensionContent>
-6. Guardar XML firmado
+6. Validar la estructura de la firma (ValidarEstructuraFirma) y guardar el XML firmado
 7. Extraer valores de digest y signature
 */
-func FirmaXML(xmlPath, pfxPath, pfxPassword string) (string, string, error) {
+func FirmarXMLConCertificado(xmlPath string, pfxData []byte, pfxPassword string, opciones OpcionesFirma) (string, string, error) {
+	// Decodificar PKCS#12 para extraer clave privada y certificado
+	// PKCS#12 es el formato estándar para almacenar certificados digitales
+	signer, err := NuevoSignerPKCS12(pfxData, pfxPassword)
+	if err != nil {
+		return "", "", err
+	}
+	return FirmarXMLConSigner(xmlPath, signer, opciones)
+}
+
+// FirmarXMLConSigner firma el XML con la clave del Signer (archivo PKCS#12 o HSM).
+// Retorna DigestValue y SignatureValue igual que FirmarXMLConCertificado.
+func FirmarXMLConSigner(xmlPath string, signer Signer, opciones OpcionesFirma) (string, string, error) {
 	// ==================== CARGA Y PARSEO DEL XML ====================
 	
 	// Crear documento etree para manipulación XML
@@ -85,44 +210,49 @@ func FirmaXML(xmlPath, pfxPath, pfxPassword string) (string, string, error) {
 	doc.ReadSettings.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
 		return input, nil
 	}
-	// Cargar archivo XML desde disco
-	if err := doc.ReadFromFile(xmlPath); err != nil {
+	// Cargar archivo XML desde disco, descartando un posible BOM (SUNAT no lo acepta)
+	xmlData, err := os.ReadFile(xmlPath)
+	if err != nil {
+		return "", "", fmt.Errorf("error leyendo XML: %v", err)
+	}
+	if err := doc.ReadFromBytes(bytes.TrimPrefix(xmlData, []byte("\xef\xbb\xbf"))); err != nil {
 		return "", "", fmt.Errorf("error leyendo XML: %v", err)
 	}
 
 	// Obtener elemento raíz del documento para la firma
 	root := doc.Root()
+	if root == nil {
+		return "", "", fmt.Errorf("el XML no tiene elemento raíz")
+	}
+
+	// ==================== VIGENCIA DEL CERTIFICADO ====================
+
+	// Un certificado vencido (o aún no vigente) produce rechazos de SUNAT poco claros;
+	// se detiene la firma con el motivo explícito
+	if err := VerificarVigencia(signer.Certificado(), time.Now()); err != nil {
+		return "", "", err
+	}
 
-	// ==================== CARGA DEL CERTIFICADO DIGITAL ====================
+	// ==================== CONFIGURACIÓN DE FIRMA XMLDSIG ====================
 	
-	// Leer archivo PKCS#12 (.pfx) desde disco
-	pfxData, err := os.ReadFile(pfxPath)
+	// Crear contexto de firma con el firmante: la firma se calcula sobre el digest,
+	// por lo que la clave puede permanecer en el HSM
+	ctx, err := dsig.NewSigningContext(signer, [][]byte{signer.Certificado().Raw})
 	if err != nil {
-		return "", "", fmt.Errorf("error leyendo PFX: %v", err)
+		return "", "", fmt.Errorf("error configurando firma: %v", err)
 	}
-	
-	// Decodificar PKCS#12 para extraer clave privada y certificado
-	// PKCS#12 es el formato estándar para almacenar certificados digitales
-	privKeyIface, cert, err := pkcs12.Decode(pfxData, pfxPassword)
+	// Configurar canonicalización (por defecto C14N Exclusive, requerido por SUNAT)
+	canonicalizer, err := crearCanonicalizador(opciones)
 	if err != nil {
-		return "", "", fmt.Errorf("error decodificando PFX: %v", err)
+		return "", "", err
 	}
-	
-	// Verificar que la clave privada sea RSA (requerido por SUNAT)
-	privKey, ok := privKeyIface.(*rsa.PrivateKey)
-	if !ok {
-		return "", "", fmt.Errorf("la clave privada no es RSA")
+	ctx.Canonicalizer = canonicalizer
+	// Prefijo del namespace XMLDSig (por defecto ds:)
+	prefijo, err := resolverPrefijo(opciones, root)
+	if err != nil {
+		return "", "", err
 	}
-
-	// ==================== CONFIGURACIÓN DE FIRMA XMLDSIG ====================
-	
-	// Crear almacén de claves con el certificado cargado
-	keyStore := &X509KeyStore{PrivateKey: privKey, Certificate: cert}
-	
-	// Crear contexto de firma con configuraciones SUNAT
-	ctx := dsig.NewDefaultSigningContext(keyStore)
-	// Configurar canonicalización C14N Exclusive (requerido por SUNAT)
-	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	ctx.Prefix = prefijo
 
 	// ==================== LOCALIZACIÓN DEL PUNTO DE INSERCIÓN ====================
 	
@@ -139,26 +269,37 @@ func FirmaXML(xmlPath, pfxPath, pfxPassword string) (string, string, error) {
 		return "", "", fmt.Errorf("error firmando XML: %v", err)
 	}
 
-	signature := signedDoc.FindElement(".//ds:Signature")
+	signature := signedDoc.FindElement(rutaFirma(".//Signature"))
 	if signature == nil {
-		return "", "", fmt.Errorf("no se encontró <ds:Signature>")
+		return "", "", fmt.Errorf("no se encontró la firma XMLDSig en el documento firmado")
 	}
 	signature.CreateAttr("Id", "SignatureSP")
 
 	// Insertar la firma en el nodo <ext:ExtensionContent>
 	extNodes[0].AddChild(signature)
 
-	if err := doc.WriteToFile(xmlPath); err != nil {
+	asegurarDeclaracionUTF8(doc)
+	firmado, err := doc.WriteToBytes()
+	if err != nil {
+		return "", "", fmt.Errorf("error serializando XML firmado: %v", err)
+	}
+
+	// Validar la estructura de la firma antes de guardar: un problema detectado aquí
+	// evita un rechazo de SUNAT con un código de error de firma poco descriptivo
+	if err := ValidarEstructuraFirma(firmado); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(xmlPath, firmado, 0644); err != nil {
 		return "", "", fmt.Errorf("error guardando XML firmado: %v", err)
 	}
 
 	var digestValue, signatureValue string
-	if ref := signature.FindElement(".//ds:Reference"); ref != nil {
-		if dv := ref.FindElement("ds:DigestValue"); dv != nil {
+	if ref := signature.FindElement(rutaFirma(".//Reference")); ref != nil {
+		if dv := ref.FindElement(rutaFirma("DigestValue")); dv != nil {
 			digestValue = dv.Text()
 		}
 	}
-	if sv := signature.FindElement("ds:SignatureValue"); sv != nil {
+	if sv := signature.FindElement(rutaFirma("SignatureValue")); sv != nil {
 		signatureValue = sv.Text()
 	}
 
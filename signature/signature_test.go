@@ -0,0 +1,86 @@
+package signature
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// xmlPrueba es un documento UBL mínimo con el punto de inserción de la firma
+const xmlPrueba = `<?xml version="1.0" encoding="UTF-8"?>
+<Invoice xmlns="urn:oasis:names:specification:ubl:schema:xsd:Invoice-2" xmlns:ext="urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2" xmlns:cbc="urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"><ext:UBLExtensions><ext:UBLExtension><ext:ExtensionContent></ext:ExtensionContent></ext:UBLExtension></ext:UBLExtensions><cbc:UBLVersionID>2.1</cbc:UBLVersionID><cbc:ID>F001-1</cbc:ID></Invoice>`
+
+// signerPrueba crea un firmante con un certificado autofirmado vigente
+func signerPrueba(t *testing.T) *SignerPKCS12 {
+	t.Helper()
+	clave, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plantilla := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "CERTIFICADO DE PRUEBA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, plantilla, plantilla, &clave.PublicKey, clave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificado, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &SignerPKCS12{clave: clave, certificado: certificado}
+}
+
+// TestFirmarXMLPrefijo verifica el prefijo de los elementos de la firma: ds: por
+// defecto y el configurado en OpcionesFirma.Prefijo
+func TestFirmarXMLPrefijo(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		prefijo  string
+		esperado string
+	}{
+		{"por defecto", "", "ds"},
+		{"personalizado", "sig", "sig"},
+	}
+
+	signer := signerPrueba(t)
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			ruta := filepath.Join(t.TempDir(), "documento.xml")
+			if err := os.WriteFile(ruta, []byte(xmlPrueba), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := FirmarXMLConSigner(ruta, signer, OpcionesFirma{Prefijo: c.prefijo}); err != nil {
+				t.Fatalf("error firmando: %v", err)
+			}
+			firmado, err := os.ReadFile(ruta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			xml := string(firmado)
+
+			for _, elemento := range []string{"Signature", "SignedInfo", "SignatureValue", "DigestValue", "X509Certificate"} {
+				if !strings.Contains(xml, "<"+c.esperado+":"+elemento) {
+					t.Errorf("no se encontró <%s:%s> en el XML firmado", c.esperado, elemento)
+				}
+			}
+			declaracion := `xmlns:` + c.esperado + `="` + namespaceXMLDSig + `"`
+			if !strings.Contains(xml, declaracion) {
+				t.Errorf("no se encontró la declaración %s", declaracion)
+			}
+			if c.esperado != "ds" && strings.Contains(xml, "<ds:") {
+				t.Errorf("el XML firmado con prefijo %s contiene elementos ds:", c.esperado)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+/*
+Signer abstrae la fuente de la clave privada usada para la firma XMLDSig.
+
+La operación de firma recibe solo el digest (crypto.Signer), por lo que la clave
+puede residir en un archivo PKCS#12 o en un HSM sin salir nunca del dispositivo.
+
+Implementaciones:
+- SignerPKCS12: clave y certificado leídos de un archivo .pfx (CERT_PATH / CERT_BASE64)
+- NuevoSignerPKCS11: clave en un HSM vía PKCS#11 (requiere compilar con -tags pkcs11)
+*/
+type Signer interface {
+	crypto.Signer
+	Certificado() *x509.Certificate
+}
+
+// SignerPKCS12 firma con la clave RSA contenida en un certificado PKCS#12
+type SignerPKCS12 struct {
+	clave       *rsa.PrivateKey
+	certificado *x509.Certificate
+}
+
+// NuevoSignerPKCS12 decodifica el PKCS#12 y verifica que la clave sea RSA (requerido por SUNAT)
+func NuevoSignerPKCS12(pfxData []byte, pfxPassword string) (*SignerPKCS12, error) {
+	privKeyIface, cert, err := pkcs12.Decode(pfxData, pfxPassword)
+	if err != nil {
+		return nil, errorPFX(err)
+	}
+	privKey, ok := privKeyIface.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("la clave privada no es RSA")
+	}
+	return &SignerPKCS12{clave: privKey, certificado: cert}, nil
+}
+
+// Public retorna la clave pública del certificado
+func (s *SignerPKCS12) Public() crypto.PublicKey {
+	return s.clave.Public()
+}
+
+// Sign firma el digest con la clave privada del PKCS#12
+func (s *SignerPKCS12) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.clave.Sign(rand, digest, opts)
+}
+
+// Certificado retorna el certificado X.509 del firmante
+func (s *SignerPKCS12) Certificado() *x509.Certificate {
+	return s.certificado
+}
+
+/*
+ConfigPKCS11 agrupa los parámetros de acceso a la clave en un HSM.
+
+- Modulo: ruta de la librería PKCS#11 del fabricante (ej: /usr/lib/softhsm/libsofthsm2.so)
+- Token: etiqueta del token que contiene la clave
+- PIN: PIN de usuario del token
+- EtiquetaClave: etiqueta (CKA_LABEL) del par de claves y del certificado
+- Certificado: certificado X.509 (DER o PEM) si no está almacenado en el token
+*/
+type ConfigPKCS11 struct {
+	Modulo        string
+	Token         string
+	PIN           string
+	EtiquetaClave string
+	Certificado   []byte
+}
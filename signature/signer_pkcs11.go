@@ -0,0 +1,91 @@
+//go:build pkcs11
+
+package signature
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/ThalesGroup/crypto11"
+)
+
+// signerPKCS11 delega la firma al HSM: solo el digest viaja al dispositivo
+type signerPKCS11 struct {
+	crypto11.Signer
+	contexto    *crypto11.Context
+	certificado *x509.Certificate
+}
+
+// Certificado retorna el certificado X.509 asociado a la clave del HSM
+func (s *signerPKCS11) Certificado() *x509.Certificate {
+	return s.certificado
+}
+
+// Close cierra la sesión con el HSM
+func (s *signerPKCS11) Close() error {
+	return s.contexto.Close()
+}
+
+// NuevoSignerPKCS11 abre una sesión con el HSM y localiza el par de claves y su certificado.
+// La sesión debe mantenerse abierta mientras se firme (una por proceso).
+func NuevoSignerPKCS11(cfg ConfigPKCS11) (Signer, error) {
+	if cfg.Modulo == "" || cfg.Token == "" || cfg.EtiquetaClave == "" {
+		return nil, fmt.Errorf("configuración PKCS#11 incompleta: se requiere módulo, token y etiqueta de la clave")
+	}
+
+	contexto, err := crypto11.Configure(&crypto11.Config{
+		Path:       cfg.Modulo,
+		TokenLabel: cfg.Token,
+		Pin:        cfg.PIN,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo sesión PKCS#11: %v", err)
+	}
+
+	clave, err := contexto.FindKeyPair(nil, []byte(cfg.EtiquetaClave))
+	if err == nil && clave == nil {
+		err = fmt.Errorf("no existe un par de claves con etiqueta '%s'", cfg.EtiquetaClave)
+	}
+	if err != nil {
+		contexto.Close()
+		return nil, fmt.Errorf("error buscando clave en el HSM: %v", err)
+	}
+	if _, ok := clave.Public().(*rsa.PublicKey); !ok {
+		contexto.Close()
+		return nil, fmt.Errorf("la clave del HSM no es RSA")
+	}
+
+	cert, err := certificadoPKCS11(contexto, cfg)
+	if err != nil {
+		contexto.Close()
+		return nil, err
+	}
+
+	return &signerPKCS11{Signer: clave, contexto: contexto, certificado: cert}, nil
+}
+
+// certificadoPKCS11 usa el certificado configurado o, si no se indicó, el almacenado en el token
+func certificadoPKCS11(contexto *crypto11.Context, cfg ConfigPKCS11) (*x509.Certificate, error) {
+	if len(cfg.Certificado) > 0 {
+		der := cfg.Certificado
+		if bloque, _ := pem.Decode(der); bloque != nil {
+			der = bloque.Bytes
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo certificado del firmante: %v", err)
+		}
+		return cert, nil
+	}
+
+	cert, err := contexto.FindCertificate(nil, []byte(cfg.EtiquetaClave), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error buscando certificado en el HSM: %v", err)
+	}
+	if cert == nil {
+		return nil, fmt.Errorf("no existe un certificado con etiqueta '%s' en el token", cfg.EtiquetaClave)
+	}
+	return cert, nil
+}
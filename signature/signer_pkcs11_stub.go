@@ -0,0 +1,11 @@
+//go:build !pkcs11
+
+package signature
+
+import "fmt"
+
+// NuevoSignerPKCS11 no está disponible en binarios compilados sin el tag pkcs11
+// (la integración con el HSM requiere cgo y la librería del fabricante)
+func NuevoSignerPKCS11(cfg ConfigPKCS11) (Signer, error) {
+	return nil, fmt.Errorf("soporte PKCS#11 no incluido en este binario; compile con -tags pkcs11")
+}
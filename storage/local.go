@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Local guarda los archivos en el filesystem, bajo Dir. Con Dir vacío las rutas se usan
+// tal cual, es decir, los archivos quedan donde la API los genera (comportamiento original).
+type Local struct {
+	Dir string
+}
+
+// NewLocal crea un almacenamiento en el directorio indicado ("" = directorio de trabajo)
+func NewLocal(dir string) *Local {
+	return &Local{Dir: dir}
+}
+
+func (l *Local) ruta(path string) string {
+	if l.Dir == "" {
+		return path
+	}
+	return filepath.Join(l.Dir, path)
+}
+
+// EnDirectorioTrabajo indica que los archivos se guardan en el mismo lugar donde se
+// generan, por lo que no hace falta copiarlos
+func (l *Local) EnDirectorioTrabajo() bool {
+	return l.Dir == ""
+}
+
+func (l *Local) Save(path string, data []byte) error {
+	destino := l.ruta(path)
+	if err := os.MkdirAll(filepath.Dir(destino), 0755); err != nil {
+		return fmt.Errorf("error al crear directorio de %s: %v", destino, err)
+	}
+	return os.WriteFile(destino, data, 0644)
+}
+
+func (l *Local) Read(path string) ([]byte, error) {
+	data, err := os.ReadFile(l.ruta(path))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNoEncontrado, path)
+	}
+	return data, err
+}
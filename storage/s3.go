@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*
+S3 guarda los archivos en un bucket de un servicio compatible con S3 (AWS S3, MinIO,
+etc.). Usa direccionamiento por ruta ({endpoint}/{bucket}/{clave}), soportado por
+todos los proveedores compatibles, y firma las requests con AWS Signature V4.
+
+La clave de cada objeto es Prefix seguido de la ruta del archivo (ej: "cpe/out/F001-1.xml").
+*/
+type S3 struct {
+	Endpoint  string // URL del servicio, ej: https://s3.us-east-1.amazonaws.com o http://minio:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Prefix    string
+
+	client *http.Client
+}
+
+// NewS3 crea el cliente del almacenamiento S3
+func NewS3(endpoint, region, bucket, accessKey, secretKey, prefix string) *S3 {
+	return &S3{
+		Endpoint:  strings.TrimRight(endpoint, "/"),
+		Region:    region,
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Prefix:    prefix,
+		client:    &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (s *S3) Save(path string, data []byte) error {
+	resp, err := s.hacerRequest(http.MethodPut, path, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		cuerpo, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("S3 respondió %d al guardar %s: %s", resp.StatusCode, path, cuerpo)
+	}
+	return nil
+}
+
+func (s *S3) Read(path string) ([]byte, error) {
+	resp, err := s.hacerRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	cuerpo, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer %s desde S3: %v", path, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return cuerpo, nil
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrNoEncontrado, path)
+	}
+	return nil, fmt.Errorf("S3 respondió %d al leer %s: %s", resp.StatusCode, path, cuerpo)
+}
+
+// clave convierte la ruta local del archivo en la clave del objeto
+func (s *S3) clave(path string) string {
+	return s.Prefix + strings.TrimLeft(filepath.ToSlash(filepath.Clean(path)), "./")
+}
+
+// hacerRequest envía la request firmada sobre el objeto de la ruta indicada
+func (s *S3) hacerRequest(metodo, path string, cuerpo []byte) (*http.Response, error) {
+	uri := "/" + codificarURI(s.Bucket) + "/" + codificarURI(s.clave(path))
+	req, err := http.NewRequest(metodo, s.Endpoint+uri, bytes.NewReader(cuerpo))
+	if err != nil {
+		return nil, fmt.Errorf("error al crear request S3: %v", err)
+	}
+	s.firmar(req, uri, cuerpo, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error de conexión con S3: %v", err)
+	}
+	return resp, nil
+}
+
+// firmar agrega los headers de AWS Signature V4 (servicio "s3", sin query string)
+func (s *S3) firmar(req *http.Request, uri string, cuerpo []byte, ahora time.Time) {
+	fechaHora := ahora.Format("20060102T150405Z")
+	fecha := ahora.Format("20060102")
+	hashCuerpo := hashHex(cuerpo)
+
+	req.Header.Set("x-amz-date", fechaHora)
+	req.Header.Set("x-amz-content-sha256", hashCuerpo)
+
+	headersFirmados := "host;x-amz-content-sha256;x-amz-date"
+	requestCanonico := strings.Join([]string{
+		req.Method,
+		uri,
+		"",
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + hashCuerpo,
+		"x-amz-date:" + fechaHora,
+		"",
+		headersFirmados,
+		hashCuerpo,
+	}, "\n")
+
+	alcance := fecha + "/" + s.Region + "/s3/aws4_request"
+	textoAFirmar := "AWS4-HMAC-SHA256\n" + fechaHora + "\n" + alcance + "\n" + hashHex([]byte(requestCanonico))
+
+	clave := hmacSHA256([]byte("AWS4"+s.SecretKey), fecha)
+	clave = hmacSHA256(clave, s.Region)
+	clave = hmacSHA256(clave, "s3")
+	clave = hmacSHA256(clave, "aws4_request")
+	firma := hex.EncodeToString(hmacSHA256(clave, textoAFirmar))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, alcance, headersFirmados, firma))
+}
+
+func hashHex(data []byte) string {
+	suma := sha256.Sum256(data)
+	return hex.EncodeToString(suma[:])
+}
+
+func hmacSHA256(clave []byte, texto string) []byte {
+	mac := hmac.New(sha256.New, clave)
+	mac.Write([]byte(texto))
+	return mac.Sum(nil)
+}
+
+// codificarURI codifica la ruta como exige Signature V4: todo excepto los caracteres
+// no reservados (A-Z a-z 0-9 - _ . ~) y el separador "/"
+func codificarURI(ruta string) string {
+	var b strings.Builder
+	for _, c := range []byte(ruta) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,15 @@
+// Package storage abstrae el lugar donde se guardan los archivos generados por la API
+// (XML firmados, ZIP enviados, PDF y CDR): el filesystem local o un almacenamiento de
+// objetos compatible con S3 (AWS, MinIO, etc.).
+package storage
+
+import "errors"
+
+// ErrNoEncontrado indica que el archivo solicitado no existe en el almacenamiento
+var ErrNoEncontrado = errors.New("archivo no encontrado en el almacenamiento")
+
+// Storage guarda y lee archivos identificados por su ruta relativa (ej: "out/F001-1.xml")
+type Storage interface {
+	Save(path string, data []byte) error
+	Read(path string) ([]byte, error)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"ubl-go-conversor/models"
+	"ubl-go-conversor/repository"
+)
+
+// etapasPorAccion asocia las acciones de auditoría que marcan un hito del ciclo de vida
+// con la etapa en la que queda el documento. Las transiciones explícitas (status_changed)
+// traen su estado; las demás acciones permiten reconstruir la línea de tiempo de los
+// documentos emitidos antes de que se registraran las transiciones.
+var etapasPorAccion = map[string]string{
+	repository.ActionCreated:       models.StatusProcessing,
+	repository.ActionDraftCreated:  models.StatusDraft,
+	repository.ActionSigned:        "signed",
+	repository.ActionSent:          "sent",
+	repository.ActionSummarySent:   "sent",
+	repository.ActionApproved:      models.StatusApproved,
+	repository.ActionRejected:      models.StatusRejected,
+	repository.ActionError:         models.StatusError,
+	repository.ActionPendingSend:   models.StatusPendingSend,
+	repository.ActionScheduled:     models.StatusScheduled,
+	repository.ActionTicketPending: models.StatusTicketPending,
+}
+
+// TransicionTimeline es un paso del documento de una etapa a otra
+type TransicionTimeline struct {
+	Fecha  time.Time `json:"fecha"`
+	Desde  string    `json:"desde,omitempty"`
+	Hacia  string    `json:"hacia"`
+	Accion string    `json:"accion"`
+	// Tiempo que el documento permaneció en la etapa "desde"
+	DuracionSegundos float64 `json:"duracion_segundos"`
+}
+
+// construirTimeline reduce los logs (en orden cronológico) a las transiciones entre
+// etapas, descartando las acciones que no cambian la etapa del documento
+func construirTimeline(logs []models.AuditLog) []TransicionTimeline {
+	timeline := []TransicionTimeline{}
+	etapa := ""
+	var desde time.Time
+	for _, entrada := range logs {
+		hacia := etapasPorAccion[entrada.Action]
+		if entrada.Action == repository.ActionStatusChanged {
+			hacia = entrada.EstadoNuevo
+		}
+		if hacia == "" || hacia == etapa {
+			continue
+		}
+		transicion := TransicionTimeline{
+			Fecha:  entrada.CreatedAt,
+			Desde:  etapa,
+			Hacia:  hacia,
+			Accion: entrada.Action,
+		}
+		if etapa != "" {
+			transicion.DuracionSegundos = entrada.CreatedAt.Sub(desde).Seconds()
+		}
+		timeline = append(timeline, transicion)
+		etapa = hacia
+		desde = entrada.CreatedAt
+	}
+	return timeline
+}
+
+// consultarTimeline retorna la línea de tiempo de estados del documento, con el tiempo
+// que pasó en cada etapa, para diagnosticar demoras
+// GET /api/v1/documents/{id}/timeline
+func consultarTimeline(w http.ResponseWriter, r *http.Request, documentID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	doc, err := docRepo.GetByID(documentID)
+	if err != nil {
+		http.Error(w, "Documento no encontrado", http.StatusNotFound)
+		return
+	}
+
+	logs, err := auditRepo.GetTimeline(documentID)
+	if err != nil {
+		http.Error(w, "Error al consultar la auditoría: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	timeline := construirTimeline(logs)
+
+	// Tiempo total desde la primera etapa hasta la última transición registrada
+	var total float64
+	if len(timeline) > 0 {
+		total = timeline[len(timeline)-1].Fecha.Sub(timeline[0].Fecha).Seconds()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"document_id":             doc.ID,
+		"estado_actual":           doc.Estado,
+		"timeline":                timeline,
+		"duracion_total_segundos": total,
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"ubl-go-conversor/models"
+)
+
+/*
+manejarUso responde GET /api/v1/usage?api_key=X&periodo=YYYYMM con la cantidad de
+documentos que emitió el cliente en el mes, por estado. Sirve para facturar el
+servicio según el consumo. api_key es el identificador del cliente en API_KEYS
+(nunca la clave secreta); requiere una API key administrativa.
+*/
+func manejarUso(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cliente := r.URL.Query().Get("api_key")
+	if cliente == "" {
+		http.Error(w, "El parámetro api_key es obligatorio", http.StatusBadRequest)
+		return
+	}
+	periodo := r.URL.Query().Get("periodo")
+	desde, err := time.ParseInLocation("200601", periodo, time.Local)
+	if err != nil {
+		http.Error(w, "El parámetro periodo debe tener formato YYYYMM (ej: 202401)", http.StatusBadRequest)
+		return
+	}
+
+	porEstado, err := docRepo.GetUsoPorAPIKey(cliente, desde, desde.AddDate(0, 1, 0))
+	if err != nil {
+		http.Error(w, "Error al obtener el uso: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := models.UsoAPIKeyResponse{APIKey: cliente, Periodo: periodo, PorEstado: porEstado}
+	for _, cantidad := range porEstado {
+		response.Total += cantidad
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+    "archive/zip"
+    "bytes"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "ubl-go-conversor/models"
+)
+
+/*
+ParseCDR interpreta el XML de un CDR (ApplicationResponse) de SUNAT.
+
+Determina el estado según el código de respuesta:
+- "0": Aceptado (aprobada), u observada si trae notas
+- "4000"-"4999": Aceptado con observaciones (observada)
+- Otros códigos: Rechazado (rechazada)
+*/
+func ParseCDR(content []byte) (*models.CDRDetalle, error) {
+    // El CDR contiene ResponseCode y Description en DocumentResponse
+    var cdr struct {
+        ID           string   `xml:"ID"`
+        IssueDate    string   `xml:"IssueDate"`
+        IssueTime    string   `xml:"IssueTime"`
+        ResponseDate string   `xml:"ResponseDate"`
+        ResponseTime string   `xml:"ResponseTime"`
+        Notes        []string `xml:"Note"`                                   // Observaciones (una por cbc:Note)
+        ResponseCode string   `xml:"DocumentResponse>Response>ResponseCode"` // Código de respuesta SUNAT
+        Description  string   `xml:"DocumentResponse>Response>Description"`  // Descripción del resultado
+        DocumentoID  string   `xml:"DocumentResponse>DocumentReference>ID"`  // Comprobante referido
+    }
+    if err := xml.Unmarshal(content, &cdr); err != nil {
+        return nil, fmt.Errorf("el XML del CDR no es válido: %v", err)
+    }
+    if strings.TrimSpace(cdr.ResponseCode) == "" {
+        return nil, fmt.Errorf("el XML del CDR no contiene ResponseCode")
+    }
+
+    var observaciones []string
+    for _, nota := range cdr.Notes {
+        if nota = strings.TrimSpace(nota); nota != "" {
+            observaciones = append(observaciones, nota)
+        }
+    }
+
+    estado := "rechazada"
+    if cdr.ResponseCode == "0" {
+        estado = "aprobada"
+        if len(observaciones) > 0 {
+            estado = "observada"
+        }
+    } else if cdr.ResponseCode >= "4000" && cdr.ResponseCode < "5000" {
+        estado = "observada"
+    }
+
+    return &models.CDRDetalle{
+        ID:             cdr.ID,
+        FechaEmision:   cdr.IssueDate,
+        HoraEmision:    cdr.IssueTime,
+        FechaRecepcion: cdr.ResponseDate,
+        HoraRecepcion:  cdr.ResponseTime,
+        DocumentoID:    cdr.DocumentoID,
+        ResponseCode:   cdr.ResponseCode,
+        Description:    cdr.Description,
+        Estado:         estado,
+        Observaciones:  observaciones,
+    }, nil
+}
+
+// LeerCDR abre un CDR ZIP guardado en disco y parsea su XML de respuesta
+func LeerCDR(cdrZipPath string) (*models.CDRDetalle, error) {
+    contenido, err := os.ReadFile(cdrZipPath)
+    if err != nil {
+        return nil, fmt.Errorf("error al leer el CDR %s: %v", cdrZipPath, err)
+    }
+    return LeerCDRContenido(cdrZipPath, contenido)
+}
+
+// LeerCDRContenido interpreta un CDR ya leído (ej: desde el almacenamiento). La ruta se
+// usa para identificar el XML de respuesta dentro del ZIP y en los mensajes de error.
+func LeerCDRContenido(cdrZipPath string, contenido []byte) (*models.CDRDetalle, error) {
+    reader, err := zip.NewReader(bytes.NewReader(contenido), int64(len(contenido)))
+    if err != nil {
+        return nil, fmt.Errorf("el CDR %s no es un ZIP válido: %v", cdrZipPath, err)
+    }
+
+    file := seleccionarXMLCDR(reader.File, strings.TrimPrefix(removeExtension(filepath.Base(cdrZipPath)), "CDR-"))
+    if file == nil {
+        return nil, fmt.Errorf("no se encontró XML dentro del CDR %s", cdrZipPath)
+    }
+
+    rc, err := file.Open()
+    if err != nil {
+        return nil, fmt.Errorf("error al abrir %s del CDR: %v", file.Name, err)
+    }
+    defer rc.Close()
+
+    content, err := io.ReadAll(rc)
+    if err != nil {
+        return nil, fmt.Errorf("error al leer %s del CDR: %v", file.Name, err)
+    }
+    return ParseCDR(content)
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+    "encoding/base64"
+    "encoding/xml"
+    "fmt"
+    "regexp"
+    "strings"
+    "sync"
+
+    "ubl-go-conversor/models"
+)
+
+/*
+Consulta de CDR en SUNAT (servicio billConsultService)
+=====================================================
+
+Permite recuperar el CDR de un comprobante ya enviado usando el método
+getStatusCdr, por ejemplo cuando un reenvío tras timeout es rechazado
+porque SUNAT ya había registrado el primer envío.
+*/
+
+// codigosDocumentoYaRegistrado son los códigos de error SUNAT que indican
+// que el comprobante ya fue recibido en un envío anterior
+var codigosDocumentoYaRegistrado = map[string]bool{
+    "1033": true, // El comprobante fue registrado previamente con otros datos
+}
+
+// directorioCDR es el directorio donde el API guarda los CDR recibidos de SUNAT
+const directorioCDR = "cdr"
+
+var (
+    configConsulta  sync.RWMutex
+    consultaURL     string
+    consultaUsuario string
+    consultaClave   string
+)
+
+// ConfigurarConsultaCDR establece el endpoint y credenciales del servicio de consulta de CDR
+func ConfigurarConsultaCDR(endpoint, usuario, clave string) {
+    configConsulta.Lock()
+    defer configConsulta.Unlock()
+
+    consultaURL = endpoint
+    consultaUsuario = usuario
+    consultaClave = clave
+}
+
+// esDocumentoYaRegistrado indica si el faultcode (ej: "soap-env:Client.1033") es de documento duplicado
+func esDocumentoYaRegistrado(faultCode string) bool {
+    codigo := regexp.MustCompile(`([0-9]+)$`).FindString(faultCode)
+    return codigosDocumentoYaRegistrado[codigo]
+}
+
+// recuperarCDRRegistrado obtiene el CDR original a partir del nombre con el que se
+// envió el ZIP (formato RUC-TIPO-SERIE-NUMERO.ZIP)
+func recuperarCDRRegistrado(xmlZipName, baseCDRDir string) (*models.CDRInfo, error) {
+    partes := strings.Split(removeExtension(nombreEnvioZIP(xmlZipName)), "-")
+    if len(partes) != 4 {
+        return nil, fmt.Errorf("nombre de ZIP inválido para consultar CDR: %s", xmlZipName)
+    }
+
+    fmt.Printf("Documento ya registrado en SUNAT, recuperando CDR original de %s\n", xmlZipName)
+    return ConsultarCDR(partes[0], partes[1], partes[2], partes[3], baseCDRDir)
+}
+
+/*
+ObtenerCDRDesdeServicio recupera de SUNAT el CDR de un comprobante individual ya
+procesado (getStatusCdr), sin necesidad de ticket. Es la vía para reconstruir el CDR
+de un documento aceptado cuyo CDR se perdió. El ZIP se guarda en el directorio de CDR
+del API, igual que los CDR recibidos en el envío.
+*/
+func ObtenerCDRDesdeServicio(ruc, tipoDoc, serie, numero string) (*models.CDRInfo, error) {
+    return ConsultarCDR(ruc, tipoDoc, serie, numero, directorioCDR)
+}
+
+/*
+ConsultarCDR consulta el CDR de un comprobante con getStatusCdr y lo procesa
+igual que la respuesta de sendBill (guarda el ZIP y extrae el resultado).
+
+Parámetros:
+- ruc, tipoDoc, serie, numero: Identificación del comprobante
+- baseCDRDir: Directorio base para guardar CDR
+
+Retorna:
+- *models.CDRInfo: Información del CDR recuperado
+- error: Error de comunicación o si SUNAT no tiene CDR para el comprobante
+*/
+func ConsultarCDR(ruc, tipoDoc, serie, numero, baseCDRDir string) (*models.CDRInfo, error) {
+    configConsulta.RLock()
+    endpoint, usuario, clave := consultaURL, consultaUsuario, consultaClave
+    configConsulta.RUnlock()
+
+    if endpoint == "" {
+        return nil, fmt.Errorf("servicio de consulta de CDR no configurado")
+    }
+
+    soap := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"
+    xmlns:ser="http://service.sunat.gob.pe"
+    xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">
+  <soapenv:Header>
+    <wsse:Security>
+      <wsse:UsernameToken>
+        <wsse:Username>%s%s</wsse:Username>
+        <wsse:Password>%s</wsse:Password>
+      </wsse:UsernameToken>
+    </wsse:Security>
+  </soapenv:Header>
+  <soapenv:Body>
+    <ser:getStatusCdr>
+      <rucComprobante>%s</rucComprobante>
+      <tipoComprobante>%s</tipoComprobante>
+      <serieComprobante>%s</serieComprobante>
+      <numeroComprobante>%s</numeroComprobante>
+    </ser:getStatusCdr>
+  </soapenv:Body>
+</soapenv:Envelope>`, ruc, usuario, clave, ruc, tipoDoc, serie, numero)
+
+    bodyBytes, err := enviarSOAP(endpoint, soap, OperacionGetStatus)
+    if err != nil {
+        return nil, err
+    }
+
+    // Estructura para parsear la respuesta de getStatusCdr
+    type Envelope struct {
+        XMLName       xml.Name `xml:"Envelope"`
+        Content       string   `xml:"Body>getStatusCdrResponse>statusCdr>content"`       // CDR en Base64
+        StatusCode    string   `xml:"Body>getStatusCdrResponse>statusCdr>statusCode"`    // Código de la consulta
+        StatusMessage string   `xml:"Body>getStatusCdrResponse>statusCdr>statusMessage"` // Mensaje de la consulta
+        FaultCode     string   `xml:"Body>Fault>faultcode"`
+        FaultString   string   `xml:"Body>Fault>faultstring"`
+    }
+
+    var envelope Envelope
+    if err := xml.Unmarshal(bodyBytes, &envelope); err != nil {
+        return nil, fmt.Errorf("error al parsear respuesta de getStatusCdr: %v", err)
+    }
+    if envelope.FaultCode != "" {
+        return nil, fmt.Errorf("getStatusCdr: %s - %s", envelope.FaultCode, envelope.FaultString)
+    }
+    if envelope.Content == "" {
+        return nil, fmt.Errorf("SUNAT no retornó CDR (%s: %s)", envelope.StatusCode, envelope.StatusMessage)
+    }
+
+    decodedZip, err := base64.StdEncoding.DecodeString(envelope.Content)
+    if err != nil {
+        return nil, fmt.Errorf("error al decodificar CDR en base64: %v", err)
+    }
+
+    zipName := fmt.Sprintf("%s-%s-%s-%s.ZIP", ruc, tipoDoc, serie, numero)
+    return procesarCDR(decodedZip, zipName, baseCDRDir)
+}
@@ -0,0 +1,199 @@
+package utils
+
+import (
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+
+    "ubl-go-conversor/models"
+)
+
+/*
+Destinos de envío SUNAT
+=======================
+
+Un comprobante puede enviarse por distintos webservices, cada uno con su URL y
+autenticación:
+- SOL: webservice SOAP de SUNAT (WS-Security con usuario SOL)
+- OSE: Operador de Servicios Electrónicos, mismo contrato SOAP que SOL
+- GRE: API REST de SUNAT (guías de remisión), autenticada con token Bearer;
+  responde con un ticket que se consulta después
+*/
+
+// Tipos de destino soportados
+const (
+    DestinoSOL = "sol"
+    DestinoOSE = "ose"
+    DestinoGRE = "gre"
+)
+
+// Destino describe un webservice SUNAT/OSE con sus credenciales
+type Destino struct {
+    Nombre  string // Identificador configurado (ej: "sol", "nubefact")
+    Tipo    string // DestinoSOL, DestinoOSE o DestinoGRE
+    URL     string // billService (SOL/OSE) o base de la API REST (GRE)
+    Usuario string // Usuario secundario SOL/OSE
+    Clave   string // Clave del usuario SOL/OSE
+    Token   string // Token Bearer (GRE)
+}
+
+// ResultadoEnvio resultado de un envío: CDR inmediato (sendBill) o ticket (sendSummary, GRE)
+type ResultadoEnvio struct {
+    CDR    *models.CDRInfo
+    Ticket string
+}
+
+/*
+EnviarComprobante envía el ZIP firmado al destino indicado, adaptando el protocolo:
+SOAP con WS-Security para SOL/OSE (sendBill, o sendSummary para resúmenes y bajas)
+y REST con token Bearer para GRE.
+
+Parámetros:
+- destino: Webservice y credenciales a usar
+- ruc: RUC del emisor (forma parte del usuario WS-Security)
+- zipPath: Ruta del ZIP a enviar
+- baseCDRDir: Directorio base para guardar CDR
+*/
+func EnviarComprobante(destino Destino, ruc, zipPath, baseCDRDir string) (*ResultadoEnvio, error) {
+    switch destino.Tipo {
+    case DestinoSOL, DestinoOSE:
+        // Resúmenes y bajas van por sendSummary y se responden con ticket
+        if EsResumen(zipPath) {
+            soap, err := BuildSOAPSummary(ruc, destino.Usuario, destino.Clave, zipPath)
+            if err != nil {
+                return nil, fmt.Errorf("error al construir SOAP: %v", err)
+            }
+            ticket, err := SendSummaryStructured(destino.URL, soap)
+            if err != nil {
+                return nil, err
+            }
+            return &ResultadoEnvio{Ticket: ticket}, nil
+        }
+        soap, err := BuildSOAP(ruc, destino.Usuario, destino.Clave, zipPath)
+        if err != nil {
+            return nil, fmt.Errorf("error al construir SOAP: %v", err)
+        }
+        cdrInfo, err := SendToSunatStructured(destino.URL, soap, zipPath, baseCDRDir)
+        if err != nil {
+            return nil, err
+        }
+        return &ResultadoEnvio{CDR: cdrInfo}, nil
+    case DestinoGRE:
+        ticket, err := enviarGRE(destino, zipPath)
+        if err != nil {
+            return nil, err
+        }
+        return &ResultadoEnvio{Ticket: ticket}, nil
+    default:
+        return nil, fmt.Errorf("tipo de destino '%s' no soportado (sol, ose, gre)", destino.Tipo)
+    }
+}
+
+/*
+ConsultarTicketDestino consulta un ticket con el protocolo del destino:
+getStatus SOAP para SOL/OSE, endpoint REST de envíos para GRE.
+*/
+func ConsultarTicketDestino(destino Destino, ruc, ticket, xmlZipName, baseCDRDir string) (*EstadoTicket, error) {
+    if destino.Tipo == DestinoGRE {
+        return consultarTicketGRE(destino, ticket, xmlZipName, baseCDRDir)
+    }
+    return ConsultarTicket(destino.URL, ruc, destino.Usuario, destino.Clave, ticket, xmlZipName, baseCDRDir)
+}
+
+// enviarGRE envía el ZIP a la API REST de SUNAT y retorna el ticket de recepción
+func enviarGRE(destino Destino, zipPath string) (string, error) {
+    content, err := os.ReadFile(zipPath)
+    if err != nil {
+        return "", err
+    }
+
+    hash := sha256.Sum256(content)
+    payload := map[string]interface{}{
+        "archivo": map[string]string{
+            "nomArchivo": nombreEnvioZIP(zipPath),
+            "arcGreZip":  base64.StdEncoding.EncodeToString(content),
+            "hashZip":    hex.EncodeToString(hash[:]),
+        },
+    }
+    body, err := json.Marshal(payload)
+    if err != nil {
+        return "", err
+    }
+
+    endpoint := destino.URL + "/" + removeExtension(nombreEnvioZIP(zipPath))
+    bodyBytes, status, err := enviarHTTP("POST", endpoint, body, cabecerasGRE(destino), OperacionSendBill)
+    if err != nil {
+        return "", err
+    }
+
+    var respuesta struct {
+        NumTicket string `json:"numTicket"`
+        Cod       string `json:"cod"`
+        Msg       string `json:"msg"`
+    }
+    if err := json.Unmarshal(bodyBytes, &respuesta); err != nil {
+        return "", fmt.Errorf("error al parsear respuesta GRE (HTTP %d): %v", status, err)
+    }
+    if status != http.StatusOK || respuesta.NumTicket == "" {
+        return "", fmt.Errorf("GRE rechazó el envío (HTTP %d): %s %s", status, respuesta.Cod, respuesta.Msg)
+    }
+    return respuesta.NumTicket, nil
+}
+
+// consultarTicketGRE consulta el estado de un ticket en la API REST de SUNAT
+func consultarTicketGRE(destino Destino, ticket, xmlZipName, baseCDRDir string) (*EstadoTicket, error) {
+    bodyBytes, status, err := enviarHTTP("GET", destino.URL+"/envios/"+ticket, nil, cabecerasGRE(destino), OperacionGetStatus)
+    if err != nil {
+        return nil, err
+    }
+
+    var respuesta struct {
+        CodRespuesta string `json:"codRespuesta"` // 0, 98 o 99
+        ArcCdr       string `json:"arcCdr"`       // CDR en Base64
+        Error        struct {
+            NumError string `json:"numError"`
+            DesError string `json:"desError"`
+        } `json:"error"`
+    }
+    if err := json.Unmarshal(bodyBytes, &respuesta); err != nil {
+        return nil, fmt.Errorf("error al parsear respuesta de ticket GRE (HTTP %d): %v", status, err)
+    }
+
+    estado := &EstadoTicket{StatusCode: respuesta.CodRespuesta}
+    switch {
+    case respuesta.CodRespuesta == CodigoTicketEnProceso:
+        estado.EnProceso = true
+        return estado, nil
+    case respuesta.ArcCdr != "":
+        decodedZip, err := base64.StdEncoding.DecodeString(respuesta.ArcCdr)
+        if err != nil {
+            return nil, fmt.Errorf("error al decodificar CDR en base64: %v", err)
+        }
+        estado.CDR, err = procesarCDR(decodedZip, xmlZipName, baseCDRDir)
+        if err != nil {
+            return nil, err
+        }
+        return estado, nil
+    case respuesta.CodRespuesta == CodigoTicketConErrores:
+        // Rechazo sin CDR generado: se informa el error devuelto por SUNAT
+        estado.CDR = &models.CDRInfo{
+            ResponseCode: respuesta.Error.NumError,
+            Description:  respuesta.Error.DesError,
+            Estado:       "rechazada",
+        }
+        return estado, nil
+    default:
+        return nil, fmt.Errorf("SUNAT no retornó CDR para el ticket %s (código %s)", ticket, respuesta.CodRespuesta)
+    }
+}
+
+func cabecerasGRE(destino Destino) map[string]string {
+    return map[string]string{
+        "Content-Type":  "application/json",
+        "Authorization": "Bearer " + destino.Token,
+    }
+}
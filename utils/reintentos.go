@@ -0,0 +1,189 @@
+package utils
+
+import (
+    "bytes"
+    "compress/gzip"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Tipos de operación SUNAT con política de reintentos propia
+const (
+    OperacionSendBill    = "sendBill"    // Envío individual de comprobantes
+    OperacionSendSummary = "sendSummary" // Envío de resúmenes diarios y bajas
+    OperacionGetStatus   = "getStatus"   // Consulta de tickets y CDR
+)
+
+/*
+PoliticaReintento define cuántas veces se reintenta una operación y cuánto se espera.
+
+- MaxIntentos: número total de intentos (1 = sin reintentos)
+- Espera: espera antes del segundo intento, se duplica en cada reintento
+
+Solo se reintentan fallas de red y respuestas HTTP 502/503/504. Los SOAP Fault
+de SUNAT (HTTP 500) no se reintentan porque son respuestas válidas del servicio.
+*/
+type PoliticaReintento struct {
+    MaxIntentos int
+    Espera      time.Duration
+}
+
+var (
+    configRed   sync.RWMutex
+    timeoutHTTP = 60 * time.Second
+    politicas   = map[string]PoliticaReintento{
+        OperacionSendBill:    {MaxIntentos: 1, Espera: 2 * time.Second},
+        OperacionSendSummary: {MaxIntentos: 2, Espera: 2 * time.Second},
+        OperacionGetStatus:   {MaxIntentos: 5, Espera: time.Second},
+    }
+)
+
+// ConfigurarRed establece el timeout HTTP y la política de reintentos de cada operación
+func ConfigurarRed(timeout time.Duration, porOperacion map[string]PoliticaReintento) {
+    configRed.Lock()
+    defer configRed.Unlock()
+
+    if timeout > 0 {
+        timeoutHTTP = timeout
+    }
+    for operacion, politica := range porOperacion {
+        if politica.MaxIntentos < 1 {
+            politica.MaxIntentos = 1
+        }
+        politicas[operacion] = politica
+    }
+}
+
+// Límite de concurrencia y ritmo de requests hacia SUNAT (compartido por todos los envíos)
+var (
+    limiteSUNAT    = make(chan struct{}, 4)
+    ritmoSUNAT     sync.Mutex
+    intervaloSUNAT time.Duration
+    ultimoEnvio    time.Time
+)
+
+// ConfigurarLimiteSUNAT establece cuántos requests simultáneos se permiten hacia SUNAT
+// y el intervalo mínimo entre requests consecutivos (0 = sin límite de ritmo)
+func ConfigurarLimiteSUNAT(maxConcurrentes int, intervaloMinimo time.Duration) {
+    if maxConcurrentes < 1 {
+        maxConcurrentes = 1
+    }
+    limiteSUNAT = make(chan struct{}, maxConcurrentes)
+    intervaloSUNAT = intervaloMinimo
+}
+
+// adquirirTurnoSUNAT espera un cupo de concurrencia y respeta el intervalo mínimo entre requests.
+// Retorna la función que libera el cupo.
+func adquirirTurnoSUNAT() func() {
+    limite := limiteSUNAT
+    limite <- struct{}{}
+
+    ritmoSUNAT.Lock()
+    if espera := intervaloSUNAT - time.Since(ultimoEnvio); espera > 0 {
+        time.Sleep(espera)
+    }
+    ultimoEnvio = time.Now()
+    ritmoSUNAT.Unlock()
+
+    return func() { <-limite }
+}
+
+// obtenerConfigRed retorna el timeout y la política vigentes para una operación
+func obtenerConfigRed(operacion string) (time.Duration, PoliticaReintento) {
+    configRed.RLock()
+    defer configRed.RUnlock()
+
+    politica, ok := politicas[operacion]
+    if !ok {
+        politica = PoliticaReintento{MaxIntentos: 1}
+    }
+    return timeoutHTTP, politica
+}
+
+/*
+enviarSOAP realiza el POST del mensaje SOAP aplicando la política de reintentos
+de la operación indicada. Retorna el body completo de la respuesta.
+*/
+func enviarSOAP(endpoint, soap, operacion string) ([]byte, error) {
+    headers := map[string]string{
+        "Content-Type": `text/xml; charset="utf-8"`, // Tipo de contenido SOAP
+        "SOAPAction":   "",                          // SOAPAction vacío según SUNAT
+    }
+    bodyBytes, _, err := enviarHTTP("POST", endpoint, []byte(soap), headers, operacion)
+    return bodyBytes, err
+}
+
+/*
+enviarHTTP realiza un request a SUNAT aplicando el límite de concurrencia y la
+política de reintentos de la operación: reintenta ante errores de red y respuestas
+502/503/504. Retorna el body (descomprimido si viene en gzip) y el código HTTP.
+*/
+func enviarHTTP(metodo, endpoint string, body []byte, headers map[string]string, operacion string) ([]byte, int, error) {
+    timeout, politica := obtenerConfigRed(operacion)
+    client := &http.Client{Timeout: timeout}
+    espera := politica.Espera
+
+    var ultimoErr error
+    for intento := 1; intento <= politica.MaxIntentos; intento++ {
+        if intento > 1 {
+            fmt.Printf("Reintentando %s (intento %d de %d): %v\n", operacion, intento, politica.MaxIntentos, ultimoErr)
+            time.Sleep(espera)
+            espera *= 2
+        }
+
+        req, err := http.NewRequest(metodo, endpoint, bytes.NewReader(body))
+        if err != nil {
+            return nil, 0, err
+        }
+
+        for nombre, valor := range headers {
+            req.Header.Set(nombre, valor)
+        }
+        req.Header.Set("Accept-Encoding", "gzip") // El CDR puede ser pesado
+
+        liberar := adquirirTurnoSUNAT()
+        resp, err := client.Do(req)
+        liberar()
+        if err != nil {
+            ultimoErr = err
+            continue
+        }
+
+        bodyBytes, err := leerCuerpo(resp)
+        resp.Body.Close()
+        if err != nil {
+            ultimoErr = err
+            continue
+        }
+
+        switch resp.StatusCode {
+        case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+            ultimoErr = fmt.Errorf("SUNAT respondió HTTP %d", resp.StatusCode)
+            continue
+        }
+
+        return bodyBytes, resp.StatusCode, nil
+    }
+
+    return nil, 0, fmt.Errorf("%s falló después de %d intento(s): %v", operacion, politica.MaxIntentos, ultimoErr)
+}
+
+// leerCuerpo lee el body de la respuesta descomprimiéndolo si viene con gzip.
+// Al fijar Accept-Encoding manualmente, net/http ya no descomprime de forma transparente.
+func leerCuerpo(resp *http.Response) ([]byte, error) {
+    if !strings.EqualFold(strings.TrimSpace(resp.Header.Get("Content-Encoding")), "gzip") {
+        return io.ReadAll(resp.Body)
+    }
+
+    gz, err := gzip.NewReader(resp.Body)
+    if err != nil {
+        return nil, fmt.Errorf("respuesta gzip inválida: %v", err)
+    }
+    defer gz.Close()
+
+    return io.ReadAll(gz)
+}
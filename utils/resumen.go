@@ -0,0 +1,100 @@
+package utils
+
+import (
+    "encoding/base64"
+    "encoding/xml"
+    "fmt"
+    "io/ioutil"
+    "strings"
+)
+
+/*
+Envío de resúmenes diarios y comunicaciones de baja (método sendSummary)
+=======================================================================
+
+A diferencia de sendBill, sendSummary no devuelve el CDR sino un ticket: SUNAT
+procesa el resumen de forma asíncrona y el CDR se obtiene después consultando
+el ticket con getStatus (ver ConsultarTicket).
+*/
+
+// tiposResumen son los tipos del nombre del archivo que se envían con sendSummary:
+// RC = resumen diario, RA = comunicación de baja, RR = resumen de reversiones
+var tiposResumen = map[string]bool{
+    "RC": true,
+    "RA": true,
+    "RR": true,
+}
+
+// EsResumen indica si el ZIP es un resumen o comunicación de baja, según el nombre
+// SUNAT del archivo (RUC-RC-YYYYMMDD-N), en lugar de un comprobante individual
+func EsResumen(zipPath string) bool {
+    partes := strings.Split(removeExtension(nombreEnvioZIP(zipPath)), "-")
+    return len(partes) == 4 && tiposResumen[strings.ToUpper(partes[1])]
+}
+
+/*
+BuildSOAPSummary construye el mensaje SOAP de sendSummary. Usa la misma
+autenticación WS-Security y el mismo formato de archivo que BuildSOAP.
+*/
+func BuildSOAPSummary(ruc, usuario, clave, zipPath string) (string, error) {
+    content, err := ioutil.ReadFile(zipPath)
+    if err != nil {
+        return "", err
+    }
+
+    soap := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"
+    xmlns:ser="http://service.sunat.gob.pe"
+    xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">
+  <soapenv:Header>
+    <wsse:Security>
+      <wsse:UsernameToken>
+        <wsse:Username>%s%s</wsse:Username>
+        <wsse:Password>%s</wsse:Password>
+      </wsse:UsernameToken>
+    </wsse:Security>
+  </soapenv:Header>
+  <soapenv:Body>
+    <ser:sendSummary>
+      <fileName>%s</fileName>
+      <contentFile>%s</contentFile>
+    </ser:sendSummary>
+  </soapenv:Body>
+</soapenv:Envelope>`, ruc, usuario, clave, nombreEnvioZIP(zipPath), base64.StdEncoding.EncodeToString(content))
+
+    return soap, nil
+}
+
+/*
+SendSummaryStructured envía el resumen con sendSummary (con la política de
+reintentos de sendSummary) y retorna el ticket asignado por SUNAT.
+
+Un SOAP Fault se retorna como error: a diferencia de sendBill no hay CDR
+de rechazo, SUNAT no recibió el resumen y debe corregirse y reenviarse.
+*/
+func SendSummaryStructured(endpoint, soap string) (string, error) {
+    bodyBytes, err := enviarSOAP(endpoint, soap, OperacionSendSummary)
+    if err != nil {
+        return "", err
+    }
+
+    // Estructura para parsear la respuesta de sendSummary
+    type Envelope struct {
+        XMLName     xml.Name `xml:"Envelope"`
+        Ticket      string   `xml:"Body>sendSummaryResponse>ticket"`
+        FaultCode   string   `xml:"Body>Fault>faultcode"`
+        FaultString string   `xml:"Body>Fault>faultstring"`
+    }
+
+    var envelope Envelope
+    if err := xml.Unmarshal(bodyBytes, &envelope); err != nil {
+        return "", fmt.Errorf("error al parsear respuesta de sendSummary: %v", err)
+    }
+    if envelope.FaultCode != "" {
+        return "", fmt.Errorf("sendSummary: %s - %s", envelope.FaultCode, envelope.FaultString)
+    }
+    if envelope.Ticket == "" {
+        return "", fmt.Errorf("SUNAT no retornó ticket para el resumen")
+    }
+    return envelope.Ticket, nil
+}
@@ -29,9 +29,9 @@ import (
     "fmt"
     "io"
     "io/ioutil"
-    "net/http"
     "os"
     "path/filepath"
+    "strings"
     "ubl-go-conversor/models"
 )
 
@@ -57,6 +57,16 @@ Retorna:
 - error: Error si falla el proceso de compresión
 */
 func ZipXML(rutaXML string) (string, error) {
+    return ZipXMLComo(rutaXML, removeExtension(filepath.Base(rutaXML)))
+}
+
+/*
+ZipXMLComo comprime el XML usando nombreSUNAT (RUC-TIPO-SERIE-NUMERO) como nombre
+del XML dentro del ZIP, independiente del nombre del archivo en disco. El ZIP se
+guarda junto al XML con su mismo nombre base. El nombre interno es el que se usa
+luego como fileName del envío a SUNAT.
+*/
+func ZipXMLComo(rutaXML, nombreSUNAT string) (string, error) {
     zipName := removeExtension(rutaXML) + ".ZIP"
     zipFile, err := os.Create(zipName)
     if err != nil {
@@ -73,7 +83,7 @@ func ZipXML(rutaXML string) (string, error) {
     }
     defer xmlFile.Close()
 
-    w, err := zipWriter.Create(fmt.Sprintf("%s.XML", removeExtension(filepath.Base(rutaXML))))
+    w, err := zipWriter.Create(fmt.Sprintf("%s.XML", nombreSUNAT))
     if err != nil {
         return "", err
     }
@@ -117,8 +127,8 @@ func BuildSOAP(ruc, usuario, clave, zipPath string) (string, error) {
     // Codificar ZIP en Base64 para transmisión SOAP
     encoded := base64.StdEncoding.EncodeToString(content)
     
-    // Extraer solo el nombre del archivo ZIP (sin ruta)
-    zipName := filepath.Base(zipPath)
+    // Nombre con el que SUNAT recibe el archivo (RUC-TIPO-SERIE-NUMERO.ZIP)
+    zipName := nombreEnvioZIP(zipPath)
 
     // Construir mensaje SOAP según especificaciones SUNAT
     // El usuario debe ser RUC + usuario secundario (sin separador)
@@ -179,7 +189,7 @@ SendToSunatStructured realiza el envío del comprobante a SUNAT y procesa la res
 Esta es la función principal que implementa la comunicación completa con SUNAT:
 
 1. ENVÍO HTTP:
-   - Realiza POST al endpoint de SUNAT
+   - Realiza POST al endpoint de SUNAT (con la política de reintentos de sendBill)
    - Envía mensaje SOAP con autenticación WS-Security
    - Configura headers apropiados para SOAP
 
@@ -206,32 +216,10 @@ Retorna:
 - error: Error si falla el proceso
 */
 func SendToSunatStructured(endpoint, soap, xmlZipName, baseCDRDir string) (*models.CDRInfo, error) {
-    // ==================== CONFIGURACIÓN Y ENVÍO HTTP ====================
-    
-    // Crear cliente HTTP estándar (se podría configurar timeout)
-    client := &http.Client{}
-    
-    // Crear request POST con el mensaje SOAP como body
-    req, err := http.NewRequest("POST", endpoint, bytes.NewBufferString(soap))
-    if err != nil {
-        return nil, err
-    }
-
-    // Configurar headers requeridos para SOAP
-    req.Header.Set("Content-Type", `text/xml; charset="utf-8"`) // Tipo de contenido SOAP
-    req.Header.Set("SOAPAction", "")                            // SOAPAction vacío según SUNAT
-
-    // Enviar request a SUNAT
-    resp, err := client.Do(req)
-    if err != nil {
-        return nil, err
-    }
-    defer resp.Body.Close()
-
-    // ==================== LECTURA Y PARSEO DE RESPUESTA SOAP ====================
+    // ==================== ENVÍO HTTP CON REINTENTOS ====================
     
-    // Leer todo el contenido de la respuesta HTTP
-    bodyBytes, err := io.ReadAll(resp.Body)
+    // Enviar request a SUNAT aplicando la política de reintentos de sendBill
+    bodyBytes, err := enviarSOAP(endpoint, soap, OperacionSendBill)
     if err != nil {
         return nil, err
     }
@@ -255,6 +243,16 @@ func SendToSunatStructured(endpoint, soap, xmlZipName, baseCDRDir string) (*mode
 
     // Verificar si hay un error SOAP (faultcode presente)
     if envelope.FaultCode != "" {
+        // Si SUNAT indica que el documento ya fue registrado (reenvío tras timeout),
+        // recuperar el CDR original con getStatusCdr en lugar de reportar error
+        if esDocumentoYaRegistrado(envelope.FaultCode) {
+            cdrInfo, err := recuperarCDRRegistrado(xmlZipName, baseCDRDir)
+            if err == nil {
+                return cdrInfo, nil
+            }
+            fmt.Printf("Warning: no se pudo recuperar el CDR del documento ya registrado: %v\n", err)
+        }
+
         // Retornar información de error sin procesar CDR
         return &models.CDRInfo{
             ResponseCode: envelope.FaultCode,
@@ -272,6 +270,22 @@ func SendToSunatStructured(endpoint, soap, xmlZipName, baseCDRDir string) (*mode
         return nil, fmt.Errorf("error al decodificar base64: %v", err)
     }
 
+    return procesarCDR(decodedZip, xmlZipName, baseCDRDir)
+}
+
+/*
+procesarCDR guarda el CDR (ZIP) recibido de SUNAT y extrae su resultado.
+
+Parámetros:
+- decodedZip: Contenido del ZIP del CDR ya decodificado de Base64
+- xmlZipName: Nombre del ZIP enviado (para nombrar CDR)
+- baseCDRDir: Directorio base para guardar CDR
+
+Retorna:
+- *models.CDRInfo: Código, descripción y estado interpretado del CDR
+- error: Error si el ZIP no puede guardarse o no contiene un XML válido
+*/
+func procesarCDR(decodedZip []byte, xmlZipName, baseCDRDir string) (*models.CDRInfo, error) {
     // Crear estructura de directorios para almacenar CDR
     // Formato: baseCDRDir/nombre_documento/
     zipBaseName := removeExtension(filepath.Base(xmlZipName)) 
@@ -295,78 +309,105 @@ func SendToSunatStructured(endpoint, soap, xmlZipName, baseCDRDir string) (*mode
 
     // ==================== EXTRACCIÓN Y ANÁLISIS DEL XML CDR ====================
     
-    // Abrir CDR ZIP para extraer el XML de respuesta
+    // Abrir CDR ZIP para extraer el XML de respuesta. Si no es un ZIP válido el contenido
+    // crudo ya quedó guardado en zipFilePath para diagnóstico
     zipReader, err := zip.NewReader(bytes.NewReader(decodedZip), int64(len(decodedZip)))
     if err != nil {
-        return nil, fmt.Errorf("error al leer ZIP: %v", err)
+        return nil, fmt.Errorf("el CDR recibido no es un ZIP válido (%d bytes, guardado en %s): %v", len(decodedZip), zipFilePath, err)
     }
 
-    // Buscar archivo XML dentro del ZIP del CDR
-    // SUNAT incluye un XML con la respuesta oficial del comprobante
-    for _, file := range zipReader.File {
-        // Verificar que sea un archivo XML (puede ser .XML o .xml)
-        if ext := filepath.Ext(file.Name); ext == ".XML" || ext == ".xml" {
-            // Abrir archivo XML del CDR
-            rc, err := file.Open()
-            if err != nil {
-                return nil, err
-            }
-            defer rc.Close()
+    // Buscar el XML de respuesta dentro del ZIP del CDR
+    // SUNAT incluye un XML R-<nombre enviado>.xml y a veces entradas adicionales (ej: carpeta dummy/)
+    file := seleccionarXMLCDR(zipReader.File, nombreEnvioZIP(xmlZipName))
+    if file == nil {
+        nombres := make([]string, 0, len(zipReader.File))
+        for _, f := range zipReader.File {
+            nombres = append(nombres, f.Name)
+        }
+        return nil, fmt.Errorf("no se encontró XML dentro del ZIP del CDR (contenido: %s, guardado en %s)", strings.Join(nombres, ", "), zipFilePath)
+    }
 
-            // Leer contenido completo del XML
-            content, err := io.ReadAll(rc)
-            if err != nil {
-                return nil, err
-            }
+    // Leer contenido completo del XML
+    rc, err := file.Open()
+    if err != nil {
+        return nil, fmt.Errorf("error al abrir %s del CDR (guardado en %s): %v", file.Name, zipFilePath, err)
+    }
+    content, err := io.ReadAll(rc)
+    rc.Close()
+    if err != nil {
+        return nil, fmt.Errorf("error al leer %s del CDR (guardado en %s): %v", file.Name, zipFilePath, err)
+    }
 
-            // Guardar XML del CDR como archivo separado para auditoría
-            cdrXmlPath := filepath.Join(cdrDir, file.Name)
-            if err := os.WriteFile(cdrXmlPath, content, 0644); err != nil {
-                return nil, fmt.Errorf("error al guardar XML del CDR: %v", err)
-            }
+    // Guardar XML del CDR como archivo separado para auditoría (también si no parsea)
+    cdrXmlPath := filepath.Join(cdrDir, filepath.Base(file.Name))
+    if err := os.WriteFile(cdrXmlPath, content, 0644); err != nil {
+        return nil, fmt.Errorf("error al guardar XML del CDR: %v", err)
+    }
 
-            // Estructura para parsear respuesta CDR de SUNAT
-            // El CDR contiene ResponseCode y Description en DocumentResponse
-            type CDR struct {
-                ResponseCode string `xml:"DocumentResponse>Response>ResponseCode"` // Código de respuesta SUNAT
-                Description  string `xml:"DocumentResponse>Response>Description"`  // Descripción del resultado
-            }
+    // Parsear XML del CDR para extraer resultado y estado interpretado
+    cdr, err := ParseCDR(content)
+    if err != nil {
+        return nil, fmt.Errorf("%v (contenido crudo guardado en %s)", err, cdrXmlPath)
+    }
 
-            // Parsear XML del CDR para extraer resultado
-            var cdr CDR
-            if err := xml.Unmarshal(content, &cdr); err != nil {
-                return nil, fmt.Errorf("error al parsear CDR: %v", err)
-            }
+    // Retornar información completa del CDR
+    return &models.CDRInfo{
+        ResponseCode:  cdr.ResponseCode, // Código de respuesta SUNAT
+        Description:   cdr.Description,  // Descripción oficial
+        Estado:        cdr.Estado,       // Estado interpretado
+        CDRZipBase64:  cdrZipBase64,     // CDR completo en Base64
+        CDRZipPath:    zipFilePath,      // Ruta del archivo CDR guardado
+        Observaciones: cdr.Observaciones, // Todas las observaciones del CDR
+    }, nil
+}
 
-            // ==================== INTERPRETACIÓN DE CÓDIGOS SUNAT ====================
-            
-            // Determinar estado final según código de respuesta SUNAT:
-            // - "0": Aceptado (aprobada)
-            // - "4000"-"4999": Aceptado con observaciones (observada)
-            // - Otros códigos: Rechazado (rechazada)
-            estado := "rechazada"
-            if cdr.ResponseCode == "0" {
-                estado = "aprobada"
-            } else if cdr.ResponseCode >= "4000" && cdr.ResponseCode < "5000" {
-                estado = "observada"
-            }
+// seleccionarXMLCDR elige el XML de respuesta dentro del ZIP del CDR: primero
+// R-<nombre enviado>.xml, luego cualquier R-*.xml y por último cualquier XML.
+// Ignora directorios. Retorna nil si el ZIP no contiene ningún XML.
+func seleccionarXMLCDR(files []*zip.File, nombreEnviado string) *zip.File {
+    esperado := "R-" + strings.ToUpper(removeExtension(filepath.Base(nombreEnviado))) + ".XML"
 
-            // Retornar información completa del CDR
-            return &models.CDRInfo{
-                ResponseCode: cdr.ResponseCode, // Código de respuesta SUNAT
-                Description:  cdr.Description,  // Descripción oficial
-                Estado:       estado,           // Estado interpretado
-                CDRZipBase64: cdrZipBase64,     // CDR completo en Base64
-                CDRZipPath:   zipFilePath,      // Ruta del archivo CDR guardado
-            }, nil
+    var respuesta, cualquiera *zip.File
+    for _, file := range files {
+        if file.FileInfo().IsDir() {
+            continue
+        }
+        nombre := strings.ToUpper(filepath.Base(file.Name))
+        if filepath.Ext(nombre) != ".XML" {
+            continue
+        }
+        switch {
+        case nombre == esperado:
+            return file
+        case strings.HasPrefix(nombre, "R-") && respuesta == nil:
+            respuesta = file
+        case cualquiera == nil:
+            cualquiera = file
         }
     }
 
-    // Error si no se encuentra XML en el CDR (situación anómala)
-    return nil, fmt.Errorf("no se encontró XML dentro del ZIP del CDR")
+    if respuesta != nil {
+        return respuesta
+    }
+    return cualquiera
 }
 
 
+// nombreEnvioZIP retorna el nombre con el que se envía el ZIP a SUNAT, tomado del XML que
+// contiene (RUC-TIPO-SERIE-NUMERO.ZIP), ya que el archivo en disco puede seguir otra plantilla
+func nombreEnvioZIP(zipPath string) string {
+    reader, err := zip.OpenReader(zipPath)
+    if err == nil {
+        defer reader.Close()
+        for _, file := range reader.File {
+            if ext := strings.ToUpper(filepath.Ext(file.Name)); ext == ".XML" {
+                return removeExtension(filepath.Base(file.Name)) + ".ZIP"
+            }
+        }
+    }
+    return filepath.Base(zipPath)
+}
+
 /*
 removeExtension elimina la extensión de un nombre de archivo.
 
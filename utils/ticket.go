@@ -0,0 +1,144 @@
+package utils
+
+import (
+    "encoding/base64"
+    "encoding/xml"
+    "fmt"
+
+    "ubl-go-conversor/models"
+)
+
+/*
+Consulta de tickets de envíos asíncronos (método getStatus de billService)
+=========================================================================
+
+Los resúmenes diarios, comunicaciones de baja y sendBillAsync no devuelven el CDR
+en la misma respuesta sino un ticket. Con getStatus se consulta ese ticket hasta
+que SUNAT termina de procesarlo y entrega el CDR.
+*/
+
+// Códigos de estado de getStatus
+const (
+    CodigoTicketProcesado  = "0"  // Procesó correctamente, incluye CDR
+    CodigoTicketEnProceso  = "98" // Aún en proceso, consultar más tarde
+    CodigoTicketConErrores = "99" // Procesó con errores, incluye CDR de rechazo
+)
+
+// EstadoCDREnProceso es el estado del CDRInfo mientras SUNAT procesa el ticket (código 98)
+const EstadoCDREnProceso = "en_proceso"
+
+// EstadoTicket resultado de la consulta de un ticket
+type EstadoTicket struct {
+    StatusCode string          // Código de getStatus (0, 98, 99)
+    EnProceso  bool            // true si SUNAT aún no termina de procesar el ticket
+    CDR        *models.CDRInfo // CDR procesado cuando el ticket ya terminó
+}
+
+/*
+ConsultarTicket consulta el estado de un ticket con getStatus.
+
+Parámetros:
+- endpoint: URL de billService (la misma del envío)
+- ruc, usuario, clave: Credenciales SOL (usuario = RUC + usuario secundario)
+- ticket: Ticket devuelto por SUNAT al enviar
+- xmlZipName: Nombre del ZIP enviado (para nombrar el CDR)
+- baseCDRDir: Directorio base para guardar CDR
+
+Retorna EnProceso=true con código 98; en otro caso procesa y retorna el CDR.
+*/
+func ConsultarTicket(endpoint, ruc, usuario, clave, ticket, xmlZipName, baseCDRDir string) (*EstadoTicket, error) {
+    soap := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"
+    xmlns:ser="http://service.sunat.gob.pe"
+    xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">
+  <soapenv:Header>
+    <wsse:Security>
+      <wsse:UsernameToken>
+        <wsse:Username>%s%s</wsse:Username>
+        <wsse:Password>%s</wsse:Password>
+      </wsse:UsernameToken>
+    </wsse:Security>
+  </soapenv:Header>
+  <soapenv:Body>
+    <ser:getStatus>
+      <ticket>%s</ticket>
+    </ser:getStatus>
+  </soapenv:Body>
+</soapenv:Envelope>`, ruc, usuario, clave, ticket)
+
+    bodyBytes, err := enviarSOAP(endpoint, soap, OperacionGetStatus)
+    if err != nil {
+        return nil, err
+    }
+
+    // Estructura para parsear la respuesta de getStatus
+    type Envelope struct {
+        XMLName     xml.Name `xml:"Envelope"`
+        StatusCode  string   `xml:"Body>getStatusResponse>status>statusCode"` // 0, 98 o 99
+        Content     string   `xml:"Body>getStatusResponse>status>content"`    // CDR en Base64
+        FaultCode   string   `xml:"Body>Fault>faultcode"`
+        FaultString string   `xml:"Body>Fault>faultstring"`
+    }
+
+    var envelope Envelope
+    if err := xml.Unmarshal(bodyBytes, &envelope); err != nil {
+        return nil, fmt.Errorf("error al parsear respuesta de getStatus: %v", err)
+    }
+    if envelope.FaultCode != "" {
+        return nil, fmt.Errorf("getStatus: %s - %s", envelope.FaultCode, envelope.FaultString)
+    }
+
+    estado := &EstadoTicket{StatusCode: envelope.StatusCode}
+    if envelope.StatusCode == CodigoTicketEnProceso {
+        estado.EnProceso = true
+        return estado, nil
+    }
+
+    if envelope.Content == "" {
+        // Con 99 SUNAT terminó de procesar el ticket aunque no entregue CDR: el envío
+        // no es válido y no tiene sentido seguir consultando el ticket
+        if envelope.StatusCode == CodigoTicketConErrores {
+            estado.CDR = &models.CDRInfo{
+                ResponseCode: envelope.StatusCode,
+                Description:  fmt.Sprintf("SUNAT procesó el ticket %s con errores y no retornó CDR", ticket),
+                Estado:       "error",
+            }
+            return estado, nil
+        }
+        return nil, fmt.Errorf("SUNAT no retornó CDR para el ticket %s (código %s)", ticket, envelope.StatusCode)
+    }
+
+    decodedZip, err := base64.StdEncoding.DecodeString(envelope.Content)
+    if err != nil {
+        return nil, fmt.Errorf("error al decodificar CDR en base64: %v", err)
+    }
+
+    estado.CDR, err = procesarCDR(decodedZip, xmlZipName, baseCDRDir)
+    if err != nil {
+        return nil, err
+    }
+    return estado, nil
+}
+
+/*
+GetStatusCDR consulta un ticket con getStatus y retorna directamente el CDR.
+
+A diferencia de ConsultarTicket, el CDR se guarda con el nombre del ticket
+(cdr/<ticket>/) y el código 98 no es un error sino un CDRInfo con estado
+"en_proceso", para que quien consulta decida cuándo volver a intentar.
+Con 99 retorna el CDR de rechazo, o estado "error" si SUNAT no lo entregó.
+*/
+func GetStatusCDR(endpoint, ruc, usuario, clave, ticket string) (*models.CDRInfo, error) {
+    estado, err := ConsultarTicket(endpoint, ruc, usuario, clave, ticket, ticket+".zip", "cdr")
+    if err != nil {
+        return nil, err
+    }
+    if estado.EnProceso {
+        return &models.CDRInfo{
+            ResponseCode: estado.StatusCode,
+            Description:  fmt.Sprintf("El ticket %s aún está en proceso en SUNAT", ticket),
+            Estado:       EstadoCDREnProceso,
+        }, nil
+    }
+    return estado.CDR, nil
+}
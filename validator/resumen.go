@@ -0,0 +1,93 @@
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ubl-go-conversor/models"
+)
+
+// MaxLineasResumen límite de comprobantes por resumen diario que acepta SUNAT
+const MaxLineasResumen = 500
+
+// ValidarResumenDiario verifica que el resumen pueda enviarse como un único
+// SummaryDocuments: boletas (o sus notas) del mismo emisor, moneda y fecha de emisión,
+// cada una con un estado del catálogo 19 y con sus datos válidos.
+func ValidarResumenDiario(r models.ResumenDiario) error {
+	if err := validarEmisor(r.Emisor); err != nil {
+		return fmt.Errorf("error en emisor: %v", err)
+	}
+	if len(r.Boletas) == 0 {
+		return errors.New("el resumen debe tener al menos una boleta")
+	}
+	if len(r.Boletas) > MaxLineasResumen {
+		return fmt.Errorf("el resumen tiene %d comprobantes; el máximo permitido es %d", len(r.Boletas), MaxLineasResumen)
+	}
+
+	fechaReferencia := r.FechaReferencia()
+	vistos := map[string]bool{}
+	for i, boleta := range r.Boletas {
+		f := boleta.Comprobante
+		id := models.FormatearIDComprobante(f.Serie, f.Numero)
+		if _, ok := models.EstadosResumen[boleta.Estado]; !ok {
+			return fmt.Errorf("boleta %d (%s): estado '%s' inválido (1=adicionar, 2=modificar, 3=anular)", i+1, id, boleta.Estado)
+		}
+		if err := validarTipoLineaResumen(f); err != nil {
+			return fmt.Errorf("boleta %d (%s): %v", i+1, id, err)
+		}
+		if f.Emisor.RUC != r.Emisor.RUC {
+			return fmt.Errorf("boleta %d (%s): el RUC del emisor (%s) no coincide con el del resumen (%s)", i+1, id, f.Emisor.RUC, r.Emisor.RUC)
+		}
+		// El resumen se registra con una sola moneda (la de la primera boleta)
+		if moneda := r.Boletas[0].Comprobante.Moneda; f.Moneda != moneda {
+			return fmt.Errorf("boleta %d (%s): moneda %s distinta a la del resumen (%s); todas las boletas deben tener la misma moneda",
+				i+1, id, f.Moneda, moneda)
+		}
+		if f.FechaEmision != fechaReferencia {
+			return fmt.Errorf("boleta %d (%s): fecha de emisión %s distinta a la del resumen (%s); todas las boletas deben ser del mismo día",
+				i+1, id, f.FechaEmision, fechaReferencia)
+		}
+		clave := f.TipoDocumento + "-" + id
+		if vistos[clave] {
+			return fmt.Errorf("boleta %d (%s): comprobante repetido en el resumen", i+1, id)
+		}
+		vistos[clave] = true
+		if err := ValidarComprobanteBase(f); err != nil {
+			return fmt.Errorf("boleta %d (%s): %v", i+1, id, err)
+		}
+	}
+
+	referencia, err := time.Parse(models.FormatoFechaSUNAT, fechaReferencia)
+	if err != nil {
+		return fmt.Errorf("fecha de emisión inválida: %s", fechaReferencia)
+	}
+	generacion, err := time.Parse(models.FormatoFechaSUNAT, r.FechaGeneracion)
+	if err != nil {
+		return fmt.Errorf("fechaGeneracion inválida: %s (formato YYYY-MM-DD)", r.FechaGeneracion)
+	}
+	if generacion.Before(referencia) {
+		return fmt.Errorf("la fecha de generación %s no puede ser anterior a la fecha de emisión de las boletas %s", r.FechaGeneracion, fechaReferencia)
+	}
+	return nil
+}
+
+// validarTipoLineaResumen admite boletas (03) y notas de crédito/débito de boletas (serie B)
+func validarTipoLineaResumen(f models.ComprobanteBase) error {
+	switch f.TipoDocumento {
+	case "03":
+		return nil
+	case "07", "08":
+		if strings.HasPrefix(strings.ToUpper(f.Serie), "B") {
+			return nil
+		}
+		return fmt.Errorf("solo se informan en el resumen las notas de boletas (serie B), no la serie %s", f.Serie)
+	}
+	return fmt.Errorf("tipo de documento %s no se informa en el resumen diario (solo 03, 07 y 08)", f.TipoDocumento)
+}
+
+// FechaHoyPeru retorna la fecha actual en Perú en formato YYYY-MM-DD
+func FechaHoyPeru(ahora time.Time) string {
+	return fechaHoyPeru(ahora).Format(models.FormatoFechaSUNAT)
+}
@@ -3,13 +3,21 @@ package validator
 import (
 	"errors"
 	"fmt"
+	"math"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
+	"ubl-go-conversor/catalogos"
 	"ubl-go-conversor/models"
 )
 
 func ValidarComprobanteBase(f models.ComprobanteBase) error {
+	// El descuentoGlobal se valida y totaliza como un descuento más (catálogo 53)
+	f.IncorporarDescuentoGlobal()
+
 	if err := verificarCamposObligatorios(f); err != nil {
 		return fmt.Errorf("faltan campos obligatorios: %v", err)
 	}
@@ -34,11 +42,70 @@ func ValidarComprobanteBase(f models.ComprobanteBase) error {
 			return err
 		}
 	}
+	if err := validarIDsItems(f.Items); err != nil {
+		return err
+	}
+
+	if err := validarCuotas(f); err != nil {
+		return err
+	}
+
+	if err := validarCargos(f.Cargos); err != nil {
+		return err
+	}
+
+	if err := validarDescuentos(f.Descuentos); err != nil {
+		return err
+	}
+
+	if err := validarDocumentoAfectado(f); err != nil {
+		return err
+	}
+
+	if err := validarMotivoNota(f); err != nil {
+		return err
+	}
+
+	if err := validarTipoOperacion(f); err != nil {
+		return err
+	}
+
+	if err := validarLeyendas(f.Leyendas); err != nil {
+		return err
+	}
+
+	if err := validarPercepcion(f); err != nil {
+		return err
+	}
+
+	if err := validarRetencion(f); err != nil {
+		return err
+	}
+
+	if err := validarDescuentosExcedentes(f); err != nil {
+		return err
+	}
+
+	if err := validarTotalISC(f); err != nil {
+		return err
+	}
+
+	if err := validarICBPER(f); err != nil {
+		return err
+	}
 
 	if err := validarTotales(f); err != nil {
 		return err
 	}
 
+	if err := validarSubtotalesTributarios(f); err != nil {
+		return err
+	}
+
+	if err := validarTotalGratuito(f); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -50,6 +117,10 @@ func verificarCamposObligatorios(f models.ComprobanteBase) error {
 			break
 		}
 	}
+	// Un monto omitido no equivale a un cero explícito: se reporta como campo faltante
+	if omitidos := f.CamposOmitidos(); len(omitidos) > 0 {
+		return fmt.Errorf("no se enviaron los montos %s (envíe 0 explícitamente si corresponde)", strings.Join(omitidos, ", "))
+	}
 	if f.Serie == "" {
 		return errors.New("serie es obligatoria")
 	}
@@ -100,6 +171,12 @@ func validarEmisor(emisor models.Emisor) error {
 	if emisor.Direccion == "" {
 		return errors.New("la dirección es obligatoria")
 	}
+	if err := validarCodigoPais(emisor.CodigoPais); err != nil {
+		return err
+	}
+	if emisor.CodigoEstablecimiento != "" && !regexp.MustCompile(`^[0-9]{4}$`).MatchString(emisor.CodigoEstablecimiento) {
+		return fmt.Errorf("el código de establecimiento '%s' debe tener 4 dígitos (ej: 0000, 0001)", emisor.CodigoEstablecimiento)
+	}
 	return nil
 }
 
@@ -132,6 +209,10 @@ func validarCliente(cliente models.Cliente, tipoComprobante string) error {
 		}
 	}
 
+	if err := validarCodigoPais(cliente.CodigoPais); err != nil {
+		return err
+	}
+
 	if tipoComprobante == "01" && cliente.TipoDoc != "6" {
 		return errors.New("las facturas (01) solo pueden emitirse a clientes con RUC (tipo 6)")
 	}
@@ -142,9 +223,17 @@ func validarCliente(cliente models.Cliente, tipoComprobante string) error {
 	return nil
 }
 
+// validarCodigoPais verifica que el código sea ISO 3166-1 alfa-2 (vacío equivale a "PE")
+func validarCodigoPais(codigo string) error {
+	if !catalogos.EsCodigoPaisValido(catalogos.NormalizarCodigoPais(codigo)) {
+		return fmt.Errorf("el código de país '%s' no es un código ISO 3166-1 alfa-2 válido", codigo)
+	}
+	return nil
+}
+
 func validarCamposBasicos(f models.ComprobanteBase) error {
 	tiposDocumento := map[string]bool{
-		"01": true, "03": true, "07": true,
+		"01": true, "03": true, "07": true, "08": true,
 	}
 
 	if !tiposDocumento[f.TipoDocumento] {
@@ -165,9 +254,9 @@ func validarCamposBasicos(f models.ComprobanteBase) error {
 		if f.Serie[0] != 'B' {
 			return fmt.Errorf("para boletas, la serie debe comenzar con 'B'")
 		}
-	case "07":
+	case "07", "08":
 		if f.Serie[0] != 'F' && f.Serie[0] != 'B' {
-			return fmt.Errorf("para notas de crédito, la serie debe comenzar con 'F' o 'B'")
+			return fmt.Errorf("para notas de crédito/débito, la serie debe comenzar con 'F' o 'B'")
 		}
 	}
 
@@ -175,9 +264,23 @@ func validarCamposBasicos(f models.ComprobanteBase) error {
 		return errors.New("el número debe tener entre 1 y 8 dígitos")
 	}
 
-	if _, err := time.Parse("2006-01-02", f.FechaEmision); err != nil {
+	// El ID combinado SERIE-NUMERO debe tener el formato exacto que SUNAT espera
+	idRegex := regexp.MustCompile(`^[A-Z][A-Z0-9]{3}-[1-9][0-9]{0,7}$`)
+	if id := models.FormatearIDComprobante(f.Serie, f.Numero); !idRegex.MatchString(id) {
+		return fmt.Errorf("el ID del comprobante '%s' no es válido (serie de 4 caracteres y número de 1 a 8 dígitos mayor a 0)", id)
+	}
+
+	fechaEmision, err := time.Parse("2006-01-02", f.FechaEmision)
+	if err != nil {
 		return errors.New("la fecha de emisión tiene formato inválido (YYYY-MM-DD)")
 	}
+	if fechaEmision.After(fechaHoyPeru(time.Now())) {
+		return fmt.Errorf("la fecha de emisión %s no puede ser posterior a la fecha actual", f.FechaEmision)
+	}
+
+	if f.IdiomaPDF != "" && f.IdiomaPDF != "es" && f.IdiomaPDF != "en" {
+		return fmt.Errorf("idiomaPDF '%s' no soportado (use \"es\" o \"en\")", f.IdiomaPDF)
+	}
 
 	if f.HoraEmision != "" {
 		horaRegex := regexp.MustCompile(`^\d{2}:\d{2}:\d{2}$`)
@@ -201,20 +304,88 @@ func validarCamposBasicos(f models.ComprobanteBase) error {
 	if !monedasValidas.MatchString(f.Moneda) {
 		return fmt.Errorf("la moneda '%s' no es válida (PEN, USD, EUR)", f.Moneda)
 	}
+	if f.TipoCambio < 0 {
+		return errors.New("el tipo de cambio no puede ser negativo")
+	}
 
 	return nil
 }
 
+// validarDocumentoAfectado verifica que las notas de crédito/débito identifiquen el
+// comprobante que corrigen y estén en su misma moneda (una nota en USD no puede ajustar
+// una factura en PEN). La moneda del afectado se conoce cuando se completó desde BD.
+func validarDocumentoAfectado(f models.ComprobanteBase) error {
+	if f.TipoDocumento != "07" && f.TipoDocumento != "08" {
+		return nil
+	}
+
+	afectado := f.DocumentoAfectado
+	if afectado == nil {
+		return errors.New("las notas de crédito/débito deben indicar el documentoAfectado")
+	}
+	if afectado.TipoDocumento != "01" && afectado.TipoDocumento != "03" {
+		return fmt.Errorf("el documento afectado debe ser una factura (01) o boleta (03), se recibió '%s'", afectado.TipoDocumento)
+	}
+	if afectado.Serie == "" || afectado.Numero == "" {
+		return errors.New("el documento afectado debe indicar serie y número")
+	}
+	// La nota sigue la serie del comprobante que corrige (F para facturas, B para boletas)
+	if afectado.Serie[0] != f.Serie[0] {
+		return fmt.Errorf("la serie de la nota (%s) no corresponde a la del documento afectado (%s)", f.Serie, afectado.Serie)
+	}
+	if afectado.Moneda != "" && afectado.Moneda != f.Moneda {
+		return fmt.Errorf("la moneda de la nota (%s) debe ser la del documento afectado %s-%s (%s)",
+			f.Moneda, afectado.Serie, afectado.Numero, afectado.Moneda)
+	}
+	return nil
+}
+
+// validarMotivoNota exige el tipo de nota (catálogo 09 para crédito, 10 para débito) y su
+// sustento, que SUNAT recibe en cac:DiscrepancyResponse
+func validarMotivoNota(f models.ComprobanteBase) error {
+	var motivos map[string]string
+	switch f.TipoDocumento {
+	case "07":
+		motivos = catalogos.MotivosNotaCreditoCatalogo09
+	case "08":
+		motivos = catalogos.MotivosNotaDebitoCatalogo10
+	default:
+		return nil
+	}
+
+	if f.CodigoMotivo == "" || f.DescripcionMotivo == "" {
+		return errors.New("las notas de crédito/débito deben indicar codigoMotivo y descripcionMotivo")
+	}
+	if _, ok := motivos[f.CodigoMotivo]; !ok {
+		catalogo := "09"
+		if f.TipoDocumento == "08" {
+			catalogo = "10"
+		}
+		return fmt.Errorf("el codigoMotivo '%s' no es válido para el tipo de nota %s (catálogo %s)", f.CodigoMotivo, f.TipoDocumento, catalogo)
+	}
+	if utf8.RuneCountInString(f.DescripcionMotivo) > 500 {
+		return errors.New("la descripcionMotivo no puede exceder 500 caracteres")
+	}
+	return nil
+}
+
 func validarItem(item models.ItemComprobante, indice int) error {
 	if item.Descripcion == "" {
 		return fmt.Errorf("el ítem %d debe tener descripción", indice+1)
 	}
+	if omitidos := item.CamposOmitidos(); len(omitidos) > 0 {
+		return fmt.Errorf("el ítem %d no envía los campos %s (envíe 0 explícitamente si corresponde)",
+			indice+1, strings.Join(omitidos, ", "))
+	}
 	if item.Cantidad <= 0 {
 		return fmt.Errorf("el ítem %d debe tener cantidad mayor a 0", indice+1)
 	}
 	if item.ValorUnitario < 0 {
 		return fmt.Errorf("el ítem %d no puede tener valor unitario negativo", indice+1)
 	}
+	if item.IGV < 0 {
+		return fmt.Errorf("el ítem %d no puede tener IGV negativo (%.2f)", indice+1, item.IGV)
+	}
 
 	tiposAfectacion := map[string]bool{
 		"10": true, "11": true, "12": true, "13": true, "14": true, "15": true,
@@ -226,54 +397,866 @@ func validarItem(item models.ItemComprobante, indice int) error {
 		return fmt.Errorf("el ítem %d tiene tipo de afectación IGV inválido: %s", indice+1, item.TipoAfectacionIGV)
 	}
 
-	if item.TipoAfectacionIGV != "21" {
-		expected := item.ValorUnitario * item.Cantidad
-		if abs(item.ValorTotal-expected) > 0.01 {
-			return fmt.Errorf("el ítem %d: valor total inconsistente (esperado: %.2f, actual: %.2f)",
-				indice+1, expected, item.ValorTotal)
+	if err := validarCodigoProductoSUNAT(item, indice); err != nil {
+		return err
+	}
+
+	for j, propiedad := range item.PropiedadesAdicionales {
+		if propiedad.Nombre == "" || propiedad.Valor == "" {
+			return fmt.Errorf("el ítem %d: la propiedad adicional %d debe tener nombre y valor", indice+1, j+1)
 		}
 	}
 
+	if item.TipoAfectacionIGV == "21" {
+		if err := validarItemGratuito(item, indice); err != nil {
+			return err
+		}
+	}
+
+	if err := validarDescuentosItem(item, indice); err != nil {
+		return err
+	}
+
+	if err := validarISCItem(item, indice); err != nil {
+		return err
+	}
+
+	// El impuesto de cada línea gravada debe corresponder a la tasa de su afectación:
+	// 18% de IGV para 10-16 y 4% de IVAP para 17. El ISC se calcula primero y forma
+	// parte de la base del IGV.
+	if tasa := catalogos.TasaAfectacion(item.TipoAfectacionIGV); tasa > 0 {
+		base := item.BaseIGV()
+		esperado := redondear(base * tasa / 100)
+		if abs(item.IGV-esperado) > 0.01 {
+			if item.MontoISC > 0 && abs(item.IGV-redondear(item.ValorTotal*tasa/100)) <= 0.01 {
+				return fmt.Errorf("el ítem %d: el %s (%.2f) se calculó sin incluir el ISC en la base (esperado: %.2f = (%.2f + ISC %.2f) × %.0f%%)",
+					indice+1, nombreEsquemaTributario(item.TipoAfectacionIGV), item.IGV, esperado, item.ValorTotal, item.MontoISC, tasa)
+			}
+			return fmt.Errorf("el ítem %d: %s inconsistente para la afectación %s (esperado: %.2f = %.2f × %.0f%%, actual: %.2f)",
+				indice+1, nombreEsquemaTributario(item.TipoAfectacionIGV), item.TipoAfectacionIGV, esperado, base, tasa, item.IGV)
+		}
+	}
+
+	// En gratuitos el valor total es el valor referencial (cantidad x valor unitario referencial).
+	// Los descuentos del ítem que afectan la base (00) se restan: el valor total es el neto.
+	descuentos := sumarDescuentosBase(item.Descuentos)
+	expected := item.ValorUnitario*item.Cantidad - descuentos
+	if abs(item.ValorTotal-expected) > 0.01 {
+		if descuentos > 0 {
+			return fmt.Errorf("el ítem %d: valor total inconsistente con sus descuentos (esperado: %.2f = %.2f × %.2f - descuentos %.2f, actual: %.2f)",
+				indice+1, expected, item.Cantidad, item.ValorUnitario, descuentos, item.ValorTotal)
+		}
+		return fmt.Errorf("el ítem %d: valor total inconsistente (esperado: %.2f, actual: %.2f)",
+			indice+1, expected, item.ValorTotal)
+	}
+
+	return nil
+}
+
+// codigoProductoRegex valida el código de producto SUNAT (catálogo 25): 8 dígitos UNSPSC
+// a nivel de clase o commodity (segmento, familia, clase y commodity de 2 dígitos cada uno)
+var codigoProductoRegex = regexp.MustCompile(`^[1-9][0-9]{7}$`)
+
+// validarCodigoProductoSUNAT verifica el formato del código de producto SUNAT del ítem y
+// que no contradiga el UNSPSC enviado, ya que ambos van en cac:CommodityClassification
+func validarCodigoProductoSUNAT(item models.ItemComprobante, indice int) error {
+	if item.CodigoProductoSUNAT == "" {
+		return nil
+	}
+	if !codigoProductoRegex.MatchString(item.CodigoProductoSUNAT) {
+		return fmt.Errorf("el ítem %d tiene un código de producto SUNAT inválido '%s' (catálogo 25: 8 dígitos, ej: 51101500)",
+			indice+1, item.CodigoProductoSUNAT)
+	}
+	if item.UNSPSC != "" && item.UNSPSC != item.CodigoProductoSUNAT {
+		return fmt.Errorf("el ítem %d envía códigos de producto distintos: codigoProductoSUNAT '%s' y unspsc '%s' (envíe solo uno)",
+			indice+1, item.CodigoProductoSUNAT, item.UNSPSC)
+	}
+	return nil
+}
+
+// validarTotalGratuito verifica el total de operaciones gratuitas declarado por el cliente
+// contra la suma de los valores referenciales de los ítems 21 (lo que se informa a SUNAT
+// en el subtotal 9996)
+func validarTotalGratuito(f models.ComprobanteBase) error {
+	if f.TotalGratuito == 0 {
+		return nil
+	}
+	esperado := f.TotalOperacionesGratuitas()
+	if esperado == 0 {
+		return fmt.Errorf("se declaró totalGratuito %.2f pero el comprobante no tiene ítems gratuitos (21)", f.TotalGratuito)
+	}
+	if abs(f.TotalGratuito-esperado) > 0.01 {
+		return fmt.Errorf("total de operaciones gratuitas inconsistente: declarado %.2f, suma de valores referenciales %.2f",
+			f.TotalGratuito, esperado)
+	}
 	return nil
 }
 
+/*
+validarDescuentosItem verifica los descuentos del ítem (cac:AllowanceCharge de la línea):
+- Códigos del catálogo 53 para ítems: 00 (afecta la base) y 01 (no afecta la base)
+- Monto y factor válidos; sin montoBase, el factor se aplica sobre el valor bruto de la línea
+- Los ítems gratuitos (21) no admiten descuentos
+- Los descuentos 00 no pueden superar el valor bruto, o el valor de venta quedaría negativo
+*/
+func validarDescuentosItem(item models.ItemComprobante, indice int) error {
+	if len(item.Descuentos) == 0 {
+		return nil
+	}
+	if item.TipoAfectacionIGV == "21" {
+		return fmt.Errorf("el ítem %d es una transferencia gratuita (21) y no admite descuentos", indice+1)
+	}
+	if err := validarCargosDescuentos(item.Descuentos, catalogos.DescuentosLineaCatalogo53, "descuento"); err != nil {
+		return fmt.Errorf("el ítem %d: %v", indice+1, err)
+	}
+
+	bruto := item.ValorBruto()
+	for j, descuento := range item.Descuentos {
+		if descuento.Factor > 0 && descuento.MontoBase == 0 {
+			esperado := redondear(descuento.Factor * bruto)
+			if abs(descuento.Monto-esperado) > 0.01 {
+				return fmt.Errorf("el ítem %d: el descuento %d tiene monto inconsistente con el factor sobre el valor bruto (esperado: %.2f = %.2f × %.4f, actual: %.2f)",
+					indice+1, j+1, esperado, bruto, descuento.Factor, descuento.Monto)
+			}
+		}
+	}
+	if descuentos := sumarDescuentosBase(item.Descuentos); descuentos > bruto+0.01 {
+		return fmt.Errorf("el ítem %d: los descuentos que afectan la base (%.2f) superan el valor bruto de la línea (%.2f)",
+			indice+1, descuentos, bruto)
+	}
+	return nil
+}
+
+// sumarDescuentosBase suma los descuentos que reducen la base imponible
+func sumarDescuentosBase(descuentos []models.CargoDescuento) float64 {
+	var total float64
+	for _, descuento := range descuentos {
+		if catalogos.DescuentoAfectaBase(descuento.Codigo) {
+			total += descuento.Monto
+		}
+	}
+	return redondear(total)
+}
+
+// validarISCItem verifica el ISC de la línea: debe informar el sistema de cálculo
+// (catálogo 08) y, en el sistema al valor (01), el monto debe ser el porcentaje del
+// valor de venta. En los otros sistemas la base no viaja en el comprobante.
+func validarISCItem(item models.ItemComprobante, indice int) error {
+	if item.MontoISC < 0 {
+		return fmt.Errorf("el ítem %d no puede tener ISC negativo (%.2f)", indice+1, item.MontoISC)
+	}
+	if item.MontoISC == 0 {
+		if item.TipoSistemaISC != "" || item.PorcentajeISC != 0 {
+			return fmt.Errorf("el ítem %d informa sistema o porcentaje de ISC pero no el monto (montoISC)", indice+1)
+		}
+		return nil
+	}
+	if _, ok := catalogos.SistemasISCCatalogo08[item.TipoSistemaISC]; !ok {
+		return fmt.Errorf("el ítem %d tiene sistema de cálculo del ISC inválido '%s' (catálogo 08: 01, 02 o 03)",
+			indice+1, item.TipoSistemaISC)
+	}
+	if item.PorcentajeISC < 0 {
+		return fmt.Errorf("el ítem %d no puede tener porcentaje de ISC negativo (%.2f)", indice+1, item.PorcentajeISC)
+	}
+	if item.TipoSistemaISC == catalogos.SistemaISCAlValor {
+		esperado := redondear(item.ValorTotal * item.PorcentajeISC / 100)
+		if abs(item.MontoISC-esperado) > 0.01 {
+			return fmt.Errorf("el ítem %d: ISC inconsistente (esperado: %.2f = %.2f × %.2f%%, actual: %.2f)",
+				indice+1, esperado, item.ValorTotal, item.PorcentajeISC, item.MontoISC)
+		}
+	}
+	return nil
+}
+
+// validarTotalISC verifica el totalISC declarado (opcional) contra la suma de los ítems
+func validarTotalISC(f models.ComprobanteBase) error {
+	if f.TotalISC == 0 {
+		return nil
+	}
+	if suma := f.SumaISC(); abs(f.TotalISC-suma) > 0.01 {
+		return fmt.Errorf("total ISC inconsistente: declarado %.2f, suma de los ítems %.2f", f.TotalISC, suma)
+	}
+	return nil
+}
+
+// validarICBPER verifica el impuesto a las bolsas plásticas: en cada ítem con bolsas el
+// monto debe ser la cantidad de bolsas por el factor vigente a la fecha de emisión, y el
+// totalICBPER declarado (opcional) debe coincidir con la suma de los ítems
+func validarICBPER(f models.ComprobanteBase) error {
+	vigente := catalogos.FactorICBPER(f.FechaEmision)
+	for i, item := range f.Items {
+		if item.CantidadBolsas == 0 {
+			if item.ICBPER != 0 || item.FactorICBPER != 0 {
+				return fmt.Errorf("el ítem %d informa ICBPER pero no la cantidad de bolsas (cantidadBolsas)", i+1)
+			}
+			continue
+		}
+		if item.CantidadBolsas < 0 || item.CantidadBolsas != math.Trunc(item.CantidadBolsas) {
+			return fmt.Errorf("el ítem %d: la cantidad de bolsas debe ser un entero positivo (actual: %v)", i+1, item.CantidadBolsas)
+		}
+		if vigente == 0 {
+			return fmt.Errorf("el ítem %d informa ICBPER pero el impuesto no estaba vigente el %s", i+1, f.FechaEmision)
+		}
+		if item.FactorICBPER != 0 && abs(item.FactorICBPER-vigente) > 0.001 {
+			return fmt.Errorf("el ítem %d: factor ICBPER %.2f distinto al vigente el %s (%.2f por bolsa)",
+				i+1, item.FactorICBPER, f.FechaEmision, vigente)
+		}
+		esperado := redondear(item.CantidadBolsas * vigente)
+		if abs(item.ICBPER-esperado) > 0.01 {
+			return fmt.Errorf("el ítem %d: ICBPER inconsistente (esperado: %.2f = %.0f bolsas × %.2f, actual: %.2f)",
+				i+1, esperado, item.CantidadBolsas, vigente, item.ICBPER)
+		}
+	}
+
+	if f.TotalICBPER != 0 {
+		if suma := f.SumaICBPER(); abs(f.TotalICBPER-suma) > 0.01 {
+			return fmt.Errorf("total ICBPER inconsistente: declarado %.2f, suma de los ítems %.2f", f.TotalICBPER, suma)
+		}
+	}
+	return nil
+}
+
+// validarItemGratuito verifica un ítem de transferencia gratuita (afectación 21):
+// no se cobra (precio de venta 0), debe informar el valor referencial en ValorUnitario
+// y, al ser exonerado, el IGV calculado sobre el valor referencial es cero
+func validarItemGratuito(item models.ItemComprobante, indice int) error {
+	if item.PrecioVentaUnitario != 0 {
+		return fmt.Errorf("el ítem %d es gratuito (21): el precio de venta unitario debe ser 0 (actual: %.2f)",
+			indice+1, item.PrecioVentaUnitario)
+	}
+	if item.ValorUnitario <= 0 {
+		return fmt.Errorf("el ítem %d es gratuito (21): debe informar el valor referencial en valorUnitario", indice+1)
+	}
+	if item.CodigoTipoPrecio != "" && item.CodigoTipoPrecio != "02" {
+		return fmt.Errorf("el ítem %d es gratuito (21): el código de tipo de precio debe ser 02 (valor referencial)", indice+1)
+	}
+	if item.IGV != 0 {
+		return fmt.Errorf("el ítem %d es gratuito (21): el IGV debe ser 0 por ser operación exonerada (actual: %.2f)",
+			indice+1, item.IGV)
+	}
+	return nil
+}
+
+// validarIDsItems verifica el ID que el cliente asigna a cada ítem: es opcional, pero si
+// viene debe ser único y caber en cac:SellersItemIdentification (30 caracteres), donde se
+// informa cuando el ítem no tiene código de producto. El número de línea UBL no depende
+// de este ID: siempre es la posición del ítem (1, 2, 3...).
+func validarIDsItems(items []models.ItemComprobante) error {
+	vistos := map[string]int{}
+
+	for i, item := range items {
+		if item.ID == "" {
+			continue
+		}
+		if utf8.RuneCountInString(item.ID) > 30 {
+			return fmt.Errorf("el ítem %d tiene un ID de más de 30 caracteres '%s'", i+1, item.ID)
+		}
+
+		if previo, existe := vistos[item.ID]; existe {
+			return fmt.Errorf("el ítem %d repite el ID '%s' del ítem %d", i+1, item.ID, previo)
+		}
+		vistos[item.ID] = i + 1
+	}
+
+	return nil
+}
+
+// ZonaHorariaPeru hora oficial de Perú (UTC-5, sin horario de verano)
+var ZonaHorariaPeru = time.FixedZone("America/Lima", -5*60*60)
+
+// fechaHoyPeru retorna la fecha actual en Perú a medianoche, para comparar con fechas YYYY-MM-DD
+func fechaHoyPeru(ahora time.Time) time.Time {
+	hoy := ahora.In(ZonaHorariaPeru)
+	return time.Date(hoy.Year(), hoy.Month(), hoy.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// PlazoEnvioDias retorna los días calendario que SUNAT permite entre la fecha de emisión
+// y el envío: 3 días para facturas y sus notas, 7 días para boletas y sus notas
+// (que se informan vía resumen diario)
+func PlazoEnvioDias(tipoDoc, serie string) int {
+	switch tipoDoc {
+	case "03":
+		return 7
+	case "07", "08":
+		if strings.HasPrefix(strings.ToUpper(serie), "B") {
+			return 7
+		}
+	}
+	return 3
+}
+
+// VerificarPlazoEnvio indica si la fecha de emisión excede el plazo de envío permitido.
+// Retorna un mensaje con los días transcurridos y el plazo límite, o "" si está en plazo.
+func VerificarPlazoEnvio(f models.ComprobanteBase, ahora time.Time) string {
+	emision, err := time.Parse("2006-01-02", f.FechaEmision)
+	if err != nil {
+		return ""
+	}
+
+	plazo := PlazoEnvioDias(f.TipoDocumento, f.Serie)
+	dias := int(fechaHoyPeru(ahora).Sub(emision).Hours() / 24)
+	if dias <= plazo {
+		return ""
+	}
+
+	limite := emision.AddDate(0, 0, plazo)
+	return fmt.Sprintf("la fecha de emisión %s tiene %d días de antigüedad y excede el plazo de envío de %d días (límite: %s); SUNAT podría rechazar el comprobante o aplicar sanciones",
+		f.FechaEmision, dias, plazo, limite.Format("2006-01-02"))
+}
+
+// VerificarClienteEmisor detecta que el cliente tenga el mismo número de documento que
+// el RUC del emisor, un error de copia frecuente. Retorna "" si no coinciden o si el
+// comprobante declara autoconsumo.
+func VerificarClienteEmisor(f models.ComprobanteBase) string {
+	if f.Autoconsumo || f.Cliente.NumeroDoc == "" || f.Cliente.NumeroDoc != f.Emisor.RUC {
+		return ""
+	}
+	return fmt.Sprintf("el documento del cliente (%s) es igual al RUC del emisor; si es un autoconsumo indique \"autoconsumo\": true", f.Cliente.NumeroDoc)
+}
+
+// VerificarProporcionIGV detecta un IGV desproporcionado respecto al total gravado
+// (ej: 180% por multiplicar en lugar de calcular el 18%). Retorna "" si la proporción
+// no supera maxProporcion; no es un rechazo por sí mismo porque puede haber ISC u otros tributos.
+func VerificarProporcionIGV(f models.ComprobanteBase, maxProporcion float64) string {
+	if maxProporcion <= 0 || f.TotalIGV <= 0 {
+		return ""
+	}
+	if f.TotalGravado <= 0 {
+		return fmt.Sprintf("se declara IGV %.2f sin total gravado; verifique el tipo de afectación de los ítems", f.TotalIGV)
+	}
+	proporcion := f.TotalIGV / f.TotalGravado
+	if proporcion <= maxProporcion {
+		return ""
+	}
+	return fmt.Sprintf("el IGV (%.2f) equivale al %.2f%% del total gravado (%.2f), por encima del %.0f%% esperado (tasa 18%%); probablemente hay un error de cálculo",
+		f.TotalIGV, proporcion*100, f.TotalGravado, maxProporcion*100)
+}
+
+// VerificarDecimalesCantidad detecta ítems con cantidad fraccionaria en unidades que solo
+// admiten enteros (ej: 2.5 NIU). Retorna "" si todas las cantidades son coherentes.
+func VerificarDecimalesCantidad(items []models.ItemComprobante) string {
+	var avisos []string
+	for i, item := range items {
+		unidad := strings.ToUpper(item.UnidadMedida)
+		nombre, indivisible := catalogos.UnidadesIndivisibles[unidad]
+		if !indivisible || item.Cantidad == math.Trunc(item.Cantidad) {
+			continue
+		}
+		avisos = append(avisos, fmt.Sprintf("el ítem %d tiene cantidad %g en %s (%s), unidad que no admite decimales",
+			i+1, item.Cantidad, unidad, nombre))
+	}
+	return strings.Join(avisos, "; ")
+}
+
+// AdvertirUnidadPorDefecto arma la advertencia para los ítems (posiciones desde 1) a los
+// que se asignó la unidad de medida por defecto porque no la informaban. Retorna "" si no hay.
+func AdvertirUnidadPorDefecto(items []int, unidad string) string {
+	if len(items) == 0 {
+		return ""
+	}
+	posiciones := make([]string, len(items))
+	for i, item := range items {
+		posiciones[i] = strconv.Itoa(item)
+	}
+	if len(items) == 1 {
+		return fmt.Sprintf("el ítem %s no informa unidad de medida, se usó %s por defecto", posiciones[0], unidad)
+	}
+	return fmt.Sprintf("los ítems %s no informan unidad de medida, se usó %s por defecto", strings.Join(posiciones, ", "), unidad)
+}
+
+// AdvertirItemsDuplicados detecta ítems con el mismo código de producto y descripción.
+// No es un error (pueden ser dos ventas del mismo producto), solo retorna advertencias.
+func AdvertirItemsDuplicados(items []models.ItemComprobante) []string {
+	var advertencias []string
+	vistos := map[string]int{}
+
+	for i, item := range items {
+		if item.CodigoProducto == "" {
+			continue
+		}
+		clave := item.CodigoProducto + "|" + item.Descripcion
+		if previo, existe := vistos[clave]; existe {
+			advertencias = append(advertencias, fmt.Sprintf(
+				"el ítem %d repite código de producto '%s' y descripción del ítem %d", i+1, item.CodigoProducto, previo))
+			continue
+		}
+		vistos[clave] = i + 1
+	}
+
+	return advertencias
+}
+
 func validarTotales(f models.ComprobanteBase) error {
 	var sumaGravado, sumaExonerado, sumaInafecto, sumaIGV float64
 
+	// SUNAT redondea cada línea a 2 decimales y luego suma; se replica esa lógica
+	lineas := 0
 	for _, item := range f.Items {
 		switch item.TipoAfectacionIGV {
 		case "21":
 			continue
 		case "10", "11", "12", "13", "14", "15", "16", "17":
-			sumaGravado += item.ValorTotal
+			sumaGravado += redondear(item.ValorTotal)
 		case "20", "40":
-			sumaExonerado += item.ValorTotal
+			sumaExonerado += redondear(item.ValorTotal)
 		case "30", "31", "32", "33", "34", "35", "36", "37":
-			sumaInafecto += item.ValorTotal
+			sumaInafecto += redondear(item.ValorTotal)
+		}
+		sumaIGV += redondear(item.IGV)
+		lineas++
+	}
+
+	// Los descuentos globales 02 reducen la base gravada y el IGV en la misma proporción;
+	// los descuentos 03 se aplican después del IGV sobre el importe a pagar
+	var descuentosBase, descuentosNoBase float64
+	for _, descuento := range f.Descuentos {
+		if catalogos.DescuentoAfectaBase(descuento.Codigo) {
+			descuentosBase += descuento.Monto
+		} else {
+			descuentosNoBase += descuento.Monto
+		}
+	}
+	if descuentosBase > 0 {
+		gravadoNeto := sumaGravado - descuentosBase
+		if sumaGravado > 0 {
+			sumaIGV = sumaIGV * gravadoNeto / sumaGravado
+		}
+		sumaGravado = gravadoNeto
+	}
+
+	if err := diagnosticarDiferencia("total gravado", f.TotalGravado, sumaGravado, lineas); err != nil {
+		return err
+	}
+
+	if err := diagnosticarDiferencia("total IGV", f.TotalIGV, sumaIGV, lineas); err != nil {
+		// Caso frecuente: el integrador calculó el IGV sobre el total y no por línea
+		if igvSobreTotal := redondear(sumaGravado * 0.18); abs(f.TotalIGV-igvSobreTotal) <= 0.01 {
+			return fmt.Errorf("%v; el IGV declarado (%.2f) parece calculado sobre el total gravado, SUNAT lo exige como suma del IGV de cada línea",
+				err, f.TotalIGV)
+		}
+		return err
+	}
+
+	// El ISC y el ICBPER de las bolsas plásticas forman parte del precio de venta
+	sumaLineas := sumaGravado + sumaExonerado + sumaInafecto
+	otrosImpuestos := f.SumaISC() + f.SumaICBPER()
+	if err := validarTaxInclusiveAmount(f.TotalPrecioVenta, sumaLineas, sumaIGV, otrosImpuestos); err != nil {
+		return err
+	}
+
+	sumaCargos := 0.0
+	for _, cargo := range f.Cargos {
+		sumaCargos += cargo.Monto
+	}
+
+	// El redondeo (cbc:PayableRoundingAmount) ajusta el importe a pagar, hasta ±1.00
+	if abs(f.MontoRedondeo) > models.MaxMontoRedondeo {
+		return fmt.Errorf("monto de redondeo %.2f excede el máximo permitido de ±%.2f", f.MontoRedondeo, models.MaxMontoRedondeo)
+	}
+
+	esperado := f.TotalPrecioVenta - descuentosNoBase + sumaCargos + f.MontoRedondeo
+	if abs(f.TotalImportePagar-esperado) > 0.01 {
+		if f.MontoRedondeo != 0 {
+			return fmt.Errorf("total importe a pagar inconsistente: %.2f != precio venta %.2f - descuentos %.2f + cargos %.2f + redondeo %.2f",
+				f.TotalImportePagar, f.TotalPrecioVenta, descuentosNoBase, sumaCargos, f.MontoRedondeo)
+		}
+		return fmt.Errorf("total importe a pagar inconsistente: %.2f != precio venta %.2f - descuentos %.2f + cargos %.2f",
+			f.TotalImportePagar, f.TotalPrecioVenta, descuentosNoBase, sumaCargos)
+	}
+
+	return nil
+}
+
+/*
+validarSubtotalesTributarios verifica que en cada TaxSubtotal del XML el impuesto
+corresponda a la base por la tasa (TaxAmount ≈ TaxableAmount × Percent / 100).
+
+Los subtotales se arman igual que en el conversor: por tipo de afectación y con los
+descuentos globales 02 prorrateados en las bases gravadas. Como el impuesto es la suma
+del IGV de cada línea redondeado, se tolera 0.01 por línea del subtotal.
+*/
+func validarSubtotalesTributarios(f models.ComprobanteBase) error {
+	type subtotal struct {
+		base, impuesto float64
+		lineas         int
+	}
+	subtotales := map[string]*subtotal{}
+	var baseGravada float64
+	for _, item := range f.Items {
+		// Los gratuitos (21) ya se validan por ítem
+		if item.TipoAfectacionIGV == "21" {
+			continue
+		}
+		s, ok := subtotales[item.TipoAfectacionIGV]
+		if !ok {
+			s = &subtotal{}
+			subtotales[item.TipoAfectacionIGV] = s
+		}
+		s.base += item.BaseIGV()
+		s.impuesto += item.IGV
+		s.lineas++
+		if catalogos.TasaAfectacion(item.TipoAfectacionIGV) > 0 {
+			baseGravada += item.BaseIGV()
+		}
+	}
+
+	descuentosBase := 0.0
+	for _, descuento := range f.Descuentos {
+		if catalogos.DescuentoAfectaBase(descuento.Codigo) {
+			descuentosBase += descuento.Monto
+		}
+	}
+
+	tipos := make([]string, 0, len(subtotales))
+	for tipo := range subtotales {
+		tipos = append(tipos, tipo)
+	}
+	sort.Strings(tipos)
+
+	for _, tipo := range tipos {
+		s := subtotales[tipo]
+		base, impuesto := s.base, s.impuesto
+		// 18% para IGV (10-16), 4% para IVAP (17); los descuentos 02 se prorratean en ambas
+		tasa := catalogos.TasaAfectacion(tipo)
+		if tasa > 0 {
+			if descuentosBase > 0 && baseGravada > 0 {
+				factor := (baseGravada - descuentosBase) / baseGravada
+				base, impuesto = redondear(base*factor), redondear(impuesto*factor)
+			}
+		}
+
+		esperado := redondear(base * tasa / 100)
+		if diferencia := abs(impuesto - esperado); diferencia > 0.01*float64(s.lineas) {
+			return fmt.Errorf("subtotal tributario %s (afectación %s) inconsistente: impuesto %.2f, esperado %.2f (base %.2f × %.0f%%, diferencia: %.2f)",
+				nombreEsquemaTributario(tipo), tipo, impuesto, esperado, base, tasa, diferencia)
+		}
+	}
+	return nil
+}
+
+// esAfectacionGravada indica si la afectación tributa IGV a la tasa general (18%)
+func esAfectacionGravada(tipo string) bool {
+	switch tipo {
+	case "10", "11", "12", "13", "14", "15", "16":
+		return true
+	}
+	return false
+}
+
+// nombreEsquemaTributario retorna el nombre del tributo con que el XML declara la afectación
+func nombreEsquemaTributario(tipo string) string {
+	switch {
+	case esAfectacionGravada(tipo):
+		return "IGV"
+	case tipo == catalogos.AfectacionIVAP:
+		return "IVAP"
+	case tipo == "20":
+		return "EXO"
+	case tipo == "40":
+		return "EXP"
+	default:
+		return "INA"
+	}
+}
+
+// validarCuotas verifica las cuotas cuando la forma de pago es "Credito":
+// número secuencial y único, importe positivo, vencimiento posterior a la emisión
+// y que la suma de importes iguale el total a pagar
+func validarCuotas(f models.ComprobanteBase) error {
+	if !strings.EqualFold(f.FormaPago, "Credito") {
+		return nil
+	}
+	if len(f.Cuotas) == 0 {
+		return errors.New("las ventas al crédito deben tener al menos una cuota")
+	}
+
+	emision, err := time.Parse("2006-01-02", f.FechaEmision)
+	if err != nil {
+		return errors.New("la fecha de emisión tiene formato inválido (YYYY-MM-DD)")
+	}
+
+	numeroRegex := regexp.MustCompile(`([0-9]+)$`)
+	vistos := map[string]bool{}
+	var sumaCuotas float64
+
+	for i, cuota := range f.Cuotas {
+		if strings.TrimSpace(cuota.NumeroCuota) == "" {
+			return fmt.Errorf("la cuota %d debe tener número (ej: Cuota001)", i+1)
+		}
+		if vistos[cuota.NumeroCuota] {
+			return fmt.Errorf("la cuota %d repite el número '%s'", i+1, cuota.NumeroCuota)
+		}
+		vistos[cuota.NumeroCuota] = true
+
+		match := numeroRegex.FindStringSubmatch(cuota.NumeroCuota)
+		if match == nil {
+			return fmt.Errorf("la cuota %d tiene número '%s' sin correlativo numérico", i+1, cuota.NumeroCuota)
+		}
+		if n, _ := strconv.Atoi(match[1]); n != i+1 {
+			return fmt.Errorf("la cuota %d tiene número '%s' fuera de secuencia (esperado: %d)", i+1, cuota.NumeroCuota, i+1)
+		}
+
+		if cuota.Importe <= 0 {
+			return fmt.Errorf("la cuota %d (%s) debe tener importe mayor a 0", i+1, cuota.NumeroCuota)
+		}
+
+		venc, err := time.Parse("2006-01-02", cuota.FechaVencimiento)
+		if err != nil {
+			return fmt.Errorf("la cuota %d (%s) tiene fecha de vencimiento inválida '%s' (YYYY-MM-DD)", i+1, cuota.NumeroCuota, cuota.FechaVencimiento)
+		}
+		if !venc.After(emision) {
+			return fmt.Errorf("la cuota %d (%s) debe vencer después de la fecha de emisión", i+1, cuota.NumeroCuota)
 		}
-		sumaIGV += item.IGV
+
+		sumaCuotas += cuota.Importe
 	}
 
-	if abs(f.TotalGravado-sumaGravado) > 0.01 {
-		return fmt.Errorf("total gravado inconsistente (esperado: %.2f, actual: %.2f)", sumaGravado, f.TotalGravado)
+	// Con retención del IGV las cuotas suman el monto neto pendiente de pago
+	neto := f.MontoNetoPendiente()
+	if diferencia := neto - sumaCuotas; abs(diferencia) > 0.01 {
+		return fmt.Errorf("la suma de cuotas (%.2f) no coincide con el total a pagar (%.2f), diferencia: %.2f",
+			sumaCuotas, neto, diferencia)
 	}
 
-	if abs(f.TotalIGV-sumaIGV) > 0.01 {
-		return fmt.Errorf("total IGV inconsistente (esperado: %.2f, actual: %.2f)", sumaIGV, f.TotalIGV)
+	return nil
+}
+
+// validarCargos verifica código de motivo, monto y factor de cada cargo del documento
+func validarCargos(cargos []models.CargoDescuento) error {
+	return validarCargosDescuentos(cargos, catalogos.CargosCatalogo53, "cargo")
+}
+
+// validarDescuentos verifica código de motivo, monto y factor de cada descuento global
+func validarDescuentos(descuentos []models.CargoDescuento) error {
+	return validarCargosDescuentos(descuentos, catalogos.DescuentosCatalogo53, "descuento")
+}
+
+/*
+validarDescuentosExcedentes rechaza los descuentos que dejarían bases, IGV o importes
+negativos, que SUNAT rechaza. Se evalúa el efecto acumulado de todos los descuentos:
+- Un descuento con montoBase no puede superarla
+- Los descuentos 02 (afectan la base) no pueden superar el total gravado, o la base y
+  el IGV prorrateados quedarían negativos
+- Los descuentos 03 (no afectan la base) no pueden superar el precio de venta más los
+  cargos, o el importe a pagar quedaría negativo
+
+El mensaje identifica el primer descuento con el que se excede el monto.
+*/
+func validarDescuentosExcedentes(f models.ComprobanteBase) error {
+	var totalGravado float64
+	for _, item := range f.Items {
+		switch item.TipoAfectacionIGV {
+		case "10", "11", "12", "13", "14", "15", "16", "17":
+			totalGravado += redondear(item.ValorTotal)
+		}
 	}
 
-	totalEsperado := sumaGravado + sumaExonerado + sumaInafecto + sumaIGV
-	if abs(f.TotalPrecioVenta-totalEsperado) > 0.01 {
-		return fmt.Errorf("total precio venta inconsistente (esperado: %.2f, actual: %.2f)", totalEsperado, f.TotalPrecioVenta)
+	totalAPagar := f.TotalPrecioVenta
+	for _, cargo := range f.Cargos {
+		totalAPagar += cargo.Monto
 	}
 
-	if abs(f.TotalImportePagar-f.TotalPrecioVenta) > 0.01 {
-		return errors.New("total importe a pagar debe ser igual al total precio venta")
+	var descuentosBase, descuentosNoBase float64
+	for i, descuento := range f.Descuentos {
+		if descuento.MontoBase > 0 && descuento.Monto > descuento.MontoBase+0.01 {
+			return fmt.Errorf("el descuento %d (código %s) de %.2f supera su monto base %.2f",
+				i+1, descuento.Codigo, descuento.Monto, descuento.MontoBase)
+		}
+
+		if catalogos.DescuentoAfectaBase(descuento.Codigo) {
+			descuentosBase += descuento.Monto
+			if descuentosBase > totalGravado+0.01 {
+				return fmt.Errorf("el descuento %d (código %s, %.2f) deja la base gravada negativa: los descuentos que afectan la base suman %.2f y el total gravado es %.2f",
+					i+1, descuento.Codigo, descuento.Monto, descuentosBase, totalGravado)
+			}
+			continue
+		}
+
+		descuentosNoBase += descuento.Monto
+		if descuentosNoBase > totalAPagar+0.01 {
+			return fmt.Errorf("el descuento %d (código %s, %.2f) deja el importe a pagar negativo: los descuentos que no afectan la base suman %.2f y el precio de venta más cargos es %.2f",
+				i+1, descuento.Codigo, descuento.Monto, descuentosNoBase, totalAPagar)
+		}
 	}
+	return nil
+}
 
+// validarPercepcion verifica el régimen de percepción (catálogo 22) y, si el cliente
+// informa el monto, que coincida con la tasa aplicada al precio de venta incluido IGV
+func validarPercepcion(f models.ComprobanteBase) error {
+	if f.TipoPercepcion == "" {
+		if f.MontoPercepcion != 0 {
+			return errors.New("se informa monto de percepción sin tipo de percepción")
+		}
+		return nil
+	}
+	if f.TipoDocumento != "01" {
+		return errors.New("la percepción solo puede informarse en facturas")
+	}
+
+	esperado, ok := catalogos.MontoPercepcion(f.TipoPercepcion, f.TotalPrecioVenta)
+	if !ok {
+		return fmt.Errorf("tipo de percepción inválido: %s (catálogo 22: 01, 02, 03)", f.TipoPercepcion)
+	}
+	if f.MontoPercepcion != 0 && abs(f.MontoPercepcion-esperado) > 0.01 {
+		return fmt.Errorf("monto de percepción inconsistente: declarado %.2f, esperado %.2f (%.2f%% de %.2f, precio de venta con IGV)",
+			f.MontoPercepcion, esperado, catalogos.PorcentajesPercepcionCatalogo22[f.TipoPercepcion], f.TotalPrecioVenta)
+	}
 	return nil
 }
 
+// validarRetencion verifica la retención del IGV: solo en facturas a un cliente con RUC,
+// sin percepción, y con el monto igual a la tasa aplicada sobre el importe total
+func validarRetencion(f models.ComprobanteBase) error {
+	r := f.Retencion
+	if r == nil {
+		return nil
+	}
+	if f.TipoDocumento != "01" || f.Cliente.TipoDoc != "6" {
+		return errors.New("la retención del IGV solo aplica a facturas emitidas a un cliente con RUC (agente de retención)")
+	}
+	if f.TipoPercepcion != "" {
+		return errors.New("un comprobante no puede tener retención y percepción a la vez")
+	}
+
+	factor := r.Factor
+	if factor == 0 {
+		factor = catalogos.TasaRetencionIGV
+	}
+	if factor < 0 || factor >= 1 {
+		return fmt.Errorf("la tasa de retención %.4f es inválida (en decimal, ej: 0.03 = 3%%)", factor)
+	}
+
+	base := r.MontoBase
+	if base == 0 {
+		base = f.TotalImportePagar
+	}
+	if base > f.TotalImportePagar+0.01 {
+		return fmt.Errorf("la base de la retención (%.2f) excede el total a pagar (%.2f)", base, f.TotalImportePagar)
+	}
+
+	esperado := redondear(base * factor)
+	if r.Monto <= 0 || abs(r.Monto-esperado) > 0.01 {
+		return fmt.Errorf("monto de retención inconsistente: declarado %.2f, esperado %.2f (%.2f%% de %.2f)",
+			r.Monto, esperado, factor*100, base)
+	}
+	return nil
+}
+
+// validarTipoOperacion verifica que el tipo de operación pertenezca al catálogo 51 y que
+// los tipos de afectación de los ítems sean coherentes con él: una exportación solo admite
+// ítems de exportación (40) y una operación interna no puede incluirlos. Un comprobante
+// que mezcla ambos se rechaza indicando que deben emitirse por separado.
+func validarTipoOperacion(f models.ComprobanteBase) error {
+	tipoOperacion := catalogos.NormalizarTipoOperacion(f.TipoOperacion)
+	if _, ok := catalogos.TiposOperacionCatalogo51[tipoOperacion]; !ok {
+		return fmt.Errorf("el tipo de operación '%s' no pertenece al catálogo 51", f.TipoOperacion)
+	}
+
+	exportado, interno := 0, 0
+	for i, item := range f.Items {
+		if item.TipoAfectacionIGV == "40" && exportado == 0 {
+			exportado = i + 1
+		}
+		if item.TipoAfectacionIGV != "40" && interno == 0 {
+			interno = i + 1
+		}
+	}
+	if exportado > 0 && interno > 0 {
+		return fmt.Errorf("el comprobante mezcla ítems de exportación (ítem %d, afectación 40) con ítems de operación interna (ítem %d, afectación %s); emita la exportación (tipo de operación 02xx) y la venta interna en comprobantes separados",
+			exportado, interno, f.Items[interno-1].TipoAfectacionIGV)
+	}
+
+	exportacion := catalogos.EsOperacionExportacion(tipoOperacion)
+	for i, item := range f.Items {
+		if exportacion && item.TipoAfectacionIGV != "40" {
+			return fmt.Errorf("el ítem %d tiene tipo de afectación %s, pero la operación %s (%s) solo admite ítems de exportación (40)",
+				i+1, item.TipoAfectacionIGV, tipoOperacion, catalogos.TiposOperacionCatalogo51[tipoOperacion])
+		}
+		if !exportacion && item.TipoAfectacionIGV == "40" {
+			return fmt.Errorf("el ítem %d es de exportación (40), pero la operación %s (%s) no es de exportación; use un tipo de operación 02xx",
+				i+1, tipoOperacion, catalogos.TiposOperacionCatalogo51[tipoOperacion])
+		}
+	}
+	return nil
+}
+
+// validarLeyendas verifica que los códigos pertenezcan al catálogo 52 y que no se repitan
+// con textos distintos. Las repeticiones idénticas se consolidan al generar el XML.
+func validarLeyendas(leyendas []models.Leyenda) error {
+	descripciones := map[string]string{}
+	for i, leyenda := range leyendas {
+		codigo := strings.TrimSpace(leyenda.Codigo)
+		if _, ok := catalogos.LeyendasCatalogo52[codigo]; !ok {
+			return fmt.Errorf("la leyenda %d tiene código '%s' que no pertenece al catálogo 52", i+1, leyenda.Codigo)
+		}
+		if strings.TrimSpace(leyenda.Descripcion) == "" {
+			return fmt.Errorf("la leyenda %d (código %s) no tiene descripción", i+1, codigo)
+		}
+		if previa, repetida := descripciones[codigo]; repetida && previa != leyenda.Descripcion {
+			return fmt.Errorf("la leyenda con código %s está duplicada con textos distintos ('%s' y '%s')", codigo, previa, leyenda.Descripcion)
+		}
+		descripciones[codigo] = leyenda.Descripcion
+	}
+	return nil
+}
+
+// validarCargosDescuentos aplica las reglas comunes a cargos y descuentos (cac:AllowanceCharge)
+func validarCargosDescuentos(lista []models.CargoDescuento, codigos map[string]string, etiqueta string) error {
+	for i, cd := range lista {
+		if _, ok := codigos[cd.Codigo]; !ok {
+			return fmt.Errorf("el %s %d tiene código de motivo inválido: '%s' (catálogo 53)", etiqueta, i+1, cd.Codigo)
+		}
+		if cd.Monto <= 0 {
+			return fmt.Errorf("el %s %d debe tener monto mayor a 0", etiqueta, i+1)
+		}
+		if cd.Factor < 0 || cd.Factor > 1 {
+			return fmt.Errorf("el %s %d tiene factor inválido %.4f (debe estar entre 0 y 1)", etiqueta, i+1, cd.Factor)
+		}
+		if cd.Factor > 0 && cd.MontoBase > 0 {
+			esperado := cd.Factor * cd.MontoBase
+			if abs(cd.Monto-esperado) > 0.01 {
+				return fmt.Errorf("el %s %d: monto inconsistente con factor y base (esperado: %.2f, actual: %.2f)",
+					etiqueta, i+1, esperado, cd.Monto)
+			}
+		}
+	}
+	return nil
+}
+
+// validarTaxInclusiveAmount verifica la regla de SUNAT
+// TaxInclusiveAmount = LineExtensionAmount + total de impuestos.
+// El mensaje detalla cada componente para facilitar la corrección.
+func validarTaxInclusiveAmount(totalPrecioVenta, sumaLineas, totalIGV, otrosImpuestos float64) error {
+	esperado := sumaLineas + totalIGV + otrosImpuestos
+	if abs(totalPrecioVenta-esperado) > 0.01 {
+		return fmt.Errorf("total precio venta inconsistente: %.2f != valor venta %.2f + IGV %.2f + otros impuestos %.2f = %.2f",
+			totalPrecioVenta, sumaLineas, totalIGV, otrosImpuestos, esperado)
+	}
+	return nil
+}
+
+// diagnosticarDiferencia compara un total declarado con la suma de líneas redondeadas
+// y distingue un error de redondeo por línea (diferencia de hasta 0.01 por línea)
+// de un error de cálculo grueso
+func diagnosticarDiferencia(concepto string, declarado, esperado float64, lineas int) error {
+	diferencia := abs(declarado - esperado)
+	if diferencia <= 0.01 {
+		return nil
+	}
+	if lineas > 1 && diferencia <= 0.01*float64(lineas) {
+		return fmt.Errorf("%s: error de redondeo por línea (esperado: %.2f como suma de líneas redondeadas a 2 decimales, actual: %.2f, diferencia: %.2f); redondee cada línea antes de sumar",
+			concepto, esperado, declarado, diferencia)
+	}
+	return fmt.Errorf("%s inconsistente: error de cálculo (esperado: %.2f, actual: %.2f, diferencia: %.2f)",
+		concepto, esperado, declarado, diferencia)
+}
+
+// redondear redondea a 2 decimales como lo hace SUNAT
+func redondear(x float64) float64 {
+	return models.RedondearCentimo(x)
+}
+
 func abs(x float64) float64 {
 	if x < 0 {
 		return -x
@@ -0,0 +1,70 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+
+	"ubl-go-conversor/catalogos"
+	"ubl-go-conversor/models"
+)
+
+// TestValidarPercepcion verifica la percepción con las tres tasas del catálogo 22, tanto
+// el monto calculado sobre el precio de venta con IGV como el declarado por el cliente
+func TestValidarPercepcion(t *testing.T) {
+	casos := []struct {
+		regimen  string
+		esperado float64
+	}{
+		{"01", 23.60}, // 2%
+		{"02", 11.80}, // 1%
+		{"03", 5.90},  // 0.5%
+	}
+
+	for _, c := range casos {
+		t.Run(c.regimen, func(t *testing.T) {
+			calculado, ok := catalogos.MontoPercepcion(c.regimen, 1180)
+			if !ok || calculado != c.esperado {
+				t.Fatalf("monto calculado: esperado %.2f, obtenido %.2f (ok=%v)", c.esperado, calculado, ok)
+			}
+
+			f := models.ComprobanteBase{TipoDocumento: "01", TotalPrecioVenta: 1180, TipoPercepcion: c.regimen}
+			if err := validarPercepcion(f); err != nil {
+				t.Errorf("sin monto declarado: error inesperado: %v", err)
+			}
+
+			f.MontoPercepcion = c.esperado
+			if err := validarPercepcion(f); err != nil {
+				t.Errorf("con monto declarado %.2f: error inesperado: %v", c.esperado, err)
+			}
+		})
+	}
+}
+
+func TestValidarPercepcionMontoInconsistente(t *testing.T) {
+	// 2% de 1180 es 23.60; se declara el 1%
+	f := models.ComprobanteBase{TipoDocumento: "01", TotalPrecioVenta: 1180, TipoPercepcion: "01", MontoPercepcion: 11.80}
+	err := validarPercepcion(f)
+	if err == nil {
+		t.Fatal("se esperaba error por monto de percepción inconsistente")
+	}
+	if !strings.Contains(err.Error(), "esperado 23.60") {
+		t.Errorf("el mensaje debe indicar el monto esperado: %v", err)
+	}
+}
+
+// TestValidarTipoOperacionMixta verifica que un comprobante con ítems de exportación e
+// internos se rechace con un único mensaje que indique emitirlos por separado, sea cual
+// sea el tipo de operación declarado
+func TestValidarTipoOperacionMixta(t *testing.T) {
+	items := []models.ItemComprobante{{TipoAfectacionIGV: "40"}, {TipoAfectacionIGV: "10"}}
+	for _, tipoOperacion := range []string{"0101", "0200"} {
+		err := validarTipoOperacion(models.ComprobanteBase{TipoOperacion: tipoOperacion, Items: items})
+		if err == nil || !strings.Contains(err.Error(), "comprobantes separados") {
+			t.Errorf("operación %s: se esperaba el error de operaciones mixtas, obtenido %v", tipoOperacion, err)
+		}
+	}
+
+	if err := validarTipoOperacion(models.ComprobanteBase{TipoOperacion: "0200", Items: items[:1]}); err != nil {
+		t.Errorf("exportación pura: error inesperado: %v", err)
+	}
+}
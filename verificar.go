@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"ubl-go-conversor/models"
+)
+
+/*
+manejarVerificacion responde GET /api/v1/verify?ruc=&tipo=&serie=&numero=&monto=&fecha=,
+el endpoint público con el que los receptores comprueban que un comprobante emitido
+por este servicio fue aceptado por SUNAT (similar a la consulta de validez de SUNAT).
+
+Se consulta el estado registrado en BD. El monto y la fecha son obligatorios y deben
+coincidir con el comprobante: sin ellos no se revelan los datos del documento, lo que
+evita enumerar comprobantes por serie y número.
+*/
+func manejarVerificacion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	ruc, tipo, serie, numero := q.Get("ruc"), q.Get("tipo"), q.Get("serie"), q.Get("numero")
+	if ruc == "" || tipo == "" || serie == "" || numero == "" || q.Get("monto") == "" || q.Get("fecha") == "" {
+		http.Error(w, "Los parámetros ruc, tipo, serie, numero, monto y fecha son obligatorios", http.StatusBadRequest)
+		return
+	}
+	monto, err := models.ParsearMonto(q.Get("monto"))
+	if err != nil {
+		http.Error(w, "Parámetro monto inválido: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	fecha, err := models.ParsearFecha(q.Get("fecha"))
+	if err != nil {
+		http.Error(w, "Parámetro fecha inválido: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(verificarComprobante(ruc, tipo, serie, numero, monto, fecha))
+}
+
+// verificarComprobante busca el comprobante y arma el resultado de la verificación
+func verificarComprobante(ruc, tipo, serie, numero string, monto float64, fecha string) models.VerificacionResponse {
+	documentID := models.GenerateDocumentID(ruc, tipo, serie, models.NormalizarNumero(numero))
+	noEncontrado := models.VerificacionResponse{
+		Estado:  "no_encontrado",
+		Mensaje: "No existe un comprobante emitido con los datos consultados",
+	}
+
+	doc, err := docRepo.GetByID(documentID)
+	if err != nil {
+		return noEncontrado
+	}
+	if math.Abs(doc.Total-monto) > 0.01 || fechaEmisionDocumento(doc) != fecha {
+		return noEncontrado
+	}
+
+	resultado := models.VerificacionResponse{
+		RUC:           doc.RUC,
+		TipoDocumento: doc.TipoDoc,
+		Serie:         doc.Serie,
+		Numero:        doc.Numero,
+		FechaEmision:  fecha,
+		Moneda:        doc.Moneda,
+		Total:         doc.Total,
+	}
+	switch doc.Estado {
+	case models.StatusApproved, models.StatusObserved, models.StatusActionRequired:
+		resultado.Valido = true
+		resultado.Estado = "aceptado"
+		resultado.Mensaje = fmt.Sprintf("El comprobante %s-%s fue aceptado por SUNAT", doc.Serie, doc.Numero)
+	case models.StatusRejected:
+		resultado.Estado = "rechazado"
+		resultado.Mensaje = fmt.Sprintf("El comprobante %s-%s fue rechazado por SUNAT y no tiene validez", doc.Serie, doc.Numero)
+	case models.StatusPending, models.StatusProcessing, models.StatusPendingSend, models.StatusTicketPending, models.StatusScheduled:
+		resultado.Estado = "pendiente"
+		resultado.Mensaje = fmt.Sprintf("El comprobante %s-%s aún no tiene respuesta de SUNAT", doc.Serie, doc.Numero)
+	default:
+		// Un borrador o un comprobante con error de proceso no fue emitido ante SUNAT
+		return noEncontrado
+	}
+	return resultado
+}
+
+// fechaEmisionDocumento retorna la fecha de emisión registrada. Los documentos anteriores
+// a la columna fecha_emision la toman del comprobante guardado en payload.
+func fechaEmisionDocumento(doc *models.Document) string {
+	if doc.FechaEmision != "" || doc.Payload == "" {
+		return doc.FechaEmision
+	}
+	var comprobante struct {
+		FechaEmision string `json:"fechaEmision"`
+	}
+	json.Unmarshal([]byte(doc.Payload), &comprobante)
+	return comprobante.FechaEmision
+}